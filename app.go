@@ -4,27 +4,46 @@ import (
 	log "github.com/Financial-Times/go-logger"
 	"github.com/Financial-Times/kafka-client-go/kafka"
 	queueConsumer "github.com/Financial-Times/notifications-push/consumer"
-	"github.com/Financial-Times/service-status-go/httphandlers"
-	"github.com/gorilla/mux"
 	"github.com/jawher/mow.cli"
 	"net"
 	"net/http"
-	_ "net/http/pprof"
 	"os"
-	"regexp"
 	"strconv"
 	"time"
 
+	"crypto/tls"
 	"fmt"
+	"github.com/Financial-Times/notifications-push/audit"
+	"github.com/Financial-Times/notifications-push/certs"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/cluster"
+	"github.com/Financial-Times/notifications-push/config"
 	"github.com/Financial-Times/notifications-push/dispatch"
 	"github.com/Financial-Times/notifications-push/resources"
+	"github.com/Financial-Times/notifications-push/rpc"
+	"github.com/Financial-Times/notifications-push/supervisor"
+	"github.com/Financial-Times/notifications-push/tracing"
+	"github.com/Shopify/sarama"
+	"github.com/gorilla/mux"
 	"github.com/wvanbergen/kazoo-go"
 	"github.com/samuel/go-zookeeper/zk"
 )
 
 const (
-	heartbeatPeriod = 30 * time.Second
-	serviceName     = "notifications-push"
+	heartbeatPeriod         = 30 * time.Second
+	configPollInterval      = 10 * time.Second
+	localPollInterval       = 1 * time.Second
+	consumerLagPollInterval = 30 * time.Second
+	restartBackoff          = 1 * time.Second
+	maxRestartBackoff       = 1 * time.Minute
+	supervisorHistorySize   = 100
+	tracingBatchSize        = 100
+	tracingFlushPeriod      = 5 * time.Second
+	auditHistorySize        = 10000
+	auditQueueSize          = 1000
+	readHeaderTimeout       = 10 * time.Second
+	idleTimeout             = 2 * time.Minute
+	serviceName             = "notifications-push"
 )
 
 func main() {
@@ -88,6 +107,227 @@ func main() {
 		Desc:   `The whitelist for incoming notifications - i.e. ^http://.*-transformer-(pr|iw)-uk-.*\.svc\.ft\.com(:\d{2,5})?/content/[\w-]+.*$`,
 		EnvVar: "WHITELIST",
 	})
+	skipRules := app.String(cli.StringOpt{
+		Name:   "skip_rules",
+		Value:  "",
+		Desc:   `JSON list of rules for transaction IDs that are not regular publishes - i.e. [{"name":"Synthetic transaction ID","pattern":"^SYNTH","action":"monitor"}]. Supported actions are drop, monitor (deliver to monitor subscribers only) and flag (deliver with the given "flag"). By default synthetic and carousel transactions are dropped.`,
+		EnvVar: "SKIP_RULES",
+	})
+	payloadFields := app.String(cli.StringOpt{
+		Name:   "payload_fields",
+		Value:  "",
+		Desc:   `JSON list of additional payload fields to be copied into notifications - i.e. [{"source":"publishedDate","type":"string"},{"source":"brands","target":"brands","type":"stringList"}]. Supported types are string, bool, number and stringList, fields without a type are copied as they are.`,
+		EnvVar: "PAYLOAD_FIELDS",
+	})
+	capturedHeaders := app.Strings(cli.StringsOpt{
+		Name:   "captured_headers",
+		Value:  []string{"Origin-System-Id", "Content-Type", "Message-Timestamp"},
+		Desc:   "Comma separated Kafka message headers to be captured into notifications. They are returned to monitor subscribers and on the /__history endpoint, and can be used in subscription filters.",
+		EnvVar: "CAPTURED_HEADERS",
+	})
+	configFile := app.String(cli.StringOpt{
+		Name:   "config_file",
+		Value:  "",
+		Desc:   "Path of the JSON (or YAML, with a .yaml or .yml extension) configuration file with the whitelist, supportedContentTypes, notificationsDelay, heartbeatPeriod (in seconds) and skipRules settings. It is reloaded on change or on SIGHUP, the missing settings are taken from the command line.",
+		EnvVar: "CONFIG_FILE",
+	})
+	eventSchema := app.String(cli.StringOpt{
+		Name:   "event_schema",
+		Value:  "",
+		Desc:   "Path of the JSON Schema file the incoming publication events of the resource are validated against. No validation is done if it is empty.",
+		EnvVar: "EVENT_SCHEMA",
+	})
+	eventValidationMode := app.String(cli.StringOpt{
+		Name:   "event_validation_mode",
+		Value:  "lenient",
+		Desc:   "What happens to publication events failing the schema validation: strict (they are skipped) or lenient (they are only reported)",
+		EnvVar: "EVENT_VALIDATION_MODE",
+	})
+	ingestEnabled := app.Bool(cli.BoolOpt{
+		Name:   "ingest_enabled",
+		Value:  false,
+		Desc:   "Enables the POST /__ingest endpoint, which handles the posted Kafka messages as if they were consumed from the queue. Used to replay recorded messages.",
+		EnvVar: "INGEST_ENABLED",
+	})
+	messageSource := app.String(cli.StringOpt{
+		Name:   "message_source",
+		Value:  "kafka",
+		Desc:   "Where messages are consumed from: kafka, or in standalone mode http (POST /__ingest), stdin or file (MESSAGE_FILE, followed like tail -f). Standalone mode has no external dependencies, API keys are not validated.",
+		EnvVar: "MESSAGE_SOURCE",
+	})
+	messageFile := app.String(cli.StringOpt{
+		Name:   "message_file",
+		Value:  "",
+		Desc:   "Path of the JSON lines file of Kafka messages consumed by the file message source",
+		EnvVar: "MESSAGE_FILE",
+	})
+	clusterMode := app.Bool(cli.BoolOpt{
+		Name:   "cluster_mode",
+		Value:  false,
+		Desc:   "Shares the notification history and the subscribers with the other replicas, so that /__history and /__stats return a cluster-wide view and subscribers can resume their stream on any replica",
+		EnvVar: "CLUSTER_MODE",
+	})
+	clusterNode := app.String(cli.StringOpt{
+		Name:   "cluster_node",
+		Value:  "",
+		Desc:   "The name of this replica in the cluster, the host name by default",
+		EnvVar: "CLUSTER_NODE",
+	})
+	clusterPeers := app.Strings(cli.StringsOpt{
+		Name:   "cluster_peers",
+		Value:  []string{},
+		Desc:   "Comma separated host:port addresses of the replicas. A host resolving to several addresses (i.e. a headless service) stands for all of them.",
+		EnvVar: "CLUSTER_PEERS",
+	})
+	clusterSyncInterval := app.Int(cli.IntOpt{
+		Name:   "cluster_sync_interval",
+		Value:  5,
+		Desc:   "How often the state of the replicas is shared (in seconds)",
+		EnvVar: "CLUSTER_SYNC_INTERVAL",
+	})
+	grpcPort := app.Int(cli.IntOpt{
+		Name:   "grpc_port",
+		Value:  0,
+		Desc:   "Port of the gRPC push service, it is disabled when 0",
+		EnvVar: "GRPC_PORT",
+	})
+	tlsCertFile := app.String(cli.StringOpt{
+		Name:   "tls_cert_file",
+		Value:  "",
+		Desc:   "PEM certificate file of the service, TLS is terminated by the service when it is set. It is reloaded on change or on SIGHUP.",
+		EnvVar: "TLS_CERT_FILE",
+	})
+	tlsKeyFile := app.String(cli.StringOpt{
+		Name:   "tls_key_file",
+		Value:  "",
+		Desc:   "PEM private key file of the TLS certificate. It is reloaded on change or on SIGHUP.",
+		EnvVar: "TLS_KEY_FILE",
+	})
+	tlsClientCAFile := app.String(cli.StringOpt{
+		Name:   "tls_client_ca_file",
+		Value:  "",
+		Desc:   "PEM file of the CAs signing the client certificates. Subscribers with a verified client certificate are identified by it instead of their API key.",
+		EnvVar: "TLS_CLIENT_CA_FILE",
+	})
+	tlsRequireClientCert := app.Bool(cli.BoolOpt{
+		Name:   "tls_require_client_cert",
+		Value:  false,
+		Desc:   "Whether all the clients must send a certificate signed by the CAs of tls_client_ca_file",
+		EnvVar: "TLS_REQUIRE_CLIENT_CERT",
+	})
+	adminPort := app.Int(cli.IntOpt{
+		Name:   "admin_port",
+		Value:  0,
+		Desc:   "Port of the admin endpoints (history, stats, config, metrics, health, ingest, cluster state and profiling), they are served on the application port when 0",
+		EnvVar: "ADMIN_PORT",
+	})
+	adminCredentials := app.String(cli.StringOpt{
+		Name:   "admin_credentials",
+		Value:  "",
+		Desc:   "user:password credentials of the admin endpoints, which are not authenticated when empty. Requires admin_port.",
+		EnvVar: "ADMIN_CREDENTIALS",
+	})
+
+	healthMaxDelayedNotifications := app.Int(cli.IntOpt{
+		Name:   "health_max_delayed_notifications",
+		Value:  1000,
+		Desc:   "Number of notifications waiting for the cache delay beyond which the health check fails",
+		EnvVar: "HEALTH_MAX_DELAYED_NOTIFICATIONS",
+	})
+	healthMaxConsumerLag := app.Int(cli.IntOpt{
+		Name:   "health_max_consumer_lag",
+		Value:  300,
+		Desc:   "Lag in seconds of the consumer behind the Kafka topic, from the Message-Timestamp of the latest message, beyond which the health check fails",
+		EnvVar: "HEALTH_MAX_CONSUMER_LAG",
+	})
+	healthMaxLaggingSubscribers := app.Int(cli.IntOpt{
+		Name:   "health_max_lagging_subscribers",
+		Value:  10,
+		Desc:   "Percentage of subscribers lagging behind beyond which the health check fails",
+		EnvVar: "HEALTH_MAX_LAGGING_SUBSCRIBERS",
+	})
+
+	healthMaxSilence := app.Int(cli.IntOpt{
+		Name:   "health_max_silence",
+		Value:  1800,
+		Desc:   "Seconds without any notification dispatched during the publishing hours beyond which the health check fails, 0 to disable the check",
+		EnvVar: "HEALTH_MAX_SILENCE",
+	})
+	publishingHours := app.String(cli.StringOpt{
+		Name:   "publishing_hours",
+		Value:  "6-22",
+		Desc:   "Hours of the day in UTC, in the from-to format, during which content is expected to be published. Empty for the whole day.",
+		EnvVar: "PUBLISHING_HOURS",
+	})
+
+	supervisorPolicies := app.String(cli.StringOpt{
+		Name:   "supervisor_policies",
+		Value:  "",
+		Desc:   "Comma separated name:policy overrides of the policies of the Kafka consumer errors, i.e. partition-not-claimed:exit. The policies are ignore, count, restart and exit.",
+		EnvVar: "SUPERVISOR_POLICIES",
+	})
+	supervisorRestartAttempts := app.Int(cli.IntOpt{
+		Name:   "supervisor_restart_attempts",
+		Value:  5,
+		Desc:   "Number of consecutive restarts of the Kafka consumer after which the service exits instead, 0 for no limit",
+		EnvVar: "SUPERVISOR_RESTART_ATTEMPTS",
+	})
+
+	tracingExporter := app.String(cli.StringOpt{
+		Name:   "tracing_exporter",
+		Value:  "",
+		Desc:   "Exporter of the spans timing the handling of the notifications: stdout, otlp to post them to a collector, or empty to disable tracing",
+		EnvVar: "TRACING_EXPORTER",
+	})
+	tracingCollectorURL := app.String(cli.StringOpt{
+		Name:   "tracing_collector_url",
+		Value:  tracing.DefaultCollectorURL,
+		Desc:   "OTLP/HTTP traces endpoint of the collector the spans are posted to with the otlp exporter",
+		EnvVar: "TRACING_COLLECTOR_URL",
+	})
+
+	auditSink := app.String(cli.StringOpt{
+		Name:   "audit_sink",
+		Value:  "",
+		Desc:   "Sink of the audit records of the subscriber sessions: file, kafka, or empty to disable auditing",
+		EnvVar: "AUDIT_SINK",
+	})
+	auditKeySalt := app.String(cli.StringOpt{
+		Name:   "audit_key_salt",
+		Value:  "",
+		Desc:   "Secret salt of the fingerprints the API keys are audited under, it must be the same on every replica and kept over time",
+		EnvVar: "AUDIT_KEY_SALT",
+	})
+	auditFile := app.String(cli.StringOpt{
+		Name:   "audit_file",
+		Value:  "audit.log",
+		Desc:   "File the audit records are appended to with the file sink",
+		EnvVar: "AUDIT_FILE",
+	})
+	auditFileMaxSize := app.Int(cli.IntOpt{
+		Name:   "audit_file_max_size",
+		Value:  100,
+		Desc:   "Size in MB the audit file is rotated at",
+		EnvVar: "AUDIT_FILE_MAX_SIZE",
+	})
+	auditFileMaxBackups := app.Int(cli.IntOpt{
+		Name:   "audit_file_max_backups",
+		Value:  10,
+		Desc:   "Number of rotated audit files kept",
+		EnvVar: "AUDIT_FILE_MAX_BACKUPS",
+	})
+	auditKafkaBrokers := app.String(cli.StringOpt{
+		Name:   "audit_kafka_brokers",
+		Value:  "",
+		Desc:   "Comma separated Kafka brokers the audit records are sent to with the kafka sink",
+		EnvVar: "AUDIT_KAFKA_BROKERS",
+	})
+	auditKafkaTopic := app.String(cli.StringOpt{
+		Name:   "audit_kafka_topic",
+		Value:  "NotificationsPushAudit",
+		Desc:   "Kafka topic the audit records are sent to with the kafka sink",
+		EnvVar: "AUDIT_KAFKA_TOPIC",
+	})
 
 	log.InitLogger(serviceName, "info")
 
@@ -98,26 +338,62 @@ func main() {
 	}).Infof("[Startup] notifications-push is starting ")
 
 	app.Action = func() {
+		clk := clock.System()
 		errCh := make(chan error, 2)
 		defer close(errCh)
-		var fatalErrs = []error{kazoo.ErrPartitionNotClaimed, zk.ErrNoServer}
-		fatalErrHandler := func(err error, serviceName string) {
-			log.WithError(err).Fatalf("Exiting %s due to fatal error", serviceName)
-		}
 
-		supervisor := newServiceSupervisor(serviceName, errCh, fatalErrs, fatalErrHandler)
-		go supervisor.Supervise()
+		tracer, stopTracing, err := newTracer(*tracingExporter, *tracingCollectorURL, clk)
+		if err != nil {
+			log.WithError(err).Fatal("Tracing exporter MUST be valid!")
+		}
+		tracing.SetTracer(tracer)
+		defer stopTracing()
 
-		consumerConfig := kafka.DefaultConsumerConfig()
-		messageConsumer, err := kafka.NewConsumer(kafka.Config{
-			ZookeeperConnectionString: *consumerAddrs,
-			ConsumerGroup:             *consumerGroupID,
-			Topics:                    []string{*topic},
-			ConsumerGroupConfig:       consumerConfig,
-			Err:                       errCh,
-		})
+		auditLog, err := newAuditLog(*auditSink, *auditKeySalt, *auditFile, *auditFileMaxSize, *auditFileMaxBackups, *auditKafkaBrokers, *auditKafkaTopic, clk)
 		if err != nil {
-			log.WithError(err).Fatal("Cannot create Kafka client")
+			log.WithError(err).Fatal("Audit sink MUST be valid!")
+		}
+		defer auditLog.Close()
+
+		standalone := *messageSource != "kafka"
+		apiGatewayKeyValidationURL := fmt.Sprintf("%s/%s", *apiBaseURL, *apiKeyValidationEndpoint)
+
+		var messageConsumer kafka.Consumer
+		var sup *supervisor.Supervisor
+		if standalone {
+			localConsumer, err := newLocalConsumer(*messageSource, *messageFile)
+			if err != nil {
+				log.WithError(err).Fatal("Cannot create local message source")
+			}
+			log.WithField("source", *messageSource).Warn("Running standalone, API keys are not validated")
+			messageConsumer = localConsumer
+			apiGatewayKeyValidationURL = ""
+		} else {
+			rules, err := supervisor.OverridePolicies(supervisorRules(), *supervisorPolicies)
+			if err != nil {
+				log.WithError(err).Fatal("Supervisor policies MUST be valid!")
+			}
+
+			kafkaConsumer, err := queueConsumer.NewRestartableConsumer(func() (kafka.Consumer, error) {
+				return kafka.NewConsumer(kafka.Config{
+					ZookeeperConnectionString: *consumerAddrs,
+					ConsumerGroup:             *consumerGroupID,
+					Topics:                    []string{*topic},
+					ConsumerGroupConfig:       kafka.DefaultConsumerConfig(),
+					Err:                       errCh,
+				})
+			})
+			if err != nil {
+				log.WithError(err).Fatal("Cannot create Kafka client")
+			}
+			messageConsumer = kafkaConsumer
+
+			exit := func(err error) {
+				log.WithError(err).Fatalf("Exiting %s due to fatal error", serviceName)
+			}
+			backoff := supervisor.Backoff{Initial: restartBackoff, Max: maxRestartBackoff, Attempts: *supervisorRestartAttempts}
+			sup = supervisor.New(errCh, rules, kafkaConsumer.Restart, exit, backoff, supervisorHistorySize, clk)
+			go sup.Supervise()
 		}
 
 		httpClient := &http.Client{
@@ -133,24 +409,170 @@ func main() {
 			},
 		}
 
+		skipRulesList, err := queueConsumer.ParseSkipRules(*skipRules)
+		if err != nil {
+			log.WithError(err).Fatal("Skip rules MUST be valid!")
+		}
+
+		defaultConfig := config.Config{
+			Whitelist:             *whitelist,
+			SupportedContentTypes: resources.DefaultSupportedContentTypes,
+			NotificationsDelay:    *delay,
+			HeartbeatPeriod:       int(heartbeatPeriod / time.Second),
+			SkipRules:             skipRulesList,
+		}
+
+		var configWatcher *config.Watcher
+		activeConfig, err := config.Activate(defaultConfig, "command line")
+		if *configFile != "" {
+			configWatcher = config.NewWatcher(*configFile, defaultConfig, configPollInterval)
+			activeConfig, err = configWatcher.Load()
+		}
+		if err != nil {
+			log.WithError(err).Fatal("Configuration MUST be valid!")
+		}
+		log.WithField("source", activeConfig.Source).WithField("version", activeConfig.Version).Info("Loaded configuration")
+
+		resources.SetSupportedContentTypes(activeConfig.Config.SupportedContentTypes)
+
 		history := dispatch.NewHistory(*historySize)
-		dispatcher := dispatch.NewDispatcher(time.Duration(*delay)*time.Second, heartbeatPeriod, history)
+		dispatcher := dispatch.NewDispatcher(activeConfig.Delay(), activeConfig.Heartbeat(), history, clk)
+
+		hours, err := resources.ParsePublishingHours(*publishingHours)
+		if err != nil {
+			log.WithError(err).Fatal("Publishing hours MUST be valid!")
+		}
+
+		lag := queueConsumer.NewLag(clk)
+		thresholds := resources.HealthThresholds{
+			DelayedNotifications: *healthMaxDelayedNotifications,
+			ConsumerLag:          time.Duration(*healthMaxConsumerLag) * time.Second,
+			LaggingSubscribers:   float64(*healthMaxLaggingSubscribers),
+			MaxSilence:           time.Duration(*healthMaxSilence) * time.Second,
+			PublishingHours:      hours,
+		}
+		var hc *resources.HealthCheck
+		var partitionLag *queueConsumer.PartitionLag
+		if standalone {
+			hc = resources.NewStandaloneHealthCheck(messageConsumer, dispatcher, thresholds)
+		} else {
+			// the lag is only monitored, the service runs without it
+			offsets, err := queueConsumer.NewKafkaOffsets(*consumerAddrs, *consumerGroupID, *topic)
+			if err != nil {
+				log.WithError(err).Error("Cannot monitor the consumer lag")
+			} else {
+				partitionLag = queueConsumer.NewPartitionLag(offsets, consumerLagPollInterval, clk)
+				go partitionLag.Start()
+				defer partitionLag.Stop()
+			}
+			hc = resources.NewHealthCheck(messageConsumer, sup, dispatcher, lag, partitionLag, apiGatewayKeyValidationURL, httpClient, thresholds, clk)
+		}
+
+		fieldMappings, err := queueConsumer.ParseFieldMappings(*payloadFields)
+		if err != nil {
+			log.WithError(err).Fatal("Payload field mappings MUST be valid!")
+		}
 
 		mapper := queueConsumer.NotificationMapper{
 			Resource:   *resource,
 			APIBaseURL: *apiBaseURL,
+			Fields:     fieldMappings,
 		}
 
-		whitelistR, err := regexp.Compile(*whitelist)
+		validator, err := newEventValidator(*eventSchema, *eventValidationMode)
 		if err != nil {
-			log.WithError(err).Fatal("Whitelist regex MUST compile!")
+			log.WithError(err).Fatal("Event schema MUST be valid!")
 		}
 
-		apiGatewayKeyValidationURL := fmt.Sprintf("%s/%s", *apiBaseURL, *apiKeyValidationEndpoint)
-		go server(":"+strconv.Itoa(*port), *resource, dispatcher, history, messageConsumer, apiGatewayKeyValidationURL, httpClient)
+		activeConfigProvider := func() *config.Active { return activeConfig }
+		if configWatcher != nil {
+			activeConfigProvider = configWatcher.Active
+		}
+
+		queueHandler := queueConsumer.NewMessageQueueHandler(activeConfig.WhitelistRegexp, activeConfig.Config.SkipRules, *capturedHeaders, validator, mapper, dispatcher)
+
+		var ingestHandler queueConsumer.MessageQueueHandler
+		if *ingestEnabled || *messageSource == "http" {
+			log.Warn("The /__ingest endpoint is enabled")
+			ingestHandler = queueHandler
+		}
+
+		var adminUser, adminPassword string
+		if *adminCredentials != "" {
+			if *adminPort == 0 {
+				log.Fatal("Admin credentials MUST come with an admin port!")
+			}
+			adminUser, adminPassword, err = resources.ParseCredentials(*adminCredentials)
+			if err != nil {
+				log.WithError(err).Fatal("Admin credentials MUST be valid!")
+			}
+		}
+
+		var tlsConfig, peerTLSConfig *tls.Config
+		if *tlsCertFile != "" || *tlsKeyFile != "" {
+			reloader, err := certs.NewReloader(*tlsCertFile, *tlsKeyFile, configPollInterval)
+			if err != nil {
+				log.WithError(err).Fatal("TLS certificate MUST be valid!")
+			}
+			tlsConfig, err = certs.ServerConfig(reloader, *tlsClientCAFile, *tlsRequireClientCert)
+			if err != nil {
+				log.WithError(err).Fatal("TLS client CAs MUST be valid!")
+			}
+			// the state of the replicas is served over TLS with the other endpoints
+			peerTLSConfig = certs.PeerConfig(reloader)
+			log.WithField("cert", *tlsCertFile).WithField("clientCAs", *tlsClientCAFile).Info("Terminating TLS")
+			go reloader.Watch()
+			defer reloader.Stop()
+		}
 
-		queueHandler := queueConsumer.NewMessageQueueHandler(whitelistR, mapper, dispatcher)
-		pushService := newPushService(dispatcher, messageConsumer)
+		var replica *cluster.Cluster
+		if *clusterMode {
+			replica, err = newCluster(*clusterNode, *clusterPeers, time.Duration(*clusterSyncInterval)*time.Second, dispatcher, history, *historySize, clk, adminUser, adminPassword, peerTLSConfig)
+			if err != nil {
+				log.WithError(err).Fatal("Cannot join the cluster")
+			}
+			log.WithField("node", replica.Node()).WithField("peers", *clusterPeers).Info("Running in cluster mode")
+			go replica.Start()
+			defer replica.Stop()
+		}
+
+		// the admin endpoints are only served on the admin port if there is one, so that they are never public
+		var admin *mux.Router
+		if *adminPort != 0 {
+			admin = mux.NewRouter()
+		}
+		router := resources.NewRouter(*resource, dispatcher, history, hc, apiGatewayKeyValidationURL, httpClient, activeConfigProvider, clk, resources.RouterOptions{
+			IngestHandler: ingestHandler,
+			PartitionLag:  partitionLag,
+			Supervisor:    sup,
+			AuditLog:      auditLog,
+			Cluster:       replica,
+			Admin:         admin,
+		})
+		go server(":"+strconv.Itoa(*port), router, tlsConfig)
+		if admin != nil {
+			var adminHandler http.Handler = admin
+			if adminUser != "" {
+				adminHandler = resources.BasicAuth(adminUser, adminPassword, admin)
+			}
+			if adminUser != "" && tlsConfig == nil {
+				log.Warn("The admin credentials are sent in plain HTTP, TLS must be terminated in front of the admin port")
+			}
+			log.WithField("port", *adminPort).WithField("authenticated", adminUser != "").WithField("tls", tlsConfig != nil).Info("Serving the admin endpoints apart")
+			go server(":"+strconv.Itoa(*adminPort), adminHandler, tlsConfig)
+		}
+		if *grpcPort != 0 {
+			go grpcServer(":"+strconv.Itoa(*grpcPort), dispatcher, history, apiGatewayKeyValidationURL, httpClient, activeConfig.Heartbeat(), clk, replica, tlsConfig, auditLog)
+		}
+
+		if configWatcher != nil {
+			go configWatcher.Watch(func(active *config.Active) {
+				applyConfig(active, queueHandler, dispatcher)
+			})
+			defer configWatcher.Stop()
+		}
+
+		pushService := newPushService(dispatcher, messageConsumer, lag)
 		pushService.start(queueHandler)
 	}
 
@@ -159,24 +581,187 @@ func main() {
 	}
 }
 
-func server(listen string, resource string, dispatcher dispatch.Dispatcher, history dispatch.History, consumer kafka.Consumer, apiGatewayKeyValidationURL string, httpClient *http.Client) {
-	notificationsPushPath := "/" + resource + "/notifications-push"
+// supervisorRules classifies the errors of the Kafka consumer, those it cannot recover from by itself restart it
+func supervisorRules() []supervisor.Rule {
+	return []supervisor.Rule{
+		{Name: "partition-not-claimed", Matches: supervisor.Is(kazoo.ErrPartitionNotClaimed), Policy: supervisor.Restart},
+		{Name: "zookeeper-unreachable", Matches: supervisor.Is(zk.ErrNoServer), Policy: supervisor.Restart},
+		{Name: "zookeeper-session-expired", Matches: supervisor.Is(zk.ErrSessionExpired), Policy: supervisor.Restart},
+		{Name: "zookeeper-connection-closed", Matches: supervisor.Is(zk.ErrConnectionClosed), Policy: supervisor.Restart},
+		{Name: "kafka-out-of-brokers", Matches: supervisor.Is(sarama.ErrOutOfBrokers), Policy: supervisor.Restart},
+		{Name: "kafka-broker-error", Matches: supervisor.IsType(sarama.KError(0)), Policy: supervisor.Count},
+	}
+}
+
+// applyConfig is not atomic: the settings are applied one after the other, so for a short while a message or a subscriber
+// may see some of the new settings along with the old ones. The filters and the content types go first, so that by the
+// time the dispatcher runs with the new delay and heartbeat, what it is sent already follows the new configuration.
+func applyConfig(active *config.Active, queueHandler queueConsumer.MessageQueueHandler, dispatcher dispatch.Dispatcher) {
+	queueHandler.UpdateFilters(active.WhitelistRegexp, active.Config.SkipRules)
+	resources.SetSupportedContentTypes(active.Config.SupportedContentTypes)
+	dispatcher.Reconfigure(active.Delay(), active.Heartbeat())
+}
+
+func newLocalConsumer(source string, file string) (*queueConsumer.LocalConsumer, error) {
+	switch source {
+	case "http":
+		return queueConsumer.NewLocalConsumer(nil, false, localPollInterval), nil
+	case "stdin":
+		return queueConsumer.NewLocalConsumer(os.Stdin, false, localPollInterval), nil
+	case "file":
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		return queueConsumer.NewLocalConsumer(f, true, localPollInterval), nil
+	}
+	return nil, fmt.Errorf("unsupported message source (%s)", source)
+}
+
+// newCluster returns the replica sharing its state with the peers, over TLS with the given configuration if not nil
+func newCluster(node string, peers []string, period time.Duration, dispatcher dispatch.Dispatcher, history dispatch.History, historySize int, clk clock.Clock, adminUser string, adminPassword string, tlsConfig *tls.Config) (*cluster.Cluster, error) {
+	if node == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		node = hostname
+	}
+	if period <= 0 {
+		return nil, fmt.Errorf("invalid cluster sync interval (%v)", period)
+	}
+
+	scheme, transport := "http", http.DefaultTransport
+	if tlsConfig != nil {
+		scheme, transport = "https", &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig}
+	}
+	httpClient := &http.Client{Timeout: period, Transport: transport}
+	// the state is served with the admin endpoints
+	if adminUser != "" {
+		httpClient.Transport = &basicAuthTransport{user: adminUser, password: adminPassword, next: transport}
+	}
+	backplane := cluster.NewPeersBackplane(peers, scheme, httpClient)
+	return cluster.New(node, backplane, dispatcher, history, historySize, period, clk), nil
+}
+
+// newTracer returns the tracer exporting to the given exporter, and a function flushing the spans left on shutdown.
+// The tracer is nil when tracing is disabled.
+func newTracer(exporter string, collectorURL string, clk clock.Clock) (*tracing.Tracer, func(), error) {
+	switch exporter {
+	case "":
+		return nil, func() {}, nil
+	case "stdout":
+		return tracing.NewTracer(tracing.NewWriterExporter(os.Stdout), clk), func() {}, nil
+	case "otlp":
+		collector := tracing.NewCollectorExporter(collectorURL, &http.Client{Timeout: tracingFlushPeriod}, tracingBatchSize, tracingFlushPeriod, clk)
+		go collector.Run()
+		return tracing.NewTracer(collector, clk), collector.Stop, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported tracing exporter (%s)", exporter)
+}
+
+// newAuditLog returns the audit log writing to the given sink, it is nil when auditing is disabled
+func newAuditLog(sink string, keySalt string, file string, maxSizeMB int, maxBackups int, kafkaBrokers string, kafkaTopic string, clk clock.Clock) (*audit.Log, error) {
+	if sink != "" && keySalt == "" {
+		return nil, fmt.Errorf("the salt of the API key fingerprints is missing")
+	}
+
+	switch sink {
+	case "":
+		return nil, nil
+	case "file":
+		fileSink, err := audit.NewFileSink(file, int64(maxSizeMB)*1024*1024, maxBackups)
+		if err != nil {
+			return nil, err
+		}
+		return audit.New(fileSink, auditHistorySize, keySalt, clk), nil
+	case "kafka":
+		if kafkaBrokers == "" {
+			return nil, fmt.Errorf("the Kafka brokers of the audit sink are missing")
+		}
+		producer, err := kafka.NewProducer(kafkaBrokers, kafkaTopic, kafka.DefaultProducerConfig())
+		if err != nil {
+			return nil, err
+		}
+		kafkaSink := audit.NewKafkaSink(producer, auditQueueSize)
+		go kafkaSink.Run()
+		return audit.New(kafkaSink, auditHistorySize, keySalt, clk), nil
+	}
+	return nil, fmt.Errorf("unsupported audit sink (%s)", sink)
+}
 
-	r := mux.NewRouter()
+func newEventValidator(schemaPath string, mode string) (*queueConsumer.EventValidator, error) {
+	if mode != "strict" && mode != "lenient" {
+		return nil, fmt.Errorf("unsupported event validation mode (%s)", mode)
+	}
+	if schemaPath == "" {
+		return nil, nil
+	}
 
-	r.HandleFunc(notificationsPushPath, resources.Push(dispatcher, apiGatewayKeyValidationURL, httpClient)).Methods("GET")
-	r.HandleFunc("/__history", resources.History(history)).Methods("GET")
-	r.HandleFunc("/__stats", resources.Stats(dispatcher)).Methods("GET")
+	schema, err := queueConsumer.LoadEventSchema(schemaPath)
+	if err != nil {
+		return nil, err
+	}
 
-	hc := resources.NewHealthCheck(consumer)
+	log.WithField("schema", schemaPath).WithField("mode", mode).Info("Validating publication events")
+	return &queueConsumer.EventValidator{Schema: schema, Strict: mode == "strict"}, nil
+}
 
-	r.HandleFunc("/__health", hc.Health())
-	r.HandleFunc(httphandlers.GTGPath, httphandlers.NewGoodToGoHandler(hc.GTG))
-	r.HandleFunc(httphandlers.BuildInfoPath, httphandlers.BuildInfoHandler)
-	r.HandleFunc(httphandlers.PingPath, httphandlers.PingHandler)
+func server(listen string, handler http.Handler, tlsConfig *tls.Config) {
+	srv := newHTTPServer(listen, handler, tlsConfig)
+	var err error
+	if tlsConfig != nil {
+		// HTTP/2 is negotiated over TLS, so that the push streams of a subscriber share its connection
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	log.Fatal(err)
+}
 
-	http.Handle("/", r)
+// newHTTPServer returns the HTTP server of the service. Its timeouts only bound slow clients and idle connections,
+// as read and write timeouts would end the push streams.
+func newHTTPServer(listen string, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Addr:              listen,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+}
 
-	err := http.ListenAndServe(listen, nil)
+// grpcServer serves the gRPC push service, with keepalive pings sent as often as the heartbeats
+func grpcServer(listen string, dispatcher dispatch.Dispatcher, history dispatch.History, apiGatewayKeyValidationURL string, httpClient *http.Client, keepalivePeriod time.Duration, clk clock.Clock, replica *cluster.Cluster, tlsConfig *tls.Config, auditLog *audit.Log) {
+	if replica != nil {
+		history = replica.History()
+	}
+	lis, err := net.Listen("tcp", listen)
+	if err != nil {
+		log.WithError(err).Fatal("Cannot listen for gRPC subscribers")
+	}
+
+	s := rpc.NewGRPCServer(rpc.NewServer(dispatcher, history, apiGatewayKeyValidationURL, httpClient, clk, auditLog), keepalivePeriod, tlsConfig)
+	log.WithField("listen", listen).Info("Serving gRPC subscribers")
+	err = s.Serve(lis)
 	log.Fatal(err)
 }
+
+// basicAuthTransport authenticates the requests it sends
+type basicAuthTransport struct {
+	user     string
+	password string
+	next     http.RoundTripper
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// requests must not be modified by round trippers
+	authenticated := new(http.Request)
+	*authenticated = *req
+	authenticated.Header = http.Header{}
+	for name, values := range req.Header {
+		authenticated.Header[name] = values
+	}
+	authenticated.SetBasicAuth(t.user, t.password)
+	return t.next.RoundTrip(authenticated)
+}
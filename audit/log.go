@@ -0,0 +1,335 @@
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/rcrowley/go-metrics"
+)
+
+// FailedRecords counts the audit records the sink failed to write
+var FailedRecords = metrics.GetOrRegisterCounter("audit.records.failed", metrics.DefaultRegistry)
+
+// Client describes how a subscriber connected
+type Client struct {
+	APIKey    string
+	UserAgent string
+	// Protocol is sse for the push endpoint or grpc
+	Protocol string
+	// Format of the push stream, if negotiated
+	Format  string
+	Monitor bool
+}
+
+// Log writes the audit records of the subscriber sessions to a sink, and keeps the latest closed sessions to summarise them.
+// The methods of a nil log do nothing, so that sessions are audited the same way whether auditing is enabled or not.
+type Log struct {
+	sink        Sink
+	salt        string
+	clock       clock.Clock
+	lock        *sync.Mutex
+	open        map[*Session]struct{}
+	closed      []Record
+	next        int
+	historySize int
+	// evictedUntil is the latest close of the sessions evicted from the history
+	evictedUntil time.Time
+}
+
+// New returns a log writing to the given sink and keeping up to historySize closed sessions.
+// The API keys are fingerprinted with the salt.
+func New(sink Sink, historySize int, salt string, clk clock.Clock) *Log {
+	return &Log{
+		sink:        sink,
+		salt:        salt,
+		clock:       clk,
+		lock:        &sync.Mutex{},
+		open:        map[*Session]struct{}{},
+		historySize: historySize,
+	}
+}
+
+// Open records a subscriber registering, the session must be closed when the subscriber is
+func (l *Log) Open(sub dispatch.Subscriber, client Client) *Session {
+	if l == nil {
+		return nil
+	}
+
+	now := l.clock.Now()
+	s := &Session{
+		log: l,
+		sub: sub,
+		record: Record{
+			Event:        RegisterEvent,
+			Time:         now,
+			Session:      newSessionID(),
+			Identity:     sub.Identity(),
+			Address:      sub.Address(),
+			UserAgent:    client.UserAgent,
+			Protocol:     client.Protocol,
+			Format:       client.Format,
+			Monitor:      client.Monitor,
+			ContentType:  sub.AcceptedContentType(),
+			HeaderFilter: sub.HeaderFilter(),
+			ConnectedAt:  now,
+		},
+		lock: &sync.Mutex{},
+	}
+	if client.APIKey != "" {
+		s.record.KeyFingerprint = Fingerprint(client.APIKey, l.salt)
+		s.record.KeySuffix = KeySuffix(client.APIKey)
+	}
+
+	l.lock.Lock()
+	l.open[s] = struct{}{}
+	l.lock.Unlock()
+
+	l.write(s.record)
+	return s
+}
+
+func (l *Log) close(s *Session, r Record) {
+	l.lock.Lock()
+	delete(l.open, s)
+	if len(l.closed) < l.historySize {
+		l.closed = append(l.closed, r)
+	} else if l.historySize > 0 {
+		if l.closed[l.next].Time.After(l.evictedUntil) {
+			l.evictedUntil = l.closed[l.next].Time
+		}
+		l.closed[l.next] = r
+		l.next = (l.next + 1) % l.historySize
+	}
+	l.lock.Unlock()
+
+	l.write(r)
+}
+
+func (l *Log) write(r Record) {
+	if err := l.sink.Write(r); err != nil {
+		FailedRecords.Inc(1)
+		log.WithError(err).WithField("session", r.Session).WithField("event", r.Event).Warn("Failed to write audit record")
+	}
+}
+
+// Close closes the sink
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.sink.Close()
+}
+
+// KeySummary aggregates the sessions of a key over a time range
+type KeySummary struct {
+	Key string `json:"key"`
+	// KeySuffix is displayed to recognise the API key, keys sharing a suffix are still told apart by the fingerprint in Key
+	KeySuffix string `json:"keySuffix,omitempty"`
+	Sessions  int    `json:"sessions"`
+	// Open is the number of sessions still connected
+	Open int `json:"open"`
+	// ConnectedSeconds is the time the sessions were connected within the range
+	ConnectedSeconds float64   `json:"connectedSeconds"`
+	Notifications    int64     `json:"notifications"`
+	Dropped          uint64    `json:"dropped"`
+	FirstConnectedAt time.Time `json:"firstConnectedAt"`
+	LastSeenAt       time.Time `json:"lastSeenAt"`
+	Addresses        []string  `json:"addresses"`
+	// Disconnects counts the closed sessions by reason
+	Disconnects map[string]int `json:"disconnects,omitempty"`
+}
+
+// Summary is the summary of the sessions of this log over a time range
+type Summary struct {
+	// Keys are the sessions aggregated by key, sorted by key
+	Keys []KeySummary
+	// EarliestConnectedAt is when the earliest session the log keeps connected, zero if it keeps none
+	EarliestConnectedAt time.Time
+	// Truncated tells that sessions of the range were evicted from the history of the log and are missing from the summary
+	Truncated bool
+}
+
+// Summary aggregates by key the sessions connected at some point between from and to.
+// The open sessions are included, and the closed ones as far back as the log keeps them.
+func (l *Log) Summary(from time.Time, to time.Time) Summary {
+	if l == nil {
+		return Summary{}
+	}
+
+	now := l.clock.Now()
+	l.lock.Lock()
+	records := append([]Record{}, l.closed...)
+	var open []Record
+	for s := range l.open {
+		open = append(open, s.snapshot(now))
+	}
+	truncated := from.Before(l.evictedUntil)
+	l.lock.Unlock()
+
+	var earliest time.Time
+	for _, r := range append(records, open...) {
+		if earliest.IsZero() || r.ConnectedAt.Before(earliest) {
+			earliest = r.ConnectedAt
+		}
+	}
+
+	summaries := map[string]*KeySummary{}
+	addresses := map[string]map[string]struct{}{}
+	add := func(r Record, isOpen bool) {
+		end := r.Time
+		if !r.ConnectedAt.Before(to) || !end.After(from) {
+			return
+		}
+
+		key := r.Key()
+		summary, found := summaries[key]
+		if !found {
+			summary = &KeySummary{Key: key, KeySuffix: r.KeySuffix, FirstConnectedAt: r.ConnectedAt, Disconnects: map[string]int{}}
+			summaries[key] = summary
+			addresses[key] = map[string]struct{}{}
+		}
+		summary.Sessions++
+		summary.ConnectedSeconds += overlap(r.ConnectedAt, end, from, to).Seconds()
+		summary.Notifications += r.Notifications
+		summary.Dropped += r.Dropped
+		if r.ConnectedAt.Before(summary.FirstConnectedAt) {
+			summary.FirstConnectedAt = r.ConnectedAt
+		}
+		if end.After(summary.LastSeenAt) {
+			summary.LastSeenAt = end
+		}
+		addresses[key][r.Address] = struct{}{}
+		if isOpen {
+			summary.Open++
+		} else {
+			summary.Disconnects[r.Reason]++
+		}
+	}
+	for _, r := range records {
+		add(r, false)
+	}
+	for _, r := range open {
+		add(r, true)
+	}
+
+	var result []KeySummary
+	for key, summary := range summaries {
+		for address := range addresses[key] {
+			summary.Addresses = append(summary.Addresses, address)
+		}
+		sort.Strings(summary.Addresses)
+		if len(summary.Disconnects) == 0 {
+			summary.Disconnects = nil
+		}
+		result = append(result, *summary)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return Summary{Keys: result, EarliestConnectedAt: earliest, Truncated: truncated}
+}
+
+func overlap(start time.Time, end time.Time, from time.Time, to time.Time) time.Duration {
+	if start.Before(from) {
+		start = from
+	}
+	if end.After(to) {
+		end = to
+	}
+	if end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// Session is the connection of a subscriber. The methods of a nil session do nothing.
+type Session struct {
+	// notifications is first to be 64-bit aligned for atomic operations
+	notifications int64
+	log           *Log
+	sub           dispatch.Subscriber
+	record        Record
+	lock          *sync.Mutex
+	reason        string
+	err           string
+	closed        bool
+}
+
+// Delivered counts notifications written to the subscriber
+func (s *Session) Delivered(count int) {
+	if s == nil {
+		return
+	}
+	atomic.AddInt64(&s.notifications, int64(count))
+}
+
+// Reconnect records that the subscriber was asked to reconnect
+func (s *Session) Reconnect() {
+	s.setReason(Reconnect, nil)
+}
+
+// Failed records that writing to the subscriber failed
+func (s *Session) Failed(err error) {
+	s.setReason(WriteFailed, err)
+}
+
+// setReason keeps the first reason, the one the session ended for
+func (s *Session) setReason(reason string, err error) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.reason != "" {
+		return
+	}
+	s.reason = reason
+	if err != nil {
+		s.err = err.Error()
+	}
+}
+
+// Close records the subscriber closing, with its counts and the reason it closed for, a client closing by default
+func (s *Session) Close() {
+	if s == nil {
+		return
+	}
+	s.setReason(ClientClosed, nil)
+
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return
+	}
+	s.closed = true
+	s.lock.Unlock()
+
+	r := s.snapshot(s.log.clock.Now())
+	r.Event = CloseEvent
+	s.log.close(s, r)
+}
+
+// snapshot returns the record of the session as if it closed at the given time
+func (s *Session) snapshot(now time.Time) Record {
+	r := s.record
+	r.Time = now
+	r.DurationSeconds = now.Sub(r.ConnectedAt).Seconds()
+	r.Notifications = atomic.LoadInt64(&s.notifications)
+	r.Dropped = s.sub.Dropped()
+
+	s.lock.Lock()
+	r.Reason, r.Error = s.reason, s.err
+	s.lock.Unlock()
+	return r
+}
+
+func newSessionID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
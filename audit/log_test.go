@@ -0,0 +1,224 @@
+package audit
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+
+type memorySink struct {
+	lock    sync.Mutex
+	records []Record
+	err     error
+	closed  bool
+}
+
+func (s *memorySink) Write(r Record) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestSessionRecords(t *testing.T) {
+	clk := clock.NewFake(start)
+	sink := &memorySink{}
+	l := New(sink, 10, "salt", clk)
+
+	sub := dispatch.NewStandardSubscriber("192.168.1.1", "Article", dispatch.HeaderFilter{"X-Origin": "methode"}, clk)
+	session := l.Open(sub, Client{APIKey: "an-api-key-ending-in-c0de", UserAgent: "curl/7.54.0", Protocol: "sse", Format: "json"})
+
+	require.Len(t, sink.records, 1)
+	registered := sink.records[0]
+	assert.Equal(t, RegisterEvent, registered.Event)
+	assert.Equal(t, start, registered.Time)
+	assert.NotEmpty(t, registered.Session)
+	assert.Equal(t, Fingerprint("an-api-key-ending-in-c0de", "salt"), registered.KeyFingerprint)
+	assert.Equal(t, "c0de", registered.KeySuffix)
+	assert.Equal(t, "192.168.1.1", registered.Address)
+	assert.Equal(t, "curl/7.54.0", registered.UserAgent)
+	assert.Equal(t, "sse", registered.Protocol)
+	assert.Equal(t, "json", registered.Format)
+	assert.False(t, registered.Monitor)
+	assert.Equal(t, "Article", registered.ContentType)
+	assert.Equal(t, dispatch.HeaderFilter{"X-Origin": "methode"}, registered.HeaderFilter)
+	assert.Equal(t, start, registered.ConnectedAt)
+
+	session.Delivered(3)
+	session.Delivered(2)
+	clk.Advance(90 * time.Second)
+	session.Close()
+	session.Close()
+
+	require.Len(t, sink.records, 2, "the session is closed once")
+	closed := sink.records[1]
+	assert.Equal(t, CloseEvent, closed.Event)
+	assert.Equal(t, registered.Session, closed.Session)
+	assert.Equal(t, start.Add(90*time.Second), closed.Time)
+	assert.Equal(t, start, closed.ConnectedAt)
+	assert.Equal(t, 90.0, closed.DurationSeconds)
+	assert.Equal(t, int64(5), closed.Notifications)
+	assert.Equal(t, ClientClosed, closed.Reason)
+}
+
+func TestSessionReason(t *testing.T) {
+	clk := clock.NewFake(start)
+	sink := &memorySink{}
+	l := New(sink, 10, "salt", clk)
+
+	reconnected := l.Open(dispatch.NewStandardSubscriber("192.168.1.1", "All", nil, clk), Client{})
+	reconnected.Reconnect()
+	reconnected.Failed(errors.New("broken pipe"))
+	reconnected.Close()
+
+	failed := l.Open(dispatch.NewMonitorSubscriber("192.168.1.2", "All", nil, clk), Client{Monitor: true})
+	failed.Failed(errors.New("broken pipe"))
+	failed.Close()
+
+	require.Len(t, sink.records, 4)
+	assert.Equal(t, Reconnect, sink.records[1].Reason, "the first reason is the one the session ended for")
+	assert.Equal(t, "", sink.records[1].Error)
+	assert.Equal(t, WriteFailed, sink.records[3].Reason)
+	assert.Equal(t, "broken pipe", sink.records[3].Error)
+	assert.True(t, sink.records[3].Monitor)
+}
+
+func TestSinkErrorsAreCounted(t *testing.T) {
+	clk := clock.NewFake(start)
+	l := New(&memorySink{err: errors.New("disk full")}, 10, "salt", clk)
+	failed := FailedRecords.Count()
+
+	l.Open(dispatch.NewStandardSubscriber("192.168.1.1", "All", nil, clk), Client{}).Close()
+
+	assert.Equal(t, failed+2, FailedRecords.Count())
+	assert.Len(t, l.Summary(start.Add(-time.Hour), start.Add(time.Hour)).Keys, 1, "sessions are summarised even if their records failed")
+}
+
+func TestNilLog(t *testing.T) {
+	var l *Log
+	session := l.Open(dispatch.NewStandardSubscriber("192.168.1.1", "All", nil, clock.NewFake(start)), Client{})
+	session.Delivered(1)
+	session.Reconnect()
+	session.Failed(errors.New("broken pipe"))
+	session.Close()
+
+	assert.Nil(t, session)
+	assert.Equal(t, Summary{}, l.Summary(start, start.Add(time.Hour)))
+	assert.NoError(t, l.Close())
+}
+
+func TestClose(t *testing.T) {
+	sink := &memorySink{}
+	require.NoError(t, New(sink, 10, "salt", clock.NewFake(start)).Close())
+	assert.True(t, sink.closed)
+}
+
+func TestSummary(t *testing.T) {
+	clk := clock.NewFake(start)
+	l := New(&memorySink{}, 10, "salt", clk)
+	open := func(address string, apiKey string) *Session {
+		return l.Open(dispatch.NewStandardSubscriber(address, "All", nil, clk), Client{APIKey: apiKey})
+	}
+
+	// 10:00-10:30, before the range
+	s1 := open("192.168.1.1", "key-one-aaaa")
+	clk.Advance(30 * time.Minute)
+	s1.Close()
+
+	// 10:30-11:30, half in the range
+	s2 := open("192.168.1.1", "key-one-aaaa")
+	s2.Delivered(4)
+	clk.Advance(time.Hour)
+	s2.Failed(errors.New("broken pipe"))
+	s2.Close()
+
+	// 11:30-now (12:30), still open
+	s3 := open("192.168.1.2", "key-one-aaaa")
+	s3.Delivered(1)
+	s4 := open("192.168.1.3", "key-two-bbbb")
+	clk.Advance(30 * time.Minute)
+	s4.Close()
+	clk.Advance(30 * time.Minute)
+
+	result := l.Summary(start.Add(time.Hour), start.Add(3*time.Hour))
+	assert.Equal(t, start, result.EarliestConnectedAt)
+	assert.False(t, result.Truncated)
+	summary := result.Keys
+	require.Len(t, summary, 2)
+
+	assert.Equal(t, KeySummary{
+		Key:              Fingerprint("key-one-aaaa", "salt"),
+		KeySuffix:        "aaaa",
+		Sessions:         2,
+		Open:             1,
+		ConnectedSeconds: (30*time.Minute + time.Hour).Seconds(),
+		Notifications:    5,
+		FirstConnectedAt: start.Add(30 * time.Minute),
+		LastSeenAt:       start.Add(150 * time.Minute),
+		Addresses:        []string{"192.168.1.1", "192.168.1.2"},
+		Disconnects:      map[string]int{WriteFailed: 1},
+	}, summary[0])
+	assert.Equal(t, KeySummary{
+		Key:              Fingerprint("key-two-bbbb", "salt"),
+		KeySuffix:        "bbbb",
+		Sessions:         1,
+		ConnectedSeconds: (30 * time.Minute).Seconds(),
+		FirstConnectedAt: start.Add(90 * time.Minute),
+		LastSeenAt:       start.Add(2 * time.Hour),
+		Addresses:        []string{"192.168.1.3"},
+		Disconnects:      map[string]int{ClientClosed: 1},
+	}, summary[1])
+
+	assert.Empty(t, l.Summary(start.Add(4*time.Hour), start.Add(5*time.Hour)).Keys)
+}
+
+func TestSummaryKeepsTheLatestSessions(t *testing.T) {
+	clk := clock.NewFake(start)
+	l := New(&memorySink{}, 2, "salt", clk)
+	for _, apiKey := range []string{"key-one-aaaa", "key-two-bbbb", "key-three-cccc"} {
+		l.Open(dispatch.NewStandardSubscriber("192.168.1.1", "All", nil, clk), Client{APIKey: apiKey}).Close()
+		clk.Advance(time.Minute)
+	}
+
+	summary := l.Summary(start.Add(-time.Hour), start.Add(time.Hour))
+	require.Len(t, summary.Keys, 2)
+	assert.Equal(t, "cccc", summary.Keys[0].KeySuffix)
+	assert.Equal(t, "bbbb", summary.Keys[1].KeySuffix)
+	assert.Equal(t, start.Add(time.Minute), summary.EarliestConnectedAt)
+	assert.True(t, summary.Truncated, "the first session is missing")
+
+	assert.False(t, l.Summary(start.Add(30*time.Second), start.Add(time.Hour)).Truncated, "the range starts after the first session")
+}
+
+func TestSummaryTellsApartKeysSharingASuffix(t *testing.T) {
+	clk := clock.NewFake(start)
+	l := New(&memorySink{}, 10, "salt", clk)
+	for _, apiKey := range []string{"customer-one-c0de", "customer-two-c0de", "customer-one-c0de"} {
+		l.Open(dispatch.NewStandardSubscriber("192.168.1.1", "All", nil, clk), Client{APIKey: apiKey}).Close()
+	}
+
+	summary := l.Summary(start.Add(-time.Hour), start.Add(time.Hour)).Keys
+	require.Len(t, summary, 2)
+	assert.Equal(t, Fingerprint("customer-one-c0de", "salt"), summary[0].Key)
+	assert.Equal(t, "c0de", summary[0].KeySuffix)
+	assert.Equal(t, 2, summary[0].Sessions)
+	assert.Equal(t, Fingerprint("customer-two-c0de", "salt"), summary[1].Key)
+	assert.Equal(t, "c0de", summary[1].KeySuffix)
+	assert.Equal(t, 1, summary[1].Sessions)
+}
@@ -0,0 +1,90 @@
+// Package audit records the sessions of the subscribers, when they connect and disconnect, for reporting
+// who received notifications, when, for how long and how many.
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/dispatch"
+)
+
+// Events of the audit records
+const (
+	RegisterEvent = "register"
+	CloseEvent    = "close"
+)
+
+// Reasons a session is closed for
+const (
+	// ClientClosed is a subscriber closing its connection
+	ClientClosed = "client-closed"
+	// Reconnect is a subscriber asked to reconnect, i.e. when the service shuts down
+	Reconnect = "reconnect"
+	// WriteFailed is a failure writing to the subscriber, the error is recorded
+	WriteFailed = "write-failed"
+)
+
+// Anonymous is the key of the subscribers with neither an API key nor an identity, i.e. in standalone mode
+const Anonymous = "anonymous"
+
+const (
+	keySuffixLength = 4
+	// fingerprintLength is the number of bytes of the HMAC kept in a key fingerprint
+	fingerprintLength = 16
+)
+
+// Record is the audit record of a subscriber registering or closing its session
+type Record struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	// Session is the same in the register and close records of a session
+	Session        string                `json:"session"`
+	KeyFingerprint string                `json:"keyFingerprint,omitempty"`
+	KeySuffix      string                `json:"keySuffix,omitempty"`
+	Identity       string                `json:"identity,omitempty"`
+	Address        string                `json:"address"`
+	UserAgent      string                `json:"userAgent,omitempty"`
+	Protocol       string                `json:"protocol"`
+	Format         string                `json:"format,omitempty"`
+	Monitor        bool                  `json:"monitor"`
+	ContentType    string                `json:"contentType"`
+	HeaderFilter   dispatch.HeaderFilter `json:"headerFilter,omitempty"`
+	ConnectedAt    time.Time             `json:"connectedAt"`
+	// DurationSeconds, Notifications, Dropped and Reason are only set when the session is closed
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+	Notifications   int64   `json:"notifications"`
+	Dropped         uint64  `json:"dropped"`
+	Reason          string  `json:"reason,omitempty"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// Key is what the session is reported under: the API key fingerprint, or else the identity of the client certificate
+func (r Record) Key() string {
+	switch {
+	case r.KeyFingerprint != "":
+		return r.KeyFingerprint
+	case r.Identity != "":
+		return r.Identity
+	}
+	return Anonymous
+}
+
+// Fingerprint returns the HMAC-SHA256 of an API key with the salt, hex encoded. It tells the keys apart
+// without them being recorded nor found back from it.
+func Fingerprint(apiKey string, salt string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(apiKey))
+	return hex.EncodeToString(mac.Sum(nil)[:fingerprintLength])
+}
+
+// KeySuffix returns the last characters of an API key, for display only as keys may share it. The key itself is never recorded
+func KeySuffix(apiKey string) string {
+	length := keySuffixLength
+	if len(apiKey) < 2*length {
+		length = len(apiKey) / 2
+	}
+	return apiKey[len(apiKey)-length:]
+}
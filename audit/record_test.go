@@ -0,0 +1,27 @@
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySuffix(t *testing.T) {
+	assert.Equal(t, "c0de", KeySuffix("an-api-key-ending-in-c0de"))
+	assert.Equal(t, "ey", KeySuffix("a-key"), "at most half of a short key is recorded")
+	assert.Equal(t, "", KeySuffix("k"))
+	assert.Equal(t, "", KeySuffix(""))
+}
+
+func TestFingerprint(t *testing.T) {
+	fingerprint := Fingerprint("an-api-key-ending-in-c0de", "salt")
+	assert.Equal(t, "7ae3ae201ec96c5a2d2b602a0146188f", fingerprint)
+	assert.NotEqual(t, fingerprint, Fingerprint("an-api-key-ending-in-c0de", "pepper"), "the fingerprint depends on the salt")
+	assert.NotEqual(t, fingerprint, Fingerprint("another-key-ending-in-c0de", "salt"))
+}
+
+func TestRecordKey(t *testing.T) {
+	assert.Equal(t, "7ae3ae201ec96c5a2d2b602a0146188f", Record{KeyFingerprint: "7ae3ae201ec96c5a2d2b602a0146188f", KeySuffix: "c0de", Identity: "subscriber.ft.com"}.Key())
+	assert.Equal(t, "subscriber.ft.com", Record{Identity: "subscriber.ft.com"}.Key())
+	assert.Equal(t, Anonymous, Record{}.Key())
+}
@@ -0,0 +1,193 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/kafka-client-go/kafka"
+)
+
+// Sink is where the audit records are written to
+type Sink interface {
+	Write(r Record) error
+	Close() error
+}
+
+// FileSink appends one JSON record per line to a file. The file is rotated once it reaches its maximum size,
+// to file.1, file.2... up to the maximum number of backups, the oldest ones are removed.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	lock       *sync.Mutex
+	file       *os.File
+	size       int64
+}
+
+// NewFileSink opens the file, records are appended to it if it exists
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups, lock: &sync.Mutex{}}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.file, s.size = f, info.Size()
+	return nil
+}
+
+// Write appends the record, rotating the file first if the record does not fit in it
+func (s *FileSink) Write(r Record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+
+	if s.maxBackups <= 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return s.open()
+	}
+
+	os.Remove(s.backup(s.maxBackups))
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(s.backup(i), s.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(s.path, s.backup(1)); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *FileSink) backup(i int) string {
+	return fmt.Sprintf("%s.%d", s.path, i)
+}
+
+// Close closes the file
+func (s *FileSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// KafkaSink sends each record as a JSON message to a Kafka topic.
+// Records are queued so that they are sent off the path of the subscribers, they are dropped when the queue is full.
+type KafkaSink struct {
+	producer kafka.Producer
+	queue    chan Record
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// NewKafkaSink returns a sink sending the records with the given producer, it must be run to send them
+func NewKafkaSink(producer kafka.Producer, queueSize int) *KafkaSink {
+	return &KafkaSink{
+		producer: producer,
+		queue:    make(chan Record, queueSize),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Write queues the record, it is dropped and counted as failed if the queue is full
+func (s *KafkaSink) Write(r Record) error {
+	select {
+	case s.queue <- r:
+	default:
+		FailedRecords.Inc(1)
+	}
+	return nil
+}
+
+// Run sends the queued records until the sink is closed
+func (s *KafkaSink) Run() {
+	defer close(s.stopped)
+	for {
+		select {
+		case r := <-s.queue:
+			s.send(r)
+		case <-s.stop:
+			for len(s.queue) > 0 {
+				s.send(<-s.queue)
+			}
+			return
+		}
+	}
+}
+
+// send sends the record, with its session as the transaction ID
+func (s *KafkaSink) send(r Record) {
+	body, err := json.Marshal(r)
+	if err == nil {
+		err = s.producer.SendMessage(kafka.FTMessage{
+			Headers: map[string]string{
+				"X-Request-Id":      "tid_audit_" + r.Session,
+				"Message-Timestamp": r.Time.UTC().Format(time.RFC3339Nano),
+				"Message-Type":      "notifications-push-audit",
+				"Content-Type":      "application/json",
+			},
+			Body: string(body),
+		})
+	}
+	if err != nil {
+		FailedRecords.Inc(1)
+		log.WithError(err).WithField("session", r.Session).WithField("event", r.Event).Warn("Failed to send audit record")
+	}
+}
+
+// Close sends the records left in the queue, stops the sink and shuts the producer down
+func (s *KafkaSink) Close() error {
+	close(s.stop)
+	<-s.stopped
+	s.producer.Shutdown()
+	return nil
+}
@@ -0,0 +1,163 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readRecords(t *testing.T, path string) []Record {
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	var records []Record
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var r Record
+		require.NoError(t, json.Unmarshal([]byte(line), &r))
+		records = append(records, r)
+	}
+	return records
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	return dir
+}
+
+func TestFileSink(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	sink, err := NewFileSink(path, 1024*1024, 3)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(Record{Event: RegisterEvent, Session: "s1", KeySuffix: "c0de", ConnectedAt: start}))
+	require.NoError(t, sink.Close())
+
+	sink, err = NewFileSink(path, 1024*1024, 3)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(Record{Event: CloseEvent, Session: "s1", KeySuffix: "c0de", ConnectedAt: start, Notifications: 3}))
+	require.NoError(t, sink.Close())
+
+	records := readRecords(t, path)
+	require.Len(t, records, 2, "records are appended to the existing file")
+	assert.Equal(t, RegisterEvent, records[0].Event)
+	assert.Equal(t, "c0de", records[0].KeySuffix)
+	assert.True(t, start.Equal(records[0].ConnectedAt))
+	assert.Equal(t, CloseEvent, records[1].Event)
+	assert.Equal(t, int64(3), records[1].Notifications)
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	line, err := json.Marshal(Record{Event: RegisterEvent, Session: "s0", ConnectedAt: start})
+	require.NoError(t, err)
+
+	// two records fit in a file
+	sink, err := NewFileSink(path, int64(2*(len(line)+1)), 2)
+	require.NoError(t, err)
+	defer sink.Close()
+	for _, session := range []string{"s0", "s1", "s2", "s3", "s4", "s5", "s6"} {
+		require.NoError(t, sink.Write(Record{Event: RegisterEvent, Session: session, ConnectedAt: start}))
+	}
+
+	sessions := func(path string) []string {
+		var ids []string
+		for _, r := range readRecords(t, path) {
+			ids = append(ids, r.Session)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"s6"}, sessions(path))
+	assert.Equal(t, []string{"s4", "s5"}, sessions(path+".1"))
+	assert.Equal(t, []string{"s2", "s3"}, sessions(path+".2"))
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err), "the oldest files are removed")
+}
+
+func TestFileSinkInvalidPath(t *testing.T) {
+	_, err := NewFileSink(filepath.Join("does", "not", "exist", "audit.log"), 1024, 1)
+	assert.Error(t, err)
+}
+
+type fakeProducer struct {
+	messages []kafka.FTMessage
+	err      error
+	shutdown bool
+}
+
+func (p *fakeProducer) SendMessage(message kafka.FTMessage) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, message)
+	return nil
+}
+
+func (p *fakeProducer) ConnectivityCheck() error {
+	return nil
+}
+
+func (p *fakeProducer) Shutdown() {
+	p.shutdown = true
+}
+
+func TestKafkaSink(t *testing.T) {
+	producer := &fakeProducer{}
+	sink := NewKafkaSink(producer, 10)
+	go sink.Run()
+
+	require.NoError(t, sink.Write(Record{Event: CloseEvent, Time: start, Session: "5e55", KeySuffix: "c0de", Reason: ClientClosed}))
+	require.NoError(t, sink.Close())
+
+	require.Len(t, producer.messages, 1)
+	msg := producer.messages[0]
+	assert.Equal(t, "tid_audit_5e55", msg.Headers["X-Request-Id"])
+	assert.Equal(t, "2017-06-01T10:00:00Z", msg.Headers["Message-Timestamp"])
+	assert.Equal(t, "application/json", msg.Headers["Content-Type"])
+
+	var r Record
+	require.NoError(t, json.Unmarshal([]byte(msg.Body), &r))
+	assert.Equal(t, "c0de", r.KeySuffix)
+	assert.Equal(t, ClientClosed, r.Reason)
+	assert.True(t, producer.shutdown)
+}
+
+func TestKafkaSinkError(t *testing.T) {
+	sink := NewKafkaSink(&fakeProducer{err: errors.New("no brokers")}, 10)
+	go sink.Run()
+	failed := FailedRecords.Count()
+
+	assert.NoError(t, sink.Write(Record{Event: RegisterEvent}))
+	require.NoError(t, sink.Close())
+	assert.Equal(t, failed+1, FailedRecords.Count())
+}
+
+func TestKafkaSinkDropsRecordsWhenTheQueueIsFull(t *testing.T) {
+	producer := &fakeProducer{}
+	sink := NewKafkaSink(producer, 2)
+	failed := FailedRecords.Count()
+
+	for _, session := range []string{"1", "2", "3"} {
+		assert.NoError(t, sink.Write(Record{Event: RegisterEvent, Session: session}))
+	}
+	assert.Equal(t, failed+1, FailedRecords.Count())
+
+	go sink.Run()
+	require.NoError(t, sink.Close())
+	require.Len(t, producer.messages, 2, "the queued records are sent on close")
+	assert.Equal(t, "tid_audit_1", producer.messages[0].Headers["X-Request-Id"])
+	assert.Equal(t, "tid_audit_2", producer.messages[1].Headers["X-Request-Id"])
+}
@@ -1,59 +1,127 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
-	"flag"
+	"context"
 	"log"
-	"net/http"
-	_ "net/http/pprof"
-	"strings"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/client"
+	"github.com/jawher/mow.cli"
 )
 
-type eventData []map[string]interface{}
+// connection holds the options shared by all commands to reach the service
+type connection struct {
+	url              *string
+	apiKey           *string
+	username         *string
+	password         *string
+	heartbeatTimeout *string
+}
 
 func main() {
-	url := flag.String("url", "https://prod-coco-up-read.ft.com/content/notifications-push", "notifications push endpoint url")
-	auth := flag.String("auth", "***", "basic authentication header")
-	flag.Parse()
+	app := cli.App("notifications-push-client", "Subscribes to the notifications push stream.")
+	conn := connection{
+		url: app.String(cli.StringOpt{
+			Name:   "url",
+			Value:  "http://localhost:8080/content/notifications-push",
+			Desc:   "The notifications push endpoint URL",
+			EnvVar: "PUSH_URL",
+		}),
+		apiKey: app.String(cli.StringOpt{
+			Name:   "api_key",
+			Value:  "",
+			Desc:   "API key sent in the X-Api-Key header",
+			EnvVar: "PUSH_API_KEY",
+		}),
+		username: app.String(cli.StringOpt{
+			Name:   "username",
+			Value:  "",
+			Desc:   "Basic authentication username",
+			EnvVar: "PUSH_USERNAME",
+		}),
+		password: app.String(cli.StringOpt{
+			Name:   "password",
+			Value:  "",
+			Desc:   "Basic authentication password",
+			EnvVar: "PUSH_PASSWORD",
+		}),
+		heartbeatTimeout: app.String(cli.StringOpt{
+			Name:   "heartbeat_timeout",
+			Value:  client.DefaultHeartbeatTimeout.String(),
+			Desc:   "Time without any data before reconnecting, i.e. 90s",
+			EnvVar: "PUSH_HEARTBEAT_TIMEOUT",
+		}),
+	}
+
+	app.Command("tail", "Prints the notifications received", func(cmd *cli.Cmd) { tail(cmd, conn) })
+	app.Command("stats", "Reports the rate, heartbeat gaps and latency of the push stream", func(cmd *cli.Cmd) { stats(cmd, conn) })
+	app.Command("history", "Prints the last notifications consumed by the service", func(cmd *cli.Cmd) { history(cmd, conn) })
+	app.Command("record", "Saves the push stream to a file", func(cmd *cli.Cmd) { record(cmd, conn) })
 
-	req, err := http.NewRequest("GET", *url, nil)
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// client returns a push stream client, the given query parameters are added to the endpoint URL
+func (c connection) client(query url.Values) *client.Client {
+	heartbeatTimeout, err := time.ParseDuration(*c.heartbeatTimeout)
 	if err != nil {
-		log.Fatalf("Creating request: [%v]", err)
+		log.Fatalf("Invalid heartbeat timeout: [%v]", err)
 	}
-	req.Header.Add("Authorization", "Basic "+*auth)
 
-	resp, err := (&http.Client{}).Do(req)
+	endpoint, err := url.Parse(*c.url)
 	if err != nil {
-		log.Fatalf("Sending request: [%v]", err)
+		log.Fatalf("Invalid URL: [%v]", err)
+	}
+	params := endpoint.Query()
+	for name, values := range query {
+		for _, value := range values {
+			params.Add(name, value)
+		}
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		log.Fatalf("Received invalid statusCode: [%v]", resp.StatusCode)
+	endpoint.RawQuery = params.Encode()
+
+	return client.NewClient(client.Config{
+		URL:              endpoint.String(),
+		APIKey:           *c.apiKey,
+		Username:         *c.username,
+		Password:         *c.password,
+		HeartbeatTimeout: heartbeatTimeout,
+		OnError:          func(err error) { log.Printf("Error: [%v]", err) },
+	})
+}
+
+// stream sends the frames of the push stream to the returned channel until the command is interrupted, the duration elapses
+// or the returned function is called. A zero duration never elapses.
+func stream(c *client.Client, duration time.Duration) (<-chan client.Frame, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if duration > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), duration)
 	}
 
-	br := bufio.NewReader(resp.Body)
-	for {
-		event, err := br.ReadString('\n')
-		if err != nil {
-			log.Printf("Error: [%v]", err)
-			continue
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
 		}
-		trimmed := strings.TrimSpace(event)
-		if trimmed == "" {
-			continue
-		}
-		data := strings.TrimPrefix(trimmed, "data: ")
-		var notification eventData
-		err = json.Unmarshal([]byte(data), &notification)
-		if err != nil {
-			log.Printf("Error: [%v]. \n", err)
-			continue
-		}
-		if len(notification) == 0 {
-			log.Println("Received 'heartbeat' event")
-			continue
+		signal.Stop(interrupt)
+	}()
+
+	frames := make(chan client.Frame)
+	go func() {
+		defer close(frames)
+		if err := c.Stream(ctx, frames); err != nil && err != ctx.Err() {
+			log.Printf("Subscribing: [%v]", err)
 		}
-		log.Printf("Received notification: [%v]", notification)
-	}
+		cancel()
+	}()
+	return frames, cancel
 }
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Financial-Times/notifications-push/dispatch"
+)
+
+// filter matches a notification field, addressed by its JSON path i.e. headers.Content-Type,
+// against an exact value or a regular expression
+type filter struct {
+	path  []string
+	value string
+	regex *regexp.Regexp
+}
+
+type filters []filter
+
+// parseFilters reads filters in the form field=value or field~regex
+func parseFilters(expressions []string) (filters, error) {
+	var result filters
+	for _, expression := range expressions {
+		i := strings.IndexAny(expression, "=~")
+		if i <= 0 {
+			return nil, fmt.Errorf("filter %q should be field=value or field~regex", expression)
+		}
+
+		f := filter{path: strings.Split(expression[:i], "."), value: expression[i+1:]}
+		if expression[i] == '~' {
+			regex, err := regexp.Compile(f.value)
+			if err != nil {
+				return nil, fmt.Errorf("filter %q has an invalid regex: %v", expression, err)
+			}
+			f.regex = regex
+		}
+		result = append(result, f)
+	}
+	return result, nil
+}
+
+// Match returns true if the notification matches all the filters
+func (fs filters) Match(n dispatch.Notification) bool {
+	if len(fs) == 0 {
+		return true
+	}
+
+	attributes, err := toAttributes(n)
+	if err != nil {
+		return false
+	}
+
+	for _, f := range fs {
+		value, found := lookup(attributes, f.path)
+		if !found {
+			return false
+		}
+		if f.regex != nil && !f.regex.MatchString(value) {
+			return false
+		}
+		if f.regex == nil && value != f.value {
+			return false
+		}
+	}
+	return true
+}
+
+func toAttributes(n dispatch.Notification) (map[string]interface{}, error) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return nil, err
+	}
+	var attributes map[string]interface{}
+	err = json.Unmarshal(data, &attributes)
+	return attributes, err
+}
+
+func lookup(attributes map[string]interface{}, path []string) (string, bool) {
+	var value interface{} = attributes
+	for _, name := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[name]; !ok {
+			return "", false
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []interface{}:
+		values := make([]string, len(v))
+		for i := range v {
+			values[i] = fmt.Sprint(v[i])
+		}
+		return strings.Join(values, ","), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/jawher/mow.cli"
+)
+
+const historyPath = "/__history"
+
+func history(cmd *cli.Cmd, conn connection) {
+	format := cmd.String(cli.StringOpt{
+		Name:  "format",
+		Value: "pretty",
+		Desc:  "Output format: pretty, json (one notification per line) or csv",
+	})
+
+	cmd.Action = func() {
+		p, err := newPrinter(*format, os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		notifications, err := fetchHistory(conn)
+		if err != nil {
+			log.Fatalf("Fetching history: [%v]", err)
+		}
+
+		now := time.Now()
+		for _, n := range notifications {
+			if err := p.Print(now, n); err != nil {
+				log.Fatalf("Printing notification: [%v]", err)
+			}
+		}
+	}
+}
+
+// fetchHistory reads the notification history from the service hosting the push endpoint
+func fetchHistory(conn connection) ([]dispatch.Notification, error) {
+	endpoint, err := url.Parse(*conn.url)
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Path = historyPath
+	endpoint.RawQuery = ""
+
+	req, err := http.NewRequest("GET", endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if *conn.apiKey != "" {
+		req.Header.Set("X-Api-Key", *conn.apiKey)
+	}
+	if *conn.username != "" {
+		req.SetBasicAuth(*conn.username, *conn.password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with status %d", endpoint, resp.StatusCode)
+	}
+
+	var notifications []dispatch.Notification
+	err = json.NewDecoder(resp.Body).Decode(&notifications)
+	return notifications, err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/dispatch"
+)
+
+// printer writes notifications in one of the output formats
+type printer interface {
+	Print(receivedAt time.Time, n dispatch.Notification) error
+}
+
+func newPrinter(format string, w io.Writer) (printer, error) {
+	switch format {
+	case "pretty":
+		return prettyPrinter{w: w}, nil
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		return jsonPrinter{encoder: encoder}, nil
+	case "csv":
+		return &csvPrinter{w: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unsupported output format %q, use pretty, json or csv", format)
+}
+
+type prettyPrinter struct {
+	w io.Writer
+}
+
+func (p prettyPrinter) Print(receivedAt time.Time, n dispatch.Notification) error {
+	line := fmt.Sprintf("%s %-6s %s %s", receivedAt.Format(time.RFC3339), changeType(n), n.ID, n.PublishReference)
+	if n.Title != "" {
+		line += fmt.Sprintf(" %q", n.Title)
+	}
+	if len(n.Flags) > 0 {
+		line += " [" + strings.Join(n.Flags, ",") + "]"
+	}
+	_, err := fmt.Fprintln(p.w, line)
+	return err
+}
+
+type jsonPrinter struct {
+	encoder *json.Encoder
+}
+
+func (p jsonPrinter) Print(receivedAt time.Time, n dispatch.Notification) error {
+	return p.encoder.Encode(n)
+}
+
+var csvHeader = []string{"receivedAt", "type", "id", "apiUrl", "publishReference", "lastModified", "title"}
+
+type csvPrinter struct {
+	w             *csv.Writer
+	headerWritten bool
+}
+
+func (p *csvPrinter) Print(receivedAt time.Time, n dispatch.Notification) error {
+	if !p.headerWritten {
+		if err := p.w.Write(csvHeader); err != nil {
+			return err
+		}
+		p.headerWritten = true
+	}
+
+	if err := p.w.Write([]string{receivedAt.Format(time.RFC3339Nano), changeType(n), n.ID, n.APIURL, n.PublishReference, n.LastModified, n.Title}); err != nil {
+		return err
+	}
+	p.w.Flush()
+	return p.w.Error()
+}
+
+// changeType returns the last segment of the notification type, i.e. UPDATE
+func changeType(n dispatch.Notification) string {
+	return n.Type[strings.LastIndex(n.Type, "/")+1:]
+}
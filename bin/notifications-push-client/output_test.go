@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var receivedAt = time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+
+var testNotification = dispatch.Notification{
+	APIURL:           "http://api.ft.com/content/7998974a-1e97-11e6-b286-cddde55ca122",
+	ID:               "http://www.ft.com/thing/7998974a-1e97-11e6-b286-cddde55ca122",
+	Type:             "http://www.ft.com/thing/ThingChangeType/UPDATE",
+	PublishReference: "tid_test",
+	LastModified:     "2017-06-01T09:59:58.5Z",
+	Title:            "Lorem & ipsum",
+	Headers:          map[string]string{"Origin-System-Id": "methode"},
+}
+
+func TestPrinters(t *testing.T) {
+	tests := map[string]string{
+		"pretty": "2017-06-01T10:00:00Z UPDATE http://www.ft.com/thing/7998974a-1e97-11e6-b286-cddde55ca122 tid_test \"Lorem & ipsum\"\n",
+		"json":   `{"apiUrl":"http://api.ft.com/content/7998974a-1e97-11e6-b286-cddde55ca122","id":"http://www.ft.com/thing/7998974a-1e97-11e6-b286-cddde55ca122","type":"http://www.ft.com/thing/ThingChangeType/UPDATE","publishReference":"tid_test","lastModified":"2017-06-01T09:59:58.5Z","title":"Lorem & ipsum","standout":{"scoop":false},"headers":{"Origin-System-Id":"methode"}}` + "\n",
+		"csv": "receivedAt,type,id,apiUrl,publishReference,lastModified,title\n" +
+			"2017-06-01T10:00:00Z,UPDATE,http://www.ft.com/thing/7998974a-1e97-11e6-b286-cddde55ca122,http://api.ft.com/content/7998974a-1e97-11e6-b286-cddde55ca122,tid_test,2017-06-01T09:59:58.5Z,Lorem & ipsum\n",
+	}
+
+	for format, expected := range tests {
+		buffer := &bytes.Buffer{}
+		p, err := newPrinter(format, buffer)
+		require.NoError(t, err)
+
+		require.NoError(t, p.Print(receivedAt, testNotification))
+		assert.Equal(t, expected, buffer.String(), "Output of the %s format", format)
+	}
+}
+
+func TestUnsupportedFormat(t *testing.T) {
+	_, err := newPrinter("xml", &bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestFilters(t *testing.T) {
+	tests := []struct {
+		expressions []string
+		matches     bool
+	}{
+		{nil, true},
+		{[]string{"publishReference=tid_test"}, true},
+		{[]string{"publishReference=tid"}, false},
+		{[]string{"publishReference~^tid_"}, true},
+		{[]string{"headers.Origin-System-Id=methode", "type~UPDATE$"}, true},
+		{[]string{"headers.Origin-System-Id=methode", "type~DELETE$"}, false},
+		{[]string{"standout.scoop=false"}, true},
+		{[]string{"missing=value"}, false},
+	}
+
+	for _, test := range tests {
+		fs, err := parseFilters(test.expressions)
+		require.NoError(t, err)
+		assert.Equal(t, test.matches, fs.Match(testNotification), "Filters %v", test.expressions)
+	}
+}
+
+func TestInvalidFilters(t *testing.T) {
+	for _, expression := range []string{"publishReference", "=value", "title~("} {
+		_, err := parseFilters([]string{expression})
+		assert.Error(t, err, "Filter %s", expression)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/client"
+	"github.com/jawher/mow.cli"
+)
+
+func record(cmd *cli.Cmd, conn connection) {
+	output := cmd.String(cli.StringOpt{
+		Name:  "output",
+		Value: "-",
+		Desc:  "File the session is saved to, - for the standard output. An existing file is never overwritten",
+	})
+	duration := cmd.String(cli.StringOpt{
+		Name:  "duration",
+		Value: "0s",
+		Desc:  "How long to record for, until interrupted by default",
+	})
+	count := cmd.Int(cli.IntOpt{
+		Name:  "count",
+		Value: 0,
+		Desc:  "Stop after recording this many notifications, unlimited by default",
+	})
+
+	cmd.Action = func() {
+		sessionDuration, err := time.ParseDuration(*duration)
+		if err != nil {
+			log.Fatalf("Invalid duration: [%v]", err)
+		}
+
+		recorded, err := recordSession(conn.client(url.Values{}), *output, sessionDuration, *count)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Recorded %d notifications", recorded)
+	}
+}
+
+// recordSession saves the push stream to the output file, which must not exist yet, or to the standard output.
+// It returns the number of notifications recorded.
+func recordSession(c *client.Client, output string, sessionDuration time.Duration, count int) (int, error) {
+	var w io.Writer = os.Stdout
+	if output != "-" {
+		f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return 0, fmt.Errorf("creating output file: [%v]", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	frames, cancel := stream(c, sessionDuration)
+	defer cancel()
+
+	recorded := 0
+	for frame := range frames {
+		if err := writeEvent(w, frame.Event); err != nil {
+			return recorded, fmt.Errorf("recording event: [%v]", err)
+		}
+		recorded += len(frame.Notifications)
+		if count > 0 && recorded >= count {
+			break
+		}
+	}
+	return recorded, nil
+}
+
+// writeEvent writes an event in the format of the push stream
+func writeEvent(w io.Writer, event client.Event) error {
+	buffer := bufio.NewWriter(w)
+	if event.ID != "" {
+		fmt.Fprintf(buffer, "id: %s\n", event.ID)
+	}
+	if event.Type != "" {
+		fmt.Fprintf(buffer, "event: %s\n", event.Type)
+	}
+	for _, line := range strings.Split(event.Data, "\n") {
+		fmt.Fprintf(buffer, "data: %s\n", line)
+	}
+	buffer.WriteString("\n")
+	return buffer.Flush()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordSession(t *testing.T) {
+	server := pushServer(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "notifications-push-client")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "session.sample")
+
+	start := time.Now()
+	recorded, err := recordSession(testConnection(server.URL).client(nil), output, time.Minute, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, recorded)
+	assert.True(t, time.Since(start) < 10*time.Second, "The session ends once the count is reached")
+
+	data, err := ioutil.ReadFile(output)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"id":"http://www.ft.com/thing/`)
+}
+
+func TestRecordSessionDoesNotOverwrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notifications-push-client")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, "response.sample")
+	require.NoError(t, ioutil.WriteFile(output, []byte("fixture"), 0644))
+
+	_, err = recordSession(testConnection("http://localhost:0").client(nil), output, time.Minute, 1)
+	assert.Error(t, err)
+
+	data, err := ioutil.ReadFile(output)
+	require.NoError(t, err)
+	assert.Equal(t, "fixture", string(data), "An existing file is left untouched")
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/client"
+	"github.com/jawher/mow.cli"
+)
+
+func stats(cmd *cli.Cmd, conn connection) {
+	interval := cmd.String(cli.StringOpt{
+		Name:  "interval",
+		Value: "10s",
+		Desc:  "How often the statistics are reported",
+	})
+	duration := cmd.String(cli.StringOpt{
+		Name:  "duration",
+		Value: "0s",
+		Desc:  "How long to collect statistics for, until interrupted by default",
+	})
+
+	cmd.Action = func() {
+		reportInterval, err := time.ParseDuration(*interval)
+		if err != nil || reportInterval <= 0 {
+			log.Fatalf("Invalid interval: [%v]", *interval)
+		}
+		sessionDuration, err := time.ParseDuration(*duration)
+		if err != nil {
+			log.Fatalf("Invalid duration: [%v]", err)
+		}
+
+		runStats(conn.client(statsQuery), reportInterval, sessionDuration, os.Stdout)
+	}
+}
+
+// statsQuery subscribes as a monitor, standard subscribers do not receive the lastModified the latency is measured from
+var statsQuery = url.Values{"monitor": {"true"}}
+
+// runStats reports the statistics of the push stream every interval, and once the stream ends
+func runStats(c *client.Client, reportInterval time.Duration, sessionDuration time.Duration, out io.Writer) {
+	ticker := time.NewTicker(reportInterval)
+	defer ticker.Stop()
+
+	s := newSessionStats(time.Now())
+	frames, cancel := stream(c, sessionDuration)
+	defer cancel()
+	for {
+		select {
+		case frame, ok := <-frames:
+			if !ok {
+				fmt.Fprintln(out, s.Report(time.Now()))
+				return
+			}
+			s.Add(frame)
+		case now := <-ticker.C:
+			fmt.Fprintln(out, s.Report(now))
+		}
+	}
+}
+
+// sessionStats collects statistics of the frames received from the push stream
+type sessionStats struct {
+	start           time.Time
+	notifications   int
+	heartbeats      int
+	lastHeartbeat   time.Time
+	maxHeartbeatGap time.Duration
+	latencies       int
+	totalLatency    time.Duration
+	maxLatency      time.Duration
+}
+
+func newSessionStats(start time.Time) *sessionStats {
+	return &sessionStats{start: start}
+}
+
+// Add records a frame received. The latency of a notification is the time between its last modification and its reception.
+func (s *sessionStats) Add(frame client.Frame) {
+	if frame.Heartbeat {
+		if !s.lastHeartbeat.IsZero() {
+			if gap := frame.ReceivedAt.Sub(s.lastHeartbeat); gap > s.maxHeartbeatGap {
+				s.maxHeartbeatGap = gap
+			}
+		}
+		s.heartbeats++
+		s.lastHeartbeat = frame.ReceivedAt
+	}
+
+	for _, n := range frame.Notifications {
+		s.notifications++
+
+		lastModified, err := time.Parse(time.RFC3339Nano, n.LastModified)
+		if err != nil {
+			continue
+		}
+		latency := frame.ReceivedAt.Sub(lastModified)
+		s.latencies++
+		s.totalLatency += latency
+		if latency > s.maxLatency {
+			s.maxLatency = latency
+		}
+	}
+}
+
+// Report summarises the statistics collected until the given time
+func (s *sessionStats) Report(now time.Time) string {
+	elapsed := now.Sub(s.start)
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(s.notifications) / elapsed.Minutes()
+	}
+
+	report := fmt.Sprintf("elapsed=%s notifications=%d rate=%.2f/min heartbeats=%d maxHeartbeatGap=%s",
+		truncate(elapsed, time.Second), s.notifications, rate, s.heartbeats, truncate(s.maxHeartbeatGap, time.Millisecond))
+	if s.latencies > 0 {
+		report += fmt.Sprintf(" meanLatency=%s maxLatency=%s",
+			truncate(s.totalLatency/time.Duration(s.latencies), time.Millisecond), truncate(s.maxLatency, time.Millisecond))
+	} else if s.notifications > 0 {
+		report += " latency=unavailable (the notifications have no lastModified, is the stream a monitor one?)"
+	}
+	return report
+}
+
+func truncate(d time.Duration, unit time.Duration) time.Duration {
+	return d / unit * unit
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/client"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionStats(t *testing.T) {
+	s := newSessionStats(receivedAt)
+
+	s.Add(client.Frame{Heartbeat: true, ReceivedAt: receivedAt.Add(30 * time.Second)})
+	s.Add(client.Frame{Notifications: []dispatch.Notification{testNotification}, ReceivedAt: receivedAt.Add(40 * time.Second)})
+	s.Add(client.Frame{Heartbeat: true, ReceivedAt: receivedAt.Add(75 * time.Second)})
+	s.Add(client.Frame{Heartbeat: true, ReceivedAt: receivedAt.Add(105 * time.Second)})
+
+	assert.Equal(t, "elapsed=2m0s notifications=1 rate=0.50/min heartbeats=3 maxHeartbeatGap=45s meanLatency=41.5s maxLatency=41.5s",
+		s.Report(receivedAt.Add(2*time.Minute)))
+}
+
+// pushServer sends a notification modified a second ago, stripped of its lastModified unless the subscriber is a monitor
+func pushServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := testNotification
+		n.LastModified = time.Now().Add(-time.Second).Format(time.RFC3339Nano)
+		if r.URL.Query().Get("monitor") != "true" {
+			n.LastModified = ""
+		}
+		data, err := json.Marshal([]dispatch.Notification{n})
+		require.NoError(t, err)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: []\n\ndata: " + string(data) + "\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+}
+
+func testConnection(url string) connection {
+	empty, heartbeatTimeout := "", "1m"
+	return connection{url: &url, apiKey: &empty, username: &empty, password: &empty, heartbeatTimeout: &heartbeatTimeout}
+}
+
+func TestStatsMeasuresLatency(t *testing.T) {
+	server := pushServer(t)
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	runStats(testConnection(server.URL).client(statsQuery), time.Hour, 500*time.Millisecond, out)
+
+	assert.Contains(t, out.String(), "notifications=1 ")
+	assert.Contains(t, out.String(), " meanLatency=1")
+	assert.NotContains(t, out.String(), "latency=unavailable")
+}
+
+func TestStatsWithoutLatency(t *testing.T) {
+	server := pushServer(t)
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	runStats(testConnection(server.URL).client(url.Values{}), time.Hour, 500*time.Millisecond, out)
+
+	assert.Contains(t, out.String(), "notifications=1 ")
+	assert.Contains(t, out.String(), " latency=unavailable")
+	assert.NotContains(t, out.String(), "meanLatency")
+}
+
+func TestWriteEvent(t *testing.T) {
+	buffer := &bytes.Buffer{}
+
+	require.NoError(t, writeEvent(buffer, client.Event{Data: "[]"}))
+	require.NoError(t, writeEvent(buffer, client.Event{ID: "1", Type: "notification", Data: "[{},\n{}]"}))
+
+	assert.Equal(t, "data: []\n\nid: 1\nevent: notification\ndata: [{},\ndata: {}]\n\n", buffer.String())
+}
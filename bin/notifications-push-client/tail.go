@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"os"
+
+	"github.com/jawher/mow.cli"
+)
+
+func tail(cmd *cli.Cmd, conn connection) {
+	format := cmd.String(cli.StringOpt{
+		Name:  "format",
+		Value: "pretty",
+		Desc:  "Output format: pretty, json (one notification per line) or csv",
+	})
+	contentType := cmd.String(cli.StringOpt{
+		Name:  "type",
+		Value: "",
+		Desc:  "Content type of the notifications, i.e. Article, ContentPackage or All",
+	})
+	filterExpressions := cmd.Strings(cli.StringsOpt{
+		Name:  "filter",
+		Value: []string{},
+		Desc:  "Only print notifications whose field matches, i.e. publishReference~^tid_ (regex) or headers.Origin-System-Id=methode (exact)",
+	})
+	heartbeats := cmd.Bool(cli.BoolOpt{
+		Name:  "heartbeats",
+		Value: false,
+		Desc:  "Log the heartbeats received",
+	})
+
+	cmd.Action = func() {
+		filters, err := parseFilters(*filterExpressions)
+		if err != nil {
+			log.Fatalf("Invalid filter: [%v]", err)
+		}
+		p, err := newPrinter(*format, os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		query := url.Values{}
+		if *contentType != "" {
+			query.Set("type", *contentType)
+		}
+
+		frames, cancel := stream(conn.client(query), 0)
+		defer cancel()
+		for frame := range frames {
+			if frame.Heartbeat && *heartbeats {
+				log.Println("Received 'heartbeat' event")
+			}
+			for _, n := range frame.Notifications {
+				if !filters.Match(n) {
+					continue
+				}
+				if err := p.Print(frame.ReceivedAt, n); err != nil {
+					log.Fatalf("Printing notification: [%v]", err)
+				}
+			}
+		}
+	}
+}
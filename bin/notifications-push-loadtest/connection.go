@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/client"
+)
+
+// connection is a single simulated subscriber and the statistics of its push stream
+type connection struct {
+	id              int
+	contentType     string
+	heartbeatPeriod time.Duration
+	client          *client.Client
+	// injected are the injection times of the expected notifications, by ID
+	injected map[string]time.Time
+
+	lock            *sync.Mutex
+	connected       bool
+	connects        int
+	connectFailures int
+	disconnects     int
+	lastHeartbeat   time.Time
+	heartbeats      int
+	jitters         []time.Duration
+	latencies       []time.Duration
+	received        map[string]bool
+}
+
+func newConnection(id int, endpoint string, apiKey string, contentType string, heartbeatPeriod time.Duration, injected map[string]time.Time) *connection {
+	c := &connection{
+		id:              id,
+		contentType:     contentType,
+		heartbeatPeriod: heartbeatPeriod,
+		injected:        injected,
+		lock:            &sync.Mutex{},
+		received:        make(map[string]bool),
+	}
+	c.client = client.NewClient(client.Config{
+		URL:              endpoint,
+		APIKey:           apiKey,
+		HeartbeatTimeout: 2 * heartbeatPeriod,
+		OnConnect:        c.onConnect,
+		OnError:          c.onError,
+	})
+	return c
+}
+
+func (c *connection) run(ctx context.Context) {
+	frames := make(chan client.Frame)
+	go func() {
+		c.client.Stream(ctx, frames)
+		close(frames)
+	}()
+
+	for frame := range frames {
+		c.add(frame)
+	}
+}
+
+func (c *connection) onConnect() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.connected = true
+	c.connects++
+	// heartbeat gaps are only measured within a connection
+	c.lastHeartbeat = time.Time{}
+}
+
+func (c *connection) onError(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.connected {
+		c.disconnects++
+	} else {
+		c.connectFailures++
+	}
+	c.connected = false
+}
+
+func (c *connection) add(frame client.Frame) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if frame.Heartbeat {
+		c.heartbeats++
+		if !c.lastHeartbeat.IsZero() {
+			jitter := frame.ReceivedAt.Sub(c.lastHeartbeat) - c.heartbeatPeriod
+			if jitter < 0 {
+				jitter = -jitter
+			}
+			c.jitters = append(c.jitters, jitter)
+		}
+		c.lastHeartbeat = frame.ReceivedAt
+	}
+
+	for _, n := range frame.Notifications {
+		c.received[n.ID] = true
+		if injectedAt, found := c.injectedAt(n.ID); found {
+			c.latencies = append(c.latencies, frame.ReceivedAt.Sub(injectedAt))
+		} else if lastModified, err := time.Parse(time.RFC3339Nano, n.LastModified); err == nil {
+			// only monitor subscribers get the last modified date
+			c.latencies = append(c.latencies, frame.ReceivedAt.Sub(lastModified))
+		}
+	}
+}
+
+// missing returns the expected notifications which should have been delivered to this connection but were not
+func (c *connection) missing(expected []expectedNotification) []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var missing []string
+	for _, e := range expected {
+		if !e.deliveredTo(c.contentType) {
+			continue
+		}
+		if !c.receivedID(e.id) {
+			missing = append(missing, e.id)
+		}
+	}
+	return missing
+}
+
+// injectedAt looks the received ID up in the injected notifications, by its UUID too
+func (c *connection) injectedAt(id string) (time.Time, bool) {
+	if t, found := c.injected[id]; found {
+		return t, true
+	}
+	t, found := c.injected[id[strings.LastIndex(id, "/")+1:]]
+	return t, found
+}
+
+// receivedID matches the expected ID against the end of the received IDs, so that UUIDs can be expected
+func (c *connection) receivedID(id string) bool {
+	if c.received[id] {
+		return true
+	}
+	for received := range c.received {
+		if len(received) > len(id) && received[len(received)-len(id):] == id && received[len(received)-len(id)-1] == '/' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnection(t *testing.T) {
+	lastModified := time.Now().Add(-time.Second).UTC().Format(time.RFC3339Nano)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "type=Article&monitor=true", r.URL.RawQuery)
+		fmt.Fprint(w, "data: []\n\n")
+		fmt.Fprintf(w, "data: [{\"id\":\"http://www.ft.com/thing/7998974a-1e97-11e6-b286-cddde55ca122\",\"lastModified\":%q}]\n\n", lastModified)
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		fmt.Fprint(w, "data: []\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	c := newConnection(1, server.URL+"?type=Article&monitor=true", "", "Article", 150*time.Millisecond, nil)
+	c.run(ctx)
+
+	assert.Equal(t, 1, c.connects)
+	assert.Equal(t, 0, c.disconnects)
+	assert.Equal(t, 2, c.heartbeats)
+	assert.Len(t, c.jitters, 1)
+	assert.True(t, c.jitters[0] > 80*time.Millisecond && c.jitters[0] <= 100*time.Millisecond, "Heartbeat jitter %v should be measured against the period", c.jitters[0])
+	assert.Len(t, c.latencies, 1)
+	assert.True(t, c.latencies[0] >= time.Second, "Latency should be measured from the last modified date")
+
+	missing := c.missing([]expectedNotification{
+		{id: "7998974a-1e97-11e6-b286-cddde55ca122"},
+		{id: "5056c256-225e-11e6-9d4d-c11776a5124d", contentType: "Article"},
+		{id: "9752e1f2-2269-11e6-aa98-db1e01fabc0c", contentType: "ContentPackage"},
+	})
+	assert.Equal(t, []string{"5056c256-225e-11e6-9d4d-c11776a5124d"}, missing)
+
+	r := newReport([]*connection{c}, nil, time.Second)
+	assert.True(t, strings.Contains(r.String(true), "connection=1 type=\"Article\" connects=1"), r.String(true))
+	assert.True(t, strings.Contains(r.String(false), "(1 samples), monitor connections only"), r.String(false))
+}
+
+func TestConnectionLatencyFromInjectionTime(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "", r.URL.RawQuery, "The connection should be a standard one")
+		fmt.Fprint(w, "data: [{\"id\":\"http://www.ft.com/thing/7998974a-1e97-11e6-b286-cddde55ca122\"}]\n\n")
+		fmt.Fprint(w, "data: [{\"id\":\"http://www.ft.com/thing/5056c256-225e-11e6-9d4d-c11776a5124d\"}]\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	expected := []expectedNotification{{id: "7998974a-1e97-11e6-b286-cddde55ca122", injectedAt: time.Now().Add(-2 * time.Second)}}
+	c := newConnection(1, server.URL, "", "", time.Minute, injectionTimes(expected))
+	c.run(ctx)
+
+	assert.Len(t, c.received, 2)
+	require.Len(t, c.latencies, 1, "Only the injected notification has a known latency")
+	assert.True(t, c.latencies[0] >= 2*time.Second && c.latencies[0] < 3*time.Second, "Latency %v should be measured from the injection time", c.latencies[0])
+
+	r := newReport([]*connection{c}, expected, time.Second)
+	assert.True(t, strings.Contains(r.String(false), "(1 samples)\n"), r.String(false))
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// expectedNotification is a notification injected during the test, i.e. by publishing to the queue
+type expectedNotification struct {
+	id          string
+	contentType string
+	// injectedAt is when the notification was injected, the latency of the notification is measured from it if set
+	injectedAt time.Time
+}
+
+// deliveredTo checks if the notification should be delivered to subscribers of the given content type.
+// Subscribers of All and of the service default get every notification of an unspecified type.
+func (e expectedNotification) deliveredTo(contentType string) bool {
+	return e.contentType == "" || contentType == "All" || contentType == e.contentType || (contentType == "" && e.contentType == "Article")
+}
+
+// injectionTimes returns the injection time of the expected notifications which have one, by ID
+func injectionTimes(expected []expectedNotification) map[string]time.Time {
+	injected := make(map[string]time.Time)
+	for _, e := range expected {
+		if !e.injectedAt.IsZero() {
+			injected[e.id] = e.injectedAt
+		}
+	}
+	return injected
+}
+
+// readExpected reads one `id[,type[,injectedAt]]` per line, injectedAt being RFC3339, empty lines and lines starting with # are ignored
+func readExpected(path string) ([]expectedNotification, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var expected []expectedNotification
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, ",", 3)
+		e := expectedNotification{id: strings.TrimSpace(fields[0])}
+		if len(fields) > 1 {
+			e.contentType = strings.TrimSpace(fields[1])
+		}
+		if len(fields) > 2 && strings.TrimSpace(fields[2]) != "" {
+			var err error
+			if e.injectedAt, err = time.Parse(time.RFC3339Nano, strings.TrimSpace(fields[2])); err != nil {
+				return nil, fmt.Errorf("the injection time of %s is not a RFC3339 time: %v", e.id, err)
+			}
+		}
+		expected = append(expected, e)
+	}
+	return expected, scanner.Err()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jawher/mow.cli"
+)
+
+func main() {
+	app := cli.App("notifications-push-loadtest", "Opens many concurrent push streams and reports how they are served.")
+	pushURL := app.String(cli.StringOpt{
+		Name:   "url",
+		Value:  "http://localhost:8080/content/notifications-push",
+		Desc:   "The notifications push endpoint URL",
+		EnvVar: "PUSH_URL",
+	})
+	apiKey := app.String(cli.StringOpt{
+		Name:   "api_key",
+		Value:  "",
+		Desc:   "API key sent in the X-Api-Key header",
+		EnvVar: "PUSH_API_KEY",
+	})
+	connections := app.Int(cli.IntOpt{
+		Name:   "connections",
+		Value:  100,
+		Desc:   "Number of concurrent push streams",
+		EnvVar: "CONNECTIONS",
+	})
+	rampUp := app.String(cli.StringOpt{
+		Name:   "ramp_up",
+		Value:  "10s",
+		Desc:   "Time over which the connections are opened",
+		EnvVar: "RAMP_UP",
+	})
+	duration := app.String(cli.StringOpt{
+		Name:   "duration",
+		Value:  "5m",
+		Desc:   "How long the streams are kept open, ramp up included",
+		EnvVar: "DURATION",
+	})
+	types := app.Strings(cli.StringsOpt{
+		Name:   "types",
+		Value:  []string{},
+		Desc:   "Content types assigned round robin to the connections, i.e. Article,ContentPackage,All. The service default is used if empty.",
+		EnvVar: "TYPES",
+	})
+	monitorPercentage := app.Int(cli.IntOpt{
+		Name:   "monitor_percentage",
+		Value:  0,
+		Desc:   "Percentage of connections subscribing as monitors",
+		EnvVar: "MONITOR_PERCENTAGE",
+	})
+	heartbeatPeriod := app.String(cli.StringOpt{
+		Name:   "heartbeat_period",
+		Value:  "30s",
+		Desc:   "The heartbeat period of the service, heartbeat jitter is measured against it",
+		EnvVar: "HEARTBEAT_PERIOD",
+	})
+	expectedFile := app.String(cli.StringOpt{
+		Name:   "expected",
+		Value:  "",
+		Desc:   "File of the notifications injected during the test, one `id[,type[,injectedAt]]` per line. Every connection is checked for missing notifications, and the latency measured from the injection time.",
+		EnvVar: "EXPECTED",
+	})
+	verbose := app.Bool(cli.BoolOpt{
+		Name:   "verbose",
+		Value:  false,
+		Desc:   "Report the statistics of every connection",
+		EnvVar: "VERBOSE",
+	})
+
+	app.Action = func() {
+		rampUpDuration := mustParseDuration("ramp_up", *rampUp)
+		testDuration := mustParseDuration("duration", *duration)
+		period := mustParseDuration("heartbeat_period", *heartbeatPeriod)
+		if *connections <= 0 {
+			log.Fatalf("The number of connections (%d) must be positive", *connections)
+		}
+
+		var expected []expectedNotification
+		if *expectedFile != "" {
+			var err error
+			if expected, err = readExpected(*expectedFile); err != nil {
+				log.Fatalf("Reading expected notifications: [%v]", err)
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), testDuration)
+		defer cancel()
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-interrupt
+			cancel()
+		}()
+
+		injected := injectionTimes(expected)
+		forceMonitor := len(injected) == 0 && *monitorPercentage <= 0
+		if forceMonitor {
+			log.Print("No injection time is expected, subscribing one connection as a monitor to measure the latency from the last modified dates")
+		}
+
+		conns := make([]*connection, *connections)
+		for i := range conns {
+			query := url.Values{}
+			if len(*types) > 0 {
+				query.Set("type", (*types)[i%len(*types)])
+			}
+			if (i*100)/(*connections) < *monitorPercentage || (forceMonitor && i == 0) {
+				query.Set("monitor", "true")
+			}
+			conns[i] = newConnection(i, withQuery(*pushURL, query), *apiKey, query.Get("type"), period, injected)
+		}
+
+		log.Printf("Opening %d connections over %v", len(conns), rampUpDuration)
+		start := time.Now()
+		wg := &sync.WaitGroup{}
+		for i, c := range conns {
+			delay := rampUpDuration * time.Duration(i) / time.Duration(len(conns))
+			wg.Add(1)
+			go func(c *connection) {
+				defer wg.Done()
+				select {
+				case <-time.After(delay):
+					c.run(ctx)
+				case <-ctx.Done():
+				}
+			}(c)
+		}
+		wg.Wait()
+
+		r := newReport(conns, expected, time.Since(start))
+		fmt.Print(r.String(*verbose))
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func mustParseDuration(name string, value string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s: [%v]", name, err)
+	}
+	return d
+}
+
+func withQuery(endpoint string, query url.Values) string {
+	if len(query) == 0 {
+		return endpoint
+	}
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + query.Encode()
+	}
+	return endpoint + "?" + query.Encode()
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// report aggregates the statistics of all the connections of a test
+type report struct {
+	elapsed          time.Duration
+	connections      int
+	neverConnected   int
+	connectFailures  int
+	disconnects      int
+	heartbeats       int
+	notifications    int
+	latencies        []time.Duration
+	monitorLatency   bool
+	jitters          []time.Duration
+	expected         int
+	missing          int
+	incomplete       int
+	connectionReport []string
+}
+
+func newReport(conns []*connection, expected []expectedNotification, elapsed time.Duration) report {
+	// without injection times the latency is only measured on the monitor connections, from the last modified dates
+	r := report{elapsed: elapsed, connections: len(conns), expected: len(expected), monitorLatency: len(injectionTimes(expected)) == 0}
+	for _, c := range conns {
+		missing := c.missing(expected)
+
+		c.lock.Lock()
+		if c.connects == 0 {
+			r.neverConnected++
+		}
+		r.connectFailures += c.connectFailures
+		r.disconnects += c.disconnects
+		r.heartbeats += c.heartbeats
+		r.notifications += len(c.received)
+		r.latencies = append(r.latencies, c.latencies...)
+		r.jitters = append(r.jitters, c.jitters...)
+		r.connectionReport = append(r.connectionReport, fmt.Sprintf("connection=%d type=%q connects=%d disconnects=%d heartbeats=%d notifications=%d missing=%d maxJitter=%v",
+			c.id, c.contentType, c.connects, c.disconnects, c.heartbeats, len(c.received), len(missing), percentile(c.jitters, 100)))
+		c.lock.Unlock()
+
+		r.missing += len(missing)
+		if len(missing) > 0 {
+			r.incomplete++
+		}
+	}
+	return r
+}
+
+func (r report) String(verbose bool) string {
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, "Elapsed:          %v\n", r.elapsed)
+	fmt.Fprintf(buffer, "Connections:      %d (%d never connected)\n", r.connections, r.neverConnected)
+	fmt.Fprintf(buffer, "Connect failures: %d\n", r.connectFailures)
+	fmt.Fprintf(buffer, "Disconnects:      %d\n", r.disconnects)
+	fmt.Fprintf(buffer, "Heartbeats:       %d\n", r.heartbeats)
+	fmt.Fprintf(buffer, "Notifications:    %d\n", r.notifications)
+	if r.monitorLatency {
+		fmt.Fprintf(buffer, "Latency:          %s, monitor connections only\n", percentiles(r.latencies))
+	} else {
+		fmt.Fprintf(buffer, "Latency:          %s\n", percentiles(r.latencies))
+	}
+	fmt.Fprintf(buffer, "Heartbeat jitter: %s\n", percentiles(r.jitters))
+	if r.expected > 0 {
+		fmt.Fprintf(buffer, "Missing:          %d notifications of %d expected, %d connections incomplete\n", r.missing, r.expected, r.incomplete)
+	}
+	if verbose {
+		for _, line := range r.connectionReport {
+			fmt.Fprintln(buffer, line)
+		}
+	}
+	return buffer.String()
+}
+
+func percentiles(values []time.Duration) string {
+	if len(values) == 0 {
+		return "n/a"
+	}
+
+	sorted := sortDurations(values)
+	return fmt.Sprintf("p50=%v p90=%v p99=%v max=%v (%d samples)",
+		nearestRank(sorted, 50), nearestRank(sorted, 90), nearestRank(sorted, 99), nearestRank(sorted, 100), len(values))
+}
+
+// percentile returns the nearest-rank percentile of the given values
+func percentile(values []time.Duration, p int) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	return nearestRank(sortDurations(values), p)
+}
+
+func sortDurations(values []time.Duration) []time.Duration {
+	sorted := make([]time.Duration, len(values))
+	copy(sorted, values)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+func nearestRank(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
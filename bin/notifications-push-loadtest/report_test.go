@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	var values []time.Duration
+	for i := 100; i > 0; i-- {
+		values = append(values, time.Duration(i)*time.Millisecond)
+	}
+
+	assert.Equal(t, 50*time.Millisecond, percentile(values, 50))
+	assert.Equal(t, 99*time.Millisecond, percentile(values, 99))
+	assert.Equal(t, 100*time.Millisecond, percentile(values, 100))
+	assert.Equal(t, time.Millisecond, percentile(values, 0))
+	assert.Equal(t, time.Duration(0), percentile(nil, 50))
+	assert.Equal(t, 100*time.Millisecond, values[0], "The values should not be sorted in place")
+}
+
+func TestPercentiles(t *testing.T) {
+	assert.Equal(t, "n/a", percentiles(nil))
+	assert.Equal(t, "p50=1s p90=2s p99=2s max=2s (2 samples)", percentiles([]time.Duration{2 * time.Second, time.Second}))
+}
+
+func TestReadExpected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notifications-push-loadtest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "expected")
+	require.NoError(t, ioutil.WriteFile(path, []byte("# injected\n7998974a-1e97-11e6-b286-cddde55ca122\n\n5056c256-225e-11e6-9d4d-c11776a5124d, ContentPackage\n9752e1f2-2269-11e6-aa98-db1e01fabc0c,,2017-06-01T10:00:00Z\n"), 0644))
+
+	expected, err := readExpected(path)
+	require.NoError(t, err)
+	assert.Equal(t, []expectedNotification{
+		{id: "7998974a-1e97-11e6-b286-cddde55ca122"},
+		{id: "5056c256-225e-11e6-9d4d-c11776a5124d", contentType: "ContentPackage"},
+		{id: "9752e1f2-2269-11e6-aa98-db1e01fabc0c", injectedAt: time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)},
+	}, expected)
+	assert.Equal(t, map[string]time.Time{"9752e1f2-2269-11e6-aa98-db1e01fabc0c": time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)}, injectionTimes(expected))
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("7998974a-1e97-11e6-b286-cddde55ca122,Article,yesterday\n"), 0644))
+	_, err = readExpected(path)
+	assert.Error(t, err)
+}
+
+func TestDeliveredTo(t *testing.T) {
+	article := expectedNotification{id: "1", contentType: "Article"}
+	assert.True(t, article.deliveredTo(""), "Article is the default content type")
+	assert.True(t, article.deliveredTo("All"))
+	assert.True(t, article.deliveredTo("Article"))
+	assert.False(t, article.deliveredTo("ContentPackage"))
+	assert.True(t, expectedNotification{id: "2"}.deliveredTo("ContentPackage"))
+}
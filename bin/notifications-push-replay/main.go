@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jawher/mow.cli"
+)
+
+func main() {
+	app := cli.App("notifications-push-replay", "Replays recorded Kafka messages into a notifications-push instance started with INGEST_ENABLED.")
+	ingestURL := app.String(cli.StringOpt{
+		Name:   "url",
+		Value:  "http://localhost:8080/__ingest",
+		Desc:   "The ingest endpoint URL",
+		EnvVar: "INGEST_URL",
+	})
+	rate := app.Int(cli.IntOpt{
+		Name:   "rate",
+		Value:  10,
+		Desc:   "Messages replayed per second, unless the original timing is used",
+		EnvVar: "RATE",
+	})
+	originalTiming := app.Bool(cli.BoolOpt{
+		Name:   "original_timing",
+		Value:  false,
+		Desc:   "Replay the messages with the intervals between their Message-Timestamp headers",
+		EnvVar: "ORIGINAL_TIMING",
+	})
+	speed := app.Int(cli.IntOpt{
+		Name:   "speed",
+		Value:  1,
+		Desc:   "How many times faster than the original timing the messages are replayed",
+		EnvVar: "SPEED",
+	})
+	file := app.StringArg("FILE", "", "JSON lines file of the recorded messages, i.e. {\"headers\":{\"X-Request-Id\":\"tid_test\"},\"body\":\"...\"}")
+
+	app.Action = func() {
+		if *rate <= 0 || *speed <= 0 {
+			log.Fatal("The rate and the speed must be positive")
+		}
+
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatalf("Opening recording: [%v]", err)
+		}
+		defer f.Close()
+
+		messages, err := readMessages(f)
+		if err != nil {
+			log.Fatalf("Reading recording: [%v]", err)
+		}
+
+		var schedule []time.Duration
+		if *originalTiming {
+			schedule = originalSchedule(messages, *speed)
+		} else {
+			schedule = rateSchedule(len(messages), *rate)
+		}
+
+		r := replayer{url: *ingestURL, httpClient: &http.Client{Timeout: 10 * time.Second}}
+		accepted, rejected := r.replay(messages, schedule)
+		log.Printf("Replayed %d messages: %d accepted, %d rejected", len(messages), accepted, rejected)
+		if rejected > 0 {
+			os.Exit(1)
+		}
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
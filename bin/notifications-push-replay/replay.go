@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/Financial-Times/notifications-push/consumer"
+)
+
+const maxMessageSize = 16 * 1024 * 1024
+
+// readMessages reads one Kafka message per line, empty lines are ignored
+func readMessages(r io.Reader) ([]kafka.FTMessage, error) {
+	var messages []kafka.FTMessage
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var msg kafka.FTMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, scanner.Err()
+}
+
+// rateSchedule returns the time to wait before each message to replay them at the given rate per second
+func rateSchedule(count int, rate int) []time.Duration {
+	schedule := make([]time.Duration, count)
+	for i := 1; i < count; i++ {
+		schedule[i] = time.Second / time.Duration(rate)
+	}
+	return schedule
+}
+
+// originalSchedule returns the time to wait before each message to reproduce the intervals between
+// their Message-Timestamp headers, sped up by the given factor. Messages without a valid timestamp,
+// or older than the previous one, are replayed straight away.
+func originalSchedule(messages []kafka.FTMessage, speed int) []time.Duration {
+	schedule := make([]time.Duration, len(messages))
+
+	var previous time.Time
+	for i, msg := range messages {
+		timestamp, ok := consumer.NotificationQueueMessage{FTMessage: msg}.Timestamp()
+		if !ok {
+			continue
+		}
+		if !previous.IsZero() && timestamp.After(previous) {
+			schedule[i] = timestamp.Sub(previous) / time.Duration(speed)
+		}
+		if timestamp.After(previous) {
+			previous = timestamp
+		}
+	}
+	return schedule
+}
+
+// replayer posts messages to the ingest endpoint of the service
+type replayer struct {
+	url        string
+	httpClient *http.Client
+	sleep      func(d time.Duration)
+}
+
+// replay posts the messages, waiting the scheduled time before each one
+func (r replayer) replay(messages []kafka.FTMessage, schedule []time.Duration) (accepted int, rejected int) {
+	sleep := r.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	for i, msg := range messages {
+		sleep(schedule[i])
+		if err := r.post(msg); err != nil {
+			log.Printf("Message %d (%s) rejected: [%v]", i+1, msg.Headers["X-Request-Id"], err)
+			rejected++
+			continue
+		}
+		accepted++
+	}
+	return accepted, rejected
+}
+
+func (r replayer) post(msg kafka.FTMessage) error {
+	body, err := json.Marshal(map[string]interface{}{"headers": msg.Headers, "body": msg.Body})
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.httpClient.Post(r.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		reason, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(reason)))
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMessages(t *testing.T) {
+	recording := `{"headers":{"X-Request-Id":"tid_1"},"body":"{}"}
+
+{"Headers":{"X-Request-Id":"tid_2"},"Body":"{\"ContentURI\":\"http://test\"}"}
+`
+	messages, err := readMessages(strings.NewReader(recording))
+	require.NoError(t, err)
+	assert.Equal(t, []kafka.FTMessage{
+		{Headers: map[string]string{"X-Request-Id": "tid_1"}, Body: "{}"},
+		{Headers: map[string]string{"X-Request-Id": "tid_2"}, Body: `{"ContentURI":"http://test"}`},
+	}, messages)
+
+	_, err = readMessages(strings.NewReader("{}\n{"))
+	assert.EqualError(t, err, "line 2: unexpected end of JSON input")
+}
+
+func TestRateSchedule(t *testing.T) {
+	assert.Equal(t, []time.Duration{0, 250 * time.Millisecond, 250 * time.Millisecond}, rateSchedule(3, 4))
+}
+
+func TestOriginalSchedule(t *testing.T) {
+	messages := []kafka.FTMessage{
+		{Headers: map[string]string{"Message-Timestamp": "2017-06-01T10:00:00.000Z"}},
+		{Headers: map[string]string{"Message-Timestamp": "2017-06-01T10:00:04.000Z"}},
+		{Headers: map[string]string{}},
+		{Headers: map[string]string{"Message-Timestamp": "2017-06-01T10:00:03.000Z"}},
+		{Headers: map[string]string{"Message-Timestamp": "2017-06-01T11:00:05.000+0100"}},
+	}
+
+	assert.Equal(t, []time.Duration{0, 2 * time.Second, 0, 0, 500 * time.Millisecond}, originalSchedule(messages, 2))
+}
+
+func TestReplay(t *testing.T) {
+	var received []kafka.FTMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		var msg kafka.FTMessage
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&msg))
+		received = append(received, msg)
+
+		if msg.Body == "invalid" {
+			http.Error(w, "invalid event", http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	messages := []kafka.FTMessage{
+		{Headers: map[string]string{"X-Request-Id": "tid_1"}, Body: "{}"},
+		{Headers: map[string]string{"X-Request-Id": "tid_2"}, Body: "invalid"},
+	}
+
+	var slept []time.Duration
+	r := replayer{url: server.URL, httpClient: http.DefaultClient, sleep: func(d time.Duration) { slept = append(slept, d) }}
+	accepted, rejected := r.replay(messages, []time.Duration{0, time.Second})
+
+	assert.Equal(t, 1, accepted)
+	assert.Equal(t, 1, rejected)
+	assert.Equal(t, messages, received)
+	assert.Equal(t, []time.Duration{0, time.Second}, slept)
+}
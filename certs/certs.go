@@ -0,0 +1,215 @@
+// Package certs terminates TLS in the service, with certificates reloaded on change and optional client certificates.
+package certs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/rcrowley/go-metrics"
+)
+
+// Metrics of the certificate reloads
+var (
+	ReloadsCounter        = metrics.GetOrRegisterCounter("tls.reloads", metrics.DefaultRegistry)
+	ReloadFailuresCounter = metrics.GetOrRegisterCounter("tls.reload.failures", metrics.DefaultRegistry)
+)
+
+// Reloader serves the certificate of the service, reloading the certificate and key files when they change
+// or when the process receives a SIGHUP
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	pollInterval time.Duration
+	lock         *sync.RWMutex
+	cert         *tls.Certificate
+	modTimes     [2]time.Time
+	stopChan     chan bool
+}
+
+// NewReloader returns a reloader of the given certificate and key files, failing if they are not a valid key pair
+func NewReloader(certFile string, keyFile string, pollInterval time.Duration) (*Reloader, error) {
+	r := &Reloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		pollInterval: pollInterval,
+		lock:         &sync.RWMutex{},
+		stopChan:     make(chan bool),
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) load() error {
+	modTimes := r.fileModTimes()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.cert = &cert
+	r.modTimes = modTimes
+	return nil
+}
+
+// GetCertificate returns the certificate currently loaded, it is meant for tls.Config
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
+
+// Watch polls the certificate and key files for changes and reloads them on SIGHUP until the reloader is stopped.
+// An invalid key pair is reported and the previous one is kept.
+func (r *Reloader) Watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if r.changed() {
+				r.reload("file changed")
+			}
+		case <-hup:
+			r.reload("SIGHUP received")
+		case <-r.stopChan:
+			return
+		}
+	}
+}
+
+// Stop stops watching the certificate and key files
+func (r *Reloader) Stop() {
+	r.stopChan <- true
+}
+
+func (r *Reloader) reload(reason string) {
+	entry := log.WithField("cert", r.certFile).WithField("key", r.keyFile).WithField("reason", reason)
+	if err := r.load(); err != nil {
+		ReloadFailuresCounter.Inc(1)
+		entry.WithError(err).Error("Invalid certificate, keeping the active one")
+		return
+	}
+	ReloadsCounter.Inc(1)
+	entry.Info("Reloaded certificate")
+}
+
+func (r *Reloader) changed() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.fileModTimes() != r.modTimes
+}
+
+func (r *Reloader) fileModTimes() [2]time.Time {
+	var modTimes [2]time.Time
+	for i, path := range []string{r.certFile, r.keyFile} {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[i] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// ServerConfig returns the TLS configuration of the service, negotiating HTTP/2. Client certificates signed by the CAs
+// of clientCAFile are verified if the clients send one, or always if they are required. There are no client certificates
+// without clientCAFile.
+func ServerConfig(r *Reloader, clientCAFile string, requireClientCert bool) (*tls.Config, error) {
+	config := &tls.Config{
+		GetCertificate: r.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	if clientCAFile == "" {
+		if requireClientCert {
+			return nil, fmt.Errorf("client certificates cannot be required without the CAs to verify them")
+		}
+		return config, nil
+	}
+
+	pem, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("there are no certificates in %s", clientCAFile)
+	}
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	if requireClientCert {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// PeerConfig returns the TLS configuration of the connections to the other replicas of the service. The replicas
+// are reached by IP, so their host name is not verified: a replica is trusted if it serves the certificate of the reloader,
+// or a certificate verified by the system CAs. The certificate of the reloader is also sent to the replicas requiring one.
+func PeerConfig(r *Reloader) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.GetCertificate(nil)
+		},
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return r.verifyPeer(rawCerts)
+		},
+	}
+}
+
+func (r *Reloader) verifyPeer(rawCerts [][]byte) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("the peer has sent no certificate")
+	}
+	if own, _ := r.GetCertificate(nil); own != nil && len(own.Certificate) > 0 && bytes.Equal(own.Certificate[0], rawCerts[0]) {
+		return nil
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{Intermediates: intermediates})
+	return err
+}
+
+// Identity returns the identity of the client of the connection, the common name of its verified certificate
+// or else its first DNS name. It is empty if the client has not sent a certificate.
+func Identity(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := state.VerifiedChains[0][0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
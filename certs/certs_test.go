@@ -0,0 +1,284 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+type keyPair struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newKeyPair returns a key pair signed by the parent, or self-signed CA without parent
+func newKeyPair(t *testing.T, commonName string, dnsNames []string, parent *keyPair) *keyPair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if commonName == "127.0.0.1" {
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+	}
+
+	signer := &keyPair{cert: template, key: key}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer = parent
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.cert, &key.PublicKey, signer.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &keyPair{cert: cert, key: key}
+}
+
+func (p *keyPair) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.cert.Raw})
+}
+
+func (p *keyPair) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(p.key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (p *keyPair) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(p.certPEM(), p.keyPEM(t))
+	require.NoError(t, err)
+	return cert
+}
+
+// write writes the key pair files, modified at the given time so that changes are seen whatever the file system precision
+func (p *keyPair) write(t *testing.T, certFile string, keyFile string, modTime time.Time) {
+	require.NoError(t, ioutil.WriteFile(certFile, p.certPEM(), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile, p.keyPEM(t), 0600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "certs")
+	require.NoError(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func servedCommonName(t *testing.T, r *Reloader) string {
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func waitFor(condition func() bool) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+func TestReloaderReloadsOnChange(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	ca := newKeyPair(t, "ca", nil, nil)
+	now := time.Now()
+	newKeyPair(t, "first", nil, ca).write(t, certFile, keyFile, now.Add(-time.Minute))
+
+	r, err := NewReloader(certFile, keyFile, 10*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, "first", servedCommonName(t, r))
+
+	go r.Watch()
+	defer r.Stop()
+
+	reloads := ReloadsCounter.Count()
+	newKeyPair(t, "second", nil, ca).write(t, certFile, keyFile, now)
+	assert.True(t, waitFor(func() bool { return ReloadsCounter.Count() > reloads }), "The key pair is reloaded")
+	assert.Equal(t, "second", servedCommonName(t, r))
+}
+
+func TestReloaderKeepsTheKeyPairOnInvalidChange(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	now := time.Now()
+	newKeyPair(t, "first", nil, nil).write(t, certFile, keyFile, now.Add(-time.Minute))
+
+	r, err := NewReloader(certFile, keyFile, 10*time.Millisecond)
+	require.NoError(t, err)
+	go r.Watch()
+	defer r.Stop()
+
+	failures := ReloadFailuresCounter.Count()
+	// the certificate does not match the key any more
+	require.NoError(t, ioutil.WriteFile(certFile, newKeyPair(t, "other", nil, nil).certPEM(), 0600))
+	require.NoError(t, os.Chtimes(certFile, now, now))
+	assert.True(t, waitFor(func() bool { return ReloadFailuresCounter.Count() > failures }), "The reload fails")
+	assert.Equal(t, "first", servedCommonName(t, r))
+}
+
+func TestNewReloaderWithInvalidFiles(t *testing.T) {
+	_, err := NewReloader("missing.crt", "missing.key", time.Second)
+	assert.Error(t, err)
+}
+
+func TestServerConfig(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	ca := newKeyPair(t, "ca", nil, nil)
+	newKeyPair(t, "127.0.0.1", nil, ca).write(t, certFile, keyFile, time.Now())
+	require.NoError(t, ioutil.WriteFile(caFile, ca.certPEM(), 0600))
+	r, err := NewReloader(certFile, keyFile, time.Second)
+	require.NoError(t, err)
+
+	config, err := ServerConfig(r, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+	assert.Equal(t, []string{"h2", "http/1.1"}, config.NextProtos)
+
+	config, err = ServerConfig(r, caFile, false)
+	require.NoError(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, config.ClientAuth)
+
+	config, err = ServerConfig(r, caFile, true)
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+
+	_, err = ServerConfig(r, "", true)
+	assert.Error(t, err, "Client certificates cannot be required without CAs")
+
+	_, err = ServerConfig(r, keyFile, false)
+	assert.Error(t, err, "There are no CAs in the file")
+}
+
+func TestServerConfigNegotiatesHTTP2WithClientIdentity(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	ca := newKeyPair(t, "ca", nil, nil)
+	newKeyPair(t, "127.0.0.1", nil, ca).write(t, certFile, keyFile, time.Now())
+	require.NoError(t, ioutil.WriteFile(caFile, ca.certPEM(), 0600))
+	r, err := NewReloader(certFile, keyFile, time.Second)
+	require.NoError(t, err)
+	config, err := ServerConfig(r, caFile, false)
+	require.NoError(t, err)
+
+	srv := &http.Server{
+		TLSConfig: config,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto + " " + Identity(r.TLS)))
+		}),
+	}
+	require.NoError(t, http2.ConfigureServer(srv, nil))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	go srv.Serve(tls.NewListener(lis, srv.TLSConfig))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certificates ...tls.Certificate) string {
+		transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certificates}}
+		require.NoError(t, http2.ConfigureTransport(transport))
+		resp, err := (&http.Client{Transport: transport}).Get("https://" + lis.Addr().String())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	assert.Equal(t, "HTTP/2.0 ", get(), "Clients without certificate have no identity")
+	assert.Equal(t, "HTTP/2.0 content-syndication", get(newKeyPair(t, "content-syndication", nil, ca).tlsCertificate(t)))
+}
+
+func TestPeerConfig(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	otherCertFile, otherKeyFile := filepath.Join(dir, "other.crt"), filepath.Join(dir, "other.key")
+	ca := newKeyPair(t, "ca", nil, nil)
+	newKeyPair(t, "replica", []string{"notifications-push.ft.com"}, ca).write(t, certFile, keyFile, time.Now())
+	newKeyPair(t, "other", []string{"notifications-push.ft.com"}, ca).write(t, otherCertFile, otherKeyFile, time.Now())
+	require.NoError(t, ioutil.WriteFile(caFile, ca.certPEM(), 0600))
+
+	r, err := NewReloader(certFile, keyFile, time.Second)
+	require.NoError(t, err)
+	other, err := NewReloader(otherCertFile, otherKeyFile, time.Second)
+	require.NoError(t, err)
+
+	get := func(server *Reloader) (string, error) {
+		config, err := ServerConfig(server, caFile, true)
+		require.NoError(t, err)
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer lis.Close()
+		go (&http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(Identity(r.TLS)))
+		})}).Serve(tls.NewListener(lis, config))
+
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: PeerConfig(r)}}
+		resp, err := client.Get("https://" + lis.Addr().String())
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body), nil
+	}
+
+	identity, err := get(r)
+	require.NoError(t, err, "A replica serving the same certificate is trusted, whatever its address")
+	assert.Equal(t, "replica", identity, "The certificate of the replica should be sent as a client certificate")
+
+	_, err = get(other)
+	assert.Error(t, err, "Another certificate must be verified by the system CAs")
+}
+
+func TestIdentity(t *testing.T) {
+	ca := newKeyPair(t, "ca", nil, nil)
+	withCommonName := newKeyPair(t, "content-syndication", []string{"syndication.ft.com"}, ca)
+	withDNSName := newKeyPair(t, "", []string{"syndication.ft.com"}, ca)
+
+	assert.Equal(t, "content-syndication", Identity(&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{withCommonName.cert, ca.cert}}}))
+	assert.Equal(t, "syndication.ft.com", Identity(&tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{withDNSName.cert, ca.cert}}}))
+	assert.Empty(t, Identity(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{withCommonName.cert}}), "Unverified certificates do not count")
+	assert.Empty(t, Identity(nil))
+}
@@ -0,0 +1,320 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/dispatch"
+)
+
+// ErrHeartbeatTimeout is the reason of a reconnection when nothing was received for longer than the heartbeat timeout
+var ErrHeartbeatTimeout = errors.New("no heartbeat received within the heartbeat timeout")
+
+// Config of a push stream client. Zero values are replaced by the defaults.
+type Config struct {
+	URL              string
+	APIKey           string
+	Username         string
+	Password         string
+	HeartbeatTimeout time.Duration
+	MinBackoff       time.Duration
+	MaxBackoff       time.Duration
+	HTTPClient       *http.Client
+	// OnConnect is called every time the stream is (re)connected
+	OnConnect func()
+	// OnError is called with every connection failure or stream error, by default errors are logged
+	OnError func(err error)
+}
+
+// Defaults of the client configuration
+const (
+	DefaultHeartbeatTimeout = 60 * time.Second
+	DefaultMinBackoff       = 1 * time.Second
+	DefaultMaxBackoff       = 1 * time.Minute
+)
+
+// Frame is a single event received from the push stream
+type Frame struct {
+	Event         Event
+	Notifications []dispatch.Notification
+	Heartbeat     bool
+	ReceivedAt    time.Time
+}
+
+// Client of the notifications push stream
+type Client struct {
+	config      Config
+	lock        *sync.RWMutex
+	lastEventID string
+	retry       time.Duration
+}
+
+// StatusError is returned when the push endpoint responds with an unexpected status code
+type StatusError struct {
+	StatusCode int
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("push endpoint responded with status %d", e.StatusCode)
+}
+
+// permanent status codes will not change by reconnecting
+func (e StatusError) permanent() bool {
+	return e.StatusCode >= 400 && e.StatusCode < 500 && e.StatusCode != http.StatusTooManyRequests
+}
+
+// NewClient returns a client of the push stream with the given configuration
+func NewClient(config Config) *Client {
+	if config.HeartbeatTimeout <= 0 {
+		config.HeartbeatTimeout = DefaultHeartbeatTimeout
+	}
+	if config.MinBackoff <= 0 {
+		config.MinBackoff = DefaultMinBackoff
+	}
+	if config.MaxBackoff < config.MinBackoff {
+		config.MaxBackoff = DefaultMaxBackoff
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{}
+	}
+	if config.OnError == nil {
+		config.OnError = func(err error) {
+			log.WithField("url", config.URL).WithError(err).Warn("Push stream error")
+		}
+	}
+	return &Client{config: config, lock: &sync.RWMutex{}}
+}
+
+// LastEventID returns the ID of the last event received, which is used to resume the stream on reconnection
+func (c *Client) LastEventID() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.lastEventID
+}
+
+func (c *Client) received(event Event, retry time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if event.ID != "" {
+		c.lastEventID = event.ID
+	}
+	c.retry = retry
+}
+
+// Notifications subscribes to the push stream and returns the received notifications until the context is done
+func (c *Client) Notifications(ctx context.Context) <-chan dispatch.Notification {
+	notifications := make(chan dispatch.Notification)
+	frames := make(chan Frame)
+
+	go func() {
+		if err := c.Stream(ctx, frames); err != nil && err != ctx.Err() {
+			c.config.OnError(err)
+		}
+		close(frames)
+	}()
+
+	go func() {
+		defer close(notifications)
+		for frame := range frames {
+			for _, n := range frame.Notifications {
+				select {
+				case notifications <- n:
+				case <-ctx.Done():
+				}
+			}
+		}
+	}()
+
+	return notifications
+}
+
+// Stream subscribes to the push stream and sends every frame received to the given channel until the context is done.
+// The stream is reconnected with a jittered backoff whenever it fails, resuming from the last event ID received.
+// It returns early only if the push endpoint rejects the subscription.
+func (c *Client) Stream(ctx context.Context, frames chan<- Frame) error {
+	attempt := 0
+	for {
+		received, err := c.subscribe(ctx, frames)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if statusErr, ok := err.(StatusError); ok && statusErr.permanent() {
+			return err
+		}
+		c.config.OnError(err)
+
+		if received {
+			attempt = 0
+		}
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		attempt++
+	}
+}
+
+func (c *Client) subscribe(ctx context.Context, frames chan<- Frame) (bool, error) {
+	req, err := http.NewRequest("GET", c.config.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if c.config.APIKey != "" {
+		req.Header.Set("X-Api-Key", c.config.APIKey)
+	}
+	if c.config.Username != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+	if lastEventID := c.LastEventID(); lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := c.config.HTTPClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+		return false, StatusError{StatusCode: resp.StatusCode}
+	}
+
+	if c.config.OnConnect != nil {
+		c.config.OnConnect()
+	}
+	return c.read(ctx, resp.Body, frames)
+}
+
+func (c *Client) read(ctx context.Context, body io.Reader, frames chan<- Frame) (bool, error) {
+	type readEvent struct {
+		event Event
+		retry time.Duration
+	}
+
+	activity := make(chan struct{}, 1)
+	events := make(chan readEvent)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+
+	reader := NewEventReader(body, func(line string) {
+		select {
+		case activity <- struct{}{}:
+		default:
+		}
+	})
+
+	go func() {
+		for {
+			event, err := reader.ReadEvent()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case events <- readEvent{event: event, retry: reader.Retry()}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTimer(c.config.HeartbeatTimeout)
+	defer heartbeat.Stop()
+
+	received := false
+	for {
+		select {
+		case <-activity:
+			if !heartbeat.Stop() {
+				<-heartbeat.C
+			}
+			heartbeat.Reset(c.config.HeartbeatTimeout)
+		case read := <-events:
+			received = true
+			c.received(read.event, read.retry)
+
+			frame, err := decodeFrame(read.event)
+			if err != nil {
+				c.config.OnError(err)
+				continue
+			}
+
+			select {
+			case frames <- frame:
+			case <-ctx.Done():
+				return received, ctx.Err()
+			}
+		case err := <-errs:
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return received, err
+		case <-heartbeat.C:
+			return received, ErrHeartbeatTimeout
+		case <-ctx.Done():
+			return received, ctx.Err()
+		}
+	}
+}
+
+func decodeFrame(event Event) (Frame, error) {
+	frame := Frame{Event: event, ReceivedAt: time.Now()}
+
+	switch event.Type {
+	case "", "message", "notification":
+	case "heartbeat":
+		frame.Heartbeat = true
+		return frame, nil
+	default:
+		return frame, nil
+	}
+
+	data := strings.TrimSpace(event.Data)
+	if strings.HasPrefix(data, "[") {
+		if err := json.Unmarshal([]byte(data), &frame.Notifications); err != nil {
+			return frame, fmt.Errorf("decoding notifications: %v", err)
+		}
+	} else {
+		var n dispatch.Notification
+		if err := json.Unmarshal([]byte(data), &n); err != nil {
+			return frame, fmt.Errorf("decoding notification: %v", err)
+		}
+		frame.Notifications = []dispatch.Notification{n}
+	}
+
+	frame.Heartbeat = len(frame.Notifications) == 0
+	return frame, nil
+}
+
+// backoff returns the jittered time to wait before the given reconnection attempt, starting from
+// the reconnection time set by the stream if there is one
+func (c *Client) backoff(attempt int) time.Duration {
+	c.lock.RLock()
+	base := c.config.MinBackoff
+	if c.retry > 0 {
+		base = c.retry
+	}
+	c.lock.RUnlock()
+
+	backoff := c.config.MaxBackoff
+	if attempt < 16 && base<<uint(attempt) < backoff {
+		backoff = base << uint(attempt)
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
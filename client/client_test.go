@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationsAreDecoded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/event-stream", r.Header.Get("Accept"))
+		assert.Equal(t, "key", r.Header.Get("X-Api-Key"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: []\n\n")
+		fmt.Fprint(w, "data: [{\"id\":\"http://www.ft.com/thing/1\",\"type\":\"http://www.ft.com/thing/ThingChangeType/UPDATE\"}]\n\n")
+		fmt.Fprint(w, "data: {\"id\":\"http://www.ft.com/thing/2\"}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewClient(Config{URL: server.URL, APIKey: "key"})
+	notifications := c.Notifications(ctx)
+
+	n := receive(t, notifications)
+	assert.Equal(t, "http://www.ft.com/thing/1", n.ID)
+	assert.Equal(t, "http://www.ft.com/thing/ThingChangeType/UPDATE", n.Type)
+
+	n = receive(t, notifications)
+	assert.Equal(t, "http://www.ft.com/thing/2", n.ID)
+
+	cancel()
+	for range notifications {
+	}
+}
+
+func TestStreamReportsHeartbeats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: []\n\nevent: heartbeat\ndata: {}\n\nevent: other\ndata: {}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	frames := make(chan Frame)
+	go NewClient(Config{URL: server.URL}).Stream(ctx, frames)
+
+	assert.True(t, (<-frames).Heartbeat, "An empty list should be a heartbeat")
+	assert.True(t, (<-frames).Heartbeat, "A heartbeat event should be a heartbeat")
+
+	other := <-frames
+	assert.False(t, other.Heartbeat)
+	assert.Empty(t, other.Notifications, "Other events should not be decoded")
+	assert.Equal(t, "other", other.Event.Type)
+}
+
+func TestStreamResumesFromLastEventID(t *testing.T) {
+	var lock sync.Mutex
+	var lastEventIDs []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		connection := len(lastEventIDs)
+		lock.Unlock()
+
+		fmt.Fprintf(w, "retry: 1\nid: %d\ndata: [{\"id\":\"%d\"}]\n\n", connection, connection)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := NewClient(Config{URL: server.URL, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond, OnError: func(error) {}})
+	notifications := c.Notifications(ctx)
+
+	assert.Equal(t, "1", receive(t, notifications).ID)
+	assert.Equal(t, "2", receive(t, notifications).ID)
+	assert.Equal(t, "3", receive(t, notifications).ID)
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, []string{"", "1", "2"}, lastEventIDs[:3])
+}
+
+func TestStreamReconnectsOnMissingHeartbeat(t *testing.T) {
+	connections := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connections <- struct{}{}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 10)
+	c := NewClient(Config{
+		URL:              server.URL,
+		HeartbeatTimeout: 20 * time.Millisecond,
+		MinBackoff:       time.Millisecond,
+		MaxBackoff:       time.Millisecond,
+		OnError:          func(err error) { errs <- err },
+	})
+	go c.Stream(ctx, make(chan Frame))
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-connections:
+		case <-time.After(time.Second):
+			require.Fail(t, "The client did not connect")
+		}
+	}
+	assert.Equal(t, ErrHeartbeatTimeout, <-errs)
+}
+
+func TestStreamStopsWhenUnauthorized(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", user)
+		assert.Equal(t, "wrong", password)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	c := NewClient(Config{URL: server.URL, Username: "user", Password: "wrong"})
+	err := c.Stream(context.Background(), make(chan Frame))
+
+	assert.Equal(t, StatusError{StatusCode: http.StatusUnauthorized}, err)
+}
+
+func TestBackoff(t *testing.T) {
+	c := NewClient(Config{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+
+	for attempt, max := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		backoff := c.backoff(attempt)
+		assert.True(t, backoff >= max/2 && backoff <= max, "Backoff %v of attempt %d should be between %v and %v", backoff, attempt, max/2, max)
+	}
+	assert.True(t, c.backoff(100) <= time.Second, "Backoff should not overflow")
+}
+
+func receive(t *testing.T, notifications <-chan dispatch.Notification) dispatch.Notification {
+	select {
+	case n := <-notifications:
+		return n
+	case <-time.After(time.Second):
+		require.Fail(t, "No notification received")
+	}
+	return dispatch.Notification{}
+}
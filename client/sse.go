@@ -0,0 +1,90 @@
+package client
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is a server-sent event read from the push stream
+type Event struct {
+	ID   string
+	Type string
+	Data string
+}
+
+// EventReader reads server-sent events as described by https://www.w3.org/TR/eventsource/#parsing-an-event-stream
+type EventReader struct {
+	reader      *bufio.Reader
+	lastEventID string
+	retry       time.Duration
+	onLine      func(line string)
+}
+
+// NewEventReader returns a reader of the events of the given stream. The optional onLine function
+// is called for every line read, comments included, so it can be used to track the activity of the stream.
+func NewEventReader(r io.Reader, onLine func(line string)) *EventReader {
+	return &EventReader{reader: bufio.NewReader(r), onLine: onLine}
+}
+
+// LastEventID returns the last event ID set by the stream
+func (r *EventReader) LastEventID() string {
+	return r.lastEventID
+}
+
+// Retry returns the reconnection time last set by the stream, or zero if it was never set
+func (r *EventReader) Retry() time.Duration {
+	return r.retry
+}
+
+// ReadEvent returns the next event of the stream with data. The ID of an event is the last ID set
+// by the stream, even if it was set by a previous event.
+func (r *EventReader) ReadEvent() (Event, error) {
+	var eventType string
+	var data []string
+
+	for {
+		line, err := r.reader.ReadString('\n')
+		if err != nil {
+			return Event{}, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if r.onLine != nil {
+			r.onLine(line)
+		}
+
+		if line == "" {
+			if data == nil {
+				eventType = ""
+				continue
+			}
+			return Event{ID: r.lastEventID, Type: eventType, Data: strings.Join(data, "\n")}, nil
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "data":
+			data = append(data, value)
+		case "event":
+			eventType = value
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				r.lastEventID = value
+			}
+		case "retry":
+			if millis, err := strconv.Atoi(value); err == nil {
+				r.retry = time.Duration(millis) * time.Millisecond
+			}
+		}
+	}
+}
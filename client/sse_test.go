@@ -0,0 +1,56 @@
+package client
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadEvent(t *testing.T) {
+	stream := ": comment\n" +
+		"retry: 1500\n" +
+		"id: 1\n" +
+		"event: notification\n" +
+		"data: [{\"id\":\"a\"},\n" +
+		"data: {\"id\":\"b\"}]\r\n" +
+		"\n" +
+		"data: []\n" +
+		"\n"
+
+	var lines []string
+	r := NewEventReader(strings.NewReader(stream), func(line string) { lines = append(lines, line) })
+
+	event, err := r.ReadEvent()
+	require.NoError(t, err)
+	assert.Equal(t, Event{ID: "1", Type: "notification", Data: "[{\"id\":\"a\"},\n{\"id\":\"b\"}]"}, event)
+	assert.Equal(t, 1500*time.Millisecond, r.Retry())
+
+	event, err = r.ReadEvent()
+	require.NoError(t, err)
+	assert.Equal(t, Event{ID: "1", Data: "[]"}, event, "The last event ID should be kept, the event type should not")
+	assert.Equal(t, "1", r.LastEventID())
+
+	_, err = r.ReadEvent()
+	assert.Equal(t, io.EOF, err)
+	assert.Len(t, lines, 9, "Every line should be reported, comments included")
+}
+
+func TestReadEventIgnoresEventsWithoutData(t *testing.T) {
+	r := NewEventReader(strings.NewReader("event: heartbeat\n\nid: 2\n\ndata: x\n\n"), nil)
+
+	event, err := r.ReadEvent()
+	require.NoError(t, err)
+	assert.Equal(t, Event{ID: "2", Data: "x"}, event)
+}
+
+func TestReadEventIgnoresInvalidRetry(t *testing.T) {
+	r := NewEventReader(strings.NewReader("retry: soon\ndata: x\n\n"), nil)
+
+	_, err := r.ReadEvent()
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), r.Retry())
+}
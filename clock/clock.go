@@ -0,0 +1,232 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and schedules timers, so that time can be controlled in tests
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event scheduled on a clock, like time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// System returns the clock of the operating system
+func System() Clock {
+	return systemClock{}
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t systemTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+func (t systemTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+// Fake is a clock whose time only changes when it is advanced
+type Fake struct {
+	lock    *sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	changed chan struct{}
+}
+
+// NewFake returns a fake clock set to the given time
+func NewFake(now time.Time) *Fake {
+	return &Fake{lock: &sync.Mutex{}, now: now, changed: make(chan struct{})}
+}
+
+// Now returns the time of the fake clock
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+// After returns a channel receiving the time once the clock is advanced by the given duration
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// NewTimer returns a timer firing once the clock is advanced by the given duration
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: f, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the time forward, firing the timers due in order
+func (f *Fake) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.now = f.now.Add(d)
+	sort.Sort(byDeadline(f.timers))
+
+	var pending []*fakeTimer
+	for _, t := range f.timers {
+		if t.deadline.After(f.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.active = false
+		select {
+		case t.c <- f.now:
+		default:
+		}
+	}
+	f.timers = pending
+	f.notifyChanged()
+}
+
+// Timers returns the number of timers waiting to fire
+func (f *Fake) Timers() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.timers)
+}
+
+// WaitForTimers blocks until at least the given number of timers are waiting to fire, or the timeout expires.
+// It returns false on timeout.
+func (f *Fake) WaitForTimers(count int, timeout time.Duration) bool {
+	return f.waitFor(func() bool { return len(f.timers) >= count }, timeout)
+}
+
+// WaitForDeadline blocks until a timer is waiting to fire at the given time, or the timeout expires.
+// It returns false on timeout.
+func (f *Fake) WaitForDeadline(deadline time.Time, timeout time.Duration) bool {
+	return f.waitFor(func() bool {
+		for _, t := range f.timers {
+			if t.deadline.Equal(deadline) {
+				return true
+			}
+		}
+		return false
+	}, timeout)
+}
+
+// waitFor blocks until the condition, which is checked holding the lock, is true or the timeout expires
+func (f *Fake) waitFor(condition func() bool, timeout time.Duration) bool {
+	expired := time.After(timeout)
+	for {
+		f.lock.Lock()
+		done := condition()
+		changed := f.changed
+		f.lock.Unlock()
+
+		if done {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-expired:
+			return false
+		}
+	}
+}
+
+func (f *Fake) schedule(t *fakeTimer, d time.Duration) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	wasActive := f.remove(t)
+	t.deadline = f.now.Add(d)
+	if d <= 0 {
+		select {
+		case t.c <- f.now:
+		default:
+		}
+		f.notifyChanged()
+		return wasActive
+	}
+
+	t.active = true
+	f.timers = append(f.timers, t)
+	f.notifyChanged()
+	return wasActive
+}
+
+func (f *Fake) stop(t *fakeTimer) bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	wasActive := f.remove(t)
+	f.notifyChanged()
+	return wasActive
+}
+
+func (f *Fake) remove(t *fakeTimer) bool {
+	if !t.active {
+		return false
+	}
+	t.active = false
+	for i := range f.timers {
+		if f.timers[i] == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// notifyChanged wakes up the goroutines waiting for timers, it must be called holding the lock
+func (f *Fake) notifyChanged() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+type fakeTimer struct {
+	clock    *Fake
+	c        chan time.Time
+	deadline time.Time
+	active   bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.clock.stop(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	return t.clock.schedule(t, d)
+}
+
+type byDeadline []*fakeTimer
+
+func (timers byDeadline) Len() int           { return len(timers) }
+func (timers byDeadline) Swap(i, j int)      { timers[i], timers[j] = timers[j], timers[i] }
+func (timers byDeadline) Less(i, j int) bool { return timers[i].deadline.Before(timers[j].deadline) }
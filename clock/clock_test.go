@@ -0,0 +1,94 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var start = time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+
+func TestFakeTimersFireWhenDue(t *testing.T) {
+	c := NewFake(start)
+	late := c.After(2 * time.Second)
+	early := c.NewTimer(time.Second)
+
+	c.Advance(999 * time.Millisecond)
+	assertNotFired(t, early.C())
+	assert.Equal(t, 2, c.Timers())
+
+	c.Advance(time.Millisecond)
+	assert.Equal(t, start.Add(time.Second), <-early.C())
+	assertNotFired(t, late)
+
+	c.Advance(5 * time.Second)
+	assert.Equal(t, start.Add(6*time.Second), <-late, "Timers should receive the time they were fired at")
+	assert.Equal(t, start.Add(6*time.Second), c.Now())
+	assert.Equal(t, 0, c.Timers())
+}
+
+func TestFakeTimerStopAndReset(t *testing.T) {
+	c := NewFake(start)
+	timer := c.NewTimer(time.Second)
+
+	assert.True(t, timer.Stop())
+	assert.False(t, timer.Stop(), "Should not be active once stopped")
+	c.Advance(time.Second)
+	assertNotFired(t, timer.C())
+
+	assert.False(t, timer.Reset(time.Second))
+	assert.True(t, timer.Reset(3*time.Second))
+	c.Advance(2 * time.Second)
+	assertNotFired(t, timer.C())
+	c.Advance(time.Second)
+	<-timer.C()
+	assert.False(t, timer.Stop(), "Should not be active once fired")
+}
+
+func TestFakeZeroDurationFiresImmediately(t *testing.T) {
+	c := NewFake(start)
+	assert.Equal(t, start, <-c.After(0))
+	assert.Equal(t, 0, c.Timers())
+}
+
+func TestWaitForTimers(t *testing.T) {
+	c := NewFake(start)
+	assert.False(t, c.WaitForTimers(1, 10*time.Millisecond))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.After(time.Second)
+	}()
+	assert.True(t, c.WaitForTimers(1, time.Second))
+}
+
+func TestWaitForDeadline(t *testing.T) {
+	c := NewFake(start)
+	timer := c.NewTimer(time.Hour)
+	assert.False(t, c.WaitForDeadline(start.Add(time.Minute), 10*time.Millisecond))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		timer.Reset(time.Minute)
+	}()
+	assert.True(t, c.WaitForDeadline(start.Add(time.Minute), time.Second))
+}
+
+func TestSystemClock(t *testing.T) {
+	c := System()
+	assert.WithinDuration(t, time.Now(), c.Now(), time.Second)
+
+	timer := c.NewTimer(time.Millisecond)
+	<-timer.C()
+	assert.False(t, timer.Stop())
+	<-c.After(time.Millisecond)
+}
+
+func assertNotFired(t *testing.T, c <-chan time.Time) {
+	select {
+	case fired := <-c:
+		assert.Fail(t, "Timer should not have fired", "fired at %v", fired)
+	default:
+	}
+}
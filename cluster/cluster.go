@@ -0,0 +1,183 @@
+// Package cluster shares the notification history and the subscribers of the replicas of the service through
+// a backplane, so that every replica can return a cluster-wide view of them.
+package cluster
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/dispatch"
+)
+
+// expiryPeriods is the number of sync periods after which a replica that stopped sharing its state is left out
+const expiryPeriods = 3
+
+// NodeState is the state a replica shares with the rest of the cluster
+type NodeState struct {
+	Node        string
+	UpdatedAt   time.Time
+	History     []dispatch.Notification
+	Subscribers []dispatch.SubscriberPayload
+}
+
+// Backplane shares the state of the replicas of the service
+type Backplane interface {
+	// Share publishes the state of this replica
+	Share(state NodeState) error
+	// States returns the last state shared by the replicas, this one may be included
+	States() ([]NodeState, error)
+}
+
+// Cluster is a replica of the service sharing its state with the others
+type Cluster struct {
+	node        string
+	backplane   Backplane
+	dispatcher  dispatch.Dispatcher
+	history     dispatch.History
+	historySize int
+	period      time.Duration
+	clock       clock.Clock
+	lock        *sync.RWMutex
+	peers       []NodeState
+	stop        chan struct{}
+}
+
+// New returns the given replica of the cluster, sharing the subscribers of the dispatcher and its local history
+// every sync period
+func New(node string, backplane Backplane, dispatcher dispatch.Dispatcher, history dispatch.History, historySize int, period time.Duration, clk clock.Clock) *Cluster {
+	return &Cluster{
+		node:        node,
+		backplane:   backplane,
+		dispatcher:  dispatcher,
+		history:     history,
+		historySize: historySize,
+		period:      period,
+		clock:       clk,
+		lock:        &sync.RWMutex{},
+		stop:        make(chan struct{}),
+	}
+}
+
+// Node returns the name of this replica
+func (c *Cluster) Node() string {
+	return c.node
+}
+
+// Backplane returns the backplane the state of the replicas is shared through
+func (c *Cluster) Backplane() Backplane {
+	return c.backplane
+}
+
+// Start syncs the state of the replica every sync period until it is stopped
+func (c *Cluster) Start() {
+	timer := c.clock.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C():
+			if err := c.Sync(); err != nil {
+				log.WithError(err).WithField("node", c.node).Warn("Failed syncing with the cluster")
+			}
+			timer.Reset(c.period)
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// Stop stops syncing the state of the replica
+func (c *Cluster) Stop() {
+	close(c.stop)
+}
+
+// Sync shares the state of this replica and reads the state of the others
+func (c *Cluster) Sync() error {
+	if err := c.backplane.Share(c.LocalState()); err != nil {
+		return err
+	}
+
+	states, err := c.backplane.States()
+	if err != nil {
+		return err
+	}
+
+	now := c.clock.Now()
+	var peers []NodeState
+	for _, state := range states {
+		if state.Node == c.node || now.Sub(state.UpdatedAt) > expiryPeriods*c.period {
+			continue
+		}
+		peers = append(peers, state)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Node < peers[j].Node })
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.peers = peers
+	return nil
+}
+
+// LocalState returns the current state of this replica
+func (c *Cluster) LocalState() NodeState {
+	return NodeState{
+		Node:        c.node,
+		UpdatedAt:   c.clock.Now(),
+		History:     c.history.Notifications(),
+		Subscribers: c.localSubscribers(),
+	}
+}
+
+func (c *Cluster) localSubscribers() []dispatch.SubscriberPayload {
+	subscribers := []dispatch.SubscriberPayload{}
+	for _, s := range c.dispatcher.Subscribers() {
+		payload := dispatch.NewSubscriberPayload(s)
+		payload.Node = c.node
+		subscribers = append(subscribers, *payload)
+	}
+	return subscribers
+}
+
+// States returns the state of every replica of the cluster, this one first. The state of the others is
+// the one read on the last sync.
+func (c *Cluster) States() []NodeState {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append([]NodeState{c.LocalState()}, c.peers...)
+}
+
+// Notifications returns the most recent notifications dispatched by any replica of the cluster
+func (c *Cluster) Notifications() []dispatch.Notification {
+	merged := dispatch.NewHistory(c.historySize)
+	seen := map[string]bool{}
+	for _, state := range c.States() {
+		for _, n := range state.History {
+			id := dispatch.EventID(n)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			merged.Push(n)
+		}
+	}
+	return merged.Notifications()
+}
+
+// History returns the cluster-wide history. Notifications are pushed to the local history of the replica.
+func (c *Cluster) History() dispatch.History {
+	return &clusterHistory{c}
+}
+
+type clusterHistory struct {
+	cluster *Cluster
+}
+
+func (h *clusterHistory) Push(n dispatch.Notification) {
+	h.cluster.history.Push(n)
+}
+
+func (h *clusterHistory) Notifications() []dispatch.Notification {
+	return h.cluster.Notifications()
+}
@@ -0,0 +1,145 @@
+package cluster
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const period = 5 * time.Second
+
+var start = time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+
+var n1 = dispatch.Notification{ID: "http://www.ft.com/thing/1", PublishReference: "tid_1", LastModified: "2017-06-01T09:59:01.000Z", NotificationDate: "2017-06-01T09:59:31.000Z"}
+var n2 = dispatch.Notification{ID: "http://www.ft.com/thing/2", PublishReference: "tid_2", LastModified: "2017-06-01T09:59:02.000Z", NotificationDate: "2017-06-01T09:59:32.000Z"}
+var n3 = dispatch.Notification{ID: "http://www.ft.com/thing/3", PublishReference: "tid_3", LastModified: "2017-06-01T09:59:03.000Z", NotificationDate: "2017-06-01T09:59:33.000Z"}
+
+type replica struct {
+	*Cluster
+	history    dispatch.History
+	dispatcher dispatch.Dispatcher
+}
+
+func newReplica(node string, backplane Backplane, clk clock.Clock, notifications ...dispatch.Notification) replica {
+	history := dispatch.NewHistory(10)
+	for _, n := range notifications {
+		history.Push(n)
+	}
+	dispatcher := dispatch.NewDispatcher(0, time.Minute, history, clk)
+	return replica{New(node, backplane, dispatcher, history, 10, period, clk), history, dispatcher}
+}
+
+func TestClusterMergesHistory(t *testing.T) {
+	backplane := NewLocalBackplane()
+	clk := clock.NewFake(start)
+
+	delayed := n2
+	delayed.NotificationDate = "2017-06-01T09:59:33.000Z"
+	a := newReplica("pod-a", backplane, clk, n1, n2)
+	b := newReplica("pod-b", backplane, clk, delayed, n3)
+
+	assert.Len(t, a.History().Notifications(), 2, "Only the local history is known before syncing")
+
+	require.NoError(t, a.Sync())
+	require.NoError(t, b.Sync())
+	require.NoError(t, a.Sync())
+
+	for _, r := range []replica{a, b} {
+		notifications := r.History().Notifications()
+		require.Len(t, notifications, 3, "Notifications dispatched by several replicas are listed once")
+		assert.Equal(t, []string{"tid_3", "tid_2", "tid_1"}, []string{notifications[0].PublishReference, notifications[1].PublishReference, notifications[2].PublishReference})
+	}
+	assert.Equal(t, n2.NotificationDate, a.History().Notifications()[1].NotificationDate, "The local notification is preferred")
+	assert.Equal(t, delayed.NotificationDate, b.History().Notifications()[1].NotificationDate, "The local notification is preferred")
+
+	a.History().Push(n3)
+	assert.Len(t, a.history.Notifications(), 3, "Notifications are pushed to the local history")
+}
+
+func TestClusterHistoryIsLimited(t *testing.T) {
+	backplane := NewLocalBackplane()
+	clk := clock.NewFake(start)
+
+	var older []dispatch.Notification
+	for i := 0; i < 10; i++ {
+		n := n1
+		n.PublishReference = "tid_old"
+		n.LastModified = start.Add(time.Duration(i-120) * time.Second).Format(time.RFC3339Nano)
+		older = append(older, n)
+	}
+	a := newReplica("pod-a", backplane, clk, older...)
+	b := newReplica("pod-b", backplane, clk, n1, n2, n3)
+
+	require.NoError(t, a.Sync())
+	require.NoError(t, b.Sync())
+
+	notifications := b.History().Notifications()
+	assert.Len(t, notifications, 10)
+	assert.Equal(t, "tid_3", notifications[0].PublishReference)
+	assert.Equal(t, "tid_old", notifications[9].PublishReference, "The oldest notifications are left out")
+}
+
+func TestClusterStates(t *testing.T) {
+	backplane := NewLocalBackplane()
+	clk := clock.NewFake(start)
+
+	a := newReplica("pod-a", backplane, clk)
+	b := newReplica("pod-b", backplane, clk)
+	c := newReplica("pod-c", backplane, clk)
+	b.dispatcher.Register(dispatch.NewStandardSubscriber("192.168.1.3", "Article", nil, clk))
+	b.dispatcher.Register(dispatch.NewMonitorSubscriber("192.168.1.2", "All", nil, clk))
+
+	require.NoError(t, a.Sync())
+	require.NoError(t, c.Sync())
+	require.NoError(t, b.Sync())
+
+	states := b.States()
+	require.Len(t, states, 3)
+	assert.Equal(t, []string{"pod-b", "pod-a", "pod-c"}, []string{states[0].Node, states[1].Node, states[2].Node}, "This replica comes first")
+	require.Len(t, states[0].Subscribers, 2)
+	addresses := []string{}
+	for _, s := range states[0].Subscribers {
+		assert.Equal(t, "pod-b", s.Node, "Subscribers are listed with their replica")
+		addresses = append(addresses, s.Address)
+	}
+	sort.Strings(addresses)
+	assert.Equal(t, []string{"192.168.1.2", "192.168.1.3"}, addresses)
+	assert.Empty(t, states[1].Subscribers)
+
+	clk.Advance(expiryPeriods * period)
+	require.NoError(t, a.Sync())
+	require.NoError(t, b.Sync())
+	assert.Len(t, b.States(), 3, "Replicas are kept until they expire")
+
+	clk.Advance(time.Second)
+	require.NoError(t, b.Sync())
+	states = b.States()
+	require.Len(t, states, 2, "Replicas that stopped sharing their state are left out")
+	assert.Equal(t, "pod-a", states[1].Node)
+}
+
+func TestClusterStartSyncsEveryPeriod(t *testing.T) {
+	backplane := NewLocalBackplane()
+	clk := clock.NewFake(start)
+	a := newReplica("pod-a", backplane, clk)
+
+	go a.Start()
+	defer a.Stop()
+
+	require.True(t, clk.WaitForDeadline(start.Add(period), time.Second), "The state is shared on start")
+	states, err := backplane.States()
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	assert.Equal(t, start, states[0].UpdatedAt)
+
+	clk.Advance(period)
+	require.True(t, clk.WaitForDeadline(start.Add(2*period), time.Second), "The state is shared every period")
+	states, err = backplane.States()
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(period), states[0].UpdatedAt)
+}
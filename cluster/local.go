@@ -0,0 +1,38 @@
+package cluster
+
+import (
+	"sort"
+	"sync"
+)
+
+// LocalBackplane is an in-memory backplane shared by the replicas running in the same process, i.e. in tests
+type LocalBackplane struct {
+	lock   *sync.RWMutex
+	states map[string]NodeState
+}
+
+// NewLocalBackplane returns an empty in-memory backplane
+func NewLocalBackplane() *LocalBackplane {
+	return &LocalBackplane{lock: &sync.RWMutex{}, states: map[string]NodeState{}}
+}
+
+// Share replaces the state of the replica
+func (b *LocalBackplane) Share(state NodeState) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.states[state.Node] = state
+	return nil
+}
+
+// States returns the last state shared by every replica, by name
+func (b *LocalBackplane) States() ([]NodeState, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+
+	states := []NodeState{}
+	for _, state := range b.states {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Node < states[j].Node })
+	return states, nil
+}
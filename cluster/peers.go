@@ -0,0 +1,160 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/dispatch"
+)
+
+// StatePath is where the replicas serve their state to the peers backplane
+const StatePath = "/__cluster"
+
+// PeersBackplane shares the state of the replicas over HTTP: every replica serves its last state on the StatePath
+// and reads the state of its peers from there.
+type PeersBackplane struct {
+	peers      []string
+	scheme     string
+	httpClient *http.Client
+	lock       *sync.RWMutex
+	state      *NodeState
+}
+
+// NewPeersBackplane returns a backplane reading the state of the given host:port addresses, over http or https
+// as the scheme says. A host resolving to several addresses, i.e. the headless service of the replicas, stands for all of them.
+func NewPeersBackplane(peers []string, scheme string, httpClient *http.Client) *PeersBackplane {
+	return &PeersBackplane{peers: peers, scheme: scheme, httpClient: httpClient, lock: &sync.RWMutex{}}
+}
+
+// Share replaces the state served to the peers
+func (b *PeersBackplane) Share(state NodeState) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.state = &state
+	return nil
+}
+
+// States returns the state of the reachable peers, the ones failing are logged and left out
+func (b *PeersBackplane) States() ([]NodeState, error) {
+	addrs, err := b.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []NodeState
+	lock := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			state, err := b.fetch(addr)
+			if err != nil {
+				log.WithError(err).WithField("peer", addr).Warn("Cannot read the state of the peer")
+				return
+			}
+			lock.Lock()
+			states = append(states, state)
+			lock.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+	return states, nil
+}
+
+func (b *PeersBackplane) resolve() ([]string, error) {
+	var addrs []string
+	for _, peer := range b.peers {
+		host, port, err := net.SplitHostPort(peer)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := net.LookupHost(host)
+		if err != nil {
+			log.WithError(err).WithField("peer", peer).Warn("Cannot resolve the peer")
+			continue
+		}
+		for _, ip := range ips {
+			addrs = append(addrs, net.JoinHostPort(ip, port))
+		}
+	}
+	return addrs, nil
+}
+
+func (b *PeersBackplane) fetch(addr string) (NodeState, error) {
+	var state NodeState
+	resp, err := b.httpClient.Get(b.scheme + "://" + addr + StatePath)
+	if err != nil {
+		return state, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return state, fmt.Errorf("peer responded with status %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&state)
+	return state, err
+}
+
+// ServeHTTP serves the last state shared by this replica
+func (b *PeersBackplane) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.lock.RLock()
+	state := b.state
+	b.lock.RUnlock()
+
+	if state == nil {
+		http.Error(w, "The state of the replica is not shared yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		log.WithError(err).Warn("Serving the state of the replica")
+	}
+}
+
+type stateJSON struct {
+	Node        string                       `json:"node"`
+	UpdatedAt   time.Time                    `json:"updatedAt"`
+	History     []historyJSON                `json:"history"`
+	Subscribers []dispatch.SubscriberPayload `json:"subscribers"`
+}
+
+// historyJSON keeps the attributes of a notification that are not part of its JSON representation,
+// but are needed to resume subscribers from the cluster-wide history
+type historyJSON struct {
+	Notification dispatch.Notification `json:"notification"`
+	ContentType  string                `json:"contentType,omitempty"`
+	MonitorOnly  bool                  `json:"monitorOnly,omitempty"`
+}
+
+// MarshalJSON returns the JSON representation of the state shared with the peers
+func (s NodeState) MarshalJSON() ([]byte, error) {
+	state := stateJSON{Node: s.Node, UpdatedAt: s.UpdatedAt, History: []historyJSON{}, Subscribers: s.Subscribers}
+	for _, n := range s.History {
+		state.History = append(state.History, historyJSON{Notification: n, ContentType: n.ContentType, MonitorOnly: n.MonitorOnly})
+	}
+	return json.Marshal(state)
+}
+
+// UnmarshalJSON reads the state shared by a peer
+func (s *NodeState) UnmarshalJSON(data []byte) error {
+	var state stateJSON
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	*s = NodeState{Node: state.Node, UpdatedAt: state.UpdatedAt, Subscribers: state.Subscribers}
+	for _, h := range state.History {
+		n := h.Notification
+		n.ContentType = h.ContentType
+		n.MonitorOnly = h.MonitorOnly
+		s.History = append(s.History, n)
+	}
+	return nil
+}
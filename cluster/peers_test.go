@@ -0,0 +1,108 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeStateJSON(t *testing.T) {
+	synthetic := n1
+	synthetic.ContentType = "Article"
+	synthetic.MonitorOnly = true
+	synthetic.Fields = map[string]interface{}{"publishedDate": "2017-06-01T09:59:01.000Z"}
+	state := NodeState{
+		Node:        "pod-a",
+		UpdatedAt:   start,
+		History:     []dispatch.Notification{synthetic, n2},
+		Subscribers: []dispatch.SubscriberPayload{{Address: "192.168.1.3", Type: "dispatch.standardSubscriber", Node: "pod-a"}},
+	}
+
+	data, err := json.Marshal(state)
+	require.NoError(t, err)
+
+	var actual NodeState
+	require.NoError(t, json.Unmarshal(data, &actual))
+	assert.Equal(t, state, actual, "The notification attributes needed to resume subscribers are kept")
+}
+
+func TestPeersBackplane(t *testing.T) {
+	a := NewPeersBackplane(nil, "http", &http.Client{})
+	b := NewPeersBackplane(nil, "http", &http.Client{})
+	serverA := httptest.NewServer(a)
+	defer serverA.Close()
+	serverB := httptest.NewServer(b)
+	defer serverB.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	require.NoError(t, a.Share(NodeState{Node: "pod-a", UpdatedAt: start, History: []dispatch.Notification{n1}}))
+	require.NoError(t, b.Share(NodeState{Node: "pod-b", UpdatedAt: start, History: []dispatch.Notification{n2, n3}}))
+
+	peers := NewPeersBackplane([]string{addr(serverA), addr(serverB), addr(down)}, "http", &http.Client{})
+	states, err := peers.States()
+	require.NoError(t, err, "Unreachable peers are left out")
+	require.Len(t, states, 2)
+
+	byNode := map[string]NodeState{}
+	for _, state := range states {
+		byNode[state.Node] = state
+	}
+	assert.Equal(t, []dispatch.Notification{n1}, byNode["pod-a"].History)
+	assert.Equal(t, []dispatch.Notification{n2, n3}, byNode["pod-b"].History)
+}
+
+func TestPeersBackplaneResolvesHosts(t *testing.T) {
+	b := NewPeersBackplane(nil, "http", &http.Client{})
+	server := httptest.NewServer(b)
+	defer server.Close()
+	require.NoError(t, b.Share(NodeState{Node: "pod-a", UpdatedAt: start}))
+
+	port := addr(server)[strings.LastIndex(addr(server), ":"):]
+	states, err := NewPeersBackplane([]string{"localhost" + port}, "http", &http.Client{}).States()
+	require.NoError(t, err)
+	require.NotEmpty(t, states)
+	assert.Equal(t, "pod-a", states[0].Node)
+
+	_, err = NewPeersBackplane([]string{"localhost"}, "http", &http.Client{}).States()
+	assert.Error(t, err, "Peers must have a port")
+}
+
+func TestPeersBackplaneOverTLS(t *testing.T) {
+	b := NewPeersBackplane(nil, "https", &http.Client{})
+	server := httptest.NewTLSServer(b)
+	defer server.Close()
+	require.NoError(t, b.Share(NodeState{Node: "pod-a", UpdatedAt: start}))
+
+	leaf, err := x509.ParseCertificate(server.TLS.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	states, err := NewPeersBackplane([]string{strings.TrimPrefix(server.URL, "https://")}, "https", httpClient).States()
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	assert.Equal(t, "pod-a", states[0].Node)
+}
+
+func TestPeersBackplaneServesNothingBeforeSharing(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", StatePath, nil)
+
+	NewPeersBackplane(nil, "http", &http.Client{}).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func addr(server *httptest.Server) string {
+	return strings.TrimPrefix(server.URL, "http://")
+}
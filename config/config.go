@@ -0,0 +1,118 @@
+package config
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/consumer"
+	"github.com/ghodss/yaml"
+)
+
+// Config is the part of the service configuration that can be changed without a restart
+type Config struct {
+	Whitelist             string             `json:"whitelist"`
+	SupportedContentTypes []string           `json:"supportedContentTypes"`
+	NotificationsDelay    int                `json:"notificationsDelay"`
+	HeartbeatPeriod       int                `json:"heartbeatPeriod"`
+	SkipRules             consumer.SkipRules `json:"skipRules"`
+}
+
+// Active is a validated configuration, ready to be applied
+type Active struct {
+	Config          Config         `json:"config"`
+	Version         string         `json:"version"`
+	Source          string         `json:"source"`
+	LoadedAt        time.Time      `json:"loadedAt"`
+	WhitelistRegexp *regexp.Regexp `json:"-"`
+}
+
+// Delay returns the time to delay each notification before forwarding it to subscribers
+func (a *Active) Delay() time.Duration {
+	return time.Duration(a.Config.NotificationsDelay) * time.Second
+}
+
+// Heartbeat returns the heartbeat period of the push stream
+func (a *Active) Heartbeat() time.Duration {
+	return time.Duration(a.Config.HeartbeatPeriod) * time.Second
+}
+
+// Activate validates the configuration read from the given source. The version of the
+// active configuration identifies its content.
+func Activate(c Config, source string) (*Active, error) {
+	whitelist, err := regexp.Compile(c.Whitelist)
+	if err != nil {
+		return nil, fmt.Errorf("whitelist regex MUST compile: %v", err)
+	}
+	if len(c.SupportedContentTypes) == 0 {
+		return nil, errors.New("at least one supported content type is required")
+	}
+	if c.NotificationsDelay < 0 {
+		return nil, fmt.Errorf("notifications delay (%d) cannot be negative", c.NotificationsDelay)
+	}
+	if c.HeartbeatPeriod <= 0 {
+		return nil, fmt.Errorf("heartbeat period (%d) must be positive", c.HeartbeatPeriod)
+	}
+	c.SkipRules = append(consumer.SkipRules(nil), c.SkipRules...)
+	if err := c.SkipRules.Compile(); err != nil {
+		return nil, err
+	}
+
+	content, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha1.Sum(content)
+
+	return &Active{
+		Config:          c,
+		Version:         hex.EncodeToString(hash[:])[:12],
+		Source:          source,
+		LoadedAt:        time.Now(),
+		WhitelistRegexp: whitelist,
+	}, nil
+}
+
+// Parse reads a JSON configuration, the settings missing from it are taken from the defaults
+func Parse(data []byte, defaults Config) (Config, error) {
+	c := defaults
+	c.SupportedContentTypes = nil
+	c.SkipRules = nil
+
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Config{}, err
+	}
+
+	if c.SupportedContentTypes == nil {
+		c.SupportedContentTypes = defaults.SupportedContentTypes
+	}
+	if c.SkipRules == nil {
+		c.SkipRules = defaults.SkipRules
+	}
+	return c, nil
+}
+
+// ParseYAML reads a YAML configuration, with the same settings and defaults as a JSON one
+func ParseYAML(data []byte, defaults Config) (Config, error) {
+	content, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return Config{}, err
+	}
+	return Parse(content, defaults)
+}
+
+// ParseFile reads the configuration of the given file, in YAML if its extension is .yaml or .yml and in JSON otherwise
+func ParseFile(path string, data []byte, defaults Config) (Config, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseYAML(data, defaults)
+	default:
+		return Parse(data, defaults)
+	}
+}
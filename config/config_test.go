@@ -0,0 +1,118 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/Financial-Times/notifications-push/consumer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var defaultConfig = Config{
+	Whitelist:             `^http://.*-transformer-(pr|iw)-uk-.*\.svc\.ft\.com(:\d{2,5})?/(lists)/[\w-]+.*$`,
+	SupportedContentTypes: []string{"Article", "ContentPackage", "All"},
+	NotificationsDelay:    30,
+	HeartbeatPeriod:       30,
+	SkipRules:             consumer.DefaultSkipRules(),
+}
+
+func TestActivate(t *testing.T) {
+	active, err := Activate(defaultConfig, "command line")
+	require.NoError(t, err)
+
+	assert.Equal(t, "command line", active.Source)
+	assert.Len(t, active.Version, 12)
+	assert.True(t, active.WhitelistRegexp.MatchString("http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah"))
+
+	sameActive, err := Activate(defaultConfig, "config.json")
+	require.NoError(t, err)
+	assert.Equal(t, active.Version, sameActive.Version, "The version depends on the content only")
+
+	changed := defaultConfig
+	changed.NotificationsDelay = 10
+	changedActive, err := Activate(changed, "command line")
+	require.NoError(t, err)
+	assert.NotEqual(t, active.Version, changedActive.Version, "The version changes with the content")
+}
+
+func TestActivateInvalidConfig(t *testing.T) {
+	invalidWhitelist := defaultConfig
+	invalidWhitelist.Whitelist = "^http://(.*"
+
+	noContentTypes := defaultConfig
+	noContentTypes.SupportedContentTypes = []string{}
+
+	negativeDelay := defaultConfig
+	negativeDelay.NotificationsDelay = -1
+
+	noHeartbeat := defaultConfig
+	noHeartbeat.HeartbeatPeriod = 0
+
+	invalidSkipRules := defaultConfig
+	invalidSkipRules.SkipRules = consumer.SkipRules{{Name: "synthetic", Pattern: "^SYNTH", Action: "ignore"}}
+
+	for description, c := range map[string]Config{
+		"Invalid whitelist":  invalidWhitelist,
+		"No content types":   noContentTypes,
+		"Negative delay":     negativeDelay,
+		"No heartbeat":       noHeartbeat,
+		"Invalid skip rules": invalidSkipRules,
+	} {
+		_, err := Activate(c, "command line")
+		assert.Error(t, err, description)
+	}
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(`{"notificationsDelay": 10, "skipRules": [{"name": "Synthetic transaction ID", "pattern": "^SYNTH", "action": "monitor"}]}`), defaultConfig)
+	require.NoError(t, err)
+
+	assert.Equal(t, defaultConfig.Whitelist, c.Whitelist, "Missing settings are taken from the defaults")
+	assert.Equal(t, defaultConfig.SupportedContentTypes, c.SupportedContentTypes, "Missing settings are taken from the defaults")
+	assert.Equal(t, defaultConfig.HeartbeatPeriod, c.HeartbeatPeriod, "Missing settings are taken from the defaults")
+	assert.Equal(t, 10, c.NotificationsDelay)
+	require.Len(t, c.SkipRules, 1)
+	assert.Equal(t, consumer.MonitorOnlyAction, c.SkipRules[0].Action)
+}
+
+func TestParseInvalidJSON(t *testing.T) {
+	_, err := Parse([]byte(`{"notificationsDelay": "10"}`), defaultConfig)
+	assert.Error(t, err)
+}
+
+func TestParseYAML(t *testing.T) {
+	c, err := ParseYAML([]byte(`
+notificationsDelay: 10
+supportedContentTypes: [Article]
+skipRules:
+  - name: Synthetic transaction ID
+    pattern: ^SYNTH
+    action: monitor
+`), defaultConfig)
+	require.NoError(t, err)
+
+	assert.Equal(t, defaultConfig.Whitelist, c.Whitelist, "Missing settings are taken from the defaults")
+	assert.Equal(t, []string{"Article"}, c.SupportedContentTypes)
+	assert.Equal(t, 10, c.NotificationsDelay)
+	require.Len(t, c.SkipRules, 1)
+	assert.Equal(t, consumer.MonitorOnlyAction, c.SkipRules[0].Action)
+}
+
+func TestParseFile(t *testing.T) {
+	yamlConfig := []byte("notificationsDelay: 10\n")
+	jsonConfig := []byte(`{"notificationsDelay": 10}`)
+
+	for path, data := range map[string][]byte{
+		"config.yaml": yamlConfig,
+		"config.YML":  yamlConfig,
+		"config.json": jsonConfig,
+		"config":      jsonConfig,
+	} {
+		c, err := ParseFile(path, data, defaultConfig)
+		require.NoError(t, err, path)
+		assert.Equal(t, 10, c.NotificationsDelay, path)
+	}
+
+	_, err := ParseFile("config.json", yamlConfig, defaultConfig)
+	assert.Error(t, err, "JSON files are not parsed as YAML")
+}
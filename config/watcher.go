@@ -0,0 +1,137 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/rcrowley/go-metrics"
+)
+
+// Metrics of the configuration reloads
+var (
+	ReloadsCounter        = metrics.GetOrRegisterCounter("config.reloads", metrics.DefaultRegistry)
+	ReloadFailuresCounter = metrics.GetOrRegisterCounter("config.reload.failures", metrics.DefaultRegistry)
+)
+
+// Watcher reloads the configuration file when it changes or when the process receives a SIGHUP
+type Watcher struct {
+	path         string
+	defaults     Config
+	pollInterval time.Duration
+	lock         *sync.RWMutex
+	active       *Active
+	modTime      time.Time
+	stopChan     chan bool
+}
+
+// NewWatcher returns a watcher of the given configuration file, settings missing from the file are taken from the defaults
+func NewWatcher(path string, defaults Config, pollInterval time.Duration) *Watcher {
+	return &Watcher{
+		path:         path,
+		defaults:     defaults,
+		pollInterval: pollInterval,
+		lock:         &sync.RWMutex{},
+		stopChan:     make(chan bool),
+	}
+}
+
+// Load reads and activates the configuration file, without applying it
+func (w *Watcher) Load() (*Active, error) {
+	active, err := w.read()
+	if err != nil {
+		return nil, err
+	}
+
+	w.setActive(active)
+	return active, nil
+}
+
+func (w *Watcher) read() (*Active, error) {
+	w.modTime = w.fileModTime()
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := ParseFile(w.path, data, w.defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	return Activate(c, w.path)
+}
+
+func (w *Watcher) setActive(active *Active) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.active = active
+}
+
+// Active returns the configuration currently applied
+func (w *Watcher) Active() *Active {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.active
+}
+
+// Watch polls the configuration file for changes and reloads it on SIGHUP until the watcher is stopped.
+// Every new valid configuration is passed to apply.
+func (w *Watcher) Watch(apply func(active *Active)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !w.fileModTime().Equal(w.modTime) {
+				w.reload("file changed", apply)
+			}
+		case <-hup:
+			w.reload("SIGHUP received", apply)
+		case <-w.stopChan:
+			return
+		}
+	}
+}
+
+// Stop stops watching the configuration file
+func (w *Watcher) Stop() {
+	w.stopChan <- true
+}
+
+func (w *Watcher) reload(reason string, apply func(active *Active)) {
+	previous := w.Active()
+	active, err := w.read()
+	if err != nil {
+		ReloadFailuresCounter.Inc(1)
+		log.WithField("config", w.path).WithField("reason", reason).WithError(err).Error("Invalid configuration, keeping the active one")
+		return
+	}
+
+	if previous != nil && previous.Version == active.Version {
+		log.WithField("config", w.path).WithField("reason", reason).WithField("version", active.Version).Info("Configuration has not changed")
+		return
+	}
+
+	ReloadsCounter.Inc(1)
+	log.WithField("config", w.path).WithField("reason", reason).WithField("version", active.Version).Info("Applying new configuration")
+	apply(active)
+	w.setActive(active)
+}
+
+func (w *Watcher) fileModTime() time.Time {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
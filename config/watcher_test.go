@@ -0,0 +1,65 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcherReloadsChangedConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notifications-push-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"notificationsDelay": 10}`), 0644))
+
+	w := NewWatcher(path, defaultConfig, 10*time.Millisecond)
+	initial, err := w.Load()
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, initial.Delay())
+
+	applied := make(chan *Active, 1)
+	go w.Watch(func(active *Active) { applied <- active })
+	defer w.Stop()
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"notificationsDelay": 20}`), 0644))
+	require.NoError(t, os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second)))
+
+	select {
+	case active := <-applied:
+		assert.Equal(t, 20*time.Second, active.Delay())
+		assert.NotEqual(t, initial.Version, active.Version)
+	case <-time.After(time.Second):
+		assert.Fail(t, "The changed configuration was not applied")
+	}
+	assert.Equal(t, 20*time.Second, w.Active().Delay())
+}
+
+func TestWatcherKeepsActiveConfigWhenInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notifications-push-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"notificationsDelay": 10}`), 0644))
+
+	w := NewWatcher(path, defaultConfig, time.Hour)
+	initial, err := w.Load()
+	require.NoError(t, err)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"whitelist": "^http://(.*"}`), 0644))
+
+	failures := ReloadFailuresCounter.Count()
+	w.reload("test", func(active *Active) {
+		assert.Fail(t, "Invalid configuration should not be applied")
+	})
+
+	assert.Equal(t, failures+1, ReloadFailuresCounter.Count())
+	assert.Equal(t, initial, w.Active())
+}
@@ -2,63 +2,112 @@ package consumer
 
 import (
 	"regexp"
+	"sync/atomic"
 
 	log "github.com/Financial-Times/go-logger"
 	"github.com/Financial-Times/kafka-client-go/kafka"
 	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/Financial-Times/notifications-push/tracing"
 )
 
 // MessageQueueHandler is a generic interface for implementation of components to hendle messages form the kafka queue.
 type MessageQueueHandler interface {
 	HandleMessage(queueMsg kafka.FTMessage) error
+	UpdateFilters(whitelist *regexp.Regexp, skipRules SkipRules)
+}
+
+type messageFilters struct {
+	whiteList *regexp.Regexp
+	skipRules SkipRules
 }
 
 type simpleMessageQueueHandler struct {
-	whiteList  *regexp.Regexp
-	mapper     NotificationMapper
-	dispatcher dispatch.Dispatcher
+	filters         atomic.Value
+	capturedHeaders []string
+	validator       *EventValidator
+	mapper          Mapper
+	dispatcher      dispatch.Dispatcher
 }
 
 // NewMessageQueueHandler returns a new message handler
-func NewMessageQueueHandler(whitelist *regexp.Regexp, mapper NotificationMapper, dispatcher dispatch.Dispatcher) MessageQueueHandler {
-	return &simpleMessageQueueHandler{
-		whiteList:  whitelist,
-		mapper:     mapper,
-		dispatcher: dispatcher,
+func NewMessageQueueHandler(whitelist *regexp.Regexp, skipRules SkipRules, capturedHeaders []string, validator *EventValidator, mapper Mapper, dispatcher dispatch.Dispatcher) MessageQueueHandler {
+	qHandler := &simpleMessageQueueHandler{
+		capturedHeaders: capturedHeaders,
+		validator:       validator,
+		mapper:          mapper,
+		dispatcher:      dispatcher,
 	}
+	qHandler.UpdateFilters(whitelist, skipRules)
+	return qHandler
+}
+
+// UpdateFilters replaces the whitelist and the skip rules, messages being handled keep using the previous ones
+func (qHandler *simpleMessageQueueHandler) UpdateFilters(whitelist *regexp.Regexp, skipRules SkipRules) {
+	qHandler.filters.Store(messageFilters{whiteList: whitelist, skipRules: skipRules})
 }
 
+// HandleMessage is traced in the trace of the traceparent header of the message, if any
 func (qHandler *simpleMessageQueueHandler) HandleMessage(queueMsg kafka.FTMessage) error {
 	msg := NotificationQueueMessage{queueMsg}
 
+	span := tracing.Start("kafka.message", tracing.FromHeaders(msg.Headers))
+	span.SetAttribute("transaction_id", msg.TransactionID())
+	defer span.Finish()
+
 	pubEvent, err := msg.ToPublicationEvent()
 	if err != nil {
 		log.WithField("transaction_id", msg.TransactionID()).WithField("msg", msg.Body).WithError(err).Warn("Skipping event.")
+		span.SetError(err)
 		return err
 	}
+	span.SetAttribute("contentUri", pubEvent.ContentURI)
 
-	if msg.HasCarouselTransactionID() {
-		log.WithField("transaction_id", msg.TransactionID()).WithField("contentUri", pubEvent.ContentURI).Info("Skipping event: Carousel publish event.")
-		return nil
-	}
+	filters := qHandler.filters.Load().(messageFilters)
 
-	if msg.HasSynthTransactionID() {
-		log.WithField("transaction_id", msg.TransactionID()).WithField("contentUri", pubEvent.ContentURI).Info("Skipping event: Synthetic transaction ID.")
+	rule, matchesRule := filters.skipRules.Match(msg.TransactionID())
+	if matchesRule && rule.Action == DropAction {
+		log.WithField("transaction_id", msg.TransactionID()).WithField("contentUri", pubEvent.ContentURI).Infof("Skipping event: %s.", rule.Name)
+		span.SetAttribute("skipped", rule.Name)
 		return nil
 	}
 
-	if !pubEvent.Matches(qHandler.whiteList) {
+	if !pubEvent.Matches(filters.whiteList) {
 		log.WithField("transaction_id", msg.TransactionID()).WithField("contentUri", pubEvent.ContentURI).Info("Skipping event: It is not in the whitelist.")
+		span.SetAttribute("skipped", "whitelist")
 		return nil
 	}
 
+	// only the events to dispatch are validated, so that skipped ones are neither counted nor rejected
+	if err := qHandler.validator.Validate(msg); err != nil {
+		log.WithField("transaction_id", msg.TransactionID()).WithError(err).Warn("Skipping event: Invalid event.")
+		span.SetError(err)
+		return err
+	}
+
+	mapSpan := tracing.Start("notification.map", span.SpanContext())
 	notification, err := qHandler.mapper.MapNotification(pubEvent, msg.TransactionID())
+	mapSpan.SetError(err)
+	mapSpan.Finish()
 	if err != nil {
 		log.WithField("transaction_id", msg.TransactionID()).WithField("msg", string(msg.Body)).WithError(err).Warn("Skipping event: Cannot build notification for message.")
+		span.SetError(err)
 		return err
 	}
 
+	notification.Headers = msg.SelectHeaders(qHandler.capturedHeaders)
+
+	if matchesRule {
+		switch rule.Action {
+		case MonitorOnlyAction:
+			notification.MonitorOnly = true
+		case FlagAction:
+			notification.Flags = append(notification.Flags, rule.Flag)
+		}
+		log.WithField("transaction_id", msg.TransactionID()).WithField("skipRule", rule.Name).WithField("action", rule.Action).Info("Event matches skip rule.")
+	}
+
 	log.WithField("resource", notification.APIURL).WithField("transaction_id", notification.PublishReference).Info("Valid notification received")
+	notification.Trace = span.SpanContext()
 	qHandler.dispatcher.Send(notification)
 
 	return nil
@@ -3,12 +3,17 @@ package consumer
 import (
 	"regexp"
 	"testing"
+	"time"
 
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/dispatch"
 	"github.com/Financial-Times/notifications-push/test/mocks"
+	"github.com/Financial-Times/notifications-push/tracing"
 
 	"github.com/Financial-Times/kafka-client-go/kafka"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 var defaultWhitelist = regexp.MustCompile(`^http://.*-transformer-(pr|iw)-uk-.*\.svc\.ft\.com(:\d{2,5})?/(lists)/[\w-]+.*$`)
@@ -20,7 +25,7 @@ func TestSyntheticMessage(t *testing.T) {
 	}
 
 	dispatcher := new(mocks.MockDispatcher)
-	handler := NewMessageQueueHandler(defaultWhitelist, mapper, dispatcher)
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, nil, mapper, dispatcher)
 
 	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "SYNTH_tid"},
 		`{"UUID": "a uuid", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/55e40823-6804-4264-ac2f-b29e11bf756a"}`)
@@ -36,7 +41,7 @@ func TestFailedCMSMessageParse(t *testing.T) {
 	}
 
 	dispatcher := new(mocks.MockDispatcher)
-	handler := NewMessageQueueHandler(defaultWhitelist, mapper, dispatcher)
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, nil, mapper, dispatcher)
 
 	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_summin"}, "")
 
@@ -51,7 +56,7 @@ func TestWhitelist(t *testing.T) {
 	}
 
 	dispatcher := new(mocks.MockDispatcher)
-	handler := NewMessageQueueHandler(defaultWhitelist, mapper, dispatcher)
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, nil, mapper, dispatcher)
 
 	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_summin"},
 		`{"ContentURI": "something which wouldn't match"}`)
@@ -68,7 +73,7 @@ func TestFailsConversionToNotification(t *testing.T) {
 
 	dispatcher := new(mocks.MockDispatcher)
 
-	handler := NewMessageQueueHandler(defaultWhitelist, mapper, dispatcher)
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, nil, mapper, dispatcher)
 
 	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_summin"},
 		`{"ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/55e40823-6804-4264-ac2f-b29e11bf756a" + }`)
@@ -86,7 +91,7 @@ func TestHandleMessage(t *testing.T) {
 	dispatcher := new(mocks.MockDispatcher)
 	dispatcher.On("Send", mock.AnythingOfType("[]dispatch.Notification")).Return()
 
-	handler := NewMessageQueueHandler(defaultWhitelist, mapper, dispatcher)
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, nil, mapper, dispatcher)
 
 	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_summin"},
 		`{"UUID": "a uuid", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/55e40823-6804-4264-ac2f-b29e11bf756a"}`)
@@ -102,7 +107,7 @@ func TestHandleMessageMappingError(t *testing.T) {
 	}
 
 	dispatcher := new(mocks.MockDispatcher)
-	handler := NewMessageQueueHandler(defaultWhitelist, mapper, dispatcher)
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, nil, mapper, dispatcher)
 
 	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_summin"},
 		`{"UUID": "", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/abc"}`)
@@ -119,7 +124,7 @@ func TestDiscardStandardCarouselPublicationEvents(t *testing.T) {
 	}
 
 	dispatcher := new(mocks.MockDispatcher)
-	handler := NewMessageQueueHandler(defaultWhitelist, mapper, dispatcher)
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, nil, mapper, dispatcher)
 
 	msg1 := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_fzy2uqund8_carousel_1485954245"},
 		`{"UUID": "a uuid", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/55e40823-6804-4264-ac2f-b29e11bf756a"}`)
@@ -144,7 +149,7 @@ func TestDiscardCarouselPublicationEventsWithGeneratedTransactionID(t *testing.T
 	}
 
 	dispatcher := new(mocks.MockDispatcher)
-	handler := NewMessageQueueHandler(defaultWhitelist, mapper, dispatcher)
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, nil, mapper, dispatcher)
 
 	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_fzy2uqund8_carousel_1485954245_gentx"},
 		`{"UUID": "a uuid", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/55e40823-6804-4264-ac2f-b29e11bf756a"}`,
@@ -153,3 +158,226 @@ func TestDiscardCarouselPublicationEventsWithGeneratedTransactionID(t *testing.T
 	handler.HandleMessage(msg)
 	dispatcher.AssertNotCalled(t, "Send")
 }
+
+func TestSyntheticMessageDeliveredToMonitorSubscribers(t *testing.T) {
+	mapper := NotificationMapper{
+		APIBaseURL: "test.api.ft.com",
+		Resource:   "lists",
+	}
+
+	rules, err := ParseSkipRules(`[{"name":"Synthetic transaction ID","pattern":"^SYNTH","action":"monitor"}]`)
+	assert.NoError(t, err)
+
+	dispatcher := new(mocks.MockDispatcher)
+	dispatcher.On("Send", mock.MatchedBy(func(notifications []dispatch.Notification) bool {
+		return len(notifications) == 1 && notifications[0].MonitorOnly && len(notifications[0].Flags) == 0
+	})).Return()
+
+	handler := NewMessageQueueHandler(defaultWhitelist, rules, nil, nil, mapper, dispatcher)
+
+	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "SYNTH_tid"},
+		`{"UUID": "a uuid", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/55e40823-6804-4264-ac2f-b29e11bf756a"}`)
+
+	err = handler.HandleMessage(msg)
+	assert.NoError(t, err)
+	dispatcher.AssertExpectations(t)
+}
+
+func TestSyntheticMessageDeliveredWithFlag(t *testing.T) {
+	mapper := NotificationMapper{
+		APIBaseURL: "test.api.ft.com",
+		Resource:   "lists",
+	}
+
+	rules, err := ParseSkipRules(`[{"name":"Synthetic transaction ID","pattern":"^SYNTH","action":"flag","flag":"synthetic"}]`)
+	assert.NoError(t, err)
+
+	dispatcher := new(mocks.MockDispatcher)
+	dispatcher.On("Send", mock.MatchedBy(func(notifications []dispatch.Notification) bool {
+		return len(notifications) == 1 && !notifications[0].MonitorOnly && assert.ObjectsAreEqual([]string{"synthetic"}, notifications[0].Flags)
+	})).Return()
+
+	handler := NewMessageQueueHandler(defaultWhitelist, rules, nil, nil, mapper, dispatcher)
+
+	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "SYNTH_tid"},
+		`{"UUID": "a uuid", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/55e40823-6804-4264-ac2f-b29e11bf756a"}`)
+
+	err = handler.HandleMessage(msg)
+	assert.NoError(t, err)
+	dispatcher.AssertExpectations(t)
+}
+
+func TestHandleMessageCapturesHeaders(t *testing.T) {
+	mapper := NotificationMapper{
+		APIBaseURL: "test.api.ft.com",
+		Resource:   "lists",
+	}
+
+	dispatcher := new(mocks.MockDispatcher)
+	dispatcher.On("Send", mock.MatchedBy(func(notifications []dispatch.Notification) bool {
+		return len(notifications) == 1 && assert.ObjectsAreEqual(map[string]string{"Origin-System-Id": "http://cmdb.ft.com/systems/methode-web-pub"}, notifications[0].Headers)
+	})).Return()
+
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), []string{"Origin-System-Id", "Message-Timestamp"}, nil, mapper, dispatcher)
+
+	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_summin", "origin-system-id": "http://cmdb.ft.com/systems/methode-web-pub", "Message-Type": "cms-content-published"},
+		`{"UUID": "a uuid", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/55e40823-6804-4264-ac2f-b29e11bf756a"}`)
+
+	err := handler.HandleMessage(msg)
+	assert.NoError(t, err)
+	dispatcher.AssertExpectations(t)
+}
+
+func TestHandleInvalidMessageInStrictMode(t *testing.T) {
+	mapper := NotificationMapper{
+		APIBaseURL: "test.api.ft.com",
+		Resource:   "lists",
+	}
+
+	schema, err := ParseEventSchema([]byte(`{"required": ["LastModified"]}`))
+	require.NoError(t, err)
+
+	dispatcher := new(mocks.MockDispatcher)
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, &EventValidator{Schema: schema, Strict: true}, mapper, dispatcher)
+
+	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_summin"},
+		`{"UUID": "a uuid", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/55e40823-6804-4264-ac2f-b29e11bf756a"}`)
+
+	rejected := RejectedEventsCounter.Count()
+	err = handler.HandleMessage(msg)
+
+	assert.Error(t, err, "Invalid events are rejected in strict mode")
+	assert.Equal(t, rejected+1, RejectedEventsCounter.Count())
+	dispatcher.AssertNotCalled(t, "Send")
+}
+
+func TestHandleInvalidMessageInLenientMode(t *testing.T) {
+	mapper := NotificationMapper{
+		APIBaseURL: "test.api.ft.com",
+		Resource:   "lists",
+	}
+
+	schema, err := ParseEventSchema([]byte(`{"required": ["LastModified"]}`))
+	require.NoError(t, err)
+
+	dispatcher := new(mocks.MockDispatcher)
+	dispatcher.On("Send", mock.AnythingOfType("[]dispatch.Notification")).Return()
+
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, &EventValidator{Schema: schema}, mapper, dispatcher)
+
+	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_summin"},
+		`{"UUID": "a uuid", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/55e40823-6804-4264-ac2f-b29e11bf756a"}`)
+
+	invalid := InvalidEventsCounter.Count()
+	err = handler.HandleMessage(msg)
+
+	assert.NoError(t, err, "Invalid events are only reported in lenient mode")
+	assert.Equal(t, invalid+1, InvalidEventsCounter.Count())
+	dispatcher.AssertExpectations(t)
+}
+
+func TestSkippedMessagesAreNotValidated(t *testing.T) {
+	mapper := NotificationMapper{
+		APIBaseURL: "test.api.ft.com",
+		Resource:   "lists",
+	}
+
+	schema, err := ParseEventSchema([]byte(`{"required": ["LastModified"]}`))
+	require.NoError(t, err)
+
+	dispatcher := new(mocks.MockDispatcher)
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, &EventValidator{Schema: schema, Strict: true}, mapper, dispatcher)
+
+	notWhitelisted := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_summin"},
+		`{"UUID": "a uuid", "ContentURI": "http://methode-article-transformer-pr-uk-up.svc.ft.com:8080/content/55e40823-6804-4264-ac2f-b29e11bf756a"}`)
+	dropped := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_fzy2uqund8_carousel_1485954245"},
+		`{"UUID": "a uuid", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/55e40823-6804-4264-ac2f-b29e11bf756a"}`)
+
+	invalid, rejected := InvalidEventsCounter.Count(), RejectedEventsCounter.Count()
+
+	assert.NoError(t, handler.HandleMessage(notWhitelisted), "Events out of the whitelist are skipped, not rejected")
+	assert.NoError(t, handler.HandleMessage(dropped), "Events dropped by a skip rule are skipped, not rejected")
+	assert.Equal(t, invalid, InvalidEventsCounter.Count())
+	assert.Equal(t, rejected, RejectedEventsCounter.Count())
+	dispatcher.AssertNotCalled(t, "Send")
+}
+
+func TestUpdateFilters(t *testing.T) {
+	mapper := NotificationMapper{
+		APIBaseURL: "test.api.ft.com",
+		Resource:   "lists",
+	}
+
+	dispatcher := new(mocks.MockDispatcher)
+	dispatcher.On("Send", mock.AnythingOfType("[]dispatch.Notification")).Return()
+
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, nil, mapper, dispatcher)
+
+	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "SYNTH_tid"},
+		`{"UUID": "a uuid", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/55e40823-6804-4264-ac2f-b29e11bf756a"}`)
+
+	handler.HandleMessage(msg)
+	dispatcher.AssertNotCalled(t, "Send")
+
+	handler.UpdateFilters(defaultWhitelist, SkipRules{})
+
+	handler.HandleMessage(msg)
+	dispatcher.AssertExpectations(t)
+}
+
+func TestHandleMessageTraced(t *testing.T) {
+	spans := &mocks.SpanRecorder{}
+	tracing.SetTracer(tracing.NewTracer(spans, clock.NewFake(time.Now())))
+	defer tracing.SetTracer(nil)
+
+	mapper := NotificationMapper{
+		APIBaseURL: "test.api.ft.com",
+		Resource:   "lists",
+	}
+
+	dispatcher := new(mocks.MockDispatcher)
+	dispatcher.On("Send", mock.AnythingOfType("[]dispatch.Notification")).Return()
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, nil, mapper, dispatcher)
+
+	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_summin", "Traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		`{"UUID": "a uuid", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/55e40823-6804-4264-ac2f-b29e11bf756a"}`)
+	require.NoError(t, handler.HandleMessage(msg))
+
+	message := spans.Spans("kafka.message")
+	require.Len(t, message, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", message[0].Context.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", message[0].ParentID.String())
+	assert.Equal(t, "tid_summin", message[0].Attributes["transaction_id"])
+
+	mapping := spans.Spans("notification.map")
+	require.Len(t, mapping, 1)
+	assert.Equal(t, message[0].Context.SpanID, mapping[0].ParentID)
+
+	notification := dispatcher.Calls[0].Arguments.Get(0).([]dispatch.Notification)[0]
+	assert.Equal(t, message[0].Context, notification.Trace, "the dispatch is traced in the trace of the message")
+}
+
+func TestHandleMessageTracedError(t *testing.T) {
+	spans := &mocks.SpanRecorder{}
+	tracing.SetTracer(tracing.NewTracer(spans, clock.NewFake(time.Now())))
+	defer tracing.SetTracer(nil)
+
+	mapper := NotificationMapper{
+		APIBaseURL: "test.api.ft.com",
+		Resource:   "lists",
+	}
+
+	dispatcher := new(mocks.MockDispatcher)
+	handler := NewMessageQueueHandler(defaultWhitelist, DefaultSkipRules(), nil, nil, mapper, dispatcher)
+
+	msg := kafka.NewFTMessage(map[string]string{"X-Request-Id": "tid_summin"},
+		`{"UUID": "", "ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah/abc"}`)
+	require.Error(t, handler.HandleMessage(msg))
+
+	message := spans.Spans("kafka.message")
+	require.Len(t, message, 1)
+	assert.False(t, message[0].ParentID.IsValid(), "the message has no trace context, it starts a new trace")
+	assert.NotEmpty(t, message[0].Error)
+	require.Len(t, spans.Spans("notification.map"), 1)
+	assert.NotEmpty(t, spans.Spans("notification.map")[0].Error)
+}
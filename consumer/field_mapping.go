@@ -0,0 +1,132 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Financial-Times/notifications-push/dispatch"
+)
+
+// Supported types of a mapped payload field. A field without a type is copied as it is.
+const (
+	StringField     = "string"
+	BoolField       = "bool"
+	NumberField     = "number"
+	StringListField = "stringList"
+)
+
+// FieldMapping copies the payload field found at the dot separated Source path
+// to the Target attribute of the notification
+type FieldMapping struct {
+	Source string `json:"source"`
+	Target string `json:"target,omitempty"`
+	Type   string `json:"type,omitempty"`
+}
+
+// FieldMappings is the list of additional payload fields to be copied into notifications
+type FieldMappings []FieldMapping
+
+// ParseFieldMappings reads field mappings from their JSON representation,
+// i.e. [{"source":"publishedDate","type":"string"},{"source":"brands","target":"brands"}]
+func ParseFieldMappings(mappingsJSON string) (FieldMappings, error) {
+	if mappingsJSON == "" {
+		return nil, nil
+	}
+
+	var mappings FieldMappings
+	if err := json.Unmarshal([]byte(mappingsJSON), &mappings); err != nil {
+		return nil, err
+	}
+
+	targets := map[string]struct{}{}
+	for i := range mappings {
+		m := &mappings[i]
+		if m.Source == "" {
+			return nil, fmt.Errorf("field mapping %d has no source", i)
+		}
+		if m.Target == "" {
+			path := strings.Split(m.Source, ".")
+			m.Target = path[len(path)-1]
+		}
+
+		switch m.Type {
+		case "", StringField, BoolField, NumberField, StringListField:
+		default:
+			return nil, fmt.Errorf("field mapping for %s has an unsupported type (%s)", m.Source, m.Type)
+		}
+
+		if dispatch.IsNotificationAttribute(m.Target) {
+			return nil, fmt.Errorf("field mapping for %s cannot override the notification attribute %s", m.Source, m.Target)
+		}
+		if _, found := targets[m.Target]; found {
+			return nil, fmt.Errorf("field mapping for %s has a duplicate target (%s)", m.Source, m.Target)
+		}
+		targets[m.Target] = struct{}{}
+	}
+	return mappings, nil
+}
+
+// Apply returns the mapped fields found in the payload together with the errors of the fields that could not be mapped.
+// Missing fields are not errors.
+func (mappings FieldMappings) Apply(payload map[string]interface{}) (map[string]interface{}, []error) {
+	var fields map[string]interface{}
+	var errs []error
+
+	for _, m := range mappings {
+		value, found := lookupPayloadPath(strings.Split(m.Source, "."), payload)
+		if !found || value == nil {
+			continue
+		}
+
+		if !hasFieldType(value, m.Type) {
+			errs = append(errs, fmt.Errorf("%s is %T, not a %s", m.Source, value, m.Type))
+			continue
+		}
+
+		if fields == nil {
+			fields = map[string]interface{}{}
+		}
+		fields[m.Target] = value
+	}
+	return fields, errs
+}
+
+func hasFieldType(value interface{}, fieldType string) bool {
+	switch fieldType {
+	case StringField:
+		_, ok := value.(string)
+		return ok
+	case BoolField:
+		_, ok := value.(bool)
+		return ok
+	case NumberField:
+		_, ok := value.(float64)
+		return ok
+	case StringListField:
+		list, ok := value.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, item := range list {
+			if _, ok := item.(string); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	return true
+}
+
+func lookupPayloadPath(path []string, payload map[string]interface{}) (interface{}, bool) {
+	value, found := payload[path[0]]
+	if !found || len(path) == 1 {
+		return value, found
+	}
+
+	nested, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return lookupPayloadPath(path[1:], nested)
+}
@@ -0,0 +1,42 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFieldMappings(t *testing.T) {
+	mappings, err := ParseFieldMappings(`[{"source":"standout.editorsChoice","type":"bool"},{"source":"brands","target":"brandIds"}]`)
+
+	assert.NoError(t, err)
+	assert.Equal(t, FieldMappings{
+		{Source: "standout.editorsChoice", Target: "editorsChoice", Type: BoolField},
+		{Source: "brands", Target: "brandIds"},
+	}, mappings)
+}
+
+func TestParseEmptyFieldMappings(t *testing.T) {
+	mappings, err := ParseFieldMappings("")
+
+	assert.NoError(t, err)
+	assert.Empty(t, mappings)
+}
+
+func TestInvalidFieldMappings(t *testing.T) {
+	var testCases = []struct {
+		description string
+		mappings    string
+	}{
+		{"Not JSON", `publishedDate`},
+		{"Missing source", `[{"target":"publishedDate"}]`},
+		{"Unsupported type", `[{"source":"publishedDate","type":"date"}]`},
+		{"Notification attribute target", `[{"source":"headline","target":"title"}]`},
+		{"Duplicate target", `[{"source":"publishedDate"},{"source":"metadata.publishedDate"}]`},
+	}
+
+	for _, tc := range testCases {
+		_, err := ParseFieldMappings(tc.mappings)
+		assert.Error(t, err, tc.description)
+	}
+}
@@ -0,0 +1,67 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/Financial-Times/notifications-push/clock"
+)
+
+// Lag tracks how far behind the queue the consumer is, from the Message-Timestamp header of the latest message consumed
+type Lag struct {
+	clock clock.Clock
+	lock  *sync.RWMutex
+	lag   time.Duration
+	// consumedAt is when the latest message was consumed, or when tracking started
+	consumedAt time.Time
+}
+
+// NewLag returns a lag tracker timed by the given clock
+func NewLag(clk clock.Clock) *Lag {
+	return &Lag{clock: clk, lock: &sync.RWMutex{}, consumedAt: clk.Now()}
+}
+
+// Track records the lag of the message, the lag of messages without a valid timestamp is ignored
+func (l *Lag) Track(queueMsg kafka.FTMessage) {
+	now := l.clock.Now()
+	timestamp, ok := NotificationQueueMessage{queueMsg}.Timestamp()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.consumedAt = now
+	if !ok {
+		return
+	}
+	l.lag = now.Sub(timestamp)
+	if l.lag < 0 {
+		l.lag = 0
+	}
+}
+
+// Current returns the lag of the latest message consumed
+func (l *Lag) Current() time.Duration {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.lag
+}
+
+// Behind returns how far behind the queue the consumer is, given how many messages it is behind. While there are messages
+// left to consume, the lag grows with the time since the latest message was consumed, so that a stalled consumer is
+// seen falling behind even though it consumes nothing.
+func (l *Lag) Behind(backlog int64) time.Duration {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	if backlog <= 0 {
+		return l.lag
+	}
+	return l.lag + l.clock.Now().Sub(l.consumedAt)
+}
+
+// TrackLag returns a message handler tracking the lag of the messages before handing them to next
+func TrackLag(l *Lag, next func(queueMsg kafka.FTMessage) error) func(queueMsg kafka.FTMessage) error {
+	return func(queueMsg kafka.FTMessage) error {
+		l.Track(queueMsg)
+		return next(queueMsg)
+	}
+}
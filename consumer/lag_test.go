@@ -0,0 +1,62 @@
+package consumer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLag(t *testing.T) {
+	now := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	lag := NewLag(clock.NewFake(now))
+	assert.Equal(t, time.Duration(0), lag.Current(), "Nothing is consumed yet")
+
+	lag.Track(kafka.NewFTMessage(map[string]string{"Message-Timestamp": "2017-06-01T09:58:00.000Z"}, ""))
+	assert.Equal(t, 2*time.Minute, lag.Current())
+
+	lag.Track(kafka.NewFTMessage(map[string]string{"Message-Timestamp": "2017-06-01T10:59:30.000+0100"}, ""))
+	assert.Equal(t, 30*time.Second, lag.Current(), "The latest message counts")
+
+	lag.Track(kafka.NewFTMessage(map[string]string{"Message-Timestamp": "invalid"}, ""))
+	lag.Track(kafka.NewFTMessage(map[string]string{}, ""))
+	assert.Equal(t, 30*time.Second, lag.Current(), "Messages without timestamp are ignored")
+
+	lag.Track(kafka.NewFTMessage(map[string]string{"Message-Timestamp": "2017-06-01T10:00:01.000Z"}, ""))
+	assert.Equal(t, time.Duration(0), lag.Current(), "Clock skew does not make the lag negative")
+}
+
+func TestTrackLag(t *testing.T) {
+	now := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	lag := NewLag(clock.NewFake(now))
+	handlerErr := errors.New("invalid message")
+
+	handler := TrackLag(lag, func(queueMsg kafka.FTMessage) error { return handlerErr })
+	err := handler(kafka.NewFTMessage(map[string]string{"Message-Timestamp": "2017-06-01T09:59:00.000Z"}, ""))
+
+	assert.Equal(t, handlerErr, err)
+	assert.Equal(t, time.Minute, lag.Current())
+}
+
+func TestLagBehind(t *testing.T) {
+	now := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	lag := NewLag(clk)
+
+	clk.Advance(time.Minute)
+	assert.Equal(t, time.Duration(0), lag.Behind(0), "There is nothing to consume")
+	assert.Equal(t, time.Minute, lag.Behind(5), "Nothing was consumed since tracking started")
+
+	lag.Track(kafka.NewFTMessage(map[string]string{"Message-Timestamp": "2017-06-01T10:00:30.000Z"}, ""))
+	assert.Equal(t, 30*time.Second, lag.Behind(5))
+
+	clk.Advance(10 * time.Minute)
+	assert.Equal(t, 30*time.Second, lag.Behind(0), "The consumer is caught up")
+	assert.Equal(t, 10*time.Minute+30*time.Second, lag.Behind(5), "The consumer stopped with messages left to consume")
+
+	lag.Track(kafka.NewFTMessage(map[string]string{}, ""))
+	assert.Equal(t, 30*time.Second, lag.Behind(5), "Messages without timestamp show the consumer is consuming")
+}
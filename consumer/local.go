@@ -0,0 +1,136 @@
+package consumer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/kafka-client-go/kafka"
+)
+
+// ErrNotListening is returned when a message is published to a local consumer which is not listening
+var ErrNotListening = errors.New("local consumer is not listening")
+
+// LocalConsumer is a kafka.Consumer of messages from a local source instead of a Kafka cluster,
+// to run the service without external dependencies
+type LocalConsumer struct {
+	source       io.Reader
+	follow       bool
+	pollInterval time.Duration
+	lock         *sync.RWMutex
+	handler      func(message kafka.FTMessage) error
+	shutdown     chan struct{}
+	shutdownOnce *sync.Once
+}
+
+// NewLocalConsumer returns a consumer of the messages read from the given source, one {"headers":{...},"body":"..."} per line.
+// If follow is true, the source is polled for new lines once its end is reached, like tail -f does.
+// Messages can also be published directly, the source is optional.
+func NewLocalConsumer(source io.Reader, follow bool, pollInterval time.Duration) *LocalConsumer {
+	return &LocalConsumer{
+		source:       source,
+		follow:       follow,
+		pollInterval: pollInterval,
+		lock:         &sync.RWMutex{},
+		shutdown:     make(chan struct{}),
+		shutdownOnce: &sync.Once{},
+	}
+}
+
+// StartListening passes the messages to the given handler until the consumer is shut down
+func (c *LocalConsumer) StartListening(messageHandler func(message kafka.FTMessage) error) {
+	c.lock.Lock()
+	c.handler = messageHandler
+	c.lock.Unlock()
+
+	if c.source != nil {
+		go c.read()
+	}
+	<-c.shutdown
+
+	c.lock.Lock()
+	c.handler = nil
+	c.lock.Unlock()
+}
+
+// Shutdown stops the consumer
+func (c *LocalConsumer) Shutdown() {
+	c.shutdownOnce.Do(func() { close(c.shutdown) })
+}
+
+// ConnectivityCheck checks the consumer is listening
+func (c *LocalConsumer) ConnectivityCheck() error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.handler == nil {
+		return ErrNotListening
+	}
+	return nil
+}
+
+// Publish passes a message to the handler of the consumer, returning the handler error
+func (c *LocalConsumer) Publish(message kafka.FTMessage) error {
+	c.lock.RLock()
+	handler := c.handler
+	c.lock.RUnlock()
+
+	if handler == nil {
+		return ErrNotListening
+	}
+	return handler(message)
+}
+
+func (c *LocalConsumer) read() {
+	reader := bufio.NewReader(c.source)
+	var partial string
+	for {
+		line, err := reader.ReadString('\n')
+		partial += line
+
+		if err == io.EOF && c.follow {
+			select {
+			case <-time.After(c.pollInterval):
+				continue
+			case <-c.shutdown:
+				return
+			}
+		}
+		if err != nil && err != io.EOF {
+			log.WithError(err).Error("Cannot read local messages")
+			return
+		}
+
+		c.publishLine(partial)
+		partial = ""
+		if err == io.EOF {
+			log.Info("Finished reading local messages")
+			return
+		}
+	}
+}
+
+func (c *LocalConsumer) publishLine(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	var message kafka.FTMessage
+	if err := json.Unmarshal([]byte(line), &message); err != nil {
+		log.WithError(err).Warn("Skipping invalid local message")
+		return
+	}
+	if message.Headers == nil {
+		message.Headers = map[string]string{}
+	}
+
+	select {
+	case <-c.shutdown:
+	default:
+		c.Publish(message)
+	}
+}
@@ -0,0 +1,110 @@
+package consumer
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type messageRecorder struct {
+	lock     *sync.Mutex
+	messages []kafka.FTMessage
+	received chan struct{}
+}
+
+func newMessageRecorder() *messageRecorder {
+	return &messageRecorder{lock: &sync.Mutex{}, received: make(chan struct{}, 10)}
+}
+
+func (r *messageRecorder) handle(message kafka.FTMessage) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.messages = append(r.messages, message)
+	r.received <- struct{}{}
+	if message.Body == "invalid" {
+		return errors.New("invalid message")
+	}
+	return nil
+}
+
+func (r *messageRecorder) wait(t *testing.T, count int) []kafka.FTMessage {
+	for i := 0; i < count; i++ {
+		select {
+		case <-r.received:
+		case <-time.After(time.Second):
+			require.Fail(t, "Messages were not received")
+		}
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.messages
+}
+
+func TestLocalConsumerReadsSource(t *testing.T) {
+	source := strings.NewReader(`{"headers":{"X-Request-Id":"tid_1"},"body":"{}"}` + "\n\nnot json\n" + `{"body":"last"}`)
+	c := NewLocalConsumer(source, false, time.Millisecond)
+	recorder := newMessageRecorder()
+
+	go c.StartListening(recorder.handle)
+	defer c.Shutdown()
+
+	messages := recorder.wait(t, 2)
+	assert.Equal(t, []kafka.FTMessage{
+		{Headers: map[string]string{"X-Request-Id": "tid_1"}, Body: "{}"},
+		{Headers: map[string]string{}, Body: "last"},
+	}, messages)
+	assert.NoError(t, c.ConnectivityCheck(), "The consumer should keep listening at the end of the source")
+}
+
+func TestLocalConsumerFollowsSource(t *testing.T) {
+	reader, writer := io.Pipe()
+	c := NewLocalConsumer(reader, true, time.Millisecond)
+	recorder := newMessageRecorder()
+
+	go c.StartListening(recorder.handle)
+	defer c.Shutdown()
+
+	go func() {
+		writer.Write([]byte(`{"body":"first`))
+		writer.Write([]byte(`"}` + "\n"))
+		writer.Write([]byte(`{"body":"second"}` + "\n"))
+	}()
+
+	messages := recorder.wait(t, 2)
+	assert.Equal(t, "first", messages[0].Body, "Lines written in parts should be read whole")
+	assert.Equal(t, "second", messages[1].Body)
+}
+
+func TestLocalConsumerPublish(t *testing.T) {
+	c := NewLocalConsumer(nil, false, time.Millisecond)
+	recorder := newMessageRecorder()
+
+	assert.Equal(t, ErrNotListening, c.Publish(kafka.FTMessage{Body: "early"}))
+	assert.Equal(t, ErrNotListening, c.ConnectivityCheck())
+
+	stopped := make(chan struct{})
+	go func() {
+		c.StartListening(recorder.handle)
+		close(stopped)
+	}()
+
+	for i := 0; c.ConnectivityCheck() != nil; i++ {
+		require.True(t, i < 1000, "The consumer did not start listening")
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, c.Publish(kafka.FTMessage{Body: "{}"}))
+	assert.EqualError(t, c.Publish(kafka.FTMessage{Body: "invalid"}), "invalid message")
+
+	c.Shutdown()
+	c.Shutdown()
+	<-stopped
+	assert.Equal(t, ErrNotListening, c.Publish(kafka.FTMessage{Body: "late"}))
+	assert.Len(t, recorder.wait(t, 2), 2)
+}
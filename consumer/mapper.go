@@ -2,21 +2,30 @@ package consumer
 
 import (
 	"errors"
+	"fmt"
 	"regexp"
 
+	log "github.com/Financial-Times/go-logger"
 	"github.com/Financial-Times/notifications-push/dispatch"
 )
 
+// Mapper maps publication events to notifications
+type Mapper interface {
+	MapNotification(event PublicationEvent, transactionID string) (dispatch.Notification, error)
+}
+
 // NotificationMapper maps CmsPublicationEvents to Notifications
 type NotificationMapper struct {
 	APIBaseURL string
 	Resource   string
+	Fields     FieldMappings
 }
 
 // UUIDRegexp enables to check if a string matches a UUID
 var UUIDRegexp = regexp.MustCompile("[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{12}")
 
 // MapNotification maps the given event to a new notification.
+// Payload fields of unexpected types are logged and left out of the notification.
 func (n NotificationMapper) MapNotification(event PublicationEvent, transactionID string) (dispatch.Notification, error) {
 	UUID := UUIDRegexp.FindString(event.ContentURI)
 	if UUID == "" {
@@ -27,6 +36,8 @@ func (n NotificationMapper) MapNotification(event PublicationEvent, transactionI
 	var scoop bool
 	var title = ""
 	var contentType = ""
+	var fields map[string]interface{}
+	var mappingErrs []error
 
 	if event.HasEmptyPayload() {
 		eventType = "DELETE"
@@ -34,12 +45,27 @@ func (n NotificationMapper) MapNotification(event PublicationEvent, transactionI
 		eventType = "UPDATE"
 		notificationPayloadMap, ok := event.Payload.(map[string]interface{})
 		if ok {
-			title = getValueFromPayload("title", notificationPayloadMap)
-			contentType = getValueFromPayload("type", notificationPayloadMap)
-			scoop = getScoopFromPayload(notificationPayloadMap)
+			var err error
+			if title, err = getStringFromPayload("title", notificationPayloadMap); err != nil {
+				mappingErrs = append(mappingErrs, err)
+			}
+			if contentType, err = getStringFromPayload("type", notificationPayloadMap); err != nil {
+				mappingErrs = append(mappingErrs, err)
+			}
+			if scoop, err = getScoopFromPayload(notificationPayloadMap); err != nil {
+				mappingErrs = append(mappingErrs, err)
+			}
+
+			var errs []error
+			fields, errs = n.Fields.Apply(notificationPayloadMap)
+			mappingErrs = append(mappingErrs, errs...)
 		}
 	}
 
+	for _, err := range mappingErrs {
+		log.WithField("transaction_id", transactionID).WithField("contentUri", event.ContentURI).WithError(err).Warn("Cannot map payload field.")
+	}
+
 	return dispatch.Notification{
 		Type:             "http://www.ft.com/thing/ThingChangeType/" + eventType,
 		ID:               "http://www.ft.com/thing/" + UUID,
@@ -48,26 +74,32 @@ func (n NotificationMapper) MapNotification(event PublicationEvent, transactionI
 		LastModified:     event.LastModified,
 		Title:            title,
 		Standout:         dispatch.Standout{Scoop: scoop},
+		Fields:           fields,
 		ContentType:      contentType,
 	}, nil
 }
 
-func getScoopFromPayload(notificationPayloadMap map[string]interface{}) bool {
-	var standout = notificationPayloadMap["standout"]
-	if standout != nil {
-		standoutMap, ok := standout.(map[string]interface{})
-		if ok && standoutMap["scoop"] != nil {
-			return standoutMap["scoop"].(bool)
-		}
+func getScoopFromPayload(notificationPayloadMap map[string]interface{}) (bool, error) {
+	scoop, found := lookupPayloadPath([]string{"standout", "scoop"}, notificationPayloadMap)
+	if !found || scoop == nil {
+		return false, nil
 	}
 
-	return false
+	scoopValue, ok := scoop.(bool)
+	if !ok {
+		return false, fmt.Errorf("standout.scoop is %T, not a boolean", scoop)
+	}
+	return scoopValue, nil
 }
 
-func getValueFromPayload(key string, payload map[string]interface{}) string {
-	if payload[key] != nil {
-		return payload[key].(string)
+func getStringFromPayload(key string, payload map[string]interface{}) (string, error) {
+	if payload[key] == nil {
+		return "", nil
 	}
 
-	return ""
+	value, ok := payload[key].(string)
+	if !ok {
+		return "", fmt.Errorf("%s is %T, not a string", key, payload[key])
+	}
+	return value, nil
 }
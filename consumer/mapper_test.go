@@ -109,3 +109,92 @@ func TestNotificationMappingFieldsNotExtractedFromPayload(t *testing.T) {
 	assert.Equal(t, false, n.Standout.Scoop, "Scoop field should be set to false when it cannot be extracted from payload")
 	assert.Equal(t, "", n.ContentType, "ContentType field should be empty when it cannot be extracted from payload")
 }
+
+func TestNotificationMappingUnexpectedPayloadTypes(t *testing.T) {
+	payload := map[string]interface{}{"title": 42, "standout": map[string]interface{}{"scoop": "yes"}, "type": []interface{}{"Article"}}
+
+	event := PublicationEvent{
+		ContentURI:   "http://list-transformer-pr-uk-up.svc.ft.com:8081/list/blah/" + uuid.NewV4().String(),
+		LastModified: "2016-11-02T10:54:22.234Z",
+		Payload:      payload,
+	}
+
+	mapper := NotificationMapper{
+		APIBaseURL: "test.api.ft.com",
+		Resource:   "list",
+	}
+
+	n, err := mapper.MapNotification(event, "tid_test1")
+
+	assert.Nil(t, err, "The mapping should not return an error")
+	assert.Equal(t, "http://www.ft.com/thing/ThingChangeType/UPDATE", n.Type, "It is an UPDATE notification")
+	assert.Empty(t, n.Title, "Title should be empty when it is not a string")
+	assert.Equal(t, false, n.Standout.Scoop, "Scoop field should be set to false when it is not a boolean")
+	assert.Equal(t, "", n.ContentType, "ContentType field should be empty when it is not a string")
+}
+
+func TestNotificationMappingAdditionalFields(t *testing.T) {
+	payload := map[string]interface{}{
+		"title":           "This is a title",
+		"publishedDate":   "2016-11-02T10:54:22.234Z",
+		"canBeSyndicated": "yes",
+		"brands":          []interface{}{"http://api.ft.com/things/dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54"},
+		"standout":        map[string]interface{}{"editorsChoice": true},
+	}
+
+	event := PublicationEvent{
+		ContentURI:   "http://list-transformer-pr-uk-up.svc.ft.com:8081/list/blah/" + uuid.NewV4().String(),
+		LastModified: "2016-11-02T10:54:22.234Z",
+		Payload:      payload,
+	}
+
+	fields, err := ParseFieldMappings(`[
+		{"source": "publishedDate", "type": "string"},
+		{"source": "canBeSyndicated", "type": "string"},
+		{"source": "brands", "type": "stringList"},
+		{"source": "standout.editorsChoice", "target": "editorsChoice", "type": "bool"},
+		{"source": "comments.enabled", "type": "bool"}
+	]`)
+	assert.NoError(t, err)
+
+	mapper := NotificationMapper{
+		APIBaseURL: "test.api.ft.com",
+		Resource:   "list",
+		Fields:     fields,
+	}
+
+	n, err := mapper.MapNotification(event, "tid_test1")
+
+	assert.Nil(t, err, "The mapping should not return an error")
+	assert.Equal(t, "This is a title", n.Title, "Title should pe mapped correctly")
+	assert.Equal(t, map[string]interface{}{
+		"publishedDate":   "2016-11-02T10:54:22.234Z",
+		"canBeSyndicated": "yes",
+		"brands":          []interface{}{"http://api.ft.com/things/dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54"},
+		"editorsChoice":   true,
+	}, n.Fields, "Additional fields should be mapped correctly")
+}
+
+func TestNotificationMappingAdditionalFieldsOfUnexpectedType(t *testing.T) {
+	payload := map[string]interface{}{"publishedDate": 1478084062, "canBeSyndicated": "yes"}
+
+	event := PublicationEvent{
+		ContentURI:   "http://list-transformer-pr-uk-up.svc.ft.com:8081/list/blah/" + uuid.NewV4().String(),
+		LastModified: "2016-11-02T10:54:22.234Z",
+		Payload:      payload,
+	}
+
+	fields, err := ParseFieldMappings(`[{"source": "publishedDate", "type": "string"}, {"source": "canBeSyndicated"}]`)
+	assert.NoError(t, err)
+
+	mapper := NotificationMapper{
+		APIBaseURL: "test.api.ft.com",
+		Resource:   "list",
+		Fields:     fields,
+	}
+
+	n, err := mapper.MapNotification(event, "tid_test1")
+
+	assert.Nil(t, err, "The mapping should not return an error")
+	assert.Equal(t, map[string]interface{}{"canBeSyndicated": "yes"}, n.Fields, "Fields of unexpected type should not be mapped")
+}
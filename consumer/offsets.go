@@ -0,0 +1,77 @@
+package consumer
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/wvanbergen/kazoo-go"
+)
+
+// Offsets gives the offsets of a topic, per partition
+type Offsets interface {
+	// Committed returns the offsets of the next messages the consumer group will consume, partitions it has not consumed yet are left out
+	Committed() (map[int32]int64, error)
+	// Newest returns the offsets of the next messages that will be produced
+	Newest() (map[int32]int64, error)
+}
+
+type kafkaOffsets struct {
+	kz     *kazoo.Kazoo
+	client sarama.Client
+	group  string
+	topic  string
+}
+
+// NewKafkaOffsets returns the offsets of the topic, the committed ones are those of the consumer group in Zookeeper
+// and the newest ones are asked to the brokers registered in Zookeeper
+func NewKafkaOffsets(zookeeperConnectionString string, consumerGroup string, topic string) (Offsets, error) {
+	kz, err := kazoo.NewKazooFromConnectionString(zookeeperConnectionString, nil)
+	if err != nil {
+		return nil, err
+	}
+	brokers, err := kz.BrokerList()
+	if err != nil {
+		kz.Close()
+		return nil, err
+	}
+	client, err := sarama.NewClient(brokers, sarama.NewConfig())
+	if err != nil {
+		kz.Close()
+		return nil, err
+	}
+	return &kafkaOffsets{kz: kz, client: client, group: consumerGroup, topic: topic}, nil
+}
+
+func (o *kafkaOffsets) Committed() (map[int32]int64, error) {
+	partitions, err := o.client.Partitions(o.topic)
+	if err != nil {
+		return nil, err
+	}
+	group := o.kz.Consumergroup(o.group)
+	committed := map[int32]int64{}
+	for _, partition := range partitions {
+		offset, err := group.FetchOffset(o.topic, partition)
+		if err != nil {
+			return nil, err
+		}
+		// the consumer group commits the offset of the next message to consume, there is none before it consumes any
+		if offset >= 0 {
+			committed[partition] = offset
+		}
+	}
+	return committed, nil
+}
+
+func (o *kafkaOffsets) Newest() (map[int32]int64, error) {
+	partitions, err := o.client.Partitions(o.topic)
+	if err != nil {
+		return nil, err
+	}
+	newest := map[int32]int64{}
+	for _, partition := range partitions {
+		offset, err := o.client.GetOffset(o.topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+		newest[partition] = offset
+	}
+	return newest, nil
+}
@@ -0,0 +1,109 @@
+package consumer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/rcrowley/go-metrics"
+)
+
+// LagGauge is the number of messages the consumer group is behind the topic, over all partitions.
+// Each partition has its own consumer.lag.partition.<partition> gauge.
+var LagGauge = metrics.GetOrRegisterGauge("consumer.lag", metrics.DefaultRegistry)
+
+// PartitionLag polls how many messages the consumer group is behind the topic, per partition
+type PartitionLag struct {
+	offsets      Offsets
+	pollInterval time.Duration
+	clock        clock.Clock
+	lock         *sync.RWMutex
+	lags         map[int32]int64
+	stopChan     chan struct{}
+}
+
+// NewPartitionLag returns a lag poller of the given offsets, timed by the given clock
+func NewPartitionLag(offsets Offsets, pollInterval time.Duration, clk clock.Clock) *PartitionLag {
+	return &PartitionLag{
+		offsets:      offsets,
+		pollInterval: pollInterval,
+		clock:        clk,
+		lock:         &sync.RWMutex{},
+		lags:         map[int32]int64{},
+		stopChan:     make(chan struct{}),
+	}
+}
+
+// Start polls the offsets until stopped
+func (l *PartitionLag) Start() {
+	l.poll()
+	timer := l.clock.NewTimer(l.pollInterval)
+	for {
+		select {
+		case <-timer.C():
+			l.poll()
+			timer.Reset(l.pollInterval)
+		case <-l.stopChan:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Stop stops polling
+func (l *PartitionLag) Stop() {
+	close(l.stopChan)
+}
+
+// poll updates the lags, they are kept as they were if the offsets cannot be fetched
+func (l *PartitionLag) poll() {
+	committed, err := l.offsets.Committed()
+	if err != nil {
+		log.WithError(err).Warn("Cannot fetch the committed offsets of the consumer group")
+		return
+	}
+	newest, err := l.offsets.Newest()
+	if err != nil {
+		log.WithError(err).Warn("Cannot fetch the newest offsets of the topic")
+		return
+	}
+
+	lags := map[int32]int64{}
+	var total int64
+	for partition, offset := range committed {
+		lag := newest[partition] - offset
+		if lag < 0 {
+			lag = 0
+		}
+		lags[partition] = lag
+		total += lag
+		metrics.GetOrRegisterGauge(fmt.Sprintf("consumer.lag.partition.%d", partition), metrics.DefaultRegistry).Update(lag)
+	}
+	LagGauge.Update(total)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.lags = lags
+}
+
+// Lags returns how many messages the consumer group is behind, per partition
+func (l *PartitionLag) Lags() map[int32]int64 {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	lags := map[int32]int64{}
+	for partition, lag := range l.lags {
+		lags[partition] = lag
+	}
+	return lags
+}
+
+// Total returns how many messages the consumer group is behind over all partitions
+func (l *PartitionLag) Total() int64 {
+	var total int64
+	for _, lag := range l.Lags() {
+		total += lag
+	}
+	return total
+}
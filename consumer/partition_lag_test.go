@@ -0,0 +1,73 @@
+package consumer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeOffsets struct {
+	lock      sync.Mutex
+	committed map[int32]int64
+	newest    map[int32]int64
+	err       error
+	fetched   int
+}
+
+func (o *fakeOffsets) set(committed map[int32]int64, newest map[int32]int64, err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.committed, o.newest, o.err = committed, newest, err
+}
+
+func (o *fakeOffsets) fetches() int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.fetched
+}
+
+func (o *fakeOffsets) Committed() (map[int32]int64, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.fetched++
+	return o.committed, o.err
+}
+
+func (o *fakeOffsets) Newest() (map[int32]int64, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.newest, o.err
+}
+
+func TestPartitionLag(t *testing.T) {
+	offsets := &fakeOffsets{}
+	offsets.set(map[int32]int64{0: 10, 1: 20}, map[int32]int64{0: 15, 1: 20, 2: 7}, nil)
+	clk := clock.NewFake(time.Now())
+	lag := NewPartitionLag(offsets, time.Minute, clk)
+
+	go lag.Start()
+	defer lag.Stop()
+	require.True(t, clk.WaitForTimers(1, time.Second), "The next poll is scheduled")
+
+	assert.Equal(t, map[int32]int64{0: 5, 1: 0}, lag.Lags(), "Partitions not consumed yet are left out")
+	assert.Equal(t, int64(5), lag.Total())
+	assert.Equal(t, int64(5), LagGauge.Value())
+	assert.Equal(t, int64(5), metrics.DefaultRegistry.Get("consumer.lag.partition.0").(metrics.Gauge).Value())
+
+	offsets.set(nil, nil, errors.New("zookeeper is down"))
+	clk.Advance(time.Minute)
+	require.True(t, clk.WaitForTimers(1, time.Second), "The next poll is scheduled")
+	assert.Equal(t, 2, offsets.fetches())
+	assert.Equal(t, map[int32]int64{0: 5, 1: 0}, lag.Lags(), "The lags are kept when the offsets cannot be fetched")
+
+	offsets.set(map[int32]int64{0: 16}, map[int32]int64{0: 15}, nil)
+	clk.Advance(time.Minute)
+	require.True(t, clk.WaitForTimers(1, time.Second), "The next poll is scheduled")
+	assert.Equal(t, map[int32]int64{0: 0}, lag.Lags(), "The newest offsets may be older than the committed ones")
+}
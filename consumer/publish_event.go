@@ -4,31 +4,49 @@ import (
 	"encoding/json"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/Financial-Times/kafka-client-go/kafka"
 )
 
+var messageTimestampLayouts = []string{"2006-01-02T15:04:05.000Z0700", time.RFC3339Nano}
+
 // NotificationQueueMessage is a wrapper for the queue consumer message type
 type NotificationQueueMessage struct {
 	kafka.FTMessage
 }
 
-// HasSynthTransactionID checks if the message is synthetic
-func (msg NotificationQueueMessage) HasSynthTransactionID() bool {
-	tid := msg.TransactionID()
-	return strings.HasPrefix(tid, "SYNTH")
+// TransactionID returns the message TID
+func (msg NotificationQueueMessage) TransactionID() string {
+	return msg.Headers["X-Request-Id"]
 }
 
-// HasCarouselTransactionID checks if the message is genearted by the publish carousel
-func (msg NotificationQueueMessage) HasCarouselTransactionID() bool {
-	return carouselTransactionIDRegExp.MatchString(msg.TransactionID())
+// Timestamp returns the time of the Message-Timestamp header, if it is valid
+func (msg NotificationQueueMessage) Timestamp() (time.Time, bool) {
+	value := msg.Headers["Message-Timestamp"]
+	for _, layout := range messageTimestampLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
 }
 
-var carouselTransactionIDRegExp = regexp.MustCompile(`^.+_carousel_[\d]{10}.*$`) //`^(tid_[\S]+)_carousel_[\d]{10}.*$`
-
-// TransactionID returns the message TID
-func (msg NotificationQueueMessage) TransactionID() string {
-	return msg.Headers["X-Request-Id"]
+// SelectHeaders returns the values of the given headers present on the message, header names are case-insensitive
+func (msg NotificationQueueMessage) SelectHeaders(names []string) map[string]string {
+	var selected map[string]string
+	for _, name := range names {
+		for key, value := range msg.Headers {
+			if strings.EqualFold(key, name) {
+				if selected == nil {
+					selected = map[string]string{}
+				}
+				selected[name] = value
+				break
+			}
+		}
+	}
+	return selected
 }
 
 // ToPublicationEvent converts the message to a CmsPublicationEvent
@@ -0,0 +1,112 @@
+package consumer
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+)
+
+// ErrShutdown is returned when a consumer which is shut down is restarted
+var ErrShutdown = errors.New("the consumer is shut down")
+
+// RestartableConsumer is a consumer that can be replaced by a new one, i.e. when it cannot recover from an error by itself
+type RestartableConsumer struct {
+	newConsumer func() (kafka.Consumer, error)
+	lock        *sync.Mutex
+	current     kafka.Consumer
+	// running tells whether the current consumer is not shut down yet
+	running   bool
+	handler   func(message kafka.FTMessage) error
+	listening *sync.WaitGroup
+	shutdown  chan struct{}
+}
+
+// NewRestartableConsumer returns a consumer created, and recreated on restart, by newConsumer
+func NewRestartableConsumer(newConsumer func() (kafka.Consumer, error)) (*RestartableConsumer, error) {
+	current, err := newConsumer()
+	if err != nil {
+		return nil, err
+	}
+	return &RestartableConsumer{
+		newConsumer: newConsumer,
+		lock:        &sync.Mutex{},
+		current:     current,
+		running:     true,
+		listening:   &sync.WaitGroup{},
+		shutdown:    make(chan struct{}),
+	}, nil
+}
+
+// StartListening hands the messages to the handler, whatever the consumer they come from, until it is shut down
+func (c *RestartableConsumer) StartListening(messageHandler func(message kafka.FTMessage) error) {
+	c.lock.Lock()
+	c.handler = messageHandler
+	c.listen(c.current)
+	c.lock.Unlock()
+
+	<-c.shutdown
+	c.listening.Wait()
+}
+
+func (c *RestartableConsumer) listen(consumer kafka.Consumer) {
+	c.listening.Add(1)
+	go func() {
+		defer c.listening.Done()
+		consumer.StartListening(c.handler)
+	}()
+}
+
+// Restart shuts the current consumer down and replaces it with a new one. If the new one cannot be created,
+// there is no consumer until the next successful restart.
+func (c *RestartableConsumer) Restart() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	select {
+	case <-c.shutdown:
+		return ErrShutdown
+	default:
+	}
+
+	if c.running {
+		c.current.Shutdown()
+		c.running = false
+	}
+	consumer, err := c.newConsumer()
+	if err != nil {
+		return err
+	}
+	c.current = consumer
+	c.running = true
+	if c.handler != nil {
+		c.listen(consumer)
+	}
+	return nil
+}
+
+// Shutdown shuts the current consumer down, for good
+func (c *RestartableConsumer) Shutdown() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	select {
+	case <-c.shutdown:
+		return
+	default:
+	}
+
+	close(c.shutdown)
+	if c.running {
+		c.current.Shutdown()
+		c.running = false
+	}
+}
+
+// ConnectivityCheck checks the current consumer
+func (c *RestartableConsumer) ConnectivityCheck() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.running {
+		return errors.New("the consumer is being restarted")
+	}
+	return c.current.ConnectivityCheck()
+}
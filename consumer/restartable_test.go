@@ -0,0 +1,109 @@
+package consumer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// localConsumers creates local consumers, failing when there is an error to return
+type localConsumers struct {
+	lock      sync.Mutex
+	consumers []*LocalConsumer
+	err       error
+}
+
+func (f *localConsumers) create() (kafka.Consumer, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	c := NewLocalConsumer(nil, false, time.Millisecond)
+	f.consumers = append(f.consumers, c)
+	return c, nil
+}
+
+func (f *localConsumers) latest() *LocalConsumer {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.consumers[len(f.consumers)-1]
+}
+
+func (f *localConsumers) fail(err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.err = err
+}
+
+func waitForListening(t *testing.T, c kafka.Consumer) {
+	for i := 0; c.ConnectivityCheck() != nil && i < 1000; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, c.ConnectivityCheck(), "The consumer is listening")
+}
+
+func TestRestartableConsumer(t *testing.T) {
+	consumers := &localConsumers{}
+	c, err := NewRestartableConsumer(consumers.create)
+	require.NoError(t, err)
+	recorder := newMessageRecorder()
+
+	stopped := make(chan struct{})
+	go func() {
+		c.StartListening(recorder.handle)
+		close(stopped)
+	}()
+
+	first := consumers.latest()
+	waitForListening(t, c)
+	require.NoError(t, first.Publish(kafka.NewFTMessage(nil, "first")))
+
+	require.NoError(t, c.Restart())
+	second := consumers.latest()
+	assert.True(t, first != second, "The consumer is replaced")
+	waitForListening(t, c)
+	assert.Equal(t, ErrNotListening, first.Publish(kafka.NewFTMessage(nil, "lost")), "The previous consumer is shut down")
+	require.NoError(t, second.Publish(kafka.NewFTMessage(nil, "second")))
+
+	messages := recorder.wait(t, 2)
+	assert.Equal(t, "first", messages[0].Body)
+	assert.Equal(t, "second", messages[1].Body)
+
+	c.Shutdown()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		assert.Fail(t, "StartListening returns once the consumer is shut down")
+	}
+	assert.Equal(t, ErrShutdown, c.Restart())
+}
+
+func TestRestartableConsumerFailingRestart(t *testing.T) {
+	consumers := &localConsumers{}
+	c, err := NewRestartableConsumer(consumers.create)
+	require.NoError(t, err)
+	go c.StartListening(func(message kafka.FTMessage) error { return nil })
+	defer c.Shutdown()
+	waitForListening(t, c)
+
+	consumers.fail(errors.New("zookeeper is unreachable"))
+	assert.EqualError(t, c.Restart(), "zookeeper is unreachable")
+	assert.Error(t, c.ConnectivityCheck(), "There is no consumer until it is restarted")
+
+	consumers.fail(nil)
+	require.NoError(t, c.Restart())
+	waitForListening(t, c)
+	assert.Len(t, consumers.consumers, 2)
+}
+
+func TestNewRestartableConsumerFailing(t *testing.T) {
+	consumers := &localConsumers{err: errors.New("zookeeper is unreachable")}
+	_, err := NewRestartableConsumer(consumers.create)
+	assert.Error(t, err)
+}
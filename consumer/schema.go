@@ -0,0 +1,323 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// EventSchema validates publication events against a JSON Schema. It is not a complete implementation of the
+// specification, only of this subset of the draft-07 validation keywords: type, properties, required,
+// additionalProperties, items (a single schema), enum, pattern, minLength, maxLength, minimum, maximum, minItems
+// and maxItems. Patterns are Go regular expressions (RE2), not ECMA 262 ones. There is no $ref, no definitions,
+// no combinators (allOf, anyOf, oneOf, not), no conditionals and no format: a schema using any keyword outside
+// the subset is rejected rather than partially applied. The annotation keywords are ignored.
+type EventSchema struct {
+	root *schemaNode
+}
+
+// ValidationError describes a value of the event that does not conform to the schema
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+type schemaNode struct {
+	types                  []string
+	properties             map[string]*schemaNode
+	required               []string
+	additionalProperties   *schemaNode
+	noAdditionalProperties bool
+	items                  *schemaNode
+	enum                   []interface{}
+	pattern                *regexp.Regexp
+	minLength, maxLength   *int
+	minimum, maximum       *float64
+	minItems, maxItems     *int
+}
+
+var ignoredSchemaKeywords = map[string]struct{}{"$schema": {}, "$id": {}, "id": {}, "title": {}, "description": {}, "default": {}, "examples": {}}
+
+// LoadEventSchema reads the schema from the given file
+func LoadEventSchema(path string) (*EventSchema, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseEventSchema(data)
+}
+
+// ParseEventSchema reads the schema from its JSON representation
+func ParseEventSchema(data []byte) (*EventSchema, error) {
+	var schema interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, err
+	}
+
+	root, err := parseSchemaNode(schema, "#")
+	if err != nil {
+		return nil, err
+	}
+	return &EventSchema{root: root}, nil
+}
+
+// Validate checks the JSON event against the schema, returning every violation found
+func (s *EventSchema) Validate(event []byte) []ValidationError {
+	var value interface{}
+	if err := json.Unmarshal(event, &value); err != nil {
+		return []ValidationError{{Path: "$", Message: "invalid JSON: " + err.Error()}}
+	}
+	return s.root.validate(value, "$", nil)
+}
+
+func parseSchemaNode(schema interface{}, location string) (*schemaNode, error) {
+	definition, ok := schema.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("schema at %s is not an object", location)
+	}
+
+	node := &schemaNode{}
+	for keyword, value := range definition {
+		var err error
+		switch keyword {
+		case "type":
+			node.types, err = parseStrings(value)
+		case "properties":
+			node.properties, err = parseProperties(value, location+"/properties")
+		case "required":
+			node.required, err = parseStrings(value)
+		case "additionalProperties":
+			if allowed, isBool := value.(bool); isBool {
+				node.noAdditionalProperties = !allowed
+			} else {
+				node.additionalProperties, err = parseSchemaNode(value, location+"/additionalProperties")
+			}
+		case "items":
+			node.items, err = parseSchemaNode(value, location+"/items")
+		case "enum":
+			var isList bool
+			if node.enum, isList = value.([]interface{}); !isList {
+				err = fmt.Errorf("enum is not a list")
+			}
+		case "pattern":
+			pattern, isString := value.(string)
+			if !isString {
+				err = fmt.Errorf("pattern is not a string")
+			} else {
+				node.pattern, err = regexp.Compile(pattern)
+			}
+		case "minLength":
+			node.minLength, err = parseInt(value)
+		case "maxLength":
+			node.maxLength, err = parseInt(value)
+		case "minItems":
+			node.minItems, err = parseInt(value)
+		case "maxItems":
+			node.maxItems, err = parseInt(value)
+		case "minimum":
+			node.minimum, err = parseNumber(value)
+		case "maximum":
+			node.maximum, err = parseNumber(value)
+		default:
+			if _, ignored := ignoredSchemaKeywords[keyword]; !ignored {
+				err = fmt.Errorf("unsupported keyword")
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("schema at %s/%s: %v", location, keyword, err)
+		}
+	}
+	return node, nil
+}
+
+func parseProperties(value interface{}, location string) (map[string]*schemaNode, error) {
+	definitions, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("properties is not an object")
+	}
+
+	properties := map[string]*schemaNode{}
+	for name, definition := range definitions {
+		property, err := parseSchemaNode(definition, location+"/"+name)
+		if err != nil {
+			return nil, err
+		}
+		properties[name] = property
+	}
+	return properties, nil
+}
+
+func parseStrings(value interface{}) ([]string, error) {
+	if s, ok := value.(string); ok {
+		return []string{s}, nil
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%v is neither a string nor a list", value)
+	}
+
+	var values []string
+	for _, item := range list {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a string", item)
+		}
+		values = append(values, s)
+	}
+	return values, nil
+}
+
+func parseInt(value interface{}) (*int, error) {
+	n, ok := value.(float64)
+	if !ok || n != float64(int(n)) {
+		return nil, fmt.Errorf("%v is not an integer", value)
+	}
+	i := int(n)
+	return &i, nil
+}
+
+func parseNumber(value interface{}) (*float64, error) {
+	n, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%v is not a number", value)
+	}
+	return &n, nil
+}
+
+func (node *schemaNode) validate(value interface{}, path string, errs []ValidationError) []ValidationError {
+	if len(node.types) > 0 && !matchesAnyType(value, node.types) {
+		return append(errs, ValidationError{path, fmt.Sprintf("expected %s, got %s", strings.Join(node.types, " or "), jsonType(value))})
+	}
+
+	if len(node.enum) > 0 && !inEnum(value, node.enum) {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("%v is not one of %v", value, node.enum)})
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		errs = node.validateObject(v, path, errs)
+	case []interface{}:
+		errs = node.validateArray(v, path, errs)
+	case string:
+		errs = node.validateString(v, path, errs)
+	case float64:
+		errs = node.validateNumber(v, path, errs)
+	}
+	return errs
+}
+
+func (node *schemaNode) validateObject(object map[string]interface{}, path string, errs []ValidationError) []ValidationError {
+	for _, name := range node.required {
+		if _, found := object[name]; !found {
+			errs = append(errs, ValidationError{path + "." + name, "is required"})
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, defined := node.properties[name]
+		switch {
+		case defined:
+			errs = property.validate(object[name], path+"."+name, errs)
+		case node.noAdditionalProperties:
+			errs = append(errs, ValidationError{path + "." + name, "is not allowed"})
+		case node.additionalProperties != nil:
+			errs = node.additionalProperties.validate(object[name], path+"."+name, errs)
+		}
+	}
+	return errs
+}
+
+func (node *schemaNode) validateArray(array []interface{}, path string, errs []ValidationError) []ValidationError {
+	if node.minItems != nil && len(array) < *node.minItems {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("expected at least %d items, got %d", *node.minItems, len(array))})
+	}
+	if node.maxItems != nil && len(array) > *node.maxItems {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("expected at most %d items, got %d", *node.maxItems, len(array))})
+	}
+	if node.items != nil {
+		for i, item := range array {
+			errs = node.items.validate(item, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	}
+	return errs
+}
+
+func (node *schemaNode) validateString(s string, path string, errs []ValidationError) []ValidationError {
+	length := utf8.RuneCountInString(s)
+	if node.minLength != nil && length < *node.minLength {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("expected at least %d characters, got %d", *node.minLength, length)})
+	}
+	if node.maxLength != nil && length > *node.maxLength {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("expected at most %d characters, got %d", *node.maxLength, length)})
+	}
+	if node.pattern != nil && !node.pattern.MatchString(s) {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("%q does not match %s", s, node.pattern)})
+	}
+	return errs
+}
+
+func (node *schemaNode) validateNumber(n float64, path string, errs []ValidationError) []ValidationError {
+	if node.minimum != nil && n < *node.minimum {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("%v is less than %v", n, *node.minimum)})
+	}
+	if node.maximum != nil && n > *node.maximum {
+		errs = append(errs, ValidationError{path, fmt.Sprintf("%v is greater than %v", n, *node.maximum)})
+	}
+	return errs
+}
+
+func matchesAnyType(value interface{}, types []string) bool {
+	actual := jsonType(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(value, allowed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testEventSchema = `{
+	"$schema": "http://json-schema.org/draft-04/schema#",
+	"type": "object",
+	"required": ["ContentURI", "LastModified"],
+	"properties": {
+		"ContentURI": {"type": "string", "pattern": "^http://"},
+		"LastModified": {"type": "string", "minLength": 20},
+		"Payload": {
+			"type": ["object", "string", "null"],
+			"properties": {
+				"title": {"type": "string"},
+				"type": {"enum": ["Article", "ContentPackage"]},
+				"brands": {"type": "array", "maxItems": 2, "items": {"type": "string"}},
+				"standout": {"type": "object", "additionalProperties": false, "properties": {"scoop": {"type": "boolean"}}}
+			}
+		}
+	}
+}`
+
+func TestValidEvent(t *testing.T) {
+	schema, err := ParseEventSchema([]byte(testEventSchema))
+	require.NoError(t, err)
+
+	errs := schema.Validate([]byte(`{"ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah", "LastModified": "2016-11-02T10:54:22.234Z", "Payload": {"title": "A title", "type": "Article", "brands": ["FT"], "standout": {"scoop": true}}}`))
+	assert.Empty(t, errs)
+
+	errs = schema.Validate([]byte(`{"ContentURI": "http://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah", "LastModified": "2016-11-02T10:54:22.234Z", "Payload": ""}`))
+	assert.Empty(t, errs, "Delete events are valid")
+}
+
+func TestInvalidEvent(t *testing.T) {
+	schema, err := ParseEventSchema([]byte(testEventSchema))
+	require.NoError(t, err)
+
+	errs := schema.Validate([]byte(`{"ContentURI": "https://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah", "Payload": {"title": 42, "type": "Video", "brands": ["FT", 1, "FT"], "standout": {"scoop": true, "editorsChoice": false}}}`))
+
+	assert.Equal(t, []ValidationError{
+		{"$.LastModified", "is required"},
+		{"$.ContentURI", `"https://list-transformer-pr-uk-up.svc.ft.com:8080/lists/blah" does not match ^http://`},
+		{"$.Payload.brands", "expected at most 2 items, got 3"},
+		{"$.Payload.brands[1]", "expected string, got integer"},
+		{"$.Payload.standout.editorsChoice", "is not allowed"},
+		{"$.Payload.title", "expected string, got integer"},
+		{"$.Payload.type", "Video is not one of [Article ContentPackage]"},
+	}, errs)
+}
+
+func TestEventNotJSON(t *testing.T) {
+	schema, err := ParseEventSchema([]byte(testEventSchema))
+	require.NoError(t, err)
+
+	errs := schema.Validate([]byte(`{"ContentURI": `))
+	require.Len(t, errs, 1)
+	assert.Equal(t, "$", errs[0].Path)
+}
+
+func TestInvalidEventSchema(t *testing.T) {
+	var testCases = []struct {
+		description string
+		schema      string
+	}{
+		{"Not JSON", `{"type": `},
+		{"Not an object", `["object"]`},
+		{"Unsupported keyword", `{"properties": {"Payload": {"anyOf": [{"type": "object"}, {"type": "string"}]}}}`},
+		{"Invalid pattern", `{"properties": {"ContentURI": {"pattern": "^http(://"}}}`},
+		{"Invalid length", `{"properties": {"ContentURI": {"minLength": 1.5}}}`},
+	}
+
+	for _, tc := range testCases {
+		_, err := ParseEventSchema([]byte(tc.schema))
+		assert.Error(t, err, tc.description)
+	}
+}
@@ -0,0 +1,96 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// SkipAction is what happens to a message whose transaction ID matches a SkipRule
+type SkipAction string
+
+const (
+	// DropAction discards the message, no notification is sent
+	DropAction SkipAction = "drop"
+	// MonitorOnlyAction delivers the notification to monitor subscribers only
+	MonitorOnlyAction SkipAction = "monitor"
+	// FlagAction delivers the notification to every subscriber, marked with the rule's flag
+	FlagAction SkipAction = "flag"
+)
+
+// SkipRule matches transaction IDs of messages that should not be treated as regular publishes
+type SkipRule struct {
+	Name    string     `json:"name"`
+	Pattern string     `json:"pattern"`
+	Action  SkipAction `json:"action"`
+	Flag    string     `json:"flag,omitempty"`
+	regex   *regexp.Regexp
+}
+
+// SkipRules is an ordered list of skip rules, the first matching rule wins
+type SkipRules []SkipRule
+
+// DefaultSkipRules drops synthetic and publish carousel transactions
+func DefaultSkipRules() SkipRules {
+	return SkipRules{
+		{Name: "Carousel publish event", Pattern: `^.+_carousel_[\d]{10}.*$`, Action: DropAction, regex: regexp.MustCompile(`^.+_carousel_[\d]{10}.*$`)},
+		{Name: "Synthetic transaction ID", Pattern: `^SYNTH`, Action: DropAction, regex: regexp.MustCompile(`^SYNTH`)},
+	}
+}
+
+// ParseSkipRules reads skip rules from their JSON representation, i.e. [{"name":"Synthetic","pattern":"^SYNTH","action":"monitor"}].
+// An empty string results in the default rules.
+func ParseSkipRules(rulesJSON string) (SkipRules, error) {
+	if rulesJSON == "" {
+		return DefaultSkipRules(), nil
+	}
+
+	var rules SkipRules
+	if err := json.Unmarshal([]byte(rulesJSON), &rules); err != nil {
+		return nil, err
+	}
+
+	if err := rules.Compile(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Compile validates the rules and prepares their patterns for matching
+func (rules SkipRules) Compile() error {
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *SkipRule) compile() error {
+	switch r.Action {
+	case DropAction, MonitorOnlyAction:
+	case FlagAction:
+		if r.Flag == "" {
+			return fmt.Errorf("skip rule %q must define a flag for the %s action", r.Name, r.Action)
+		}
+	default:
+		return fmt.Errorf("skip rule %q has an unsupported action (%s)", r.Name, r.Action)
+	}
+
+	regex, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return fmt.Errorf("skip rule %q has an invalid pattern: %v", r.Name, err)
+	}
+	r.regex = regex
+	return nil
+}
+
+// Match returns the first rule matching the given transaction ID
+func (rules SkipRules) Match(transactionID string) (SkipRule, bool) {
+	for _, r := range rules {
+		if r.regex.MatchString(transactionID) {
+			return r, true
+		}
+	}
+	return SkipRule{}, false
+}
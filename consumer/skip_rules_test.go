@@ -0,0 +1,53 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultSkipRules(t *testing.T) {
+	rules, err := ParseSkipRules("")
+	assert.NoError(t, err)
+
+	rule, ok := rules.Match("SYNTH_tid")
+	assert.True(t, ok, "Synthetic transaction should match")
+	assert.Equal(t, DropAction, rule.Action)
+
+	rule, ok = rules.Match("tid_fzy2uqund8_carousel_1485954245_gentx")
+	assert.True(t, ok, "Carousel transaction should match")
+	assert.Equal(t, DropAction, rule.Action)
+
+	_, ok = rules.Match("tid_summin")
+	assert.False(t, ok, "Regular transaction should not match")
+}
+
+func TestFirstMatchingSkipRuleWins(t *testing.T) {
+	rules, err := ParseSkipRules(`[{"name":"first","pattern":"^SYNTH_carousel","action":"drop"},{"name":"second","pattern":"^SYNTH","action":"monitor"}]`)
+	assert.NoError(t, err)
+
+	rule, ok := rules.Match("SYNTH_carousel_tid")
+	assert.True(t, ok)
+	assert.Equal(t, "first", rule.Name)
+
+	rule, ok = rules.Match("SYNTH_tid")
+	assert.True(t, ok)
+	assert.Equal(t, "second", rule.Name)
+}
+
+func TestInvalidSkipRules(t *testing.T) {
+	var testCases = []struct {
+		description string
+		rules       string
+	}{
+		{"Not JSON", `SYNTH`},
+		{"Unsupported action", `[{"name":"synth","pattern":"^SYNTH","action":"ignore"}]`},
+		{"Flag action without flag", `[{"name":"synth","pattern":"^SYNTH","action":"flag"}]`},
+		{"Invalid pattern", `[{"name":"synth","pattern":"^SYNTH(","action":"drop"}]`},
+	}
+
+	for _, tc := range testCases {
+		_, err := ParseSkipRules(tc.rules)
+		assert.Error(t, err, tc.description)
+	}
+}
@@ -0,0 +1,47 @@
+package consumer
+
+import (
+	"fmt"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/rcrowley/go-metrics"
+)
+
+// Metrics of the event validation
+var (
+	ValidEventsCounter    = metrics.GetOrRegisterCounter("events.validation.valid", metrics.DefaultRegistry)
+	InvalidEventsCounter  = metrics.GetOrRegisterCounter("events.validation.invalid", metrics.DefaultRegistry)
+	RejectedEventsCounter = metrics.GetOrRegisterCounter("events.validation.rejected", metrics.DefaultRegistry)
+)
+
+// EventValidator checks the incoming messages against the event schema.
+// In strict mode invalid events are rejected, in lenient mode they are only reported.
+type EventValidator struct {
+	Schema *EventSchema
+	Strict bool
+}
+
+// Validate reports the schema violations of the message and returns an error if the message should be rejected
+func (v *EventValidator) Validate(msg NotificationQueueMessage) error {
+	if v == nil {
+		return nil
+	}
+
+	errs := v.Schema.Validate([]byte(msg.Body))
+	if len(errs) == 0 {
+		ValidEventsCounter.Inc(1)
+		return nil
+	}
+
+	InvalidEventsCounter.Inc(1)
+	for _, err := range errs {
+		log.WithField("transaction_id", msg.TransactionID()).WithField("path", err.Path).WithField("strict", v.Strict).Warnf("Event does not conform to schema: %s", err.Message)
+	}
+
+	if !v.Strict {
+		return nil
+	}
+
+	RejectedEventsCounter.Inc(1)
+	return fmt.Errorf("event does not conform to schema (%d violations), first violation at %v", len(errs), errs[0])
+}
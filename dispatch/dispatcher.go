@@ -1,16 +1,31 @@
 package dispatch
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/tracing"
+	"github.com/rcrowley/go-metrics"
 )
 
 const (
 	heartbeatMsg  = "[]"
 	rfc3339Millis = "2006-01-02T15:04:05.000Z07:00"
+	// missedTicks is the number of heartbeat periods the dispatch loop may go without ticking before it is deemed stalled
+	missedTicks = 3
+)
+
+var (
+	heartbeatEvent = Event{Type: HeartbeatEvent, Data: heartbeatMsg}
+	reconnectEvent = Event{Type: ReconnectEvent}
+	// NotificationAgeTimer times the age of the notifications when they are dispatched, since their LastModified
+	NotificationAgeTimer = metrics.GetOrRegisterTimer("notifications.age", metrics.DefaultRegistry)
 )
 
 // Dispatcher forwards a new notification onto subscribers.
@@ -19,9 +34,22 @@ type Dispatcher interface {
 	Stop()
 	Send(notification ...Notification)
 	Subscribers() []Subscriber
+	Reconfigure(delay time.Duration, heartbeatPeriod time.Duration)
+	Reconnect()
+	Delayed() int
+	CheckAlive() error
+	Freshness() Freshness
 	Registrar
 }
 
+// Freshness tells how fresh the latest notification dispatched was
+type Freshness struct {
+	// DispatchedAt is when the notification was dispatched, zero if none was
+	DispatchedAt time.Time
+	// Age of the notification when it was dispatched, since its LastModified
+	Age time.Duration
+}
+
 // Registrar (aka Registrator :smirk:) is the interface for a component that
 // manages subscriber registration
 type Registrar interface {
@@ -29,9 +57,9 @@ type Registrar interface {
 	Close(subscriber Subscriber)
 }
 
-// NewDispatcher creates and returns a new dispatcher
-func NewDispatcher(delay time.Duration, heartbeatPeriod time.Duration, history History) Dispatcher {
-	return &dispatcher{
+// NewDispatcher creates and returns a new dispatcher, delays and heartbeats are timed by the given clock
+func NewDispatcher(delay time.Duration, heartbeatPeriod time.Duration, history History, clk clock.Clock) Dispatcher {
+	d := &dispatcher{
 		delay:           delay,
 		heartbeatPeriod: heartbeatPeriod,
 		inbound:         make(chan Notification),
@@ -39,10 +67,18 @@ func NewDispatcher(delay time.Duration, heartbeatPeriod time.Duration, history H
 		lock:            &sync.RWMutex{},
 		history:         history,
 		stopChan:        make(chan bool),
+		settingsLock:    &sync.RWMutex{},
+		reconfigured:    make(chan struct{}, 1),
+		clock:           clk,
 	}
+	d.lastTick.Store(time.Time{})
+	d.freshness.Store(Freshness{})
+	return d
 }
 
 type dispatcher struct {
+	// delayed is first to be 64-bit aligned for atomic operations
+	delayed         int64
 	delay           time.Duration
 	heartbeatPeriod time.Duration
 	inbound         chan Notification
@@ -50,86 +86,214 @@ type dispatcher struct {
 	lock            *sync.RWMutex
 	history         History
 	stopChan        chan bool
+	settingsLock    *sync.RWMutex
+	reconfigured    chan struct{}
+	clock           clock.Clock
+	lastTick        atomic.Value
+	freshness       atomic.Value
 }
 
 func (d *dispatcher) Start() {
-	heartbeat := time.NewTimer(d.heartbeatPeriod)
+	heartbeat := d.clock.NewTimer(d.getHeartbeatPeriod())
+	// the heartbeat is rescheduled before any work, so that its period does not depend on how long the work takes
+	resetHeartbeat := func() {
+		if !heartbeat.Stop() {
+			select {
+			case <-heartbeat.C():
+			default:
+			}
+		}
+		heartbeat.Reset(d.getHeartbeatPeriod())
+	}
 
+	d.tick()
 	for {
 		select {
 		case notification := <-d.inbound:
+			resetHeartbeat()
+			d.tick()
 			d.forwardToSubscribers(notification)
-		case <-heartbeat.C:
+		case <-heartbeat.C():
+			heartbeat.Reset(d.getHeartbeatPeriod())
+			d.tick()
 			d.heartbeat()
+		case <-d.reconfigured:
+			resetHeartbeat()
 		case <-d.stopChan:
 			heartbeat.Stop()
 			return
 		}
+	}
+}
+
+func (d *dispatcher) tick() {
+	d.lastTick.Store(d.clock.Now())
+}
 
-		heartbeat.Reset(d.heartbeatPeriod)
+// CheckAlive returns an error if the dispatch loop is not started, or has not ticked for several heartbeat periods,
+// i.e. it is blocked sending to a subscriber
+func (d *dispatcher) CheckAlive() error {
+	lastTick := d.lastTick.Load().(time.Time)
+	if lastTick.IsZero() {
+		return errors.New("the dispatcher is not started")
 	}
+	if since := d.clock.Now().Sub(lastTick); since > missedTicks*d.getHeartbeatPeriod() {
+		return fmt.Errorf("the dispatcher has not ticked for %v", since)
+	}
+	return nil
+}
+
+// Freshness returns how fresh the latest notification dispatched was
+func (d *dispatcher) Freshness() Freshness {
+	return d.freshness.Load().(Freshness)
+}
+
+func (d *dispatcher) recordFreshness(n Notification) {
+	f := Freshness{DispatchedAt: d.clock.Now()}
+	if lastModified, err := time.Parse(time.RFC3339Nano, n.LastModified); err == nil {
+		f.Age = f.DispatchedAt.Sub(lastModified)
+		NotificationAgeTimer.Update(f.Age)
+	}
+	d.freshness.Store(f)
+}
+
+// Delayed returns the number of notifications waiting for the cache delay before being dispatched
+func (d *dispatcher) Delayed() int {
+	return int(atomic.LoadInt64(&d.delayed))
+}
+
+// Reconfigure changes the delay of the notifications sent from now on and restarts the heartbeat with the new period
+func (d *dispatcher) Reconfigure(delay time.Duration, heartbeatPeriod time.Duration) {
+	d.settingsLock.Lock()
+	d.delay = delay
+	d.heartbeatPeriod = heartbeatPeriod
+	d.settingsLock.Unlock()
+
+	select {
+	case d.reconfigured <- struct{}{}:
+	default:
+	}
+	log.WithField("delay", delay).WithField("heartbeatPeriod", heartbeatPeriod).Info("Reconfigured dispatcher")
+}
+
+func (d *dispatcher) getDelay() time.Duration {
+	d.settingsLock.RLock()
+	defer d.settingsLock.RUnlock()
+	return d.delay
+}
+
+func (d *dispatcher) getHeartbeatPeriod() time.Duration {
+	d.settingsLock.RLock()
+	defer d.settingsLock.RUnlock()
+	return d.heartbeatPeriod
 }
 
 func (d *dispatcher) forwardToSubscribers(notification Notification) {
 	d.lock.RLock()
 	defer d.lock.RUnlock()
 
+	d.recordFreshness(notification)
+
+	// the writes to the subscribers are traced as children of the fan-out
+	span := tracing.Start("dispatch.fanout", notification.Trace)
+	span.SetAttribute("transaction_id", notification.PublishReference)
+	notification.Trace = span.SpanContext()
+
 	var sent, failed, skipped int
 	defer func() {
 		log.WithFields(map[string]interface{}{"transaction_id": notification.PublishReference, "resource": notification.APIURL, "sent": sent, "failed": failed, "skipped": skipped}).
 			Info("Processed subscribers.")
+		span.SetAttribute("sent", sent)
+		span.SetAttribute("failed", failed)
+		span.SetAttribute("skipped", skipped)
+		span.Finish()
 	}()
 
+	// subscribers of the same kind share the event, so that the notification is marshalled once per format
+	events := map[bool]Event{}
 	for sub := range d.subscribers {
 		entry := log.WithField("transaction_id", notification.PublishReference).
 			WithField("resource", notification.APIURL).
 			WithField("subscriberAddress", sub.Address()).
 			WithField("subscriberSince", sub.Since().Format(time.RFC3339))
 
-		if !sub.matchesContentType(notification) {
+		if !matches(sub, notification) {
 			skipped++
 			entry.Info("Skipping subscriber.")
 			continue
 		}
 
-		err := sub.send(notification)
-		if err != nil {
-			failed++
-			entry.WithError(err).Warn("Failed forwarding to subscriber.")
-		} else {
-			sent++
-			entry.Info("Forwarding to subscriber.")
+		e, found := events[isMonitor(sub)]
+		if !found {
+			var err error
+			e, err = sub.event(notification)
+			if err != nil {
+				failed++
+				entry.WithError(err).Warn("Failed forwarding to subscriber.")
+				continue
+			}
+			events[isMonitor(sub)] = e
 		}
+		sub.writeOnMsgChannel(e)
+		sent++
+		entry.Info("Forwarding to subscriber.")
 	}
 
 	d.history.Push(notification)
 }
 
+func matches(sub Subscriber, n Notification) bool {
+	return sub.matchesContentType(n) && sub.matchesHeaders(n) && (!n.MonitorOnly || isMonitor(sub))
+}
+
 func (d *dispatcher) heartbeat() {
 	d.lock.RLock()
 	defer d.lock.RUnlock()
 	for sub := range d.subscribers {
-		sub.writeOnMsgChannel(heartbeatMsg)
+		sub.writeOnMsgChannel(heartbeatEvent)
 	}
 }
 
+// Reconnect asks all subscribers to reconnect, i.e. before shutting down so they can move to another replica
+func (d *dispatcher) Reconnect() {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	for sub := range d.subscribers {
+		sub.writeOnMsgChannel(reconnectEvent)
+	}
+	log.WithField("subscribers", len(d.subscribers)).Info("Asked subscribers to reconnect")
+}
+
 func (d *dispatcher) Stop() {
 	d.stopChan <- true
 }
 
 func (d *dispatcher) Send(notifications ...Notification) {
-	log.WithField("batchSize", len(notifications)).Infof("Received notifications batch. Waiting configured delay (%v).", d.delay)
+	delay := d.getDelay()
+	log.WithField("batchSize", len(notifications)).Infof("Received notifications batch. Waiting configured delay (%v).", delay)
+	// the delay starts when the notifications are sent, not when the goroutine is scheduled
+	delayed := d.delayForCache(delay)
+	atomic.AddInt64(&d.delayed, int64(len(notifications)))
+	spans := make([]*tracing.Span, len(notifications))
+	for i, n := range notifications {
+		spans[i] = tracing.Start("dispatch.delay", n.Trace)
+		spans[i].SetAttribute("transaction_id", n.PublishReference)
+		spans[i].SetAttribute("delay", delay)
+	}
 	go func() {
-		d.delayForCache()
-		for _, n := range notifications {
-			n.NotificationDate = time.Now().Format(rfc3339Millis)
+		<-delayed
+		for i, n := range notifications {
+			spans[i].Finish()
+			n.Trace = spans[i].SpanContext()
+			n.NotificationDate = d.clock.Now().Format(rfc3339Millis)
 			d.inbound <- n
+			atomic.AddInt64(&d.delayed, -1)
 		}
 	}()
 }
 
-func (d *dispatcher) delayForCache() {
-	time.Sleep(d.delay)
+func (d *dispatcher) delayForCache(delay time.Duration) <-chan time.Time {
+	return d.clock.After(delay)
 }
 
 func (d *dispatcher) Register(subscriber Subscriber) {
@@ -137,9 +301,9 @@ func (d *dispatcher) Register(subscriber Subscriber) {
 	defer d.lock.Unlock()
 
 	d.subscribers[subscriber] = struct{}{}
-	log.WithField("subscriber", subscriber.Address()).WithField("subscriberType", reflect.TypeOf(subscriber).Elem().Name()).WithField("acceptedContentType", subscriber.AcceptedContentType()).Info("Registered new subscriber")
+	log.WithField("subscriber", subscriber.Address()).WithField("identity", subscriber.Identity()).WithField("subscriberType", reflect.TypeOf(subscriber).Elem().Name()).WithField("acceptedContentType", subscriber.AcceptedContentType()).Info("Registered new subscriber")
 
-	subscriber.writeOnMsgChannel(heartbeatMsg)
+	subscriber.writeOnMsgChannel(heartbeatEvent)
 }
 
 func (d *dispatcher) Subscribers() []Subscriber {
@@ -2,11 +2,13 @@ package dispatch
 
 import (
 	"encoding/json"
-	"math/rand"
+	"sync"
 	"testing"
 	"time"
 
 	logTest "github.com/Financial-Times/go-logger/test"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/tracing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -20,6 +22,11 @@ var delay = 2 * time.Second
 var heartbeat = 3 * time.Second
 var historySize = 10
 
+var start = time.Date(2016, 11, 2, 11, 0, 0, 0, time.UTC)
+
+// timeout is the real time allowed for the dispatcher goroutines to schedule their timers
+var timeout = time.Second
+
 var n1 = Notification{
 	APIURL:           "http://api.ft.com/content/7998974a-1e97-11e6-b286-cddde55ca122",
 	ID:               "http://www.ft.com/thing/7998974a-1e97-11e6-b286-cddde55ca122",
@@ -38,76 +45,130 @@ var n2 = Notification{
 }
 var zeroTime = time.Time{}
 
+// startDispatcher starts a dispatcher timed by a fake clock, once its heartbeat is scheduled
+func startDispatcher(t *testing.T, heartbeatPeriod time.Duration, h History) (Dispatcher, *clock.Fake) {
+	clk := clock.NewFake(start)
+	d := NewDispatcher(delay, heartbeatPeriod, h, clk)
+	go d.Start()
+	require.True(t, clk.WaitForTimers(1, timeout), "The heartbeat is scheduled")
+	return d, clk
+}
+
 func TestShouldDispatchNotificationsToMultipleSubscribers(t *testing.T) {
 	h := NewHistory(historySize)
-	d := NewDispatcher(delay, heartbeat, h)
-
-	m := NewMonitorSubscriber("192.168.1.2", contentTypeFilter)
-	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter)
-
-	go d.Start()
+	d, clk := startDispatcher(t, heartbeat, h)
 	defer d.Stop()
 
+	m := NewMonitorSubscriber("192.168.1.2", contentTypeFilter, nil, clk)
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
+
 	d.Register(s)
 	d.Register(m)
 
-	notBefore := time.Now()
 	d.Send(n1, n2)
+	clk.Advance(delay)
+	sent := start.Add(delay)
 
-	actualhbMessage := <-s.NotificationChannel()
+	actualhbMessage := (<-s.NotificationChannel()).Data
 	assert.Equal(t, heartbeatMsg, actualhbMessage, "First message is a heartbeat")
 
-	actualN1StdMsg := <-s.NotificationChannel()
-	verifyNotificationResponse(t, n1, zeroTime, zeroTime, actualN1StdMsg)
+	actualN1StdMsg := (<-s.NotificationChannel()).Data
+	verifyNotificationResponse(t, n1, zeroTime, actualN1StdMsg)
 
-	actualN2StdMsg := <-s.NotificationChannel()
-	verifyNotificationResponse(t, n2, zeroTime, zeroTime, actualN2StdMsg)
+	actualN2StdMsg := (<-s.NotificationChannel()).Data
+	verifyNotificationResponse(t, n2, zeroTime, actualN2StdMsg)
 
-	actualhbMessage = <-m.NotificationChannel()
+	actualhbMessage = (<-m.NotificationChannel()).Data
 	assert.Equal(t, heartbeatMsg, actualhbMessage, "First message is a heartbeat")
 
-	actualN1MonitorMsg := <-m.NotificationChannel()
-	verifyNotificationResponse(t, n1, notBefore, time.Now(), actualN1MonitorMsg)
+	actualN1MonitorMsg := (<-m.NotificationChannel()).Data
+	verifyNotificationResponse(t, n1, sent, actualN1MonitorMsg)
 
-	actualN2MonitorMsg := <-m.NotificationChannel()
-	verifyNotificationResponse(t, n2, notBefore, time.Now(), actualN2MonitorMsg)
+	actualN2MonitorMsg := (<-m.NotificationChannel()).Data
+	verifyNotificationResponse(t, n2, sent, actualN2MonitorMsg)
 }
 
-func TestShouldDispatchNotificationsToSubscribersByType(t *testing.T) {
-	hook := logTest.NewTestHook("notifications-push")
+func TestDispatchedEventIDs(t *testing.T) {
+	h := NewHistory(historySize)
+	d, clk := startDispatcher(t, heartbeat, h)
+	defer d.Stop()
+
+	m := NewMonitorSubscriber("192.168.1.2", contentTypeFilter, nil, clk)
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
+
+	d.Register(s)
+	d.Register(m)
 
+	d.Send(n1)
+	clk.Advance(delay)
+
+	assert.Equal(t, "", (<-s.NotificationChannel()).ID, "Heartbeats have no event ID")
+	assert.Equal(t, EventID(n1), (<-s.NotificationChannel()).ID, "Standard subscribers receive the event ID of the notification")
+
+	assert.Equal(t, "", (<-m.NotificationChannel()).ID, "Heartbeats have no event ID")
+	assert.Equal(t, EventID(n1), (<-m.NotificationChannel()).ID, "Monitor subscribers receive the same event ID")
+}
+
+func TestSubscribersOfTheSameKindShareEvents(t *testing.T) {
 	h := NewHistory(historySize)
-	d := NewDispatcher(delay, heartbeat, h)
+	d, clk := startDispatcher(t, heartbeat, h)
+	defer d.Stop()
 
-	m := NewMonitorSubscriber("192.168.1.2", contentTypeFilter)
-	s := NewStandardSubscriber("192.168.1.3", typeArticle)
+	s1 := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
+	s2 := NewStandardSubscriber("192.168.1.4", contentTypeFilter, nil, clk)
+	m := NewMonitorSubscriber("192.168.1.2", contentTypeFilter, nil, clk)
+	for _, s := range []Subscriber{s1, s2, m} {
+		d.Register(s)
+		<-s.NotificationChannel()
+	}
 
-	go d.Start()
+	d.Send(n1)
+	clk.Advance(delay)
+
+	e1 := <-s1.NotificationChannel()
+	e2 := <-s2.NotificationChannel()
+	em := <-m.NotificationChannel()
+	assert.True(t, e1.encoded == e2.encoded, "Standard subscribers share the encodings of the notification")
+	assert.False(t, e1.encoded == em.encoded, "Monitor subscribers get their own encodings")
+	assert.Equal(t, "", e1.Notifications[0].PublishReference)
+	assert.Equal(t, n1.PublishReference, em.Notifications[0].PublishReference)
+}
+
+func TestShouldDispatchNotificationsToSubscribersByType(t *testing.T) {
+	hook := logTest.NewTestHook("notifications-push")
+
+	h := NewHistory(historySize)
+	d, clk := startDispatcher(t, heartbeat, h)
 	defer d.Stop()
 
+	m := NewMonitorSubscriber("192.168.1.2", contentTypeFilter, nil, clk)
+	s := NewStandardSubscriber("192.168.1.3", typeArticle, nil, clk)
+
 	d.Register(s)
 	d.Register(m)
 
-	notBefore := time.Now()
 	d.Send(n1, n2)
+	clk.Advance(delay)
+	sent := start.Add(delay)
 
-	actualhbMessage := <-s.NotificationChannel()
+	actualhbMessage := (<-s.NotificationChannel()).Data
 	assert.Equal(t, heartbeatMsg, actualhbMessage, "First message is a heartbeat")
 
-	actualN2StdMsg := <-s.NotificationChannel()
-	verifyNotificationResponse(t, n2, zeroTime, zeroTime, actualN2StdMsg)
-
-	anotherHbMsg := <-s.NotificationChannel()
-	assert.Equal(t, heartbeatMsg, anotherHbMsg, "Third message is a heartbeat")
+	actualN2StdMsg := (<-s.NotificationChannel()).Data
+	verifyNotificationResponse(t, n2, zeroTime, actualN2StdMsg)
 
-	actualhbMessage = <-m.NotificationChannel()
+	actualhbMessage = (<-m.NotificationChannel()).Data
 	assert.Equal(t, heartbeatMsg, actualhbMessage, "First message is a heartbeat")
 
-	actualN1MonitorMsg := <-m.NotificationChannel()
-	verifyNotificationResponse(t, n1, notBefore, time.Now(), actualN1MonitorMsg)
+	actualN1MonitorMsg := (<-m.NotificationChannel()).Data
+	verifyNotificationResponse(t, n1, sent, actualN1MonitorMsg)
+
+	actualN2MonitorMsg := (<-m.NotificationChannel()).Data
+	verifyNotificationResponse(t, n2, sent, actualN2MonitorMsg)
 
-	actualN2MonitorMsg := <-m.NotificationChannel()
-	verifyNotificationResponse(t, n2, notBefore, time.Now(), actualN2MonitorMsg)
+	clk.Advance(heartbeat)
+	anotherHbMsg := (<-s.NotificationChannel()).Data
+	assert.Equal(t, heartbeatMsg, anotherHbMsg, "Third message is a heartbeat")
 
 	for _, e := range hook.AllEntries() {
 		tid := e.Data["transaction_id"]
@@ -133,16 +194,89 @@ func TestShouldDispatchNotificationsToSubscribersByType(t *testing.T) {
 	}
 }
 
-func TestAddAndDeleteOfSubscribers(t *testing.T) {
+func TestShouldDispatchMonitorOnlyNotificationsToMonitorSubscribers(t *testing.T) {
 	h := NewHistory(historySize)
-	d := NewDispatcher(delay, heartbeat, h)
+	d, clk := startDispatcher(t, heartbeat, h)
+	defer d.Stop()
 
-	m := NewMonitorSubscriber("192.168.1.2", contentTypeFilter)
-	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter)
+	m := NewMonitorSubscriber("192.168.1.2", contentTypeFilter, nil, clk)
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
 
-	go d.Start()
+	d.Register(s)
+	d.Register(m)
+
+	monitorOnly := n1
+	monitorOnly.MonitorOnly = true
+
+	d.Send(monitorOnly, n2)
+	clk.Advance(delay)
+	sent := start.Add(delay)
+
+	actualhbMessage := (<-s.NotificationChannel()).Data
+	assert.Equal(t, heartbeatMsg, actualhbMessage, "First message is a heartbeat")
+
+	actualN2StdMsg := (<-s.NotificationChannel()).Data
+	verifyNotificationResponse(t, n2, zeroTime, actualN2StdMsg)
+
+	actualhbMessage = (<-m.NotificationChannel()).Data
+	assert.Equal(t, heartbeatMsg, actualhbMessage, "First message is a heartbeat")
+
+	actualN1MonitorMsg := (<-m.NotificationChannel()).Data
+	verifyNotificationResponse(t, n1, sent, actualN1MonitorMsg)
+
+	actualN2MonitorMsg := (<-m.NotificationChannel()).Data
+	verifyNotificationResponse(t, n2, sent, actualN2MonitorMsg)
+}
+
+func TestShouldDispatchNotificationsToSubscribersByHeaders(t *testing.T) {
+	h := NewHistory(historySize)
+	d, clk := startDispatcher(t, heartbeat, h)
+	defer d.Stop()
+
+	methode := HeaderFilter{"Origin-System-Id": "http://cmdb.ft.com/systems/methode-web-pub"}
+	m := NewMonitorSubscriber("192.168.1.2", contentTypeFilter, methode, clk)
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, methode, clk)
+
+	d.Register(s)
+	d.Register(m)
+
+	fromMethode := n1
+	fromMethode.Headers = map[string]string{"origin-system-id": "http://cmdb.ft.com/systems/methode-web-pub"}
+	fromWordpress := n2
+	fromWordpress.Headers = map[string]string{"Origin-System-Id": "http://cmdb.ft.com/systems/wordpress"}
+
+	d.Send(fromWordpress, fromMethode)
+	clk.Advance(delay)
+
+	actualhbMessage := (<-s.NotificationChannel()).Data
+	assert.Equal(t, heartbeatMsg, actualhbMessage, "First message is a heartbeat")
+
+	actualStdMsg := (<-s.NotificationChannel()).Data
+	verifyNotificationResponse(t, n1, zeroTime, actualStdMsg)
+	assert.NotContains(t, actualStdMsg, "headers", "Headers are not sent to standard subscribers")
+
+	actualhbMessage = (<-m.NotificationChannel()).Data
+	assert.Equal(t, heartbeatMsg, actualhbMessage, "First message is a heartbeat")
+
+	actualMonitorMsg := (<-m.NotificationChannel()).Data
+	actualNotifications := []Notification{}
+	require.NoError(t, json.Unmarshal([]byte(actualMonitorMsg), &actualNotifications))
+	assert.Equal(t, n1.ID, actualNotifications[0].ID, "ID")
+	assert.Equal(t, fromMethode.Headers, actualNotifications[0].Headers, "Headers are sent to monitor subscribers")
+}
+
+func TestAddAndDeleteOfSubscribers(t *testing.T) {
+	h := NewHistory(historySize)
+	d, clk := startDispatcher(t, heartbeat, h)
 	defer d.Stop()
 
+	m := NewMonitorSubscriber("192.168.1.2", contentTypeFilter, nil, clk)
+	clk.Advance(time.Minute)
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
+
+	assert.Equal(t, start, m.Since(), "Monitor subscriber is subscribed since the time of the clock")
+	assert.Equal(t, start.Add(time.Minute), s.Since(), "Standard subscriber is subscribed since the time of the clock")
+
 	d.Register(s)
 	d.Register(m)
 
@@ -172,164 +306,210 @@ func TestAddAndDeleteOfSubscribers(t *testing.T) {
 
 func TestDispatchDelay(t *testing.T) {
 	h := NewHistory(historySize)
-	d := NewDispatcher(delay, heartbeat, h)
-
-	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter)
-
-	go d.Start()
+	d, clk := startDispatcher(t, heartbeat, h)
 	defer d.Stop()
 
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
+	m := NewMonitorSubscriber("192.168.1.2", contentTypeFilter, nil, clk)
+
 	d.Register(s)
+	d.Register(m)
 
-	actualhbMessage := <-s.NotificationChannel()
+	actualhbMessage := (<-s.NotificationChannel()).Data
+	assert.Equal(t, heartbeatMsg, actualhbMessage, "First message is a heartbeat")
+	<-m.NotificationChannel()
 
-	start := time.Now()
-	go d.Send(n1)
+	d.Send(n1)
 
-	actualN1StdMsg := <-s.NotificationChannel()
+	clk.Advance(delay - time.Millisecond)
+	assert.Equal(t, 2, clk.Timers(), "The notification is still delayed")
+	assertNoMessage(t, s)
 
-	stop := time.Now()
+	clk.Advance(time.Millisecond)
+	assert.Equal(t, 1, clk.Timers(), "The notification is no longer delayed")
 
-	actualDelay := stop.Sub(start)
+	actualN1StdMsg := (<-s.NotificationChannel()).Data
+	verifyNotificationResponse(t, n1, zeroTime, actualN1StdMsg)
 
-	assert.Equal(t, heartbeatMsg, actualhbMessage, "First message is a heartbeat")
-	verifyNotificationResponse(t, n1, zeroTime, zeroTime, actualN1StdMsg)
-	assert.InEpsilon(t, delay.Nanoseconds(), actualDelay.Nanoseconds(), 0.05, "The delay is correct with 0.05 relative error")
+	actualN1MonitorMsg := (<-m.NotificationChannel()).Data
+	verifyNotificationResponse(t, n1, start.Add(delay), actualN1MonitorMsg)
 }
 
 func TestHeartbeat(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Heartbeat for long tests only.")
-	}
-
 	h := NewHistory(10)
-	d := NewDispatcher(delay, heartbeat, h)
-
-	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter)
-
-	start := time.Now()
-	go d.Start()
+	d, clk := startDispatcher(t, heartbeat, h)
 	defer d.Stop()
+
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
 	d.Register(s)
 
-	actualHbMsg := <-s.NotificationChannel()
+	actualHbMsg := (<-s.NotificationChannel()).Data
 	assert.Equal(t, heartbeatMsg, actualHbMsg, "The first heartbeat message is correct")
 
-	actualHbMsg = <-s.NotificationChannel()
-	actualHbDelay := time.Since(start)
-	assert.InEpsilon(t, heartbeat.Nanoseconds(), actualHbDelay.Nanoseconds(), 0.05, "The first heartbeat delay is correct with 0.05 relative error")
-	assert.Equal(t, heartbeatMsg, actualHbMsg, "The second heartbeat message is correct")
-
-	start = start.Add(heartbeat)
-	actualHbMsg = <-s.NotificationChannel()
-	actualHbDelay = time.Since(start)
-
-	assert.InEpsilon(t, heartbeat.Nanoseconds(), actualHbDelay.Nanoseconds(), 0.05, "The second heartbeat delay is correct with 0.05 relative error")
-	assert.Equal(t, heartbeatMsg, actualHbMsg, "The third heartbeat message is correct")
-
-	start = start.Add(heartbeat)
-	actualHbMsg = <-s.NotificationChannel()
-	actualHbDelay = time.Since(start)
-
-	assert.InEpsilon(t, heartbeat.Nanoseconds(), actualHbDelay.Nanoseconds(), 0.05, "The third heartbeat delay is correct with 0.05 relative error")
-	assert.Equal(t, heartbeatMsg, actualHbMsg, "The fourth heartbeat message is correct")
+	expectHeartbeatAfter(t, clk, s, heartbeat, "second")
+	expectHeartbeatAfter(t, clk, s, heartbeat, "third")
+	expectHeartbeatAfter(t, clk, s, heartbeat, "fourth")
 }
-func TestHeartbeatWithNotifications(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Heartbeat for long tests only.")
-	}
 
+func TestHeartbeatWithNotifications(t *testing.T) {
 	h := NewHistory(historySize)
-	d := NewDispatcher(delay, heartbeat, h)
-
-	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter)
-
-	start := time.Now()
-	go d.Start()
+	d, clk := startDispatcher(t, heartbeat, h)
 	defer d.Stop()
+
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
 	d.Register(s)
 
-	actualHbMsg := <-s.NotificationChannel()
+	actualHbMsg := (<-s.NotificationChannel()).Data
 	assert.Equal(t, heartbeatMsg, actualHbMsg, "The first heartbeat message is correct")
 
-	actualHbMsg = <-s.NotificationChannel()
-	actualHbDelay := time.Since(start)
-	assert.InEpsilon(t, heartbeat.Nanoseconds(), actualHbDelay.Nanoseconds(), 0.05, "The first heartbeat delay is correct with 0.05 relative error")
-	assert.Equal(t, heartbeatMsg, actualHbMsg, "The second heartbeat message is correct")
+	expectHeartbeatAfter(t, clk, s, heartbeat, "second")
 
-	// send a notification
-	start = start.Add(heartbeat)
-	randDuration1 := time.Duration(rand.Intn(int(heartbeat.Seconds()-delay.Seconds()))) * time.Second
-	time.Sleep(randDuration1)
+	// send a notification, the heartbeat is due a period after it is dispatched
+	clk.Advance(500 * time.Millisecond)
 	d.Send(n1)
-	actualN1StdMsg := <-s.NotificationChannel()
-	verifyNotificationResponse(t, n1, zeroTime, zeroTime, actualN1StdMsg)
+	clk.Advance(delay)
+	actualN1StdMsg := (<-s.NotificationChannel()).Data
+	verifyNotificationResponse(t, n1, zeroTime, actualN1StdMsg)
 
-	// waiting for the second heartbeat
-	actualHbMsg = <-s.NotificationChannel()
-	actualHbDelay = time.Since(start.Add(delay))
-	assert.InEpsilon(t, randDuration1.Nanoseconds()+heartbeat.Nanoseconds(), actualHbDelay.Nanoseconds(), 0.05, "The second heartbeat delay is correct with 0.05 relative error")
-	assert.Equal(t, heartbeatMsg, actualHbMsg, "The third heartbeat message is correct")
+	expectHeartbeatAfter(t, clk, s, heartbeat, "third")
 
 	// send a notification
-	start = time.Now()
-	randDuration2 := time.Duration(rand.Intn(int(heartbeat.Seconds()-delay.Seconds()))) * time.Second
-	time.Sleep(randDuration2)
+	clk.Advance(500 * time.Millisecond)
 	d.Send(n2)
-	actualN2StdMsg := <-s.NotificationChannel()
-	verifyNotificationResponse(t, n2, zeroTime, zeroTime, actualN2StdMsg)
+	clk.Advance(delay)
+	actualN2StdMsg := (<-s.NotificationChannel()).Data
+	verifyNotificationResponse(t, n2, zeroTime, actualN2StdMsg)
 
 	// send two notifications
-	randDuration3 := time.Duration(rand.Intn(int(heartbeat.Seconds()-delay.Seconds()))) * time.Second
-	time.Sleep(randDuration3)
 	d.Send(n1, n2)
-	actualN1StdMsg = <-s.NotificationChannel()
-	verifyNotificationResponse(t, n1, zeroTime, zeroTime, actualN1StdMsg)
-	actualN2StdMsg = <-s.NotificationChannel()
-	verifyNotificationResponse(t, n2, zeroTime, zeroTime, actualN2StdMsg)
-
-	// waiting for the third heartbeat
-	actualHbMsg = <-s.NotificationChannel()
-	actualHbDelay = time.Since(start.Add(2 * delay))
-	assert.InEpsilon(t, randDuration2.Nanoseconds()+randDuration3.Nanoseconds()+heartbeat.Nanoseconds(), actualHbDelay.Nanoseconds(), 0.05, "The third heartbeat delay is correct with 0.05 relative error")
-	assert.Equal(t, heartbeatMsg, actualHbMsg, "The fourth heartbeat message is correct")
+	clk.Advance(delay)
+	actualN1StdMsg = (<-s.NotificationChannel()).Data
+	verifyNotificationResponse(t, n1, zeroTime, actualN1StdMsg)
+	actualN2StdMsg = (<-s.NotificationChannel()).Data
+	verifyNotificationResponse(t, n2, zeroTime, actualN2StdMsg)
+
+	expectHeartbeatAfter(t, clk, s, heartbeat, "fourth")
 }
-func TestDispatchedNotificationsInHistory(t *testing.T) {
-	h := NewHistory(historySize)
-	d := NewDispatcher(delay, heartbeat, h)
 
-	go d.Start()
+func TestReconfigureHeartbeat(t *testing.T) {
+	h := NewHistory(historySize)
+	d, clk := startDispatcher(t, time.Hour, h)
 	defer d.Stop()
 
-	notBefore := time.Now()
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
+	d.Register(s)
+
+	actualHbMsg := (<-s.NotificationChannel()).Data
+	assert.Equal(t, heartbeatMsg, actualHbMsg, "The first heartbeat message is correct")
+
+	newHeartbeat := 100 * time.Millisecond
+	d.Reconfigure(delay, newHeartbeat)
+	require.True(t, clk.WaitForDeadline(start.Add(newHeartbeat), timeout), "The heartbeat is rescheduled with the new period")
+
+	expectHeartbeatAfter(t, clk, s, newHeartbeat, "second")
+}
+
+func TestDispatchedNotificationsInHistory(t *testing.T) {
+	h := NewHistory(historySize)
+	d, clk := startDispatcher(t, heartbeat, h)
+	defer d.Stop()
 
 	d.Send(n1, n2)
-	time.Sleep(time.Duration(delay.Seconds()+1) * time.Second)
+	clk.Advance(delay)
+	waitForHistory(t, h, func(notifications []Notification) bool { return len(notifications) == 2 })
 
-	notAfter := time.Now()
-	verifyNotification(t, n1, notBefore, notAfter, h.Notifications()[1])
-	verifyNotification(t, n2, notBefore, notAfter, h.Notifications()[0])
+	verifyNotification(t, n1, start.Add(delay), h.Notifications()[1])
+	verifyNotification(t, n2, start.Add(delay), h.Notifications()[0])
 	assert.Len(t, h.Notifications(), 2, "History contains 2 notifications")
 
 	for i := 0; i < historySize; i++ {
 		d.Send(n2)
 	}
-	time.Sleep(time.Duration(delay.Seconds()+1) * time.Second)
+	clk.Advance(delay)
+	waitForHistory(t, h, func(notifications []Notification) bool {
+		for _, n := range notifications {
+			if n.PublishReference == n1.PublishReference {
+				return false
+			}
+		}
+		return true
+	})
 
 	assert.Len(t, h.Notifications(), historySize, "History contains 10 notifications")
 	assert.NotContains(t, h.Notifications(), n1, "History does not contain old notification")
 }
 
-func verifyNotificationResponse(t *testing.T, expected Notification, notBefore time.Time, notAfter time.Time, actualMsg string) {
+func TestReconnect(t *testing.T) {
+	h := NewHistory(historySize)
+	d, clk := startDispatcher(t, heartbeat, h)
+	defer d.Stop()
+
+	m := NewMonitorSubscriber("192.168.1.2", contentTypeFilter, nil, clk)
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
+	d.Register(s)
+	d.Register(m)
+	assert.Equal(t, HeartbeatEvent, (<-s.NotificationChannel()).Type, "First message is a heartbeat")
+	assert.Equal(t, HeartbeatEvent, (<-m.NotificationChannel()).Type, "First message is a heartbeat")
+
+	d.Reconnect()
+
+	assert.Equal(t, ReconnectEvent, (<-s.NotificationChannel()).Type)
+	assert.Equal(t, ReconnectEvent, (<-m.NotificationChannel()).Type)
+}
+
+func TestDroppedEvents(t *testing.T) {
+	h := NewHistory(historySize)
+	d, clk := startDispatcher(t, heartbeat, h)
+	defer d.Stop()
+
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
+	d.Register(s)
+	assert.Equal(t, uint64(0), s.Dropped())
+
+	for i := 0; i < cap(s.NotificationChannel())+2; i++ {
+		d.Reconnect()
+	}
+
+	assert.Equal(t, uint64(3), s.Dropped(), "The events sent while the channel is full are counted")
+}
+
+// expectHeartbeatAfter advances the clock by the heartbeat period, checking the heartbeat is not sent a moment earlier
+func expectHeartbeatAfter(t *testing.T, clk *clock.Fake, s Subscriber, period time.Duration, ordinal string) {
+	clk.Advance(period - time.Millisecond)
+	assert.Equal(t, 1, clk.Timers(), "The %s heartbeat is not due yet", ordinal)
+	assertNoMessage(t, s)
+
+	clk.Advance(time.Millisecond)
+	actualHbMsg := (<-s.NotificationChannel()).Data
+	assert.Equal(t, heartbeatMsg, actualHbMsg, "The %s heartbeat message is correct", ordinal)
+}
+
+func assertNoMessage(t *testing.T, s Subscriber) {
+	select {
+	case msg := <-s.NotificationChannel():
+		assert.Fail(t, "Unexpected message", msg.Data)
+	default:
+	}
+}
+
+func waitForHistory(t *testing.T, h History, condition func([]Notification) bool) {
+	deadline := time.Now().Add(timeout)
+	for !condition(h.Notifications()) {
+		require.True(t, time.Now().Before(deadline), "History was not updated in time")
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func verifyNotificationResponse(t *testing.T, expected Notification, notificationDate time.Time, actualMsg string) {
 	actualNotifications := []Notification{}
 	json.Unmarshal([]byte(actualMsg), &actualNotifications)
 	require.True(t, len(actualNotifications) > 0)
 	actual := actualNotifications[0]
 
-	verifyNotification(t, expected, notBefore, notAfter, actual)
+	verifyNotification(t, expected, notificationDate, actual)
 }
 
-func verifyNotification(t *testing.T, expected Notification, notBefore time.Time, notAfter time.Time, actual Notification) {
+func verifyNotification(t *testing.T, expected Notification, notificationDate time.Time, actual Notification) {
 	assert.Equal(t, expected.ID, actual.ID, "ID")
 	assert.Equal(t, expected.Type, actual.Type, "Type")
 	assert.Equal(t, expected.APIURL, actual.APIURL, "APIURL")
@@ -337,9 +517,126 @@ func verifyNotification(t *testing.T, expected Notification, notBefore time.Time
 	if actual.LastModified != "" {
 		assert.Equal(t, expected.LastModified, actual.LastModified, "LastModified")
 		assert.Equal(t, expected.PublishReference, actual.PublishReference, "PublishReference")
+		assert.Equal(t, notificationDate.Format(rfc3339Millis), actual.NotificationDate, "NotificationDate")
+	}
+}
+
+func TestCheckAlive(t *testing.T) {
+	d := NewDispatcher(delay, heartbeat, NewHistory(historySize), clock.NewFake(start))
+	assert.Error(t, d.CheckAlive(), "The dispatcher is not started")
+
+	d, clk := startDispatcher(t, heartbeat, NewHistory(historySize))
+	assert.NoError(t, d.CheckAlive())
+
+	clk.Advance(heartbeat * missedTicks)
+	require.True(t, clk.WaitForTimers(1, timeout), "The heartbeat is rescheduled")
+	assert.NoError(t, d.CheckAlive(), "The heartbeats keep the dispatcher alive")
+
+	d.Stop()
+	clk.Advance(heartbeat*missedTicks + time.Millisecond)
+	assert.Error(t, d.CheckAlive(), "The dispatcher does not tick any more")
+}
+
+func TestDelayed(t *testing.T) {
+	d, clk := startDispatcher(t, heartbeat, NewHistory(historySize))
+	defer d.Stop()
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
+	d.Register(s)
+	<-s.NotificationChannel()
+
+	d.Send(n1, n2)
+	assert.Equal(t, 2, d.Delayed(), "The notifications wait for the cache delay")
+
+	clk.Advance(delay)
+	<-s.NotificationChannel()
+	<-s.NotificationChannel()
+	deadline := time.Now().Add(timeout)
+	for d.Delayed() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, 0, d.Delayed(), "The notifications are dispatched")
+}
+
+func TestFreshness(t *testing.T) {
+	d, clk := startDispatcher(t, heartbeat, NewHistory(historySize))
+	defer d.Stop()
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
+	d.Register(s)
+	<-s.NotificationChannel()
+	assert.True(t, d.Freshness().DispatchedAt.IsZero(), "No notification is dispatched yet")
+
+	clk.Advance(heartbeat)
+	<-s.NotificationChannel()
+	assert.True(t, d.Freshness().DispatchedAt.IsZero(), "Heartbeats do not count")
+
+	d.Send(n1)
+	clk.Advance(delay)
+	<-s.NotificationChannel()
+
+	freshness := d.Freshness()
+	assert.Equal(t, start.Add(heartbeat+delay), freshness.DispatchedAt)
+	lastModified, _ := time.Parse(time.RFC3339Nano, n1.LastModified)
+	assert.Equal(t, start.Add(heartbeat+delay).Sub(lastModified), freshness.Age)
+}
+
+type spanRecorder struct {
+	lock  sync.Mutex
+	spans []*tracing.Span
+}
+
+func (r *spanRecorder) Export(span *tracing.Span) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spans = append(r.spans, span)
+}
 
-		actualDate, _ := time.Parse(rfc3339Millis, actual.NotificationDate)
-		assert.False(t, actualDate.Before(notBefore), "notificationDate is too early")
-		assert.False(t, actualDate.After(notAfter), "notificationDate is too late")
+// waitForSpan returns the first span with the given name, once exported
+func (r *spanRecorder) waitForSpan(t *testing.T, name string) *tracing.Span {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		r.lock.Lock()
+		for _, s := range r.spans {
+			if s.Name == name {
+				r.lock.Unlock()
+				return s
+			}
+		}
+		r.lock.Unlock()
+		time.Sleep(time.Millisecond)
 	}
+	require.FailNow(t, "The span is not exported", name)
+	return nil
+}
+
+func TestDispatchTraced(t *testing.T) {
+	spans := &spanRecorder{}
+	h := NewHistory(historySize)
+	d, clk := startDispatcher(t, heartbeat, h)
+	defer d.Stop()
+	tracing.SetTracer(tracing.NewTracer(spans, clk))
+	defer tracing.SetTracer(nil)
+
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clk)
+	d.Register(s)
+	<-s.NotificationChannel()
+
+	parent, err := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	traced := n1
+	traced.Trace = parent
+	d.Send(traced)
+	clk.Advance(delay)
+	e := <-s.NotificationChannel()
+
+	delayed := spans.waitForSpan(t, "dispatch.delay")
+	assert.Equal(t, parent.TraceID, delayed.Context.TraceID)
+	assert.Equal(t, parent.SpanID, delayed.ParentID)
+	assert.Equal(t, delay, delayed.Duration(), "the delay span lasts the cache delay")
+
+	fanout := spans.waitForSpan(t, "dispatch.fanout")
+	assert.Equal(t, delayed.Context.SpanID, fanout.ParentID)
+	assert.Equal(t, 1, fanout.Attributes["sent"])
+
+	require.Len(t, e.Notifications, 1)
+	assert.Equal(t, fanout.Context, e.Notifications[0].Trace, "the writes to the subscribers are traced as children of the fan-out")
 }
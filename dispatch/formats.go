@@ -0,0 +1,76 @@
+package dispatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+)
+
+// Format is an encoding of the notifications sent to subscribers
+type Format struct {
+	// Name identifies the format, i.e. in the path of its schema
+	Name    string
+	marshal func(notifications []Notification) ([]byte, error)
+}
+
+// Formats of the notifications
+var (
+	// JSONFormat encodes notifications as a JSON array, like the data of the push stream events
+	JSONFormat = Format{Name: "json", marshal: MarshalNotificationsJSON}
+	// NDJSONFormat encodes every notification as a JSON object on its own line
+	NDJSONFormat = Format{Name: "ndjson", marshal: MarshalNotificationsNDJSON}
+	// MsgPackFormat encodes notifications as a MessagePack array of maps, with the same attributes as JSON
+	MsgPackFormat = Format{Name: "msgpack", marshal: MarshalNotificationsMsgPack}
+)
+
+// Marshal encodes the notifications in the format
+func (f Format) Marshal(notifications []Notification) ([]byte, error) {
+	return f.marshal(notifications)
+}
+
+// MarshalNotificationsNDJSON returns the JSON encoding of every notification followed by a new line
+func MarshalNotificationsNDJSON(notifications []Notification) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+
+	for _, n := range notifications {
+		if err := encoder.Encode(n); err != nil {
+			return nil, err
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+// encodings caches the encodings of the notifications of an event, which is shared by all the subscribers
+// it is dispatched to, so that the notifications are marshalled once per format
+type encodings struct {
+	lock    *sync.Mutex
+	formats map[string][]byte
+}
+
+func newEncodings() *encodings {
+	return &encodings{lock: &sync.Mutex{}, formats: map[string][]byte{}}
+}
+
+// Encode returns the notifications of the event in the given format
+func (e Event) Encode(f Format) ([]byte, error) {
+	if f.Name == JSONFormat.Name && e.Data != "" {
+		return []byte(e.Data), nil
+	}
+	if e.encoded == nil {
+		return f.Marshal(e.Notifications)
+	}
+
+	e.encoded.lock.Lock()
+	defer e.encoded.lock.Unlock()
+	if data, found := e.encoded.formats[f.Name]; found {
+		return data, nil
+	}
+	data, err := f.Marshal(e.Notifications)
+	if err != nil {
+		return nil, err
+	}
+	e.encoded.formats[f.Name] = data
+	return data, nil
+}
@@ -0,0 +1,60 @@
+package dispatch
+
+import (
+	"testing"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalNotificationsNDJSON(t *testing.T) {
+	n := Notification{APIURL: "http://api.ft.com/content/1", ID: "http://www.ft.com/thing/1", Type: "http://www.ft.com/thing/ThingChangeType/UPDATE", Title: "Q&A"}
+	data, err := MarshalNotificationsNDJSON([]Notification{n, n})
+	require.NoError(t, err)
+
+	line := `{"apiUrl":"http://api.ft.com/content/1","id":"http://www.ft.com/thing/1","type":"http://www.ft.com/thing/ThingChangeType/UPDATE","title":"Q&A","standout":{"scoop":false}}` + "\n"
+	assert.Equal(t, line+line, string(data))
+
+	data, err = MarshalNotificationsNDJSON(nil)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+func TestEventIsEncodedOncePerFormat(t *testing.T) {
+	marshalled := 0
+	counting := Format{Name: "counting", marshal: func(notifications []Notification) ([]byte, error) {
+		marshalled++
+		return MarshalNotificationsNDJSON(notifications)
+	}}
+
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clock.NewFake(start))
+	e, err := s.event(n1)
+	require.NoError(t, err)
+
+	first, err := e.Encode(counting)
+	require.NoError(t, err)
+	second, err := e.Encode(counting)
+	require.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, 1, marshalled)
+
+	data, err := e.Encode(JSONFormat)
+	require.NoError(t, err)
+	assert.Equal(t, e.Data, string(data), "The JSON encoding is the data of the event")
+}
+
+func TestBatchEncoding(t *testing.T) {
+	s := NewMonitorSubscriber("192.168.1.3", contentTypeFilter, nil, clock.NewFake(start))
+	e1, err := s.event(n1)
+	require.NoError(t, err)
+	e2, err := s.event(n2)
+	require.NoError(t, err)
+
+	data, err := BatchEvents([]Event{e1, e2}).Encode(NDJSONFormat)
+	require.NoError(t, err)
+
+	expected, err := MarshalNotificationsNDJSON([]Notification{n1, n2})
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(data))
+}
@@ -4,6 +4,8 @@ import (
 	"sort"
 	"sync"
 	"time"
+
+	log "github.com/Financial-Times/go-logger"
 )
 
 // History contains the last x notifications pushed out to subscribers.
@@ -40,7 +42,28 @@ func (i *inMemoryHistory) Notifications() []Notification {
 	i.mutex.RLock()
 	defer i.mutex.RUnlock()
 
-	return i.notifications
+	return append([]Notification{}, i.notifications...)
+}
+
+// Missed returns the events of the notifications in history after the one with the given event ID, oldest first,
+// as they would have been sent to the subscriber. It returns false if the event ID is not in history.
+func Missed(history History, sub Subscriber, lastEventID string) ([]Event, bool) {
+	var missed []Event
+	for _, n := range history.Notifications() {
+		if EventID(n) == lastEventID {
+			return missed, true
+		}
+		if !matches(sub, n) {
+			continue
+		}
+		e, err := sub.event(n)
+		if err != nil {
+			log.WithError(err).WithField("transaction_id", n.PublishReference).Warn("Failed resuming subscriber.")
+			continue
+		}
+		missed = append([]Event{e}, missed...)
+	}
+	return nil, false
 }
 
 type byTimestamp []Notification
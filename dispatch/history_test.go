@@ -4,12 +4,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Financial-Times/notifications-push/clock"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHistory(t *testing.T) {
 	history := NewHistory(2)
-	lastModified := time.Now()
+	lastModified := time.Date(2016, 11, 2, 10, 54, 22, 0, time.UTC)
 
 	history.Push(Notification{
 		ID:           "note1",
@@ -38,3 +40,35 @@ func TestHistory(t *testing.T) {
 
 	assert.Equal(t, "note3", notifications[0].ID, "Should be the last pushed notification")
 }
+
+func TestMissed(t *testing.T) {
+	history := NewHistory(10)
+	article := Notification{ID: "note1", PublishReference: "tid_1", ContentType: "Article", LastModified: "2016-11-02T10:54:22.234Z"}
+	pkg := Notification{ID: "note2", PublishReference: "tid_2", ContentType: "ContentPackage", LastModified: "2016-11-02T10:54:23.234Z"}
+	synthetic := Notification{ID: "note3", PublishReference: "SYNTH_tid_3", ContentType: "Article", LastModified: "2016-11-02T10:54:24.234Z", MonitorOnly: true}
+	latest := Notification{ID: "note4", PublishReference: "tid_4", ContentType: "Article", LastModified: "2016-11-02T10:54:25.234Z"}
+	for _, n := range []Notification{article, pkg, synthetic, latest} {
+		history.Push(n)
+	}
+
+	s := NewStandardSubscriber("192.168.1.3", "Article", nil, clock.System())
+	missed, found := Missed(history, s, EventID(article))
+	require.True(t, found)
+	require.Len(t, missed, 1, "Standard subscribers miss only the notifications they would have received")
+	assert.Equal(t, EventID(latest), missed[0].ID)
+	assert.Contains(t, missed[0].Data, `"id":"note4"`)
+	assert.NotContains(t, missed[0].Data, "tid_4", "Standard subscribers do not receive the publish reference")
+
+	m := NewMonitorSubscriber("192.168.1.2", "All", nil, clock.System())
+	missed, found = Missed(history, m, EventID(article))
+	require.True(t, found)
+	require.Len(t, missed, 3)
+	assert.Equal(t, []string{EventID(pkg), EventID(synthetic), EventID(latest)}, []string{missed[0].ID, missed[1].ID, missed[2].ID}, "Missed events are the oldest first")
+
+	missed, found = Missed(history, m, EventID(latest))
+	assert.True(t, found)
+	assert.Empty(t, missed, "Nothing is missed after the latest notification")
+
+	_, found = Missed(history, m, "unknown")
+	assert.False(t, found, "Unknown event IDs cannot be resumed")
+}
@@ -0,0 +1,126 @@
+package dispatch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// MarshalNotificationsMsgPack returns the MessagePack encoding of the notifications, see https://github.com/msgpack/msgpack/blob/master/spec.md.
+// Notifications are encoded from their JSON representation, so that both formats have the same attributes.
+// It is an encoder only, of the subset of the format a JSON document maps to: nil, bool, int (the smallest of the
+// fixint, int 8, 16, 32 and 64 formats), float 64, str (fixstr, str 8, 16 and 32), array and map (fix, 16 and 32)
+// with string keys sorted. Unsigned ints, float 32, bin, ext and timestamps are never written.
+func MarshalNotificationsMsgPack(notifications []Notification) ([]byte, error) {
+	data, err := MarshalNotificationsJSON(notifications)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := writeMsgPack(buffer, value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func writeMsgPack(buffer *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buffer.WriteByte(0xc0)
+	case bool:
+		if v {
+			buffer.WriteByte(0xc3)
+		} else {
+			buffer.WriteByte(0xc2)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			writeMsgPackInt(buffer, i)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		buffer.WriteByte(0xcb)
+		binary.Write(buffer, binary.BigEndian, math.Float64bits(f))
+	case string:
+		writeMsgPackHeader(buffer, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		buffer.WriteString(v)
+	case []interface{}:
+		writeMsgPackHeader(buffer, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			if err := writeMsgPack(buffer, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		// keys are sorted so that the encoding is deterministic
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		writeMsgPackHeader(buffer, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, key := range keys {
+			writeMsgPack(buffer, key)
+			if err := writeMsgPack(buffer, v[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode %T in MessagePack", value)
+	}
+	return nil
+}
+
+// writeMsgPackHeader writes the type and length of a string, array or map, in the fix format if the length
+// is below the fix limit, otherwise with an 8 (when supported), 16 or 32 bits length
+func writeMsgPackHeader(buffer *bytes.Buffer, length int, fix byte, fixLimit int, type8 byte, type16 byte, type32 byte) {
+	switch {
+	case length < fixLimit:
+		buffer.WriteByte(fix | byte(length))
+	case type8 != 0 && length <= math.MaxUint8:
+		buffer.WriteByte(type8)
+		buffer.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buffer.WriteByte(type16)
+		binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(type32)
+		binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+}
+
+func writeMsgPackInt(buffer *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= 127:
+		buffer.WriteByte(byte(i))
+	case i < 0 && i >= -32:
+		buffer.WriteByte(byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		buffer.WriteByte(0xd0)
+		buffer.WriteByte(byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buffer.WriteByte(0xd1)
+		binary.Write(buffer, binary.BigEndian, int16(i))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buffer.WriteByte(0xd2)
+		binary.Write(buffer, binary.BigEndian, int32(i))
+	default:
+		buffer.WriteByte(0xd3)
+		binary.Write(buffer, binary.BigEndian, i)
+	}
+}
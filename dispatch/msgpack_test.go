@@ -0,0 +1,65 @@
+package dispatch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalNotificationsMsgPack(t *testing.T) {
+	n := Notification{
+		APIURL: "a",
+		ID:     "i",
+		Type:   "t",
+		Flags:  []string{},
+		Fields: map[string]interface{}{"n": -1, "z": nil},
+	}
+
+	data, err := MarshalNotificationsMsgPack([]Notification{n})
+	require.NoError(t, err)
+
+	expected := []byte{
+		0x91,                   // array of 1
+		0x86,                   // map of 6, keys sorted
+		0xa6, 'a', 'p', 'i', 'U', 'r', 'l', 0xa1, 'a',
+		0xa2, 'i', 'd', 0xa1, 'i',
+		0xa1, 'n', 0xff, // negative fixint
+		0xa8, 's', 't', 'a', 'n', 'd', 'o', 'u', 't', 0x81, 0xa5, 's', 'c', 'o', 'o', 'p', 0xc2,
+		0xa4, 't', 'y', 'p', 'e', 0xa1, 't',
+		0xa1, 'z', 0xc0,
+	}
+	assert.Equal(t, expected, data)
+}
+
+func TestMsgPackValues(t *testing.T) {
+	long := make([]byte, 40)
+	for i := range long {
+		long[i] = 'x'
+	}
+
+	tests := []struct {
+		json     string
+		expected []byte
+	}{
+		{`true`, []byte{0xc3}},
+		{`127`, []byte{0x7f}},
+		{`200`, []byte{0xd1, 0x00, 0xc8}},
+		{`-100`, []byte{0xd0, 0x9c}},
+		{`70000`, []byte{0xd2, 0x00, 0x01, 0x11, 0x70}},
+		{`5000000000`, []byte{0xd3, 0x00, 0x00, 0x00, 0x01, 0x2a, 0x05, 0xf2, 0x00}},
+		{`1.5`, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{`"` + string(long) + `"`, append([]byte{0xd9, 40}, long...)},
+		{`[]`, []byte{0x90}},
+		{`{}`, []byte{0x80}},
+	}
+
+	for _, test := range tests {
+		var n Notification
+		require.NoError(t, n.UnmarshalJSON([]byte(`{"v":`+test.json+`}`)))
+		data, err := MarshalNotificationsMsgPack([]Notification{{Fields: n.Fields}})
+		require.NoError(t, err, test.json)
+		// the value is the last one of the map, after apiUrl, id, standout and type
+		assert.Equal(t, test.expected, data[len(data)-len(test.expected):], test.json)
+	}
+}
@@ -1,19 +1,119 @@
 package dispatch
 
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/Financial-Times/notifications-push/tracing"
+)
+
 // Notification model
 type Notification struct {
-	APIURL           string   `json:"apiUrl"`
-	ID               string   `json:"id"`
-	Type             string   `json:"type"`
-	PublishReference string   `json:"publishReference,omitempty"`
-	LastModified     string   `json:"lastModified,omitempty"`
-	NotificationDate string   `json:"notificationDate,omitempty"`
-	Title            string   `json:"title,omitempty"`
-	Standout         Standout `json:"standout"`
-	ContentType      string   `json:"-"`
+	APIURL           string                 `json:"apiUrl"`
+	ID               string                 `json:"id"`
+	Type             string                 `json:"type"`
+	PublishReference string                 `json:"publishReference,omitempty"`
+	LastModified     string                 `json:"lastModified,omitempty"`
+	NotificationDate string                 `json:"notificationDate,omitempty"`
+	Title            string                 `json:"title,omitempty"`
+	Standout         Standout               `json:"standout"`
+	Flags            []string               `json:"flags,omitempty"`
+	Headers          map[string]string      `json:"headers,omitempty"`
+	Fields           map[string]interface{} `json:"-"`
+	ContentType      string                 `json:"-"`
+	MonitorOnly      bool                   `json:"-"`
+	// Trace is the context of the latest step of handling the notification, its next steps are traced as children
+	Trace tracing.SpanContext `json:"-"`
 }
 
 // Standout model for a Notification
 type Standout struct {
 	Scoop bool `json:"scoop"`
 }
+
+// EventID returns the ID of the push stream event of a notification. It depends on the notification only, not on
+// when it was dispatched, so that every replica of the service gives the same ID to the same notification.
+func EventID(n Notification) string {
+	hash := sha1.New()
+	for _, value := range []string{n.PublishReference, n.ID, n.Type, n.LastModified} {
+		io.WriteString(hash, value)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:20]
+}
+
+// notificationAttributes are the JSON attributes of a notification that cannot be overridden by additional fields
+var notificationAttributes = jsonAttributes(reflect.TypeOf(Notification{}))
+
+// IsNotificationAttribute checks if the given JSON attribute is part of the notification model
+func IsNotificationAttribute(name string) bool {
+	_, found := notificationAttributes[name]
+	return found
+}
+
+type notificationJSON Notification
+
+// MarshalJSON returns the JSON representation of a notification with its additional fields inlined
+func (n Notification) MarshalJSON() ([]byte, error) {
+	attrs, err := marshalJSONNoEscape(notificationJSON(n))
+	if err != nil || len(n.Fields) == 0 {
+		return attrs, err
+	}
+
+	fields, err := marshalJSONNoEscape(n.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := append(attrs[:len(attrs)-1], ',')
+	return append(merged, fields[1:]...), nil
+}
+
+// UnmarshalJSON reads a notification, collecting attributes outside the notification model as additional fields
+func (n *Notification) UnmarshalJSON(data []byte) error {
+	var attrs notificationJSON
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return err
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for name := range notificationAttributes {
+		delete(fields, name)
+	}
+
+	*n = Notification(attrs)
+	if len(fields) > 0 {
+		n.Fields = fields
+	}
+	return nil
+}
+
+func marshalJSONNoEscape(v interface{}) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buffer.Bytes(), "\n"), nil
+}
+
+func jsonAttributes(t reflect.Type) map[string]struct{} {
+	attrs := map[string]struct{}{}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			attrs[name] = struct{}{}
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,57 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalNotificationWithFields(t *testing.T) {
+	n := Notification{
+		APIURL: "http://api.ft.com/content/7998974a-1e97-11e6-b286-cddde55ca122",
+		ID:     "http://www.ft.com/thing/7998974a-1e97-11e6-b286-cddde55ca122",
+		Type:   "http://www.ft.com/thing/ThingChangeType/UPDATE",
+		Title:  "Markets & more",
+		Fields: map[string]interface{}{"publishedDate": "2016-11-02T10:54:22.234Z", "canBeSyndicated": "yes"},
+	}
+
+	actual, err := MarshalNotificationsJSON([]Notification{n})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"apiUrl":"http://api.ft.com/content/7998974a-1e97-11e6-b286-cddde55ca122","id":"http://www.ft.com/thing/7998974a-1e97-11e6-b286-cddde55ca122","type":"http://www.ft.com/thing/ThingChangeType/UPDATE","title":"Markets & more","standout":{"scoop":false},"canBeSyndicated":"yes","publishedDate":"2016-11-02T10:54:22.234Z"}]`+"\n", string(actual))
+}
+
+func TestUnmarshalNotificationWithFields(t *testing.T) {
+	var n Notification
+	err := json.Unmarshal([]byte(`{"apiUrl":"http://api.ft.com/content/7998974a-1e97-11e6-b286-cddde55ca122","title":"Markets & more","standout":{"scoop":true},"canBeSyndicated":"yes"}`), &n)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "http://api.ft.com/content/7998974a-1e97-11e6-b286-cddde55ca122", n.APIURL)
+	assert.Equal(t, "Markets & more", n.Title)
+	assert.True(t, n.Standout.Scoop)
+	assert.Equal(t, map[string]interface{}{"canBeSyndicated": "yes"}, n.Fields)
+}
+
+func TestEventID(t *testing.T) {
+	n := Notification{
+		APIURL:           "http://api.ft.com/content/7998974a-1e97-11e6-b286-cddde55ca122",
+		ID:               "http://www.ft.com/thing/7998974a-1e97-11e6-b286-cddde55ca122",
+		Type:             "http://www.ft.com/thing/ThingChangeType/UPDATE",
+		PublishReference: "tid_test1",
+		LastModified:     "2016-11-02T10:54:22.234Z",
+	}
+
+	dispatched := n
+	dispatched.NotificationDate = "2016-11-02T10:54:52.234Z"
+	assert.Equal(t, EventID(n), EventID(dispatched), "The event ID does not depend on when the notification is dispatched")
+	assert.Len(t, EventID(n), 20)
+
+	republished := n
+	republished.PublishReference = "tid_test2"
+	assert.NotEqual(t, EventID(n), EventID(republished), "Every publish has its own event ID")
+
+	deleted := n
+	deleted.Type = "http://www.ft.com/thing/ThingChangeType/DELETE"
+	assert.NotEqual(t, EventID(n), EventID(deleted), "Every change has its own event ID")
+}
@@ -5,38 +5,114 @@ import (
 	"encoding/json"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/clock"
 )
 
 // Subscriber represents the interface of a generic subscriber to a push stream
 type Subscriber interface {
-	send(n Notification) error
+	event(n Notification) (Event, error)
 	matchesContentType(n Notification) bool
-	NotificationChannel() chan string
-	writeOnMsgChannel(string)
+	matchesHeaders(n Notification) bool
+	NotificationChannel() chan Event
+	writeOnMsgChannel(Event)
 	Address() string
+	Identity() string
+	identify(identity string)
 	Since() time.Time
+	connectionDuration() time.Duration
+	Dropped() uint64
 	AcceptedContentType() string
+	HeaderFilter() HeaderFilter
+}
+
+// Types of the events of the push stream
+const (
+	NotificationEvent = "notification"
+	HeartbeatEvent    = "heartbeat"
+	// ReconnectEvent asks the subscriber to reconnect, i.e. to another replica of the service
+	ReconnectEvent = "reconnect"
+)
+
+// Event is a message of the push stream of a subscriber
+type Event struct {
+	// ID of the notification event, heartbeats have none
+	ID   string
+	Type string
+	// Data is the JSON encoding of the notifications, or the heartbeat message
+	Data string
+	// Notifications of the event, as they are sent to the subscriber
+	Notifications []Notification
+	encoded       *encodings
+}
+
+// BatchEvents merges notification events into a single event carrying all their notifications, in the same order.
+// The batch has the ID of the last event, so that a subscriber resuming after it gets the notifications that followed.
+func BatchEvents(events []Event) Event {
+	batch := Event{Type: NotificationEvent, encoded: newEncodings()}
+	var notifications []string
+	for _, e := range events {
+		batch.Notifications = append(batch.Notifications, e.Notifications...)
+		data := strings.TrimSpace(e.Data)
+		data = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(data, "["), "]"))
+		if data != "" {
+			notifications = append(notifications, data)
+		}
+		if e.ID != "" {
+			batch.ID = e.ID
+		}
+	}
+	batch.Data = "[" + strings.Join(notifications, ",") + "]"
+	return batch
+}
+
+// HeaderFilter holds the message header values a notification must carry to be sent to a subscriber
+type HeaderFilter map[string]string
+
+// Matches checks if the notification has all the header values of the filter, header names are case-insensitive
+func (f HeaderFilter) Matches(n Notification) bool {
+	for name, value := range f {
+		if headerValue(n.Headers, name) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func headerValue(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
 }
 
 // StandardSubscriber implements a standard subscriber
 type standardSubscriber struct {
-	notificationChannel chan string
+	notificationChannel chan Event
 	addr                string
+	identity            string
 	sinceTime           time.Time
 	acceptedContentType string
+	headerFilter        HeaderFilter
+	dropped             uint64
+	clock               clock.Clock
 }
 
-// NewStandardSubscriber returns a new instance of a standard subscriber
-func NewStandardSubscriber(address string, contentType string) Subscriber {
-	notificationChannel := make(chan string, 16)
+// NewStandardSubscriber returns a new instance of a standard subscriber, subscribed since the current time of the clock
+func NewStandardSubscriber(address string, contentType string, headerFilter HeaderFilter, clk clock.Clock) Subscriber {
+	notificationChannel := make(chan Event, 16)
 	return &standardSubscriber{
 		notificationChannel: notificationChannel,
 		addr:                address,
-		sinceTime:           time.Now(),
+		sinceTime:           clk.Now(),
 		acceptedContentType: contentType,
+		headerFilter:        headerFilter,
+		clock:               clk,
 	}
 }
 
@@ -45,16 +121,34 @@ func (s *standardSubscriber) Address() string {
 	return s.addr
 }
 
+// Identity returns the identity the standard subscriber is authenticated with, if any
+func (s *standardSubscriber) Identity() string {
+	return s.identity
+}
+
+func (s *standardSubscriber) identify(identity string) {
+	s.identity = identity
+}
+
 // AcceptedContentType returns the accepted content type for which notifications are returned
 func (s *standardSubscriber) AcceptedContentType() string {
 	return s.acceptedContentType
 }
 
+// HeaderFilter returns the message header values required for notifications to be returned
+func (s *standardSubscriber) HeaderFilter() HeaderFilter {
+	return s.headerFilter
+}
+
 // Since returns the time since a subscriber have been registered
 func (s *standardSubscriber) Since() time.Time {
 	return s.sinceTime
 }
 
+func (s *standardSubscriber) connectionDuration() time.Duration {
+	return s.clock.Now().Sub(s.sinceTime)
+}
+
 func (s *standardSubscriber) matchesContentType(n Notification) bool {
 	if strings.Contains(n.Type, "DELETE") || strings.ToLower(s.acceptedContentType) == "all" {
 		return true
@@ -63,44 +157,57 @@ func (s *standardSubscriber) matchesContentType(n Notification) bool {
 	return strings.ToLower(s.acceptedContentType) == strings.ToLower(n.ContentType)
 }
 
-func (s *standardSubscriber) send(n Notification) error {
-	notificationMsg, err := buildStandardNotificationMsg(n)
-	if err != nil {
-		return err
-	}
-	s.writeOnMsgChannel(notificationMsg)
-	return nil
+func (s *standardSubscriber) matchesHeaders(n Notification) bool {
+	return s.headerFilter.Matches(n)
+}
+
+func (s *standardSubscriber) event(n Notification) (Event, error) {
+	return newNotificationEvent(n, standardNotification(n))
 }
 
 // NotificationChannel returns the channel that can be used to send
 // notifications to the standard subscriber
-func (s *standardSubscriber) NotificationChannel() chan string {
+func (s *standardSubscriber) NotificationChannel() chan Event {
 	return s.notificationChannel
 }
 
-func (s *standardSubscriber) writeOnMsgChannel(msg string) {
+func (s *standardSubscriber) writeOnMsgChannel(e Event) {
 	select {
-	case s.notificationChannel <- msg:
+	case s.notificationChannel <- e:
 	default:
-		log.WithField("subscriber", s.Address()).WithField("message", msg).Warn("Subscriber lagging behind...")
+		atomic.AddUint64(&s.dropped, 1)
+		log.WithField("subscriber", s.Address()).WithField("message", e.Data).Warn("Subscriber lagging behind...")
 	}
 }
 
-func buildStandardNotificationMsg(n Notification) (string, error) {
+// Dropped returns the number of events dropped because the subscriber was lagging behind
+func (s *standardSubscriber) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Lagging tells whether the subscriber is lagging behind, i.e. its pending events fill more than half of its buffer
+func Lagging(s Subscriber) bool {
+	ch := s.NotificationChannel()
+	return len(ch) > cap(ch)/2
+}
+
+// standardNotification returns the notification without the attributes reserved to monitor subscribers
+func standardNotification(n Notification) Notification {
 	n.PublishReference = ""
 	n.LastModified = ""
 	n.NotificationDate = ""
-
-	return buildNotificationMsg(n)
+	n.Headers = nil
+	return n
 }
 
-func buildNotificationMsg(n Notification) (string, error) {
-	jsonNotification, err := MarshalNotificationsJSON([]Notification{n})
+// newNotificationEvent returns the event of the dispatched notification n, carrying the notification sent to the subscriber
+func newNotificationEvent(n Notification, sent Notification) (Event, error) {
+	notifications := []Notification{sent}
+	jsonNotification, err := MarshalNotificationsJSON(notifications)
 	if err != nil {
-		return "", err
+		return Event{}, err
 	}
-
-	return string(jsonNotification), err
+	return Event{ID: EventID(n), Type: NotificationEvent, Data: string(jsonNotification), Notifications: notifications, encoded: newEncodings()}, nil
 }
 
 // MarshalNotificationsJSON returns the JSON encoding of n. For notifications, we do not use the standard function json.Marshal()
@@ -124,46 +231,55 @@ type monitorSubscriber struct {
 }
 
 // NewMonitorSubscriber returns a new instance of a Monitor subscriber
-func NewMonitorSubscriber(address string, contentType string) Subscriber {
-	return &monitorSubscriber{NewStandardSubscriber(address, contentType)}
+func NewMonitorSubscriber(address string, contentType string, headerFilter HeaderFilter, clk clock.Clock) Subscriber {
+	return &monitorSubscriber{NewStandardSubscriber(address, contentType, headerFilter, clk)}
 }
 
-func (m *monitorSubscriber) send(n Notification) error {
-	notificationMsg, err := buildMonitorNotificationMsg(n)
-	if err != nil {
-		return err
-	}
-	m.writeOnMsgChannel(notificationMsg)
-	return nil
+func (m *monitorSubscriber) event(n Notification) (Event, error) {
+	return newNotificationEvent(n, n)
+}
+
+// Identify sets the identity the subscriber is authenticated with, i.e. the name in its client certificate.
+// It must be called before the subscriber is registered.
+func Identify(s Subscriber, identity string) {
+	s.identify(identity)
 }
 
-func buildMonitorNotificationMsg(n Notification) (string, error) {
-	return buildNotificationMsg(n)
+func isMonitor(s Subscriber) bool {
+	_, ok := s.(*monitorSubscriber)
+	return ok
 }
 
 // MarshalJSON returns the JSON representation of a StandardSubscriber
 func (s *standardSubscriber) MarshalJSON() ([]byte, error) {
-	return json.Marshal(newSubscriberPayload(s))
+	return json.Marshal(NewSubscriberPayload(s))
 }
 
 // MarshalJSON returns the JSON representation of a MonitorSubscriber
 func (m *monitorSubscriber) MarshalJSON() ([]byte, error) {
-	return json.Marshal(newSubscriberPayload(m))
+	return json.Marshal(NewSubscriberPayload(m))
 }
 
 // SubscriberPayload is the JSON representation of a generic subscriber
 type SubscriberPayload struct {
-	Address            string `json:"address"`
-	Since              string `json:"since"`
-	ConnectionDuration string `json:"connectionDuration"`
-	Type               string `json:"type"`
+	Address            string       `json:"address"`
+	Identity           string       `json:"identity,omitempty"`
+	Since              string       `json:"since"`
+	ConnectionDuration string       `json:"connectionDuration"`
+	Type               string       `json:"type"`
+	HeaderFilter       HeaderFilter `json:"headerFilter,omitempty"`
+	// Node is the replica the subscriber is connected to, in cluster mode
+	Node string `json:"node,omitempty"`
 }
 
-func newSubscriberPayload(s Subscriber) *SubscriberPayload {
+// NewSubscriberPayload returns the JSON representation of a subscriber
+func NewSubscriberPayload(s Subscriber) *SubscriberPayload {
 	return &SubscriberPayload{
 		Address:            s.Address(),
+		Identity:           s.Identity(),
 		Since:              s.Since().Format(time.StampMilli),
-		ConnectionDuration: time.Since(s.Since()).String(),
+		ConnectionDuration: s.connectionDuration().String(),
 		Type:               reflect.TypeOf(s).Elem().String(),
+		HeaderFilter:       s.HeaderFilter(),
 	}
 }
@@ -0,0 +1,72 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchEvents(t *testing.T) {
+	s := NewStandardSubscriber("192.168.1.3", contentTypeFilter, nil, clock.NewFake(start))
+	e1, err := s.event(n1)
+	require.NoError(t, err)
+	e2, err := s.event(n2)
+	require.NoError(t, err)
+
+	batch := BatchEvents([]Event{e1, e2})
+
+	assert.Equal(t, EventID(n2), batch.ID, "The batch has the ID of the last notification")
+	assert.Equal(t, NotificationEvent, batch.Type)
+	var notifications []Notification
+	require.NoError(t, json.Unmarshal([]byte(batch.Data), &notifications), batch.Data)
+	require.Len(t, notifications, 2)
+	assert.Equal(t, n1.Type, notifications[0].Type)
+	assert.Equal(t, n2.Type, notifications[1].Type)
+}
+
+func TestBatchEventsKeepsSpecialCharacters(t *testing.T) {
+	batch := BatchEvents([]Event{{ID: "e1", Data: `[{"title":"Q&A <live>"}]` + "\n"}, {Data: "[]"}})
+
+	assert.Equal(t, "e1", batch.ID)
+	assert.Equal(t, `[{"title":"Q&A <live>"}]`, batch.Data)
+}
+
+func TestIdentify(t *testing.T) {
+	s := NewMonitorSubscriber("192.168.1.3", "Article", nil, clock.NewFake(time.Now()))
+	assert.Empty(t, s.Identity())
+
+	Identify(s, "content-syndication")
+
+	assert.Equal(t, "content-syndication", s.Identity())
+	assert.Equal(t, "content-syndication", NewSubscriberPayload(s).Identity)
+	assert.True(t, isMonitor(s))
+}
+
+func TestSubscriberPayload(t *testing.T) {
+	clk := clock.NewFake(start)
+	s := NewStandardSubscriber("192.168.1.3", "Article", HeaderFilter{"X-Origin": "methode"}, clk)
+	clk.Advance(90 * time.Second)
+
+	payload := NewSubscriberPayload(s)
+
+	assert.Equal(t, "192.168.1.3", payload.Address)
+	assert.Equal(t, start.Format(time.StampMilli), payload.Since)
+	assert.Equal(t, "1m30s", payload.ConnectionDuration, "The connection duration is measured with the clock of the subscriber")
+	assert.Equal(t, "dispatch.standardSubscriber", payload.Type)
+	assert.Equal(t, HeaderFilter{"X-Origin": "methode"}, payload.HeaderFilter)
+}
+
+func TestLagging(t *testing.T) {
+	s := NewStandardSubscriber("192.168.1.3", "Article", nil, clock.NewFake(time.Now()))
+	for i := 0; i < cap(s.NotificationChannel())/2; i++ {
+		s.writeOnMsgChannel(heartbeatEvent)
+	}
+	assert.False(t, Lagging(s), "Half of the buffer is pending")
+
+	s.writeOnMsgChannel(heartbeatEvent)
+	assert.True(t, Lagging(s), "More than half of the buffer is pending")
+}
@@ -15,12 +15,14 @@ import (
 type pushService struct {
 	dispatcher dispatch.Dispatcher
 	consumer   kafka.Consumer
+	lag        *cons.Lag
 }
 
-func newPushService(d dispatch.Dispatcher, consumer kafka.Consumer) *pushService {
+func newPushService(d dispatch.Dispatcher, consumer kafka.Consumer, lag *cons.Lag) *pushService {
 	return &pushService{
 		dispatcher: d,
 		consumer:   consumer,
+		lag:        lag,
 	}
 }
 
@@ -32,7 +34,7 @@ func (p *pushService) start(queueHandler cons.MessageQueueHandler) {
 
 	go func() {
 		log.Println("Started consuming.")
-		p.consumer.StartListening(queueHandler.HandleMessage)
+		p.consumer.StartListening(cons.TrackLag(p.lag, queueHandler.HandleMessage))
 		log.Println("Finished consuming.")
 		wg.Done()
 	}()
@@ -41,6 +43,7 @@ func (p *pushService) start(queueHandler cons.MessageQueueHandler) {
 	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
 	<-ch
 	log.Info("Termination signal received. Quitting message consumer and notification dispatcher function.")
+	p.dispatcher.Reconnect()
 	p.consumer.Shutdown()
 	p.dispatcher.Stop()
 	wg.Wait()
@@ -0,0 +1,38 @@
+package resources
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/Financial-Times/go-logger"
+)
+
+const adminRealm = "notifications-push admin"
+
+// ParseCredentials reads user:password credentials
+func ParseCredentials(credentials string) (string, string, error) {
+	userPassword := strings.SplitN(credentials, ":", 2)
+	if len(userPassword) != 2 || userPassword[0] == "" || userPassword[1] == "" {
+		return "", "", fmt.Errorf("the credentials are not in the user:password format")
+	}
+	return userPassword[0], userPassword[1], nil
+}
+
+// BasicAuth only lets the requests authenticated with the given user and password through to next
+func BasicAuth(user string, password string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestUser, requestPassword, ok := r.BasicAuth()
+		// both are compared whatever the result of the first comparison, so that the time taken tells nothing
+		userMatches := subtle.ConstantTimeCompare([]byte(requestUser), []byte(user))
+		passwordMatches := subtle.ConstantTimeCompare([]byte(requestPassword), []byte(password))
+		if !ok || userMatches&passwordMatches != 1 {
+			log.WithField("path", r.URL.Path).WithField("remoteAddr", r.RemoteAddr).Warn("Unauthorized admin request")
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+adminRealm+`"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
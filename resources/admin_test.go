@@ -0,0 +1,52 @@
+package resources
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCredentials(t *testing.T) {
+	user, password, err := ParseCredentials("ops:s3cr:et")
+	assert.NoError(t, err)
+	assert.Equal(t, "ops", user)
+	assert.Equal(t, "s3cr:et", password, "Only the first colon separates the user from the password")
+
+	for _, credentials := range []string{"", "ops", "ops:", ":s3cret"} {
+		_, _, err = ParseCredentials(credentials)
+		assert.Error(t, err, credentials)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	handler := BasicAuth("ops", "s3cret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		status   int
+	}{
+		{"valid", "ops", "s3cret", http.StatusNoContent},
+		{"wrong password", "ops", "other", http.StatusUnauthorized},
+		{"wrong user", "other", "s3cret", http.StatusUnauthorized},
+		{"none", "", "", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/__history", nil)
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.password)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, test.status, w.Code, test.name)
+		if test.status == http.StatusUnauthorized {
+			assert.Equal(t, `Basic realm="notifications-push admin"`, w.Header().Get("WWW-Authenticate"), test.name)
+		}
+	}
+}
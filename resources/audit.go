@@ -0,0 +1,79 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/audit"
+	"github.com/Financial-Times/notifications-push/clock"
+)
+
+// defaultAuditRange is the time range summarised when the request does not ask for one
+const defaultAuditRange = 24 * time.Hour
+
+type auditSummary struct {
+	From                time.Time          `json:"from"`
+	To                  time.Time          `json:"to"`
+	EarliestConnectedAt *time.Time         `json:"earliestConnectedAt,omitempty"`
+	Truncated           bool               `json:"truncated"`
+	Keys                []audit.KeySummary `json:"keys"`
+}
+
+// AuditSummary returns the subscriber sessions of this replica aggregated by key between the from and to query parameters (RFC3339),
+// the last 24 hours by default. It tells when the earliest session the replica keeps connected, and whether sessions of the range
+// are missing because the replica no longer keeps them.
+func AuditSummary(auditLog *audit.Log, clk clock.Clock) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		from, to, err := resolveAuditRange(r, clk.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		result := auditLog.Summary(from, to)
+		summary := auditSummary{From: from, To: to, Truncated: result.Truncated, Keys: result.Keys}
+		if !result.EarliestConnectedAt.IsZero() {
+			summary.EarliestConnectedAt = &result.EarliestConnectedAt
+		}
+		if summary.Keys == nil {
+			summary.Keys = []audit.KeySummary{}
+		}
+		bytes, err := json.Marshal(summary)
+		if err != nil {
+			log.WithError(err).Warn("Error in marshalling the audit summary")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-type", "application/json")
+		if _, err = w.Write(bytes); err != nil {
+			log.WithError(err).Warn("Error writing the audit summary to HTTP response")
+		}
+	}
+}
+
+func resolveAuditRange(r *http.Request, now time.Time) (time.Time, time.Time, error) {
+	to := now
+	if value := r.URL.Query().Get("to"); value != "" {
+		var err error
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("The end of the range (%s) is not a RFC3339 time", value)
+		}
+	}
+
+	from := to.Add(-defaultAuditRange)
+	if value := r.URL.Query().Get("from"); value != "" {
+		var err error
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("The start of the range (%s) is not a RFC3339 time", value)
+		}
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("The start of the range (%s) is not before its end (%s)", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	return from, to, nil
+}
@@ -0,0 +1,86 @@
+package resources
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/audit"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/Financial-Times/notifications-push/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditSummary(t *testing.T) {
+	clk := clock.NewFake(time.Date(2017, 6, 2, 10, 0, 0, 0, time.UTC))
+	auditLog := audit.New(&mocks.AuditSink{}, 10, "salt", clk)
+	session := auditLog.Open(dispatch.NewStandardSubscriber("192.168.1.1", "All", nil, clk), audit.Client{APIKey: "an-api-key-ending-in-c0de"})
+	session.Delivered(2)
+	clk.Advance(time.Hour)
+	session.Close()
+
+	w := httptest.NewRecorder()
+	AuditSummary(auditLog, clk)(w, httptest.NewRequest("GET", "/__audit/summary", nil))
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"from":"2017-06-01T11:00:00Z","to":"2017-06-02T11:00:00Z","earliestConnectedAt":"2017-06-02T10:00:00Z","truncated":false,"keys":[{"key":"7ae3ae201ec96c5a2d2b602a0146188f","keySuffix":"c0de","sessions":1,"open":0,"connectedSeconds":3600,
+		"notifications":2,"dropped":0,"firstConnectedAt":"2017-06-02T10:00:00Z","lastSeenAt":"2017-06-02T11:00:00Z","addresses":["192.168.1.1"],
+		"disconnects":{"client-closed":1}}]}`, w.Body.String(), "the last 24 hours are summarised by default")
+
+	w = httptest.NewRecorder()
+	AuditSummary(auditLog, clk)(w, httptest.NewRequest("GET", "/__audit/summary?from=2017-06-01T00:00:00Z&to=2017-06-02T00:00:00Z", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.JSONEq(t, `{"from":"2017-06-01T00:00:00Z","to":"2017-06-02T00:00:00Z","earliestConnectedAt":"2017-06-02T10:00:00Z","truncated":false,"keys":[]}`, w.Body.String())
+}
+
+func TestAuditSummaryInvalidRange(t *testing.T) {
+	clk := clock.NewFake(time.Date(2017, 6, 2, 10, 0, 0, 0, time.UTC))
+	for _, query := range []string{"from=yesterday", "to=2017-06-02", "from=2017-06-02T00:00:00Z&to=2017-06-01T00:00:00Z"} {
+		w := httptest.NewRecorder()
+		AuditSummary(audit.New(&mocks.AuditSink{}, 10, "salt", clk), clk)(w, httptest.NewRequest("GET", "/__audit/summary?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestPushAudited(t *testing.T) {
+	d := new(MockDispatcher)
+	d.On("Register", mock.AnythingOfType("*dispatch.monitorSubscriber")).Return()
+	d.On("Close", mock.AnythingOfType("*dispatch.monitorSubscriber")).Return()
+
+	req, err := http.NewRequest("GET", "/content/notifications-push?type=Article&monitor=true", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Api-Key", "an-api-key-ending-in-c0de")
+	req.Header.Set("User-Agent", "notifications-push-client/1.0")
+	req.RemoteAddr = "192.168.1.1:43210"
+
+	start = func(sub dispatch.Subscriber) {
+		sub.NotificationChannel() <- dispatch.Event{Type: dispatch.HeartbeatEvent, Data: "[]"}
+		sub.NotificationChannel() <- dispatch.Event{ID: "e1", Type: dispatch.NotificationEvent, Data: "[{},{}]", Notifications: []dispatch.Notification{{}, {}}}
+		sub.NotificationChannel() <- dispatch.Event{Type: dispatch.ReconnectEvent}
+	}
+
+	records := &mocks.AuditSink{}
+	clk := clock.NewFake(time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC))
+	Push(d, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clk, nil, audit.New(records, 10, "salt", clk))(NewStreamResponseRecorder(), req)
+
+	require.Len(t, records.Records(), 2)
+	registered, closed := records.Records()[0], records.Records()[1]
+	assert.Equal(t, audit.RegisterEvent, registered.Event)
+	assert.Equal(t, "c0de", registered.KeySuffix)
+	assert.Equal(t, "notifications-push-client/1.0", registered.UserAgent)
+	assert.Equal(t, "sse", registered.Protocol)
+	assert.Equal(t, "json", registered.Format)
+	assert.True(t, registered.Monitor)
+	assert.Equal(t, "Article", registered.ContentType)
+
+	assert.Equal(t, audit.CloseEvent, closed.Event)
+	assert.Equal(t, registered.Session, closed.Session)
+	assert.Equal(t, int64(2), closed.Notifications)
+	assert.Equal(t, audit.Reconnect, closed.Reason)
+	d.AssertExpectations(t)
+}
@@ -0,0 +1,98 @@
+package resources
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/dispatch"
+)
+
+const (
+	batchSizeQueryParam   = "batchSize"
+	batchLingerQueryParam = "batchLinger"
+
+	// MaxBatchSize is the largest number of notifications a subscriber can ask for in a single event
+	MaxBatchSize = 500
+	// MaxBatchLinger is the longest time a subscriber can ask a notification to wait for a batch to fill up
+	MaxBatchLinger = 10 * time.Second
+	// DefaultBatchLinger is the time a notification waits for a batch to fill up when the subscriber does not ask for one
+	DefaultBatchLinger = time.Second
+)
+
+// batch groups the notification events sent to a subscriber, up to a maximum size. A notification waits
+// at most the linger time for the batch to fill up. Subscribers with a batch size of one get unbatched events.
+type batch struct {
+	stream  stream
+	size    int
+	linger  time.Duration
+	clock   clock.Clock
+	pending []dispatch.Event
+	timer   clock.Timer
+}
+
+// resolveBatch reads the batch size and linger time query parameters, i.e. batchSize=100&batchLinger=500ms
+func resolveBatch(r *http.Request) (int, time.Duration, error) {
+	size, linger := 1, DefaultBatchLinger
+
+	if value := r.URL.Query().Get(batchSizeQueryParam); value != "" {
+		var err error
+		size, err = strconv.Atoi(value)
+		if err != nil || size < 1 || size > MaxBatchSize {
+			return 0, 0, fmt.Errorf("The specified batch size (%s) is not a number between 1 and %d", value, MaxBatchSize)
+		}
+	}
+
+	if value := r.URL.Query().Get(batchLingerQueryParam); value != "" {
+		var err error
+		linger, err = time.ParseDuration(value)
+		if err != nil || linger <= 0 || linger > MaxBatchLinger {
+			return 0, 0, fmt.Errorf("The specified batch linger time (%s) is not a duration up to %v", value, MaxBatchLinger)
+		}
+	}
+	return size, linger, nil
+}
+
+// add sends the notification event once the batch is full, other events are sent right away after the pending notifications
+func (b *batch) add(e dispatch.Event) error {
+	if b.size <= 1 || e.Type != dispatch.NotificationEvent {
+		if err := b.flush(); err != nil {
+			return err
+		}
+		return b.stream.write(e)
+	}
+
+	b.pending = append(b.pending, e)
+	if len(b.pending) >= b.size {
+		return b.flush()
+	}
+	if b.timer == nil {
+		b.timer = b.clock.NewTimer(b.linger)
+	}
+	return nil
+}
+
+// expired receives when the first pending notification waited for the linger time
+func (b *batch) expired() <-chan time.Time {
+	if b.timer == nil {
+		return nil
+	}
+	return b.timer.C()
+}
+
+// flush sends the pending notifications as a single event
+func (b *batch) flush() error {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.pending) == 0 {
+		return nil
+	}
+
+	e := dispatch.BatchEvents(b.pending)
+	b.pending = nil
+	return b.stream.write(e)
+}
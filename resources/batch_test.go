@@ -0,0 +1,90 @@
+package resources
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveBatch(t *testing.T) {
+	tests := []struct {
+		url    string
+		size   int
+		linger time.Duration
+		err    bool
+	}{
+		{url: "/content/notifications-push", size: 1, linger: DefaultBatchLinger},
+		{url: "/content/notifications-push?batchSize=100", size: 100, linger: DefaultBatchLinger},
+		{url: "/content/notifications-push?batchSize=100&batchLinger=250ms", size: 100, linger: 250 * time.Millisecond},
+		{url: "/content/notifications-push?batchSize=0", err: true},
+		{url: "/content/notifications-push?batchSize=501", err: true},
+		{url: "/content/notifications-push?batchSize=many", err: true},
+		{url: "/content/notifications-push?batchSize=10&batchLinger=11s", err: true},
+		{url: "/content/notifications-push?batchSize=10&batchLinger=-1s", err: true},
+		{url: "/content/notifications-push?batchSize=10&batchLinger=soon", err: true},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", test.url, nil)
+
+		size, linger, err := resolveBatch(req)
+		if test.err {
+			assert.Error(t, err, test.url)
+			continue
+		}
+		assert.NoError(t, err, test.url)
+		assert.Equal(t, test.size, size, test.url)
+		assert.Equal(t, test.linger, linger, test.url)
+	}
+}
+
+func TestBatchIsSentWhenFull(t *testing.T) {
+	s, w := newEventStream(ProtocolV1, false)
+	b := &batch{stream: s, size: 2, linger: time.Second, clock: s.clock}
+
+	require.NoError(t, b.add(dispatch.Event{ID: "e1", Type: dispatch.NotificationEvent, Data: `[{"id":"1"}]`}))
+	assert.Empty(t, w.Body.String(), "The batch waits for more notifications")
+	assert.NotNil(t, b.expired())
+
+	require.NoError(t, b.add(dispatch.Event{ID: "e2", Type: dispatch.NotificationEvent, Data: `[{"id":"2"}]`}))
+	assert.Equal(t, "id: e2\ndata: [{\"id\":\"1\"},{\"id\":\"2\"}]\n\n", w.Body.String())
+	assert.Nil(t, b.expired(), "Nothing is pending")
+}
+
+func TestBatchIsSentAfterLinger(t *testing.T) {
+	s, w := newEventStream(ProtocolV2, false)
+	clk := s.clock.(*clock.Fake)
+	b := &batch{stream: s, size: 10, linger: time.Second, clock: clk}
+
+	require.NoError(t, b.add(dispatch.Event{ID: "e1", Type: dispatch.NotificationEvent, Data: `[{"id":"1"}]`}))
+	clk.Advance(time.Second)
+	<-b.expired()
+	require.NoError(t, b.flush())
+
+	assert.Equal(t, "id: e1\nevent: notification\ndata: [{\"id\":\"1\"}]\n\n", w.Body.String())
+}
+
+func TestBatchIsSentBeforeOtherEvents(t *testing.T) {
+	s, w := newEventStream(ProtocolV1, false)
+	b := &batch{stream: s, size: 10, linger: time.Second, clock: s.clock}
+
+	require.NoError(t, b.add(dispatch.Event{ID: "e1", Type: dispatch.NotificationEvent, Data: `[{"id":"1"}]`}))
+	require.NoError(t, b.add(dispatch.Event{Type: dispatch.HeartbeatEvent, Data: "[]"}))
+
+	assert.Equal(t, "id: e1\ndata: [{\"id\":\"1\"}]\n\ndata: []\n\n", w.Body.String())
+}
+
+func TestUnbatchedEvents(t *testing.T) {
+	s, w := newEventStream(ProtocolV1, false)
+	b := &batch{stream: s, size: 1, linger: time.Second, clock: s.clock}
+
+	require.NoError(t, b.add(dispatch.Event{ID: "e1", Type: dispatch.NotificationEvent, Data: `[{"id":"1"}]`}))
+
+	assert.Equal(t, "id: e1\ndata: [{\"id\":\"1\"}]\n\n", w.Body.String())
+	assert.Nil(t, b.expired())
+}
@@ -0,0 +1,138 @@
+package resources
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Compression measures how much the compressed push streams are compressed
+type Compression struct {
+	streams      int64
+	uncompressed uint64
+	compressed   uint64
+}
+
+type compressionStats struct {
+	// Streams is the number of compressed streams currently open
+	Streams           int64   `json:"streams"`
+	UncompressedBytes uint64  `json:"uncompressedBytes"`
+	CompressedBytes   uint64  `json:"compressedBytes"`
+	Ratio             float64 `json:"ratio"`
+}
+
+// NewCompression returns a new compression measure
+func NewCompression() *Compression {
+	return &Compression{}
+}
+
+func (c *Compression) stats() *compressionStats {
+	if c == nil {
+		return nil
+	}
+	stats := &compressionStats{
+		Streams:           atomic.LoadInt64(&c.streams),
+		UncompressedBytes: atomic.LoadUint64(&c.uncompressed),
+		CompressedBytes:   atomic.LoadUint64(&c.compressed),
+	}
+	if stats.CompressedBytes > 0 {
+		stats.Ratio = float64(stats.UncompressedBytes) / float64(stats.CompressedBytes)
+	}
+	return stats
+}
+
+// acceptsGzip checks if the subscriber accepts gzip, i.e. Accept-Encoding: gzip, deflate
+func acceptsGzip(r *http.Request) bool {
+	for _, coding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, err := mime.ParseMediaType(coding)
+		if err != nil || name != "gzip" {
+			continue
+		}
+		q, err := strconv.ParseFloat(params["q"], 64)
+		return err != nil || q > 0
+	}
+	return false
+}
+
+// countingWriter counts the bytes written
+type countingWriter struct {
+	w     io.Writer
+	count uint64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.count += uint64(n)
+	return n, err
+}
+
+// frameWriter writes the frames of a push stream. Every frame is flushed through the compressor down to the subscriber,
+// so that compression adds no latency and heartbeats keep the connection active.
+type frameWriter struct {
+	*bufio.Writer
+	w            http.ResponseWriter
+	gz           *gzip.Writer
+	compression  *Compression
+	uncompressed *countingWriter
+	compressed   *countingWriter
+}
+
+// newFrameWriter returns a writer of the push stream, compressed with gzip if the subscriber accepts it
+func newFrameWriter(w http.ResponseWriter, r *http.Request, compression *Compression) *frameWriter {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if !acceptsGzip(r) {
+		return &frameWriter{Writer: bufio.NewWriter(w), w: w}
+	}
+
+	w.Header().Set("Content-Encoding", "gzip")
+	compressed := &countingWriter{w: w}
+	gz := gzip.NewWriter(compressed)
+	uncompressed := &countingWriter{w: gz}
+	if compression != nil {
+		atomic.AddInt64(&compression.streams, 1)
+	}
+	return &frameWriter{Writer: bufio.NewWriter(uncompressed), w: w, gz: gz, compression: compression, uncompressed: uncompressed, compressed: compressed}
+}
+
+// flush sends the frame written so far to the subscriber
+func (f *frameWriter) flush() error {
+	if err := f.Flush(); err != nil {
+		return err
+	}
+	if f.gz != nil {
+		if err := f.gz.Flush(); err != nil {
+			return err
+		}
+		f.measure()
+	}
+
+	flusher := f.w.(http.Flusher)
+	flusher.Flush()
+	return nil
+}
+
+// close ends the compressed stream
+func (f *frameWriter) close() {
+	if f.gz == nil {
+		return
+	}
+	f.gz.Close()
+	f.measure()
+	if f.compression != nil {
+		atomic.AddInt64(&f.compression.streams, -1)
+	}
+}
+
+func (f *frameWriter) measure() {
+	if f.compression != nil {
+		atomic.AddUint64(&f.compression.uncompressed, f.uncompressed.count)
+		atomic.AddUint64(&f.compression.compressed, f.compressed.count)
+	}
+	f.uncompressed.count = 0
+	f.compressed.count = 0
+}
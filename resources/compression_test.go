@@ -0,0 +1,95 @@
+package resources
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		expected       bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"deflate, gzip", true},
+		{"gzip;q=0.5, br", true},
+		{"gzip;q=0", false},
+		{"br", false},
+		{"identity", false},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "/content/notifications-push", nil)
+		req.Header.Set("Accept-Encoding", test.acceptEncoding)
+
+		assert.Equal(t, test.expected, acceptsGzip(req), test.acceptEncoding)
+	}
+}
+
+func TestFrameWriterFlushesEveryFrameThroughTheCompressor(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/content/notifications-push", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	compression := NewCompression()
+
+	fw := newFrameWriter(w, req, compression)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, int64(1), compression.stats().Streams)
+
+	frame := "data: []\n\n"
+	fw.WriteString(frame)
+	require.NoError(t, fw.flush())
+
+	gz, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	received := make([]byte, len(frame))
+	_, err = io.ReadFull(gz, received)
+	require.NoError(t, err, "The frame can be decompressed before the stream ends")
+	assert.Equal(t, frame, string(received))
+
+	stats := compression.stats()
+	assert.Equal(t, uint64(len(frame)), stats.UncompressedBytes)
+	assert.Equal(t, uint64(w.Body.Len()), stats.CompressedBytes)
+
+	fw.close()
+	assert.Equal(t, int64(0), compression.stats().Streams)
+}
+
+func TestCompressionRatio(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/content/notifications-push", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	compression := NewCompression()
+
+	fw := newFrameWriter(w, req, compression)
+	for i := 0; i < 100; i++ {
+		fw.WriteString(`data: [{"apiUrl":"http://api.ft.com/content/648bda7b-1187-3496-b48e-57ecb14d5b0a","id":"http://www.ft.com/thing/648bda7b-1187-3496-b48e-57ecb14d5b0a"}]` + "\n\n")
+	}
+	require.NoError(t, fw.flush())
+
+	assert.True(t, compression.stats().Ratio > 10, "Repetitive notifications are compressed: %v", compression.stats().Ratio)
+}
+
+func TestUncompressedFrameWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	compression := NewCompression()
+
+	fw := newFrameWriter(w, httptest.NewRequest("GET", "/content/notifications-push", nil), compression)
+	fw.WriteString("data: []\n\n")
+	require.NoError(t, fw.flush())
+	fw.close()
+
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "data: []\n\n", w.Body.String())
+	assert.Equal(t, &compressionStats{}, compression.stats(), "Uncompressed streams are not measured")
+	assert.Nil(t, (*Compression)(nil).stats())
+}
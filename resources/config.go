@@ -0,0 +1,26 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/config"
+)
+
+// Config returns the active configuration and its version
+func Config(active func() *config.Active) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bytes, err := json.Marshal(active())
+		if err != nil {
+			log.WithError(err).Warn("Error in marshalling the active configuration")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-type", "application/json")
+		if _, err = w.Write(bytes); err != nil {
+			log.WithError(err).Warn("Error writing the active configuration to HTTP response")
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Financial-Times/notifications-push/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig(t *testing.T) {
+	active, err := config.Activate(config.Config{
+		Whitelist:             ".*",
+		SupportedContentTypes: DefaultSupportedContentTypes,
+		NotificationsDelay:    30,
+		HeartbeatPeriod:       30,
+	}, "command line")
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/__config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Config(func() *config.Active { return active })(w, req)
+
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"), "Should be json")
+	assert.Equal(t, 200, w.Code, "Should be OK")
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, active.Version, body["version"])
+	assert.Equal(t, "command line", body["source"])
+	assert.Equal(t, ".*", body["config"].(map[string]interface{})["whitelist"])
+}
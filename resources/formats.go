@@ -0,0 +1,179 @@
+package resources
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/Financial-Times/notifications-push/audit"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/Financial-Times/notifications-push/tracing"
+)
+
+// stream writes the events of a push stream in the format negotiated with the subscriber
+type stream interface {
+	start(sub dispatch.Subscriber) error
+	write(e dispatch.Event) error
+	dropped(count uint64, total uint64) error
+	sendError(code string, message string) error
+}
+
+// StreamFormat is a format of the push stream subscribers can ask for with the Accept header
+type StreamFormat struct {
+	Format    dispatch.Format
+	MediaType string
+	// SchemaVersion is increased on every incompatible change of the format
+	SchemaVersion int
+	// heartbeat is sent to keep the connection active
+	heartbeat []byte
+}
+
+// Formats of the push stream, the first one is the default
+var (
+	SSEStreamFormat     = StreamFormat{Format: dispatch.JSONFormat, MediaType: "text/event-stream", SchemaVersion: 1}
+	NDJSONStreamFormat  = StreamFormat{Format: dispatch.NDJSONFormat, MediaType: "application/x-ndjson", SchemaVersion: 1, heartbeat: []byte("\n")}
+	MsgPackStreamFormat = StreamFormat{Format: dispatch.MsgPackFormat, MediaType: "application/x-msgpack", SchemaVersion: 1, heartbeat: []byte{0x90}}
+
+	StreamFormats = []StreamFormat{SSEStreamFormat, NDJSONStreamFormat, MsgPackStreamFormat}
+)
+
+// ContentType returns the content type of the responses in the format
+func (f StreamFormat) ContentType() string {
+	if strings.HasPrefix(f.MediaType, "text/") || f.Format.Name == dispatch.NDJSONFormat.Name {
+		return f.MediaType + "; charset=UTF-8"
+	}
+	return f.MediaType
+}
+
+// SchemaPath returns the path of the schema of the format
+func (f StreamFormat) SchemaPath() string {
+	return fmt.Sprintf("%s/%s/v%d", schemasPath, f.Format.Name, f.SchemaVersion)
+}
+
+// resolveFormat returns the first format of the Accept header that is supported, or server-sent events,
+// so that subscribers not asking for a specific format keep getting them
+func resolveFormat(r *http.Request) StreamFormat {
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		for _, f := range StreamFormats {
+			if mediaType == f.MediaType {
+				return f
+			}
+		}
+	}
+	return SSEStreamFormat
+}
+
+// encodedStream writes the notifications encoded in a format other than server-sent events, with no framing
+// as the formats are self-delimiting. Event IDs and control events are not sent.
+type encodedStream struct {
+	fw     *frameWriter
+	format StreamFormat
+}
+
+func (s *encodedStream) start(sub dispatch.Subscriber) error {
+	return nil
+}
+
+func (s *encodedStream) write(e dispatch.Event) error {
+	var data []byte
+	switch e.Type {
+	case dispatch.HeartbeatEvent:
+		data = s.format.heartbeat
+	case dispatch.ReconnectEvent:
+		return nil
+	default:
+		var err error
+		if data, err = e.Encode(s.format.Format); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.fw.Write(data); err != nil {
+		return err
+	}
+	return s.fw.flush()
+}
+
+func (s *encodedStream) dropped(count uint64, total uint64) error {
+	return nil
+}
+
+func (s *encodedStream) sendError(code string, message string) error {
+	return nil
+}
+
+// tracedStream traces the writes of the notifications to the subscriber, as children of their fan-out
+type tracedStream struct {
+	stream
+	subscriber dispatch.Subscriber
+}
+
+func (s tracedStream) write(e dispatch.Event) error {
+	if e.Type != dispatch.NotificationEvent {
+		return s.stream.write(e)
+	}
+
+	spans := make([]*tracing.Span, len(e.Notifications))
+	for i, n := range e.Notifications {
+		spans[i] = tracing.Start("subscriber.write", n.Trace)
+		spans[i].SetAttribute("transaction_id", n.PublishReference)
+		spans[i].SetAttribute("subscriber.address", s.subscriber.Address())
+		spans[i].SetAttribute("notifications", len(e.Notifications))
+	}
+
+	err := s.stream.write(e)
+	for _, span := range spans {
+		span.SetError(err)
+		span.Finish()
+	}
+	return err
+}
+
+// auditedStream counts the notifications written to the subscriber in its audit session, and records why the stream ends
+type auditedStream struct {
+	stream
+	session *audit.Session
+}
+
+func (s auditedStream) start(sub dispatch.Subscriber) error {
+	err := s.stream.start(sub)
+	if err != nil {
+		s.session.Failed(err)
+	}
+	return err
+}
+
+func (s auditedStream) write(e dispatch.Event) error {
+	if err := s.stream.write(e); err != nil {
+		s.session.Failed(err)
+		return err
+	}
+	switch e.Type {
+	case dispatch.NotificationEvent:
+		s.session.Delivered(len(e.Notifications))
+	case dispatch.ReconnectEvent:
+		s.session.Reconnect()
+	}
+	return nil
+}
+
+func (s auditedStream) dropped(count uint64, total uint64) error {
+	err := s.stream.dropped(count, total)
+	if err != nil {
+		s.session.Failed(err)
+	}
+	return err
+}
+
+func (s auditedStream) sendError(code string, message string) error {
+	err := s.stream.sendError(code, message)
+	if err != nil {
+		s.session.Failed(err)
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package resources
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/Financial-Times/notifications-push/test/mocks"
+	"github.com/Financial-Times/notifications-push/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveFormat(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected StreamFormat
+	}{
+		{"", SSEStreamFormat},
+		{"*/*", SSEStreamFormat},
+		{"text/event-stream; version=2", SSEStreamFormat},
+		{"application/json", SSEStreamFormat},
+		{"application/x-ndjson", NDJSONStreamFormat},
+		{"application/x-msgpack", MsgPackStreamFormat},
+		{"application/x-unknown, application/x-msgpack;q=0.9, application/x-ndjson", MsgPackStreamFormat},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", "/content/notifications-push", nil)
+		req.Header.Set("Accept", test.accept)
+
+		assert.Equal(t, test.expected.MediaType, resolveFormat(req).MediaType, test.accept)
+	}
+}
+
+func TestStreamFormatContentType(t *testing.T) {
+	assert.Equal(t, "text/event-stream; charset=UTF-8", SSEStreamFormat.ContentType())
+	assert.Equal(t, "application/x-ndjson; charset=UTF-8", NDJSONStreamFormat.ContentType())
+	assert.Equal(t, "application/x-msgpack", MsgPackStreamFormat.ContentType())
+	assert.Equal(t, "/__schemas/msgpack/v1", MsgPackStreamFormat.SchemaPath())
+}
+
+func TestEncodedStream(t *testing.T) {
+	w := httptest.NewRecorder()
+	s := &encodedStream{fw: newFrameWriter(w, httptest.NewRequest("GET", "/content/notifications-push", nil), nil), format: NDJSONStreamFormat}
+
+	n := dispatch.Notification{APIURL: "http://api.ft.com/content/1", ID: "http://www.ft.com/thing/1", Type: "http://www.ft.com/thing/ThingChangeType/DELETE"}
+	require.NoError(t, s.write(dispatch.Event{Type: dispatch.HeartbeatEvent, Data: "[]"}))
+	require.NoError(t, s.write(dispatch.Event{ID: "e1", Type: dispatch.NotificationEvent, Notifications: []dispatch.Notification{n, n}}))
+	require.NoError(t, s.dropped(1, 1))
+	require.NoError(t, s.sendError("resume_failed", "missed"))
+	require.NoError(t, s.write(dispatch.Event{Type: dispatch.ReconnectEvent}))
+
+	line := `{"apiUrl":"http://api.ft.com/content/1","id":"http://www.ft.com/thing/1","type":"http://www.ft.com/thing/ThingChangeType/DELETE","standout":{"scoop":false}}` + "\n"
+	assert.Equal(t, "\n"+line+line, w.Body.String(), "Only heartbeats and notifications are sent")
+}
+
+func TestTracedStream(t *testing.T) {
+	spans := &mocks.SpanRecorder{}
+	clk := clock.NewFake(time.Now())
+	tracing.SetTracer(tracing.NewTracer(spans, clk))
+	defer tracing.SetTracer(nil)
+
+	w := httptest.NewRecorder()
+	sub := dispatch.NewStandardSubscriber("192.168.1.1", "All", nil, clk)
+	s := tracedStream{stream: &encodedStream{fw: newFrameWriter(w, httptest.NewRequest("GET", "/content/notifications-push", nil), nil), format: NDJSONStreamFormat}, subscriber: sub}
+
+	fanout := tracing.NewTracer(spans, clk).Start("dispatch.fanout", tracing.SpanContext{})
+	n1 := dispatch.Notification{APIURL: "http://api.ft.com/content/1", PublishReference: "tid_1", Trace: fanout.SpanContext()}
+	n2 := dispatch.Notification{APIURL: "http://api.ft.com/content/2", PublishReference: "tid_2"}
+	require.NoError(t, s.write(dispatch.Event{Type: dispatch.HeartbeatEvent, Data: "[]"}))
+	require.NoError(t, s.write(dispatch.Event{ID: "e1", Type: dispatch.NotificationEvent, Notifications: []dispatch.Notification{n1, n2}}))
+
+	writes := spans.Spans("subscriber.write")
+	require.Len(t, writes, 2, "one span per notification, heartbeats are not traced")
+	assert.Equal(t, fanout.Context.TraceID, writes[0].Context.TraceID)
+	assert.Equal(t, fanout.Context.SpanID, writes[0].ParentID)
+	assert.Equal(t, "tid_1", writes[0].Attributes["transaction_id"])
+	assert.Equal(t, "192.168.1.1", writes[0].Attributes["subscriber.address"])
+	assert.Equal(t, 2, writes[0].Attributes["notifications"])
+	assert.False(t, writes[1].ParentID.IsValid(), "a notification with no trace starts a new one")
+	assert.Contains(t, w.Body.String(), "http://api.ft.com/content/2")
+}
@@ -1,6 +1,9 @@
 package resources
 
 import (
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"time"
 
@@ -8,49 +11,217 @@ import (
 
 	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/consumer"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/Financial-Times/notifications-push/supervisor"
 	"github.com/Financial-Times/service-status-go/gtg"
 )
 
+const panicGuide = "https://dewey.ft.com/upp-notifications-push.html"
+
+// HealthThresholds are the limits beyond which the health checks fail
+type HealthThresholds struct {
+	// DelayedNotifications is the number of notifications that may wait for the cache delay
+	DelayedNotifications int
+	// ConsumerLag is how far behind the queue the consumer may be
+	ConsumerLag time.Duration
+	// LaggingSubscribers is the percentage of subscribers that may lag behind
+	LaggingSubscribers float64
+	// MaxSilence is how long the service may go without dispatching notifications during the publishing hours, 0 for ever
+	MaxSilence      time.Duration
+	PublishingHours PublishingHours
+}
+
 type HealthCheck struct {
-	Consumer kafka.Consumer
+	Consumer                   kafka.Consumer
+	Standalone                 bool
+	supervisor                 *supervisor.Supervisor
+	dispatcher                 dispatch.Dispatcher
+	lag                        *consumer.Lag
+	partitionLag               *consumer.PartitionLag
+	apiGatewayKeyValidationURL string
+	httpClient                 *http.Client
+	thresholds                 HealthThresholds
+	clock                      clock.Clock
+	started                    time.Time
+}
+
+// NewHealthCheck checks the kafka queue, how far behind it the consumer is and whether it is being restarted by the supervisor,
+// the API Gateway validating the API keys, the dispatcher and its subscribers, and that notifications keep being dispatched
+// during the publishing hours. The consumer lag keeps growing while the optional partition lag shows messages left to consume.
+func NewHealthCheck(kafkaConsumer kafka.Consumer, sup *supervisor.Supervisor, dispatcher dispatch.Dispatcher, lag *consumer.Lag, partitionLag *consumer.PartitionLag, apiGatewayKeyValidationURL string, httpClient *http.Client, thresholds HealthThresholds, clk clock.Clock) *HealthCheck {
+	return &HealthCheck{
+		Consumer:                   kafkaConsumer,
+		supervisor:                 sup,
+		dispatcher:                 dispatcher,
+		lag:                        lag,
+		partitionLag:               partitionLag,
+		apiGatewayKeyValidationURL: apiGatewayKeyValidationURL,
+		httpClient:                 httpClient,
+		thresholds:                 thresholds,
+		clock:                      clk,
+		started:                    clk.Now(),
+	}
 }
 
-func NewHealthCheck(kafkaConsumer kafka.Consumer) *HealthCheck {
+// NewStandaloneHealthCheck checks a local consumer instead of the kafka queue, as well as the dispatcher and its subscribers
+func NewStandaloneHealthCheck(localConsumer kafka.Consumer, dispatcher dispatch.Dispatcher, thresholds HealthThresholds) *HealthCheck {
 	return &HealthCheck{
-		Consumer: kafkaConsumer,
+		Consumer:   localConsumer,
+		Standalone: true,
+		dispatcher: dispatcher,
+		thresholds: thresholds,
 	}
 }
 
 func (h *HealthCheck) Health() func(w http.ResponseWriter, r *http.Request) {
-	checks := []fthealth.Check{h.queueCheck()}
 	hc := fthealth.TimedHealthCheck{
 		HealthCheck: fthealth.HealthCheck{
 			SystemCode:  "upp-notifications-push",
 			Name:        "Notifications Push",
 			Description: "Checks if all the dependent services are reachable and healthy.",
-			Checks:      checks,
+			Checks:      h.checks(),
 		},
 		Timeout: 10 * time.Second,
 	}
 	return fthealth.Handler(hc)
 }
 
+// criticalChecks are those the service is not good to go without
+func (h *HealthCheck) criticalChecks() []fthealth.Check {
+	return []fthealth.Check{h.queueCheck(), h.dispatcherCheck()}
+}
+
+func (h *HealthCheck) checks() []fthealth.Check {
+	checks := append(h.criticalChecks(), h.delayedNotificationsCheck(), h.laggingSubscribersCheck())
+	if h.Standalone {
+		return checks
+	}
+	checks = append(checks, h.consumerLagCheck(), h.apiGatewayCheck())
+	if h.supervisor != nil {
+		checks = append(checks, h.supervisorCheck())
+	}
+	if h.thresholds.MaxSilence > 0 {
+		checks = append(checks, h.notificationsDispatchedCheck())
+	}
+	return checks
+}
+
 // Check is the the NotificationsPushHealthcheck method that checks if the kafka queue is available
 func (h *HealthCheck) queueCheck() fthealth.Check {
+	if h.Standalone {
+		return fthealth.Check{
+			ID:               "local-message-source-listening",
+			Name:             "LocalMessageSourceListening",
+			Severity:         3,
+			BusinessImpact:   "None, the service is running standalone for development or testing.",
+			TechnicalSummary: "The local message source is not listening",
+			PanicGuide:       panicGuide,
+			Checker:          h.checkAggregateMessageQueueReachable,
+		}
+	}
 	return fthealth.Check{
 		ID:               "message-queue-reachable",
 		Name:             "MessageQueueReachable",
 		Severity:         1,
 		BusinessImpact:   "Notifications about newly modified/published content will not reach this app, nor will they reach its clients.",
 		TechnicalSummary: "Message queue is not reachable/healthy",
-		PanicGuide:       "https://dewey.ft.com/upp-notifications-push.html",
+		PanicGuide:       panicGuide,
 		Checker:          h.checkAggregateMessageQueueReachable,
 	}
 }
 
+func (h *HealthCheck) dispatcherCheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               "dispatcher-alive",
+		Name:             "DispatcherAlive",
+		Severity:         1,
+		BusinessImpact:   "Subscribers receive neither notifications nor heartbeats, and they will reconnect to no avail.",
+		TechnicalSummary: "The dispatch loop is stopped or blocked, it has not sent heartbeats for several periods",
+		PanicGuide:       panicGuide,
+		Checker:          h.checkDispatcherAlive,
+	}
+}
+
+func (h *HealthCheck) delayedNotificationsCheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               "delayed-notifications",
+		Name:             "DelayedNotifications",
+		Severity:         2,
+		BusinessImpact:   "Notifications reach subscribers late, the service may run out of memory.",
+		TechnicalSummary: "Too many notifications are waiting for the cache delay, the dispatcher cannot keep up with the queue",
+		PanicGuide:       panicGuide,
+		Checker:          h.checkDelayedNotifications,
+	}
+}
+
+func (h *HealthCheck) laggingSubscribersCheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               "lagging-subscribers",
+		Name:             "LaggingSubscribers",
+		Severity:         2,
+		BusinessImpact:   "Clients miss notifications, they have to resume or poll the notifications API to catch up.",
+		TechnicalSummary: "Too many subscribers do not read their push stream fast enough, their notifications are dropped",
+		PanicGuide:       panicGuide,
+		Checker:          h.checkLaggingSubscribers,
+	}
+}
+
+func (h *HealthCheck) consumerLagCheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               "consumer-lag",
+		Name:             "ConsumerLag",
+		Severity:         2,
+		BusinessImpact:   "Notifications about newly modified/published content reach clients late.",
+		TechnicalSummary: "The consumer is too far behind the message queue, the latest message consumed is too old or the consumer stopped with messages left to consume",
+		PanicGuide:       panicGuide,
+		Checker:          h.checkConsumerLag,
+	}
+}
+
+func (h *HealthCheck) apiGatewayCheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               "api-gateway-reachable",
+		Name:             "APIGatewayReachable",
+		Severity:         2,
+		BusinessImpact:   "New clients cannot subscribe as their API key cannot be validated, subscribed clients are not affected.",
+		TechnicalSummary: "The API Gateway validating the API keys is not reachable/healthy",
+		PanicGuide:       panicGuide,
+		Checker:          h.checkAPIGatewayReachable,
+	}
+}
+
+func (h *HealthCheck) supervisorCheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               "consumer-restarting",
+		Name:             "ConsumerRestarting",
+		Severity:         2,
+		BusinessImpact:   "Notifications about newly modified/published content are not received until the consumer is restarted.",
+		TechnicalSummary: "The consumer is being restarted after an error it cannot recover from, see /__supervisor for the errors",
+		PanicGuide:       panicGuide,
+		Checker:          h.checkSupervisor,
+	}
+}
+
+func (h *HealthCheck) notificationsDispatchedCheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               "notifications-dispatched",
+		Name:             "NotificationsDispatched",
+		Severity:         2,
+		BusinessImpact:   "Clients may not be notified about newly modified/published content.",
+		TechnicalSummary: "No notification has been dispatched for a while during the publishing hours, content may not be flowing through the message queue",
+		PanicGuide:       panicGuide,
+		Checker:          h.checkNotificationsDispatched,
+	}
+}
+
+// GTG fails on the critical checks only
 func (h *HealthCheck) GTG() gtg.Status {
-	if _, err := h.checkAggregateMessageQueueReachable(); err != nil {
-		return gtg.Status{GoodToGo: false, Message: err.Error()}
+	for _, check := range h.criticalChecks() {
+		if _, err := check.Checker(); err != nil {
+			return gtg.Status{GoodToGo: false, Message: err.Error()}
+		}
 	}
 	return gtg.Status{GoodToGo: true}
 }
@@ -58,9 +229,110 @@ func (h *HealthCheck) GTG() gtg.Status {
 func (h *HealthCheck) checkAggregateMessageQueueReachable() (string, error) {
 	// ISSUE: consumer's helthcheck always returns true
 	err := h.Consumer.ConnectivityCheck()
+	if h.Standalone {
+		if err != nil {
+			return "Local message source is not listening", err
+		}
+		return "Local message source is listening.", nil
+	}
 	if err == nil {
 		return "Connectivity to kafka is OK.", nil
 	}
 
 	return "Error connecting to kafka", errors.New("Error connecting to kafka queue")
 }
+
+func (h *HealthCheck) checkDispatcherAlive() (string, error) {
+	if err := h.dispatcher.CheckAlive(); err != nil {
+		return "Dispatcher is not alive", err
+	}
+	return "Dispatcher is alive.", nil
+}
+
+func (h *HealthCheck) checkDelayedNotifications() (string, error) {
+	delayed := h.dispatcher.Delayed()
+	msg := fmt.Sprintf("%d notifications are waiting for the cache delay", delayed)
+	if delayed > h.thresholds.DelayedNotifications {
+		return msg, fmt.Errorf("more than %d notifications are waiting for the cache delay", h.thresholds.DelayedNotifications)
+	}
+	return msg + ".", nil
+}
+
+func (h *HealthCheck) checkLaggingSubscribers() (string, error) {
+	subscribers := h.dispatcher.Subscribers()
+	if len(subscribers) == 0 {
+		return "There are no subscribers.", nil
+	}
+
+	lagging := 0
+	for _, s := range subscribers {
+		if dispatch.Lagging(s) {
+			lagging++
+		}
+	}
+	percentage := float64(lagging) * 100 / float64(len(subscribers))
+	msg := fmt.Sprintf("%d of %d subscribers are lagging behind", lagging, len(subscribers))
+	if percentage > h.thresholds.LaggingSubscribers {
+		return msg, fmt.Errorf("%.1f%% of the subscribers are lagging behind, more than %v%%", percentage, h.thresholds.LaggingSubscribers)
+	}
+	return msg + ".", nil
+}
+
+func (h *HealthCheck) checkConsumerLag() (string, error) {
+	var backlog int64
+	if h.partitionLag != nil {
+		backlog = h.partitionLag.Total()
+	}
+	lag := h.lag.Behind(backlog)
+	msg := fmt.Sprintf("The consumer is %v (%d messages) behind the queue", lag, backlog)
+	if lag > h.thresholds.ConsumerLag {
+		return msg, fmt.Errorf("the consumer is more than %v behind the queue", h.thresholds.ConsumerLag)
+	}
+	return msg + ".", nil
+}
+
+// checkAPIGatewayReachable calls the API Gateway without API key, any response but a server error means it is reachable
+func (h *HealthCheck) checkAPIGatewayReachable() (string, error) {
+	resp, err := h.httpClient.Get(h.apiGatewayKeyValidationURL)
+	if err != nil {
+		return "Cannot reach the API Gateway", err
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return "The API Gateway is not healthy", fmt.Errorf("the API Gateway returned status %d", resp.StatusCode)
+	}
+	return "The API Gateway is reachable.", nil
+}
+
+// checkNotificationsDispatched fails when no notification has been dispatched for too long during the publishing hours,
+// the silence counts from the start of the service until a notification is dispatched
+func (h *HealthCheck) checkNotificationsDispatched() (string, error) {
+	now := h.clock.Now()
+	latest := h.dispatcher.Freshness().DispatchedAt
+	if latest.IsZero() {
+		latest = h.started
+	}
+	silence := now.Sub(latest)
+	msg := fmt.Sprintf("No notification has been dispatched for %v", silence)
+
+	if !h.thresholds.PublishingHours.Contains(now) {
+		return msg + ", outside of the publishing hours (" + h.thresholds.PublishingHours.String() + ").", nil
+	}
+	if silence > h.thresholds.MaxSilence {
+		return msg, fmt.Errorf("no notification has been dispatched for more than %v during the publishing hours", h.thresholds.MaxSilence)
+	}
+	return msg + ".", nil
+}
+
+func (h *HealthCheck) checkSupervisor() (string, error) {
+	status := h.supervisor.Status()
+	msg := fmt.Sprintf("The consumer has been restarted %d times", status.Restarts)
+	if err := h.supervisor.Check(); err != nil {
+		return msg, err
+	}
+	return msg + ".", nil
+}
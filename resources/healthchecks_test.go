@@ -0,0 +1,237 @@
+package resources
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/consumer"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/Financial-Times/notifications-push/supervisor"
+	"github.com/Financial-Times/notifications-push/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testThresholds = HealthThresholds{DelayedNotifications: 10, ConsumerLag: time.Minute, LaggingSubscribers: 25}
+
+func aliveDispatcher() *mocks.MockDispatcher {
+	dispatcher := &mocks.MockDispatcher{}
+	dispatcher.On("CheckAlive").Return(nil)
+	return dispatcher
+}
+
+func TestStandaloneGTG(t *testing.T) {
+	localConsumer := consumer.NewLocalConsumer(nil, false, time.Millisecond)
+	hc := NewStandaloneHealthCheck(localConsumer, aliveDispatcher(), testThresholds)
+
+	status := hc.GTG()
+	assert.False(t, status.GoodToGo, "Should not be good to go before listening")
+	assert.Equal(t, consumer.ErrNotListening.Error(), status.Message)
+
+	go localConsumer.StartListening(func(message kafka.FTMessage) error { return nil })
+	defer localConsumer.Shutdown()
+
+	for i := 0; localConsumer.ConnectivityCheck() != nil && i < 1000; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, hc.GTG().GoodToGo, "Should be good to go once listening")
+}
+
+func TestGTGFailsOnCriticalChecksOnly(t *testing.T) {
+	localConsumer := consumer.NewLocalConsumer(nil, false, time.Millisecond)
+	go localConsumer.StartListening(func(message kafka.FTMessage) error { return nil })
+	defer localConsumer.Shutdown()
+	for i := 0; localConsumer.ConnectivityCheck() != nil && i < 1000; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	dispatcher := &mocks.MockDispatcher{}
+	dispatcher.On("CheckAlive").Return(nil).Once()
+	dispatcher.On("Delayed").Return(testThresholds.DelayedNotifications + 1)
+	hc := NewStandaloneHealthCheck(localConsumer, dispatcher, testThresholds)
+
+	assert.True(t, hc.GTG().GoodToGo, "Too many delayed notifications are not critical")
+
+	dispatcher.On("CheckAlive").Return(errors.New("the dispatcher is not started"))
+	status := hc.GTG()
+	assert.False(t, status.GoodToGo, "A dispatcher that is not alive is critical")
+	assert.Equal(t, "the dispatcher is not started", status.Message)
+}
+
+func TestChecks(t *testing.T) {
+	standalone := NewStandaloneHealthCheck(consumer.NewLocalConsumer(nil, false, time.Millisecond), aliveDispatcher(), testThresholds)
+	assert.Len(t, standalone.checks(), 4, "The consumer lag and the API Gateway are not checked standalone")
+
+	hc := NewHealthCheck(consumer.NewLocalConsumer(nil, false, time.Millisecond), nil, aliveDispatcher(), consumer.NewLag(clock.System()), nil, "http://api.ft.com/t800-healthcheck", http.DefaultClient, testThresholds, clock.System())
+	assert.Len(t, hc.checks(), 6, "Dispatched notifications are not checked without max silence")
+
+	thresholds := testThresholds
+	thresholds.MaxSilence = time.Hour
+	hc = NewHealthCheck(consumer.NewLocalConsumer(nil, false, time.Millisecond), nil, aliveDispatcher(), consumer.NewLag(clock.System()), nil, "http://api.ft.com/t800-healthcheck", http.DefaultClient, thresholds, clock.System())
+	checks := hc.checks()
+	assert.Len(t, checks, 7)
+	for _, check := range checks {
+		assert.NotEmpty(t, check.ID)
+		assert.NotEmpty(t, check.BusinessImpact, check.ID)
+		assert.NotEmpty(t, check.TechnicalSummary, check.ID)
+		assert.NotZero(t, check.Severity, check.ID)
+	}
+}
+
+func TestCheckDelayedNotifications(t *testing.T) {
+	dispatcher := &mocks.MockDispatcher{}
+	dispatcher.On("Delayed").Return(testThresholds.DelayedNotifications).Once()
+	dispatcher.On("Delayed").Return(testThresholds.DelayedNotifications + 1).Once()
+	hc := NewStandaloneHealthCheck(nil, dispatcher, testThresholds)
+
+	_, err := hc.checkDelayedNotifications()
+	assert.NoError(t, err)
+	_, err = hc.checkDelayedNotifications()
+	assert.Error(t, err)
+}
+
+func TestCheckLaggingSubscribers(t *testing.T) {
+	clk := clock.NewFake(time.Now())
+	var subscribers []dispatch.Subscriber
+	for i := 0; i < 4; i++ {
+		subscribers = append(subscribers, dispatch.NewStandardSubscriber("192.168.1.3", "Article", nil, clk))
+	}
+	dispatcher := &mocks.MockDispatcher{}
+	dispatcher.On("Subscribers").Return([]dispatch.Subscriber{}).Once()
+	dispatcher.On("Subscribers").Return(subscribers)
+	hc := NewStandaloneHealthCheck(nil, dispatcher, testThresholds)
+
+	_, err := hc.checkLaggingSubscribers()
+	assert.NoError(t, err, "There are no subscribers")
+
+	fill := func(s dispatch.Subscriber) {
+		for len(s.NotificationChannel()) < cap(s.NotificationChannel()) {
+			s.NotificationChannel() <- dispatch.Event{Type: dispatch.HeartbeatEvent}
+		}
+	}
+	fill(subscribers[0])
+	_, err = hc.checkLaggingSubscribers()
+	assert.NoError(t, err, "25% of the subscribers are lagging")
+
+	fill(subscribers[1])
+	msg, err := hc.checkLaggingSubscribers()
+	assert.Error(t, err, "50% of the subscribers are lagging")
+	assert.Equal(t, "2 of 4 subscribers are lagging behind", msg)
+}
+
+func TestCheckConsumerLag(t *testing.T) {
+	now := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	lag := consumer.NewLag(clock.NewFake(now))
+	hc := NewHealthCheck(nil, nil, nil, lag, nil, "", nil, testThresholds, clock.NewFake(now))
+
+	lag.Track(kafka.NewFTMessage(map[string]string{"Message-Timestamp": "2017-06-01T09:59:00.000Z"}, ""))
+	_, err := hc.checkConsumerLag()
+	assert.NoError(t, err)
+
+	lag.Track(kafka.NewFTMessage(map[string]string{"Message-Timestamp": "2017-06-01T09:58:59.000Z"}, ""))
+	_, err = hc.checkConsumerLag()
+	assert.Error(t, err)
+}
+
+type stalledOffsets struct {
+	committed int64
+	newest    int64
+}
+
+func (o stalledOffsets) Committed() (map[int32]int64, error) {
+	return map[int32]int64{0: o.committed}, nil
+}
+
+func (o stalledOffsets) Newest() (map[int32]int64, error) {
+	return map[int32]int64{0: o.newest}, nil
+}
+
+func TestCheckConsumerLagOfStoppedConsumer(t *testing.T) {
+	now := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(now)
+	lag := consumer.NewLag(clk)
+	partitionLag := consumer.NewPartitionLag(stalledOffsets{committed: 10, newest: 25}, time.Hour, clk)
+	go partitionLag.Start()
+	defer partitionLag.Stop()
+	require.True(t, clk.WaitForTimers(1, 5*time.Second), "The offsets are polled")
+
+	hc := NewHealthCheck(nil, nil, nil, lag, partitionLag, "", nil, testThresholds, clk)
+	lag.Track(kafka.NewFTMessage(map[string]string{"Message-Timestamp": "2017-06-01T09:59:50.000Z"}, ""))
+	_, err := hc.checkConsumerLag()
+	assert.NoError(t, err)
+
+	// the consumer stops, the messages left to consume wait
+	clk.Advance(2 * time.Minute)
+	msg, err := hc.checkConsumerLag()
+	assert.Error(t, err, "The stopped consumer falls behind")
+	assert.Equal(t, "The consumer is 2m10s (15 messages) behind the queue", msg)
+}
+
+func TestCheckAPIGatewayReachable(t *testing.T) {
+	// the mock clients share the default client, so each one is created just before it is used
+	tests := []struct {
+		name       string
+		httpClient func() *http.Client
+		reachable  bool
+	}{
+		{"unauthorized", func() *http.Client { return mocks.MockHTTPClientWithResponseCode(http.StatusUnauthorized) }, true},
+		{"unavailable", func() *http.Client { return mocks.MockHTTPClientWithResponseCode(http.StatusServiceUnavailable) }, false},
+		{"unreachable", mocks.ErroringMockHTTPClient, false},
+	}
+	for _, test := range tests {
+		hc := NewHealthCheck(nil, nil, nil, nil, nil, "http://api.ft.com/t800-healthcheck", test.httpClient(), testThresholds, clock.System())
+		_, err := hc.checkAPIGatewayReachable()
+		assert.Equal(t, test.reachable, err == nil, test.name)
+	}
+}
+
+func TestCheckNotificationsDispatched(t *testing.T) {
+	start := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	dispatcher := &mocks.MockDispatcher{}
+	dispatcher.On("Freshness").Return(dispatch.Freshness{}).Twice()
+	thresholds := testThresholds
+	thresholds.MaxSilence = time.Hour
+	thresholds.PublishingHours = PublishingHours{From: 6, To: 22}
+	hc := NewHealthCheck(nil, nil, dispatcher, nil, nil, "", nil, thresholds, clk)
+
+	_, err := hc.checkNotificationsDispatched()
+	assert.NoError(t, err, "The service just started")
+
+	clk.Advance(time.Hour + time.Second)
+	_, err = hc.checkNotificationsDispatched()
+	assert.Error(t, err, "Nothing was dispatched since the service started")
+
+	dispatcher.On("Freshness").Return(dispatch.Freshness{DispatchedAt: clk.Now().Add(-time.Minute), Age: time.Second})
+	_, err = hc.checkNotificationsDispatched()
+	assert.NoError(t, err)
+
+	clk.Advance(12 * time.Hour)
+	msg, err := hc.checkNotificationsDispatched()
+	assert.NoError(t, err, "It is outside of the publishing hours")
+	assert.Contains(t, msg, "outside of the publishing hours (06:00-22:00 UTC)")
+}
+
+func TestCheckSupervisor(t *testing.T) {
+	errCh := make(chan error)
+	defer close(errCh)
+	clk := clock.NewFake(time.Now())
+	sessionExpired := errors.New("zk: session has been expired by the server")
+	rules := []supervisor.Rule{{Name: "zookeeper-session-expired", Matches: supervisor.Is(sessionExpired), Policy: supervisor.Restart}}
+	sup := supervisor.New(errCh, rules, func() error { return nil }, func(err error) {}, supervisor.Backoff{Initial: time.Second, Max: time.Minute}, 10, clk)
+	go sup.Supervise()
+	hc := NewHealthCheck(nil, sup, nil, nil, nil, "", nil, testThresholds, clk)
+	assert.Len(t, hc.checks(), 7)
+
+	_, err := hc.checkSupervisor()
+	assert.NoError(t, err)
+
+	errCh <- sessionExpired
+	assert.True(t, clk.WaitForTimers(1, time.Second), "The restart is scheduled")
+	_, err = hc.checkSupervisor()
+	assert.Error(t, err, "The consumer is being restarted")
+}
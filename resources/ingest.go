@@ -0,0 +1,32 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/Financial-Times/notifications-push/consumer"
+)
+
+// Ingest handles a Kafka message posted as {"headers":{...},"body":"..."} as if it was consumed from the queue
+func Ingest(handler consumer.MessageQueueHandler) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var msg kafka.FTMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid message: %v", err), http.StatusBadRequest)
+			return
+		}
+		if msg.Headers == nil {
+			msg.Headers = map[string]string{}
+		}
+
+		if err := handler.HandleMessage(msg); err != nil {
+			log.WithField("transaction_id", msg.Headers["X-Request-Id"]).WithError(err).Warn("Ingested message was not handled")
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
@@ -0,0 +1,67 @@
+package resources
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/Financial-Times/notifications-push/consumer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type mockMessageQueueHandler struct {
+	mock.Mock
+}
+
+func (m *mockMessageQueueHandler) HandleMessage(queueMsg kafka.FTMessage) error {
+	args := m.Called(queueMsg)
+	return args.Error(0)
+}
+
+func (m *mockMessageQueueHandler) UpdateFilters(whitelist *regexp.Regexp, skipRules consumer.SkipRules) {
+	m.Called(whitelist, skipRules)
+}
+
+func TestIngest(t *testing.T) {
+	handler := new(mockMessageQueueHandler)
+	handler.On("HandleMessage", kafka.FTMessage{Headers: map[string]string{"X-Request-Id": "tid_test"}, Body: `{"ContentURI":"http://test"}`}).Return(nil)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/__ingest", strings.NewReader(`{"headers":{"X-Request-Id":"tid_test"},"body":"{\"ContentURI\":\"http://test\"}"}`))
+
+	Ingest(handler)(w, req)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	handler.AssertExpectations(t)
+}
+
+func TestIngestUnhandledMessage(t *testing.T) {
+	handler := new(mockMessageQueueHandler)
+	handler.On("HandleMessage", kafka.FTMessage{Headers: map[string]string{}, Body: "invalid"}).Return(errors.New("invalid event"))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/__ingest", strings.NewReader(`{"body":"invalid"}`))
+
+	Ingest(handler)(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, "invalid event\n", w.Body.String())
+	handler.AssertExpectations(t)
+}
+
+func TestIngestInvalidMessage(t *testing.T) {
+	handler := new(mockMessageQueueHandler)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/__ingest", strings.NewReader(`{"body":`))
+
+	Ingest(handler)(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	handler.AssertNotCalled(t, "HandleMessage", mock.Anything)
+}
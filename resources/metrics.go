@@ -0,0 +1,15 @@
+package resources
+
+import (
+	"net/http"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// Metrics returns the metrics of the service
+func Metrics(registry metrics.Registry) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-type", "application/json")
+		metrics.WriteJSONOnce(registry, w)
+	}
+}
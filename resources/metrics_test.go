@@ -0,0 +1,27 @@
+package resources
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	metrics.GetOrRegisterCounter("events.validation.invalid", registry).Inc(2)
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/__metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Metrics(registry)(w, req)
+
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"), "Should be json")
+	assert.JSONEq(t, `{"events.validation.invalid":{"count":2}}`, w.Body.String())
+	assert.Equal(t, 200, w.Code, "Should be OK")
+}
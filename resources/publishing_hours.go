@@ -0,0 +1,64 @@
+package resources
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PublishingHours are the hours of the day, in UTC, during which content is expected to be published.
+// The zero value stands for the whole day.
+type PublishingHours struct {
+	From int
+	To   int
+}
+
+// ParsePublishingHours reads hours in the from-to format, i.e. 6-22, where to is excluded and may be before from
+// to span midnight. Empty hours stand for the whole day.
+func ParsePublishingHours(hours string) (PublishingHours, error) {
+	if hours == "" {
+		return PublishingHours{}, nil
+	}
+	fromTo := strings.SplitN(hours, "-", 2)
+	if len(fromTo) != 2 {
+		return PublishingHours{}, fmt.Errorf("the publishing hours %q are not in the from-to format", hours)
+	}
+	from, err := parseHour(fromTo[0])
+	if err != nil {
+		return PublishingHours{}, err
+	}
+	to, err := parseHour(fromTo[1])
+	if err != nil {
+		return PublishingHours{}, err
+	}
+	return PublishingHours{From: from, To: to}, nil
+}
+
+func parseHour(value string) (int, error) {
+	hour, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, fmt.Errorf("%q is not an hour of the day", value)
+	}
+	return hour % 24, nil
+}
+
+// Contains tells whether the time is within the publishing hours
+func (p PublishingHours) Contains(t time.Time) bool {
+	hour := t.UTC().Hour()
+	switch {
+	case p.From == p.To:
+		return true
+	case p.From < p.To:
+		return hour >= p.From && hour < p.To
+	default:
+		return hour >= p.From || hour < p.To
+	}
+}
+
+func (p PublishingHours) String() string {
+	if p.From == p.To {
+		return "the whole day"
+	}
+	return fmt.Sprintf("%02d:00-%02d:00 UTC", p.From, p.To)
+}
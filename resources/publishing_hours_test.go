@@ -0,0 +1,42 @@
+package resources
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePublishingHours(t *testing.T) {
+	hours, err := ParsePublishingHours("6-22")
+	require.NoError(t, err)
+	assert.Equal(t, PublishingHours{From: 6, To: 22}, hours)
+
+	hours, err = ParsePublishingHours("")
+	require.NoError(t, err)
+	assert.Equal(t, PublishingHours{}, hours, "Empty hours are the whole day")
+
+	for _, invalid := range []string{"6", "6-", "a-22", "6-25", "-1-22"} {
+		_, err = ParsePublishingHours(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPublishingHoursContains(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2017, 6, 1, hour, 30, 0, 0, time.UTC) }
+
+	day := PublishingHours{From: 6, To: 22}
+	assert.False(t, day.Contains(at(5)))
+	assert.True(t, day.Contains(at(6)))
+	assert.True(t, day.Contains(at(21)))
+	assert.False(t, day.Contains(at(22)))
+	assert.True(t, day.Contains(at(7).In(time.FixedZone("UTC-2", -2*60*60))), "The hours are in UTC")
+
+	night := PublishingHours{From: 22, To: 6}
+	assert.True(t, night.Contains(at(23)))
+	assert.True(t, night.Contains(at(0)))
+	assert.False(t, night.Contains(at(12)))
+
+	assert.True(t, PublishingHours{}.Contains(at(3)), "The zero value is the whole day")
+}
@@ -1,23 +1,40 @@
 package resources
 
 import (
-	"bufio"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"fmt"
 	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/audit"
+	"github.com/Financial-Times/notifications-push/certs"
+	"github.com/Financial-Times/notifications-push/clock"
 	"github.com/Financial-Times/notifications-push/dispatch"
 )
 
 const (
-	apiKeyHeaderField  = "X-Api-Key"
-	apiKeyQueryParam   = "apiKey"
-	defaultContentType = "Article"
+	apiKeyHeaderField      = "X-Api-Key"
+	lastEventIDHeaderField = "Last-Event-ID"
+	apiKeyQueryParam       = "apiKey"
+	headerFilterQueryParam = "header"
+	defaultContentType     = "Article"
 )
 
-var supportedContentTypes = []string{"Article", "ContentPackage", "All"}
+// DefaultSupportedContentTypes are the content types subscribers can ask for unless configured otherwise
+var DefaultSupportedContentTypes = []string{"Article", "ContentPackage", "All"}
+
+var supportedContentTypes atomic.Value
+
+func init() {
+	SetSupportedContentTypes(DefaultSupportedContentTypes)
+}
+
+// SetSupportedContentTypes replaces the content types subscribers can ask for
+func SetSupportedContentTypes(contentTypes []string) {
+	supportedContentTypes.Store(contentTypes)
+}
 
 //ApiKey is provided either as a request param or as a header.
 func getApiKey(r *http.Request) string {
@@ -29,19 +46,34 @@ func getApiKey(r *http.Request) string {
 	return r.URL.Query().Get(apiKeyQueryParam)
 }
 
-// Push handler for push subscribers
-func Push(reg dispatch.Registrar, apiGatewayKeyValidationURL string, httpClient *http.Client) func(w http.ResponseWriter, r *http.Request) {
+// Push streams the notifications to a subscriber, in the format negotiated with the Accept header, server-sent events by default,
+// compressed with gzip if the subscriber accepts it. The subscriber opts in the version 2 of the protocol with the protocol
+// query parameter or the Accept header, and in batched notifications with the batchSize and batchLinger query parameters.
+// A subscriber resuming the stream with the Last-Event-ID header receives the notifications it missed from history, after the
+// first heartbeat. It is identified by its verified client certificate if it sends one, by its API key otherwise.
+// The compression measuring the streams and the audit log recording the sessions are optional.
+func Push(reg dispatch.Registrar, history dispatch.History, apiGatewayKeyValidationURL string, httpClient *http.Client, clk clock.Clock, compression *Compression, auditLog *audit.Log) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-type", "text/event-stream; charset=UTF-8")
+		format := resolveFormat(r)
+		w.Header().Set("Content-type", format.ContentType())
+		w.Header().Set("Link", "<"+format.SchemaPath()+`>; rel="describedby"`)
 		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-		w.Header().Set("Connection", "keep-alive")
+		// connection-specific headers are not allowed in HTTP/2
+		if r.ProtoMajor == 1 {
+			w.Header().Set("Connection", "keep-alive")
+		}
 		w.Header().Set("Pragma", "no-cache")
 		w.Header().Set("Expires", "0")
 
-		apiKey := getApiKey(r)
-		if isValid, errMsg, errStatusCode := isValidApiKey(apiKey, apiGatewayKeyValidationURL, httpClient); !isValid {
-			http.Error(w, errMsg, errStatusCode)
-			return
+		// subscribers with a verified client certificate are authenticated by it, and the API key is not validated
+		// when there is no API Gateway, i.e. in standalone mode
+		identity := certs.Identity(r.TLS)
+		if identity == "" && apiGatewayKeyValidationURL != "" {
+			apiKey := getApiKey(r)
+			if isValid, errMsg, errStatusCode := IsValidApiKey(apiKey, apiGatewayKeyValidationURL, httpClient); !isValid {
+				http.Error(w, errMsg, errStatusCode)
+				return
+			}
 		}
 
 		cn, ok := w.(http.CloseNotifier)
@@ -50,45 +82,130 @@ func Push(reg dispatch.Registrar, apiGatewayKeyValidationURL string, httpClient
 			return
 		}
 
-		bw := bufio.NewWriter(w)
-
 		contentTypeParam, err := resolveContentType(r)
 		if err != nil {
 			log.WithError(err).Error("Invalid content type")
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		headerFilter, err := resolveHeaderFilter(r)
+		if err != nil {
+			log.WithError(err).Error("Invalid header filter")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		version, commentHeartbeats, err := resolveProtocol(r)
+		if err != nil {
+			log.WithError(err).Error("Invalid protocol")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		batchSize, batchLinger, err := resolveBatch(r)
+		if err != nil {
+			log.WithError(err).Error("Invalid batch")
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		monitorParam := r.URL.Query().Get("monitor")
 		isMonitor, _ := strconv.ParseBool(monitorParam)
 
 		var s dispatch.Subscriber
 
 		if isMonitor {
-			s = dispatch.NewMonitorSubscriber(getClientAddr(r), contentTypeParam)
+			s = dispatch.NewMonitorSubscriber(getClientAddr(r), contentTypeParam, headerFilter, clk)
 		} else {
-			s = dispatch.NewStandardSubscriber(getClientAddr(r), contentTypeParam)
+			s = dispatch.NewStandardSubscriber(getClientAddr(r), contentTypeParam, headerFilter, clk)
+		}
+
+		if identity != "" {
+			dispatch.Identify(s, identity)
 		}
 
 		reg.Register(s)
 		defer reg.Close(s)
 
+		client := audit.Client{UserAgent: r.UserAgent(), Protocol: "sse", Format: format.Format.Name, Monitor: isMonitor}
+		if identity == "" {
+			client.APIKey = getApiKey(r)
+		}
+		session := auditLog.Open(s, client)
+		defer session.Close()
+
+		fw := newFrameWriter(w, r, compression)
+		defer fw.close()
+
+		var stream stream = &eventStream{fw: fw, version: version, commentHeartbeats: commentHeartbeats, clock: clk}
+		if format.Format.Name != SSEStreamFormat.Format.Name {
+			stream = &encodedStream{fw: fw, format: format}
+		}
+		stream = tracedStream{stream: stream, subscriber: s}
+		stream = auditedStream{stream: stream, session: session}
+		if err := stream.start(s); err != nil {
+			log.Infof("[%v]", err)
+			return
+		}
+		batch := &batch{stream: stream, size: batchSize, linger: batchLinger, clock: clk}
+
+		var missed []dispatch.Event
+		if lastEventID := r.Header.Get(lastEventIDHeaderField); lastEventID != "" {
+			var found bool
+			missed, found = dispatch.Missed(history, s, lastEventID)
+			entry := log.WithField("subscriber", s.Address()).WithField("lastEventID", lastEventID)
+			if found {
+				entry.WithField("missed", len(missed)).Info("Resuming subscriber")
+			} else {
+				entry.Warn("Cannot resume subscriber, the last event is not in history")
+				if err := stream.sendError("resume_failed", "The last event is not in history, some notifications may have been missed"); err != nil {
+					log.Infof("[%v]", err)
+					return
+				}
+			}
+		}
+		// live notifications may be in history too when the subscriber is resumed
+		resumed := map[string]bool{}
+		var dropped uint64
+
 		for {
 			select {
-			case notification := <-s.NotificationChannel():
-				_, err := bw.WriteString("data: " + notification + "\n\n")
-				if err != nil {
+			case e := <-s.NotificationChannel():
+				if resumed[e.ID] {
+					continue
+				}
+				if total := s.Dropped(); total > dropped {
+					if err := stream.dropped(total-dropped, total); err != nil {
+						log.Infof("[%v]", err)
+						return
+					}
+					dropped = total
+				}
+				if err := batch.add(e); err != nil {
 					log.Infof("[%v]", err)
 					return
 				}
+				// the stream is closed so that the subscriber reconnects, i.e. to another replica
+				if e.Type == dispatch.ReconnectEvent {
+					return
+				}
 
-				err = bw.Flush()
-				if err != nil {
+				for _, m := range missed {
+					if err := batch.add(m); err != nil {
+						log.Infof("[%v]", err)
+						return
+					}
+					resumed[m.ID] = true
+				}
+				if missed != nil {
+					missed = nil
+					if err := batch.flush(); err != nil {
+						log.Infof("[%v]", err)
+						return
+					}
+				}
+			case <-batch.expired():
+				if err := batch.flush(); err != nil {
 					log.Infof("[%v]", err)
 					return
 				}
-
-				flusher := w.(http.Flusher)
-				flusher.Flush()
 			case <-cn.CloseNotify():
 				return
 			}
@@ -106,14 +223,34 @@ func getClientAddr(r *http.Request) string {
 }
 
 func resolveContentType(r *http.Request) (string, error) {
-	contentType := r.URL.Query().Get("type")
+	return ResolveContentType(r.URL.Query().Get("type"))
+}
+
+// ResolveContentType checks that subscribers can ask for the content type, Article being the default
+func ResolveContentType(contentType string) (string, error) {
 	if contentType == "" {
 		return defaultContentType, nil
 	}
-	for _, t := range supportedContentTypes {
+	for _, t := range supportedContentTypes.Load().([]string) {
 		if strings.ToLower(contentType) == strings.ToLower(t) {
 			return contentType, nil
 		}
 	}
 	return "", fmt.Errorf("The specified type (%s) is unsupported", contentType)
 }
+
+// resolveHeaderFilter reads the header query parameters, i.e. header=Origin-System-Id:http://cmdb.ft.com/systems/methode-web-pub
+func resolveHeaderFilter(r *http.Request) (dispatch.HeaderFilter, error) {
+	var filter dispatch.HeaderFilter
+	for _, param := range r.URL.Query()[headerFilterQueryParam] {
+		nameValue := strings.SplitN(param, ":", 2)
+		if len(nameValue) != 2 || strings.TrimSpace(nameValue[0]) == "" {
+			return nil, fmt.Errorf("The specified header filter (%s) is not in the name:value format", param)
+		}
+		if filter == nil {
+			filter = dispatch.HeaderFilter{}
+		}
+		filter[strings.TrimSpace(nameValue[0])] = nameValue[1]
+	}
+	return filter, nil
+}
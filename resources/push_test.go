@@ -2,6 +2,12 @@ package resources
 
 import (
 	"bufio"
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -9,9 +15,11 @@ import (
 
 	"strings"
 
+	"github.com/Financial-Times/notifications-push/clock"
 	"github.com/Financial-Times/notifications-push/test/mocks"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/Financial-Times/notifications-push/dispatch"
 )
 
@@ -33,7 +41,7 @@ func TestPushStandardSubscriber(t *testing.T) {
 	req.Header.Set(apiKeyHeaderField, "some-api-key")
 
 	start = func(sub dispatch.Subscriber) {
-		sub.NotificationChannel() <- "hi"
+		sub.NotificationChannel() <- dispatch.Event{Data: "hi"}
 		time.Sleep(10 * time.Millisecond)
 		w.closer <- true
 
@@ -42,7 +50,7 @@ func TestPushStandardSubscriber(t *testing.T) {
 	}
 
 	httpClient := mocks.MockHTTPClientWithResponseCode(http.StatusOK)
-	Push(d, "http://dummy.ft.com", httpClient)(w, req)
+	Push(d, dispatch.NewHistory(10), "http://dummy.ft.com", httpClient, clock.System(), nil, nil)(w, req)
 
 	assert.Equal(t, "text/event-stream; charset=UTF-8", w.Header().Get("Content-Type"), "Should be SSE")
 	assert.Equal(t, "no-cache, no-store, must-revalidate", w.Header().Get("Cache-Control"))
@@ -75,7 +83,7 @@ func TestPushMonitorSubscriber(t *testing.T) {
 	req.Header.Set(apiKeyHeaderField, "some-api-key")
 
 	start = func(sub dispatch.Subscriber) {
-		sub.NotificationChannel() <- "hi"
+		sub.NotificationChannel() <- dispatch.Event{Data: "hi"}
 		time.Sleep(10 * time.Millisecond)
 		w.closer <- true
 
@@ -84,7 +92,7 @@ func TestPushMonitorSubscriber(t *testing.T) {
 	}
 
 	httpClient := mocks.MockHTTPClientWithResponseCode(http.StatusOK)
-	Push(d, "http://dummy.ft.com", httpClient)(w, req)
+	Push(d, dispatch.NewHistory(10), "http://dummy.ft.com", httpClient, clock.System(), nil, nil)(w, req)
 
 	assert.Equal(t, "text/event-stream; charset=UTF-8", w.Header().Get("Content-Type"), "Should be SSE")
 	assert.Equal(t, "no-cache, no-store, must-revalidate", w.Header().Get("Cache-Control"))
@@ -111,7 +119,7 @@ func TestPushFailed(t *testing.T) {
 	req.Header.Set(apiKeyHeaderField, "some-api-key")
 
 	httpClient := mocks.MockHTTPClientWithResponseCode(http.StatusOK)
-	Push(d, "http://dummy.ft.com", httpClient)(w, req)
+	Push(d, dispatch.NewHistory(10), "http://dummy.ft.com", httpClient, clock.System(), nil, nil)(w, req)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
@@ -130,7 +138,7 @@ func TestPushInvalidType(t *testing.T) {
 	req.Header.Set(apiKeyHeaderField, "some-api-key")
 
 	start = func(sub dispatch.Subscriber) {
-		sub.NotificationChannel() <- "hi"
+		sub.NotificationChannel() <- dispatch.Event{Data: "hi"}
 		time.Sleep(10 * time.Millisecond)
 		w.closer <- true
 
@@ -139,7 +147,7 @@ func TestPushInvalidType(t *testing.T) {
 	}
 
 	httpClient := mocks.MockHTTPClientWithResponseCode(http.StatusOK)
-	Push(d, "http://dummy.ft.com", httpClient)(w, req)
+	Push(d, dispatch.NewHistory(10), "http://dummy.ft.com", httpClient, clock.System(), nil, nil)(w, req)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 
@@ -165,7 +173,7 @@ func TestAPIGatewayDown(t *testing.T) {
 	req.Header.Set(apiKeyHeaderField, "some-api-key")
 
 	start = func(sub dispatch.Subscriber) {
-		sub.NotificationChannel() <- "hi"
+		sub.NotificationChannel() <- dispatch.Event{Data: "hi"}
 		time.Sleep(10 * time.Millisecond)
 		w.closer <- true
 
@@ -174,7 +182,7 @@ func TestAPIGatewayDown(t *testing.T) {
 	}
 
 	httpClient := mocks.MockHTTPClientWithResponseCode(http.StatusInternalServerError)
-	Push(d, "http://dummy.ft.com", httpClient)(w, req)
+	Push(d, dispatch.NewHistory(10), "http://dummy.ft.com", httpClient, clock.System(), nil, nil)(w, req)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
@@ -194,7 +202,7 @@ func TestInvalidApiKey(t *testing.T) {
 	req.Header.Set(apiKeyHeaderField, "some-wrong-api-key")
 
 	start = func(sub dispatch.Subscriber) {
-		sub.NotificationChannel() <- "hi"
+		sub.NotificationChannel() <- dispatch.Event{Data: "hi"}
 		time.Sleep(10 * time.Millisecond)
 		w.closer <- true
 
@@ -203,7 +211,7 @@ func TestInvalidApiKey(t *testing.T) {
 	}
 
 	httpClient := mocks.MockHTTPClientWithResponseCode(http.StatusUnauthorized)
-	Push(d, "http://dummy.ft.com", httpClient)(w, req)
+	Push(d, dispatch.NewHistory(10), "http://dummy.ft.com", httpClient, clock.System(), nil, nil)(w, req)
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
 
@@ -223,7 +231,7 @@ func TestEmptyApiKey(t *testing.T) {
 	req.Header.Set(apiKeyHeaderField, "")
 
 	start = func(sub dispatch.Subscriber) {
-		sub.NotificationChannel() <- "hi"
+		sub.NotificationChannel() <- dispatch.Event{Data: "hi"}
 		time.Sleep(10 * time.Millisecond)
 		w.closer <- true
 
@@ -232,10 +240,67 @@ func TestEmptyApiKey(t *testing.T) {
 	}
 
 	httpClient := mocks.DefaultMockHTTPClient()
-	Push(d, "http://dummy.ft.com", httpClient)(w, req)
+	Push(d, dispatch.NewHistory(10), "http://dummy.ft.com", httpClient, clock.System(), nil, nil)(w, req)
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
 
+func TestApiKeyNotValidatedWithoutAPIGateway(t *testing.T) {
+	d := new(MockDispatcher)
+
+	d.On("Register", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+	d.On("Close", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+
+	w := NewStreamResponseRecorder()
+	req, err := http.NewRequest("GET", "/content/notifications-push", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start = func(sub dispatch.Subscriber) {
+		sub.NotificationChannel() <- dispatch.Event{Data: "hi"}
+		time.Sleep(10 * time.Millisecond)
+		w.closer <- true
+	}
+
+	Push(d, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clock.System(), nil, nil)(w, req)
+
+	assert.Equal(t, "data: hi\n\n", w.Body.String())
+	assert.Equal(t, http.StatusOK, w.Code, "Should be OK")
+	d.AssertExpectations(t)
+}
+
+func TestApiKeyNotValidatedWithClientCertificate(t *testing.T) {
+	d := new(MockDispatcher)
+
+	d.On("Register", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+	d.On("Close", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+
+	w := NewStreamResponseRecorder()
+	req, err := http.NewRequest("GET", "/content/notifications-push", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ProtoMajor, req.ProtoMinor = 2, 0
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "content-syndication"}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	start = func(sub dispatch.Subscriber) {
+		sub.NotificationChannel() <- dispatch.Event{Data: "hi"}
+		time.Sleep(10 * time.Millisecond)
+		w.closer <- true
+
+		assert.Equal(t, "content-syndication", sub.Identity())
+	}
+
+	httpClient := mocks.MockHTTPClientWithResponseCode(http.StatusUnauthorized)
+	Push(d, dispatch.NewHistory(10), "http://dummy.ft.com", httpClient, clock.System(), nil, nil)(w, req)
+
+	assert.Equal(t, "data: hi\n\n", w.Body.String())
+	assert.Equal(t, http.StatusOK, w.Code, "Should be OK")
+	assert.Empty(t, w.Header().Get("Connection"), "There are no connection-specific headers in HTTP/2")
+	d.AssertExpectations(t)
+}
+
 func TestInvalidUrlForValidatingApiKey(t *testing.T) {
 	d := new(MockDispatcher)
 
@@ -252,7 +317,7 @@ func TestInvalidUrlForValidatingApiKey(t *testing.T) {
 	req.Header.Set(apiKeyHeaderField, "some-api-key")
 
 	start = func(sub dispatch.Subscriber) {
-		sub.NotificationChannel() <- "hi"
+		sub.NotificationChannel() <- dispatch.Event{Data: "hi"}
 		time.Sleep(10 * time.Millisecond)
 		w.closer <- true
 
@@ -261,7 +326,7 @@ func TestInvalidUrlForValidatingApiKey(t *testing.T) {
 	}
 
 	httpClient := mocks.DefaultMockHTTPClient()
-	Push(d, ":invalidurl", httpClient)(w, req)
+	Push(d, dispatch.NewHistory(10), ":invalidurl", httpClient, clock.System(), nil, nil)(w, req)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
@@ -281,7 +346,7 @@ func TestClientErrorByRequestingValidatingApiKey(t *testing.T) {
 	req.Header.Set(apiKeyHeaderField, "some-api-key")
 
 	start = func(sub dispatch.Subscriber) {
-		sub.NotificationChannel() <- "hi"
+		sub.NotificationChannel() <- dispatch.Event{Data: "hi"}
 		time.Sleep(10 * time.Millisecond)
 		w.closer <- true
 
@@ -290,7 +355,7 @@ func TestClientErrorByRequestingValidatingApiKey(t *testing.T) {
 	}
 
 	httpClient := mocks.ErroringMockHTTPClient()
-	Push(d, "http://dummy.ft.com", httpClient)(w, req)
+	Push(d, dispatch.NewHistory(10), "http://dummy.ft.com", httpClient, clock.System(), nil, nil)(w, req)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
@@ -317,3 +382,273 @@ type StreamResponseRecorder struct {
 func (r *StreamResponseRecorder) CloseNotify() <-chan bool {
 	return r.closer
 }
+
+func TestPushHeaderFilter(t *testing.T) {
+	d := new(MockDispatcher)
+
+	d.On("Register", mock.MatchedBy(func(sub dispatch.Subscriber) bool {
+		return assert.ObjectsAreEqual(dispatch.HeaderFilter{"Origin-System-Id": "http://cmdb.ft.com/systems/methode-web-pub"}, sub.HeaderFilter())
+	})).Return()
+	d.On("Close", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+
+	w := NewStreamResponseRecorder()
+	req, err := http.NewRequest("GET", "/content/notifications-push?header=Origin-System-Id:http://cmdb.ft.com/systems/methode-web-pub", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set(apiKeyHeaderField, "some-api-key")
+
+	start = func(sub dispatch.Subscriber) {
+		sub.NotificationChannel() <- dispatch.Event{Data: "hi"}
+		time.Sleep(10 * time.Millisecond)
+		w.closer <- true
+	}
+
+	httpClient := mocks.MockHTTPClientWithResponseCode(http.StatusOK)
+	Push(d, dispatch.NewHistory(10), "http://dummy.ft.com", httpClient, clock.System(), nil, nil)(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code, "Should be OK")
+	d.AssertExpectations(t)
+}
+
+func TestPushInvalidHeaderFilter(t *testing.T) {
+	d := new(MockDispatcher)
+
+	w := NewStreamResponseRecorder()
+	req, err := http.NewRequest("GET", "/content/notifications-push?header=Origin-System-Id", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set(apiKeyHeaderField, "some-api-key")
+
+	httpClient := mocks.MockHTTPClientWithResponseCode(http.StatusOK)
+	Push(d, dispatch.NewHistory(10), "http://dummy.ft.com", httpClient, clock.System(), nil, nil)(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "The specified header filter (Origin-System-Id) is not in the name:value format")
+	d.AssertNotCalled(t, "Register", mock.Anything)
+}
+
+func TestPushResumesFromLastEventID(t *testing.T) {
+	d := new(MockDispatcher)
+
+	d.On("Register", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+	d.On("Close", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+
+	n1 := dispatch.Notification{ID: "http://www.ft.com/thing/1", Type: "http://www.ft.com/thing/ThingChangeType/DELETE", PublishReference: "tid_1", LastModified: "2016-11-02T10:54:22.234Z"}
+	n2 := dispatch.Notification{ID: "http://www.ft.com/thing/2", Type: "http://www.ft.com/thing/ThingChangeType/DELETE", PublishReference: "tid_2", LastModified: "2016-11-02T10:54:23.234Z"}
+	history := dispatch.NewHistory(10)
+	history.Push(n1)
+	history.Push(n2)
+
+	w := NewStreamResponseRecorder()
+	req, err := http.NewRequest("GET", "/content/notifications-push", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(lastEventIDHeaderField, dispatch.EventID(n1))
+
+	start = func(sub dispatch.Subscriber) {
+		sub.NotificationChannel() <- dispatch.Event{Data: "[]"}
+		sub.NotificationChannel() <- dispatch.Event{ID: dispatch.EventID(n2), Data: "live"}
+		time.Sleep(10 * time.Millisecond)
+		w.closer <- true
+	}
+
+	Push(d, history, "", mocks.DefaultMockHTTPClient(), clock.System(), nil, nil)(w, req)
+
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(body, "data: []\n\nid: "+dispatch.EventID(n2)+"\ndata: ["), "The missed notification is sent after the first heartbeat: %q", body)
+	assert.Contains(t, body, `"id":"http://www.ft.com/thing/2"`)
+	assert.NotContains(t, body, "live", "Live notifications already sent from history are skipped")
+	assert.Equal(t, 1, strings.Count(body, "id: "))
+	d.AssertExpectations(t)
+}
+
+func TestPushProtocolV2(t *testing.T) {
+	d := new(MockDispatcher)
+
+	d.On("Register", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+	d.On("Close", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+
+	w := NewStreamResponseRecorder()
+	req, err := http.NewRequest("GET", "/content/notifications-push?protocol=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start = func(sub dispatch.Subscriber) {
+		sub.NotificationChannel() <- dispatch.Event{Type: dispatch.HeartbeatEvent, Data: "[]"}
+		sub.NotificationChannel() <- dispatch.Event{ID: "e1", Type: dispatch.NotificationEvent, Data: "[{}]"}
+		sub.NotificationChannel() <- dispatch.Event{Type: dispatch.ReconnectEvent}
+	}
+
+	clk := clock.NewFake(time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC))
+	Push(d, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clk, nil, nil)(w, req)
+
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(body, "retry: 5000\nevent: subscribed\ndata: {"), "The stream starts with the retry hint and the subscribed event: %q", body)
+	assert.True(t, strings.HasSuffix(body, "\n\nevent: heartbeat\ndata: {\"time\":\"2017-06-01T10:00:00Z\"}\n\n"+
+		"id: e1\nevent: notification\ndata: [{}]\n\n"+
+		"event: reconnect\ndata: {\"retry\":5000}\n\n"), "The stream ends after the reconnect event: %q", body)
+	d.AssertExpectations(t)
+}
+
+func TestPushProtocolV1EndsOnReconnect(t *testing.T) {
+	d := new(MockDispatcher)
+
+	d.On("Register", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+	d.On("Close", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+
+	w := NewStreamResponseRecorder()
+	req, err := http.NewRequest("GET", "/content/notifications-push", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start = func(sub dispatch.Subscriber) {
+		sub.NotificationChannel() <- dispatch.Event{Type: dispatch.HeartbeatEvent, Data: "[]"}
+		sub.NotificationChannel() <- dispatch.Event{Type: dispatch.ReconnectEvent}
+	}
+
+	Push(d, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clock.System(), nil, nil)(w, req)
+
+	assert.Equal(t, "data: []\n\n", w.Body.String(), "Version 1 subscribers only see the stream closing")
+	d.AssertExpectations(t)
+}
+
+func TestPushInvalidProtocol(t *testing.T) {
+	d := new(MockDispatcher)
+
+	w := NewStreamResponseRecorder()
+	req, err := http.NewRequest("GET", "/content/notifications-push?protocol=3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Push(d, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clock.System(), nil, nil)(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "The specified protocol version (3) is unsupported")
+	d.AssertNotCalled(t, "Register", mock.Anything)
+}
+
+func TestPushBatchesMissedNotifications(t *testing.T) {
+	d := new(MockDispatcher)
+
+	d.On("Register", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+	d.On("Close", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+
+	history := dispatch.NewHistory(10)
+	var notifications []dispatch.Notification
+	for i := 0; i < 4; i++ {
+		n := dispatch.Notification{ID: fmt.Sprintf("http://www.ft.com/thing/%d", i), Type: "http://www.ft.com/thing/ThingChangeType/DELETE", PublishReference: fmt.Sprintf("tid_%d", i), LastModified: fmt.Sprintf("2016-11-02T10:54:2%d.234Z", i)}
+		notifications = append(notifications, n)
+		history.Push(n)
+	}
+
+	w := NewStreamResponseRecorder()
+	req, err := http.NewRequest("GET", "/content/notifications-push?batchSize=10", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(lastEventIDHeaderField, dispatch.EventID(notifications[0]))
+
+	start = func(sub dispatch.Subscriber) {
+		sub.NotificationChannel() <- dispatch.Event{Type: dispatch.HeartbeatEvent, Data: "[]"}
+		time.Sleep(10 * time.Millisecond)
+		w.closer <- true
+	}
+
+	Push(d, history, "", mocks.DefaultMockHTTPClient(), clock.System(), nil, nil)(w, req)
+
+	body := w.Body.String()
+	assert.True(t, strings.HasPrefix(body, "data: []\n\nid: "+dispatch.EventID(notifications[3])+"\ndata: ["), "The missed notifications are sent in a single event: %q", body)
+	assert.Equal(t, 3, strings.Count(body, `"id":"http://www.ft.com/thing/`))
+	assert.Equal(t, 2, strings.Count(body, "data: "))
+	d.AssertExpectations(t)
+}
+
+func TestPushNDJSON(t *testing.T) {
+	d := new(MockDispatcher)
+
+	d.On("Register", mock.AnythingOfType("*dispatch.monitorSubscriber")).Return()
+	d.On("Close", mock.AnythingOfType("*dispatch.monitorSubscriber")).Return()
+
+	w := NewStreamResponseRecorder()
+	req, err := http.NewRequest("GET", "/content/notifications-push?monitor=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/x-ndjson")
+
+	n := dispatch.Notification{APIURL: "http://api.ft.com/content/1", ID: "http://www.ft.com/thing/1", Type: "http://www.ft.com/thing/ThingChangeType/DELETE", PublishReference: "tid_1"}
+	start = func(sub dispatch.Subscriber) {
+		sub.NotificationChannel() <- dispatch.Event{Type: dispatch.HeartbeatEvent, Data: "[]"}
+		sub.NotificationChannel() <- dispatch.Event{ID: "e1", Type: dispatch.NotificationEvent, Notifications: []dispatch.Notification{n}}
+		time.Sleep(10 * time.Millisecond)
+		w.closer <- true
+	}
+
+	Push(d, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clock.System(), nil, nil)(w, req)
+
+	assert.Equal(t, "application/x-ndjson; charset=UTF-8", w.Header().Get("Content-type"))
+	assert.Equal(t, `</__schemas/ndjson/v1>; rel="describedby"`, w.Header().Get("Link"))
+	assert.Equal(t, "\n"+`{"apiUrl":"http://api.ft.com/content/1","id":"http://www.ft.com/thing/1","type":"http://www.ft.com/thing/ThingChangeType/DELETE","publishReference":"tid_1","standout":{"scoop":false}}`+"\n", w.Body.String())
+	d.AssertExpectations(t)
+}
+
+func TestPushGzip(t *testing.T) {
+	d := new(MockDispatcher)
+
+	d.On("Register", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+	d.On("Close", mock.AnythingOfType("*dispatch.standardSubscriber")).Return()
+
+	w := NewStreamResponseRecorder()
+	req, err := http.NewRequest("GET", "/content/notifications-push", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	start = func(sub dispatch.Subscriber) {
+		sub.NotificationChannel() <- dispatch.Event{Type: dispatch.HeartbeatEvent, Data: "[]"}
+		sub.NotificationChannel() <- dispatch.Event{ID: "e1", Type: dispatch.NotificationEvent, Data: "[{}]"}
+		time.Sleep(10 * time.Millisecond)
+		w.closer <- true
+	}
+
+	compression := NewCompression()
+	Push(d, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clock.System(), compression, nil)(w, req)
+
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	gz, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(gz)
+	require.NoError(t, err, "The compressed stream is ended")
+	assert.Equal(t, "data: []\n\nid: e1\ndata: [{}]\n\n", string(body))
+
+	stats := compression.stats()
+	assert.Equal(t, int64(0), stats.Streams)
+	assert.Equal(t, uint64(len(body)), stats.UncompressedBytes)
+	d.AssertExpectations(t)
+}
+
+func TestPushErrorsAreNotCompressed(t *testing.T) {
+	d := new(MockDispatcher)
+
+	w := NewStreamResponseRecorder()
+	req, err := http.NewRequest("GET", "/content/notifications-push?type=Audio", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	Push(d, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clock.System(), NewCompression(), nil)(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Contains(t, w.Body.String(), "The specified type (Audio) is unsupported")
+}
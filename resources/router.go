@@ -0,0 +1,101 @@
+package resources
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/Financial-Times/notifications-push/audit"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/cluster"
+	"github.com/Financial-Times/notifications-push/config"
+	"github.com/Financial-Times/notifications-push/consumer"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/Financial-Times/notifications-push/supervisor"
+	"github.com/Financial-Times/service-status-go/httphandlers"
+	"github.com/gorilla/mux"
+	"github.com/rcrowley/go-metrics"
+)
+
+// RouterOptions are the optional dependencies of the router, the routes needing one are only added if it is set
+type RouterOptions struct {
+	// IngestHandler handles the messages posted to /__ingest
+	IngestHandler consumer.MessageQueueHandler
+	// PartitionLag adds the lag of the consumer group to the stats
+	PartitionLag *consumer.PartitionLag
+	// Supervisor reports the errors of the consumer on /__supervisor
+	Supervisor *supervisor.Supervisor
+	// AuditLog records the sessions of the subscribers and summarises them on /__audit/summary
+	AuditLog *audit.Log
+	// Cluster replaces the history and stats with the ones of the whole cluster, and serves the state of the replica to its peers
+	Cluster *cluster.Cluster
+	// Admin is the router the admin routes are added to, so that they are not public
+	Admin *mux.Router
+}
+
+// NewRouter returns the routes of the service. The push stream and the schemas are public, the admin routes (history,
+// stats, config, health, profiling...) are added to the admin router of the options, or to the returned router without one.
+// The standard endpoints telling whether the service is up are on both.
+func NewRouter(resource string, dispatcher dispatch.Dispatcher, history dispatch.History, hc *HealthCheck, apiGatewayKeyValidationURL string, httpClient *http.Client, activeConfig func() *config.Active, clk clock.Clock, options RouterOptions) *mux.Router {
+	notificationsPushPath := "/" + resource + "/notifications-push"
+
+	r := mux.NewRouter()
+	admin := options.Admin
+	if admin == nil {
+		admin = r
+	}
+
+	compression := NewCompression()
+	lag := NewLag(dispatcher, options.PartitionLag)
+	stats := Stats(dispatcher, compression, lag)
+	if c := options.Cluster; c != nil {
+		history = c.History()
+		stats = ClusterStats(c, compression, lag)
+		if backplane, ok := c.Backplane().(http.Handler); ok {
+			admin.Handle(cluster.StatePath, backplane).Methods("GET")
+		}
+	}
+
+	r.HandleFunc(notificationsPushPath, Push(dispatcher, history, apiGatewayKeyValidationURL, httpClient, clk, compression, options.AuditLog)).Methods("GET")
+	r.HandleFunc(schemasPath, Schemas).Methods("GET")
+	r.HandleFunc(schemasPath+"/{format}/{version}", Schema).Methods("GET")
+
+	admin.HandleFunc("/__history", History(history)).Methods("GET")
+	admin.HandleFunc("/__stats", stats).Methods("GET")
+	admin.HandleFunc("/__config", Config(activeConfig)).Methods("GET")
+	admin.HandleFunc("/__metrics", Metrics(metrics.DefaultRegistry)).Methods("GET")
+	if options.IngestHandler != nil {
+		admin.HandleFunc("/__ingest", Ingest(options.IngestHandler)).Methods("POST")
+	}
+	if options.Supervisor != nil {
+		admin.HandleFunc("/__supervisor", Supervisor(options.Supervisor)).Methods("GET")
+	}
+	if options.AuditLog != nil {
+		admin.HandleFunc("/__audit/summary", AuditSummary(options.AuditLog, clk)).Methods("GET")
+	}
+	admin.HandleFunc("/__health", hc.Health())
+	handleProfiling(admin)
+
+	for _, router := range uniqueRouters(r, admin) {
+		router.HandleFunc(httphandlers.GTGPath, httphandlers.NewGoodToGoHandler(hc.GTG))
+		router.HandleFunc(httphandlers.BuildInfoPath, httphandlers.BuildInfoHandler)
+		router.HandleFunc(httphandlers.PingPath, httphandlers.PingHandler)
+	}
+
+	return r
+}
+
+// handleProfiling routes the net/http/pprof handlers, rather than having them on http.DefaultServeMux
+func handleProfiling(r *mux.Router) {
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+}
+
+func uniqueRouters(public *mux.Router, admin *mux.Router) []*mux.Router {
+	if public == admin {
+		return []*mux.Router{public}
+	}
+	return []*mux.Router{public, admin}
+}
@@ -0,0 +1,63 @@
+package resources
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/audit"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/config"
+	"github.com/Financial-Times/notifications-push/consumer"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/Financial-Times/notifications-push/test/mocks"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRouter(admin *mux.Router, auditLog *audit.Log) *mux.Router {
+	history := dispatch.NewHistory(1)
+	dispatcher := dispatch.NewDispatcher(0, time.Minute, history, clock.System())
+	hc := NewStandaloneHealthCheck(consumer.NewLocalConsumer(nil, false, time.Millisecond), dispatcher, testThresholds)
+	activeConfig := func() *config.Active { return nil }
+	return NewRouter("content", dispatcher, history, hc, "", &http.Client{}, activeConfig, clock.System(), RouterOptions{AuditLog: auditLog, Admin: admin})
+}
+
+func routed(r *mux.Router, method string, path string) bool {
+	return r.Match(httptest.NewRequest(method, path, nil), &mux.RouteMatch{})
+}
+
+func TestRouterServesAdminRoutesOnTheAdminRouter(t *testing.T) {
+	admin := mux.NewRouter()
+	public := newTestRouter(admin, nil)
+
+	assert.True(t, routed(public, "GET", "/content/notifications-push"))
+	assert.False(t, routed(admin, "GET", "/content/notifications-push"), "The push stream is public")
+
+	for _, path := range []string{"/__history", "/__stats", "/__config", "/__metrics", "/__health", "/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/profile"} {
+		assert.False(t, routed(public, "GET", path), path)
+		assert.True(t, routed(admin, "GET", path), path)
+	}
+	for _, path := range []string{"/__gtg", "/__build-info", "/__ping"} {
+		assert.True(t, routed(public, "GET", path), path)
+		assert.True(t, routed(admin, "GET", path), path)
+	}
+}
+
+func TestRouterServesAdminRoutesWithoutAdminRouter(t *testing.T) {
+	r := newTestRouter(nil, nil)
+
+	for _, path := range []string{"/content/notifications-push", "/__history", "/__stats", "/__health", "/debug/pprof/", "/__gtg"} {
+		assert.True(t, routed(r, "GET", path), path)
+	}
+}
+
+func TestRouterServesTheAuditSummaryWithAnAuditLog(t *testing.T) {
+	admin := mux.NewRouter()
+	public := newTestRouter(admin, audit.New(&mocks.AuditSink{}, 10, "salt", clock.System()))
+
+	assert.False(t, routed(public, "GET", "/__audit/summary"))
+	assert.True(t, routed(admin, "GET", "/__audit/summary"))
+	assert.False(t, routed(newTestRouter(nil, nil), "GET", "/__audit/summary"), "Auditing is disabled")
+}
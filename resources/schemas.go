@@ -0,0 +1,102 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/gorilla/mux"
+)
+
+const schemasPath = "/__schemas"
+
+type formatSchema struct {
+	Format    string `json:"format"`
+	MediaType string `json:"mediaType"`
+	Version   int    `json:"version"`
+	Schema    string `json:"schema"`
+}
+
+// notificationSchema is the JSON Schema of a notification, with additional payload fields allowed
+var notificationSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []string{"apiUrl", "id", "type"},
+	"properties": map[string]interface{}{
+		"apiUrl":           map[string]string{"type": "string"},
+		"id":               map[string]string{"type": "string"},
+		"type":             map[string]string{"type": "string"},
+		"publishReference": map[string]string{"type": "string", "description": "Monitor subscribers only"},
+		"lastModified":     map[string]string{"type": "string", "description": "Monitor subscribers only"},
+		"notificationDate": map[string]string{"type": "string", "description": "Monitor subscribers only"},
+		"title":            map[string]string{"type": "string"},
+		"standout": map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{"scoop": map[string]string{"type": "boolean"}},
+		},
+		"flags":   map[string]interface{}{"type": "array", "items": map[string]string{"type": "string"}},
+		"headers": map[string]interface{}{"type": "object", "additionalProperties": map[string]string{"type": "string"}, "description": "Monitor subscribers only"},
+	},
+	"additionalProperties": true,
+}
+
+// schema returns the JSON Schema of the messages of the push stream in the given format
+func schema(f StreamFormat) map[string]interface{} {
+	s := map[string]interface{}{
+		"$schema": "http://json-schema.org/draft-04/schema#",
+		"id":      f.SchemaPath(),
+	}
+
+	switch f.Format.Name {
+	case NDJSONStreamFormat.Format.Name:
+		s["title"] = "Notifications push stream in NDJSON"
+		s["description"] = "Every line is a notification, heartbeats are empty lines"
+		for key, value := range notificationSchema {
+			s[key] = value
+		}
+	case MsgPackStreamFormat.Format.Name:
+		s["title"] = "Notifications push stream in MessagePack"
+		s["description"] = "Every message is an array of notifications encoded as maps, heartbeats are empty arrays"
+		s["type"] = "array"
+		s["items"] = notificationSchema
+	default:
+		s["title"] = "Notifications push stream data"
+		s["description"] = "The data of every event is an array of notifications, heartbeats are empty arrays"
+		s["type"] = "array"
+		s["items"] = notificationSchema
+	}
+	return s
+}
+
+// Schemas lists the formats of the push stream with the path of their schema
+func Schemas(w http.ResponseWriter, r *http.Request) {
+	var schemas []formatSchema
+	for _, f := range StreamFormats {
+		schemas = append(schemas, formatSchema{Format: f.Format.Name, MediaType: f.MediaType, Version: f.SchemaVersion, Schema: f.SchemaPath()})
+	}
+	writeSchema(w, schemas)
+}
+
+// Schema returns the JSON Schema of a version of a format of the push stream
+func Schema(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	for _, f := range StreamFormats {
+		if vars["format"] == f.Format.Name && vars["version"] == fmt.Sprintf("v%d", f.SchemaVersion) {
+			writeSchema(w, schema(f))
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("There is no schema for version %s of format %s", vars["version"], vars["format"]), http.StatusNotFound)
+}
+
+func writeSchema(w http.ResponseWriter, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		log.WithError(err).Warn("Serving schemas")
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-type", "application/json; charset=UTF-8")
+	w.Write(data)
+}
@@ -0,0 +1,58 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func schemasRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc(schemasPath, Schemas)
+	r.HandleFunc(schemasPath+"/{format}/{version}", Schema)
+	return r
+}
+
+func TestSchemas(t *testing.T) {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/__schemas", nil)
+
+	schemasRouter().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var schemas []formatSchema
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &schemas))
+	require.Len(t, schemas, 3)
+	assert.Equal(t, formatSchema{Format: "ndjson", MediaType: "application/x-ndjson", Version: 1, Schema: "/__schemas/ndjson/v1"}, schemas[1])
+}
+
+func TestSchema(t *testing.T) {
+	for _, f := range StreamFormats {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", f.SchemaPath(), nil)
+
+		schemasRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code, f.SchemaPath())
+		var schema map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &schema))
+		assert.Equal(t, f.SchemaPath(), schema["id"])
+		assert.NotEmpty(t, schema["description"])
+	}
+}
+
+func TestUnknownSchema(t *testing.T) {
+	for _, path := range []string{"/__schemas/json/v2", "/__schemas/xml/v1"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+
+		schemasRouter().ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
@@ -0,0 +1,158 @@
+package resources
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/dispatch"
+)
+
+// Versions of the push stream protocol
+const (
+	// ProtocolV1 sends notifications and heartbeats as unnamed data events
+	ProtocolV1 = 1
+	// ProtocolV2 sends named events, a reconnection time and control events
+	ProtocolV2 = 2
+)
+
+// Control events of the version 2 of the protocol
+const (
+	subscribedEvent = "subscribed"
+	droppedEvent    = "dropped"
+	errorEvent      = "error"
+)
+
+// reconnectionTime is the retry hint sent to version 2 subscribers
+const reconnectionTime = 5 * time.Second
+
+const (
+	protocolQueryParam  = "protocol"
+	heartbeatQueryParam = "heartbeat"
+)
+
+// eventStream writes the events of the push stream in the protocol version asked by the subscriber
+type eventStream struct {
+	fw      *frameWriter
+	version int
+	// commentHeartbeats are sent as SSE comments instead of heartbeat events in version 2
+	commentHeartbeats bool
+	clock             clock.Clock
+}
+
+// resolveProtocol reads the protocol version from the protocol query parameter or the version parameter
+// of the text/event-stream media type in the Accept header, i.e. Accept: text/event-stream; version=2
+func resolveProtocol(r *http.Request) (int, bool, error) {
+	version := strings.TrimSpace(r.URL.Query().Get(protocolQueryParam))
+	if version == "" {
+		version = acceptedProtocol(r.Header.Get("Accept"))
+	}
+
+	protocol := ProtocolV1
+	if version != "" {
+		var err error
+		protocol, err = strconv.Atoi(version)
+		if err != nil || (protocol != ProtocolV1 && protocol != ProtocolV2) {
+			return 0, false, fmt.Errorf("The specified protocol version (%s) is unsupported", version)
+		}
+	}
+
+	heartbeat := r.URL.Query().Get(heartbeatQueryParam)
+	switch heartbeat {
+	case "", "event":
+		return protocol, false, nil
+	case "comment":
+		return protocol, true, nil
+	}
+	return 0, false, fmt.Errorf("The specified heartbeat style (%s) is unsupported", heartbeat)
+}
+
+func acceptedProtocol(accept string) string {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err == nil && mediaType == "text/event-stream" {
+			return params["version"]
+		}
+	}
+	return ""
+}
+
+// start sends the reconnection time and the subscribed event to version 2 subscribers
+func (s *eventStream) start(sub dispatch.Subscriber) error {
+	if s.version < ProtocolV2 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(s.fw, "retry: %d\n", reconnectionTime/time.Millisecond); err != nil {
+		return err
+	}
+	return s.control(subscribedEvent, dispatch.NewSubscriberPayload(sub))
+}
+
+// write sends a dispatched event, version 1 subscribers only receive notifications and heartbeats
+func (s *eventStream) write(e dispatch.Event) error {
+	if s.version < ProtocolV2 {
+		if e.Type == dispatch.ReconnectEvent {
+			return nil
+		}
+		return s.send(e.ID, "", e.Data)
+	}
+
+	switch e.Type {
+	case dispatch.HeartbeatEvent:
+		now := s.clock.Now().UTC().Format(time.RFC3339Nano)
+		if s.commentHeartbeats {
+			if _, err := s.fw.WriteString(": heartbeat " + now + "\n\n"); err != nil {
+				return err
+			}
+			return s.fw.flush()
+		}
+		return s.control(dispatch.HeartbeatEvent, map[string]string{"time": now})
+	case dispatch.ReconnectEvent:
+		return s.control(dispatch.ReconnectEvent, map[string]int64{"retry": int64(reconnectionTime / time.Millisecond)})
+	}
+	return s.send(e.ID, dispatch.NotificationEvent, e.Data)
+}
+
+// dropped tells version 2 subscribers how many events were dropped because they were lagging behind
+func (s *eventStream) dropped(count uint64, total uint64) error {
+	return s.control(droppedEvent, map[string]uint64{"count": count, "total": total})
+}
+
+// sendError tells version 2 subscribers about a failure that does not end the stream
+func (s *eventStream) sendError(code string, message string) error {
+	return s.control(errorEvent, map[string]string{"code": code, "message": message})
+}
+
+// control sends a control event to version 2 subscribers, nothing is sent to version 1 subscribers
+func (s *eventStream) control(eventType string, data interface{}) error {
+	if s.version < ProtocolV2 {
+		return nil
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return s.send("", eventType, string(payload))
+}
+
+func (s *eventStream) send(id string, eventType string, data string) error {
+	if id != "" {
+		if _, err := s.fw.WriteString("id: " + id + "\n"); err != nil {
+			return err
+		}
+	}
+	if eventType != "" {
+		if _, err := s.fw.WriteString("event: " + eventType + "\n"); err != nil {
+			return err
+		}
+	}
+	if _, err := s.fw.WriteString("data: " + data + "\n\n"); err != nil {
+		return err
+	}
+	return s.fw.flush()
+}
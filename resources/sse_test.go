@@ -0,0 +1,101 @@
+package resources
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEventStream(version int, commentHeartbeats bool) (*eventStream, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	clk := clock.NewFake(time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC))
+	return &eventStream{fw: newFrameWriter(w, httptest.NewRequest("GET", "/content/notifications-push", nil), nil), version: version, commentHeartbeats: commentHeartbeats, clock: clk}, w
+}
+
+func TestResolveProtocol(t *testing.T) {
+	tests := []struct {
+		url               string
+		accept            string
+		version           int
+		commentHeartbeats bool
+		err               bool
+	}{
+		{url: "/content/notifications-push", version: ProtocolV1},
+		{url: "/content/notifications-push?protocol=2", version: ProtocolV2},
+		{url: "/content/notifications-push?protocol=1", accept: "text/event-stream; version=2", version: ProtocolV1},
+		{url: "/content/notifications-push", accept: "text/event-stream; version=2", version: ProtocolV2},
+		{url: "/content/notifications-push", accept: "text/plain, text/event-stream;version=2", version: ProtocolV2},
+		{url: "/content/notifications-push", accept: "text/event-stream", version: ProtocolV1},
+		{url: "/content/notifications-push?protocol=2&heartbeat=comment", version: ProtocolV2, commentHeartbeats: true},
+		{url: "/content/notifications-push?protocol=2&heartbeat=event", version: ProtocolV2},
+		{url: "/content/notifications-push?protocol=3", err: true},
+		{url: "/content/notifications-push", accept: "text/event-stream; version=two", err: true},
+		{url: "/content/notifications-push?heartbeat=silent", err: true},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", test.url, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+
+		version, commentHeartbeats, err := resolveProtocol(req)
+		if test.err {
+			assert.Error(t, err, "%s %s", test.url, test.accept)
+			continue
+		}
+		assert.NoError(t, err, "%s %s", test.url, test.accept)
+		assert.Equal(t, test.version, version, "%s %s", test.url, test.accept)
+		assert.Equal(t, test.commentHeartbeats, commentHeartbeats, "%s %s", test.url, test.accept)
+	}
+}
+
+func TestEventStreamV1(t *testing.T) {
+	s, w := newEventStream(ProtocolV1, false)
+
+	sub := dispatch.NewStandardSubscriber("192.168.1.2", "Article", nil, s.clock)
+	assert.NoError(t, s.start(sub))
+	assert.NoError(t, s.write(dispatch.Event{Type: dispatch.HeartbeatEvent, Data: "[]"}))
+	assert.NoError(t, s.write(dispatch.Event{ID: "e1", Type: dispatch.NotificationEvent, Data: "[{}]"}))
+	assert.NoError(t, s.dropped(2, 2))
+	assert.NoError(t, s.sendError("resume_failed", "missed"))
+
+	assert.Equal(t, "data: []\n\nid: e1\ndata: [{}]\n\n", w.Body.String(), "Control events are not sent to version 1 subscribers")
+}
+
+func TestEventStreamV2(t *testing.T) {
+	s, w := newEventStream(ProtocolV2, false)
+
+	assert.NoError(t, s.write(dispatch.Event{Type: dispatch.HeartbeatEvent, Data: "[]"}))
+	assert.NoError(t, s.dropped(2, 3))
+	assert.NoError(t, s.sendError("resume_failed", "missed"))
+
+	assert.Equal(t, "event: heartbeat\ndata: {\"time\":\"2017-06-01T10:00:00Z\"}\n\n"+
+		"event: dropped\ndata: {\"count\":2,\"total\":3}\n\n"+
+		"event: error\ndata: {\"code\":\"resume_failed\",\"message\":\"missed\"}\n\n", w.Body.String())
+}
+
+func TestEventStreamV2CommentHeartbeats(t *testing.T) {
+	s, w := newEventStream(ProtocolV2, true)
+
+	assert.NoError(t, s.write(dispatch.Event{Type: dispatch.HeartbeatEvent, Data: "[]"}))
+
+	assert.Equal(t, ": heartbeat 2017-06-01T10:00:00Z\n\n", w.Body.String())
+}
+
+func TestEventStreamV2Start(t *testing.T) {
+	s, w := newEventStream(ProtocolV2, false)
+
+	sub := dispatch.NewStandardSubscriber("192.168.1.2", "Article", nil, s.clock)
+	assert.NoError(t, s.start(sub))
+
+	body := w.Body.String()
+	assert.Contains(t, body, "retry: 5000\nevent: subscribed\ndata: {")
+	assert.Contains(t, body, `"address":"192.168.1.2"`)
+	assert.Contains(t, body, `"type":"dispatch.standardSubscriber"`)
+}
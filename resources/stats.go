@@ -3,24 +3,89 @@ package resources
 import (
 	"encoding/json"
 	"net/http"
+	"time"
 
 	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/cluster"
+	"github.com/Financial-Times/notifications-push/consumer"
 	"github.com/Financial-Times/notifications-push/dispatch"
 )
 
 type subscriptionStats struct {
 	NrOfSubscribers int                   `json:"nrOfSubscribers"`
 	Subscribers     []dispatch.Subscriber `json:"subscribers"`
+	Compression     *compressionStats     `json:"compression,omitempty"`
+	Lag             *lagStats             `json:"lag,omitempty"`
 }
 
-// Stats returns subscriber stats
-func Stats(dispatcher dispatch.Dispatcher) func(w http.ResponseWriter, r *http.Request) {
+type clusterStats struct {
+	NrOfSubscribers int                          `json:"nrOfSubscribers"`
+	Subscribers     []dispatch.SubscriberPayload `json:"subscribers"`
+	Nodes           []nodeStats                  `json:"nodes"`
+	// Compression of the streams of this replica
+	Compression *compressionStats `json:"compression,omitempty"`
+	// Lag of this replica
+	Lag *lagStats `json:"lag,omitempty"`
+}
+
+type nodeStats struct {
+	Node            string    `json:"node"`
+	NrOfSubscribers int       `json:"nrOfSubscribers"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// Lag measures how far behind the queue the consumer group is, and how old the notifications are when they are dispatched
+type Lag struct {
+	dispatcher   dispatch.Dispatcher
+	partitionLag *consumer.PartitionLag
+}
+
+// NewLag returns the lag of the dispatched notifications, and of the consumer group if its partition lag is polled
+func NewLag(dispatcher dispatch.Dispatcher, partitionLag *consumer.PartitionLag) *Lag {
+	return &Lag{dispatcher: dispatcher, partitionLag: partitionLag}
+}
+
+type lagStats struct {
+	Consumer  *consumerLagStats `json:"consumer,omitempty"`
+	Freshness freshnessStats    `json:"freshness"`
+}
+
+type consumerLagStats struct {
+	// Messages the consumer group is behind the topic, over all partitions
+	Messages   int64           `json:"messages"`
+	Partitions map[int32]int64 `json:"partitions"`
+}
+
+type freshnessStats struct {
+	LastDispatchedAt *time.Time `json:"lastDispatchedAt,omitempty"`
+	// AgeSeconds is the age of the latest notification dispatched since its LastModified
+	AgeSeconds float64 `json:"ageSeconds"`
+}
+
+func (l *Lag) stats() *lagStats {
+	if l == nil {
+		return nil
+	}
+	stats := &lagStats{}
+	if freshness := l.dispatcher.Freshness(); !freshness.DispatchedAt.IsZero() {
+		stats.Freshness = freshnessStats{LastDispatchedAt: &freshness.DispatchedAt, AgeSeconds: freshness.Age.Seconds()}
+	}
+	if l.partitionLag != nil {
+		stats.Consumer = &consumerLagStats{Messages: l.partitionLag.Total(), Partitions: l.partitionLag.Lags()}
+	}
+	return stats
+}
+
+// Stats returns subscriber stats, the compression ratio of the streams if it is measured, and the lag if it is measured
+func Stats(dispatcher dispatch.Dispatcher, compression *Compression, lag *Lag) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		subscribers := dispatcher.Subscribers()
 
 		stats := subscriptionStats{
 			NrOfSubscribers: len(subscribers),
 			Subscribers:     subscribers,
+			Compression:     compression.stats(),
+			Lag:             lag.stats(),
 		}
 
 		bytes, err := json.Marshal(stats)
@@ -41,3 +106,27 @@ func Stats(dispatcher dispatch.Dispatcher) func(w http.ResponseWriter, r *http.R
 		}
 	}
 }
+
+// ClusterStats returns the subscriber stats of every replica of the cluster
+func ClusterStats(c *cluster.Cluster, compression *Compression, lag *Lag) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats := clusterStats{Subscribers: []dispatch.SubscriberPayload{}, Nodes: []nodeStats{}, Compression: compression.stats(), Lag: lag.stats()}
+		for _, state := range c.States() {
+			stats.NrOfSubscribers += len(state.Subscribers)
+			stats.Subscribers = append(stats.Subscribers, state.Subscribers...)
+			stats.Nodes = append(stats.Nodes, nodeStats{Node: state.Node, NrOfSubscribers: len(state.Subscribers), UpdatedAt: state.UpdatedAt})
+		}
+
+		bytes, err := json.Marshal(stats)
+		if err != nil {
+			log.WithError(err).Warn("Error in marshalling cluster stats information")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-type", "application/json")
+		if _, err := w.Write(bytes); err != nil {
+			log.Warnf("Error writing cluster stats to HTTP response: %v", err.Error())
+		}
+	}
+}
@@ -1,12 +1,17 @@
 package resources
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/cluster"
 	"github.com/Financial-Times/notifications-push/test/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/Financial-Times/notifications-push/dispatch"
 )
 
@@ -20,7 +25,7 @@ func TestStats(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	Stats(d)(w, req)
+	Stats(d, nil, nil)(w, req)
 
 	assert.Equal(t, "application/json", w.Header().Get("Content-Type"), "Should be json")
 	assert.Equal(t, `{"nrOfSubscribers":0,"subscribers":[]}`, w.Body.String(), "Should be empty array")
@@ -28,3 +33,62 @@ func TestStats(t *testing.T) {
 
 	d.AssertExpectations(t)
 }
+
+func TestClusterStats(t *testing.T) {
+	clk := clock.NewFake(time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC))
+	backplane := cluster.NewLocalBackplane()
+	d := new(mocks.MockDispatcher)
+	d.On("Subscribers").Return([]dispatch.Subscriber{dispatch.NewStandardSubscriber("192.168.1.3", "Article", nil, clk)})
+	require.NoError(t, backplane.Share(cluster.NodeState{Node: "pod-b", UpdatedAt: clk.Now(), Subscribers: []dispatch.SubscriberPayload{{Address: "192.168.1.4", Node: "pod-b"}}}))
+
+	c := cluster.New("pod-a", backplane, d, dispatch.NewHistory(10), 10, 5*time.Second, clk)
+	require.NoError(t, c.Sync())
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/stats", nil)
+	require.NoError(t, err)
+
+	ClusterStats(c, nil, nil)(w, req)
+
+	assert.Equal(t, 200, w.Code, "Should be OK")
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"), "Should be json")
+
+	var stats clusterStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, 2, stats.NrOfSubscribers)
+	require.Len(t, stats.Subscribers, 2)
+	assert.Equal(t, "pod-a", stats.Subscribers[0].Node)
+	assert.Equal(t, "192.168.1.4", stats.Subscribers[1].Address)
+	assert.Equal(t, []nodeStats{{Node: "pod-a", NrOfSubscribers: 1, UpdatedAt: clk.Now()}, {Node: "pod-b", NrOfSubscribers: 1, UpdatedAt: clk.Now()}}, stats.Nodes)
+}
+
+func TestStatsWithCompression(t *testing.T) {
+	d := new(mocks.MockDispatcher)
+	d.On("Subscribers").Return([]dispatch.Subscriber{})
+	compression := &Compression{streams: 1, uncompressed: 300, compressed: 100}
+
+	w := httptest.NewRecorder()
+	req, err := http.NewRequest("GET", "/stats", nil)
+	require.NoError(t, err)
+
+	Stats(d, compression, nil)(w, req)
+
+	assert.Equal(t, `{"nrOfSubscribers":0,"subscribers":[],"compression":{"streams":1,"uncompressedBytes":300,"compressedBytes":100,"ratio":3}}`, w.Body.String())
+}
+
+func TestStatsWithLag(t *testing.T) {
+	d := new(mocks.MockDispatcher)
+	d.On("Subscribers").Return([]dispatch.Subscriber{})
+	d.On("Freshness").Return(dispatch.Freshness{}).Once()
+	dispatchedAt := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	d.On("Freshness").Return(dispatch.Freshness{DispatchedAt: dispatchedAt, Age: 1500 * time.Millisecond})
+	lag := NewLag(d, nil)
+
+	w := httptest.NewRecorder()
+	Stats(d, nil, lag)(w, httptest.NewRequest("GET", "/stats", nil))
+	assert.Equal(t, `{"nrOfSubscribers":0,"subscribers":[],"lag":{"freshness":{"ageSeconds":0}}}`, w.Body.String(), "No notification is dispatched yet")
+
+	w = httptest.NewRecorder()
+	Stats(d, nil, lag)(w, httptest.NewRequest("GET", "/stats", nil))
+	assert.Equal(t, `{"nrOfSubscribers":0,"subscribers":[],"lag":{"freshness":{"lastDispatchedAt":"2017-06-01T10:00:00Z","ageSeconds":1.5}}}`, w.Body.String())
+}
@@ -0,0 +1,26 @@
+package resources
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/supervisor"
+)
+
+// Supervisor returns the errors the supervisor has seen, by class and newest first, and the restarts of the consumer
+func Supervisor(s *supervisor.Supervisor) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bytes, err := json.Marshal(s.Status())
+		if err != nil {
+			log.WithError(err).Warn("Error in marshalling the supervisor status")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-type", "application/json")
+		if _, err = w.Write(bytes); err != nil {
+			log.WithError(err).Warn("Error writing the supervisor status to HTTP response")
+		}
+	}
+}
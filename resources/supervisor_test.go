@@ -0,0 +1,32 @@
+package resources
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/supervisor"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupervisor(t *testing.T) {
+	errCh := make(chan error)
+	s := supervisor.New(errCh, nil, nil, nil, supervisor.Backoff{}, 10, clock.NewFake(time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)))
+	done := make(chan struct{})
+	go func() {
+		s.Supervise()
+		close(done)
+	}()
+	errCh <- errors.New("kafka: broker not connected")
+	close(errCh)
+	<-done
+
+	w := httptest.NewRecorder()
+	Supervisor(s)(w, httptest.NewRequest("GET", "/__supervisor", nil))
+
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"errors":{"unclassified":1},"history":[{"time":"2017-06-01T10:00:00Z","error":"kafka: broker not connected","class":"unclassified","policy":"count"}],"restarts":0,"restarting":false}`, w.Body.String())
+}
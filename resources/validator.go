@@ -8,7 +8,8 @@ import (
 	"encoding/json"
 )
 
-func isValidApiKey(providedApiKey string, apiGatewayKeyValidationURL string, httpClient *http.Client) (bool, string, int) {
+// IsValidApiKey checks the API key with the API Gateway, giving the error message and the HTTP status code of invalid keys
+func IsValidApiKey(providedApiKey string, apiGatewayKeyValidationURL string, httpClient *http.Client) (bool, string, int) {
 	if providedApiKey == "" {
 		return false, "Empty api key", http.StatusUnauthorized
 	}
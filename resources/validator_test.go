@@ -9,7 +9,7 @@ import (
 
 func TestIsValidApiKeySuccessful(t *testing.T) {
 	client := mocks.MockHTTPClientWithResponseCode(http.StatusOK)
-	isValid, errMsg, errStatusCode := isValidApiKey("testKey", "http://api.gateway.url", client)
+	isValid, errMsg, errStatusCode := IsValidApiKey("testKey", "http://api.gateway.url", client)
 
 	assert.True(t, isValid)
 	assert.Equal(t, "", errMsg)
@@ -18,7 +18,7 @@ func TestIsValidApiKeySuccessful(t *testing.T) {
 
 func TestIsValidApiKeyError(t *testing.T) {
 	client := mocks.ErroringMockHTTPClient()
-	isValid, errMsg, errStatusCode := isValidApiKey("testKey", "http://api.gateway.url", client)
+	isValid, errMsg, errStatusCode := IsValidApiKey("testKey", "http://api.gateway.url", client)
 
 	assert.False(t, isValid)
 	assert.Equal(t, "Request to validate api key failed", errMsg)
@@ -27,7 +27,7 @@ func TestIsValidApiKeyError(t *testing.T) {
 
 func TestIsValidApiKeyEmptyKey(t *testing.T) {
 	client := mocks.ErroringMockHTTPClient()
-	isValid, errMsg, errStatusCode := isValidApiKey("", "http://api.gateway.url", client)
+	isValid, errMsg, errStatusCode := IsValidApiKey("", "http://api.gateway.url", client)
 
 	assert.False(t, isValid)
 	assert.Equal(t, "Empty api key", errMsg)
@@ -36,7 +36,7 @@ func TestIsValidApiKeyEmptyKey(t *testing.T) {
 
 func TestIsValidApiInvalidGatewayURL(t *testing.T) {
 	client := mocks.ErroringMockHTTPClient()
-	isValid, errMsg, errStatusCode := isValidApiKey("testKey", "://api.gateway.url", client)
+	isValid, errMsg, errStatusCode := IsValidApiKey("testKey", "://api.gateway.url", client)
 
 	assert.False(t, isValid)
 	assert.Equal(t, "Invalid URL", errMsg)
@@ -45,7 +45,7 @@ func TestIsValidApiInvalidGatewayURL(t *testing.T) {
 
 func TestIsValidApiKeyResponseUnauthorized(t *testing.T) {
 	client := mocks.MockHTTPClientWithResponseCode(http.StatusUnauthorized)
-	isValid, errMsg, errStatusCode := isValidApiKey("testKey", "http://api.gateway.url", client)
+	isValid, errMsg, errStatusCode := IsValidApiKey("testKey", "http://api.gateway.url", client)
 
 	assert.False(t, isValid)
 	assert.Equal(t, "Invalid api key", errMsg)
@@ -54,7 +54,7 @@ func TestIsValidApiKeyResponseUnauthorized(t *testing.T) {
 
 func TestIsValidApiKeyResponseTooManyRequests(t *testing.T) {
 	client := mocks.MockHTTPClientWithResponseCode(http.StatusTooManyRequests)
-	isValid, errMsg, errStatusCode := isValidApiKey("testKey", "http://api.gateway.url", client)
+	isValid, errMsg, errStatusCode := IsValidApiKey("testKey", "http://api.gateway.url", client)
 
 	assert.False(t, isValid)
 	assert.Equal(t, "Rate limit exceeded", errMsg)
@@ -63,7 +63,7 @@ func TestIsValidApiKeyResponseTooManyRequests(t *testing.T) {
 
 func TestIsValidApiKeyResponseForbidden(t *testing.T) {
 	client := mocks.MockHTTPClientWithResponseCode(http.StatusForbidden)
-	isValid, errMsg, errStatusCode := isValidApiKey("testKey", "http://api.gateway.url", client)
+	isValid, errMsg, errStatusCode := IsValidApiKey("testKey", "http://api.gateway.url", client)
 
 	assert.False(t, isValid)
 	assert.Equal(t, "Operation forbidden", errMsg)
@@ -72,7 +72,7 @@ func TestIsValidApiKeyResponseForbidden(t *testing.T) {
 
 func TestIsValidApiKeyResponseInternalServerError(t *testing.T) {
 	client := mocks.MockHTTPClientWithResponseCode(http.StatusInternalServerError)
-	isValid, errMsg, errStatusCode := isValidApiKey("testKey", "http://api.gateway.url", client)
+	isValid, errMsg, errStatusCode := IsValidApiKey("testKey", "http://api.gateway.url", client)
 
 	assert.False(t, isValid)
 	assert.Equal(t, "Request to validate api key returned an unexpected response", errMsg)
@@ -81,7 +81,7 @@ func TestIsValidApiKeyResponseInternalServerError(t *testing.T) {
 
 func TestIsValidApiKeyResponseOtherServerError(t *testing.T) {
 	client := mocks.MockHTTPClientWithResponseCode(http.StatusGatewayTimeout)
-	isValid, errMsg, errStatusCode := isValidApiKey("testKey", "http://api.gateway.url", client)
+	isValid, errMsg, errStatusCode := IsValidApiKey("testKey", "http://api.gateway.url", client)
 
 	assert.False(t, isValid)
 	assert.Equal(t, "Request to validate api key returned an unexpected response", errMsg)
@@ -0,0 +1,347 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: push.proto
+
+/*
+Package rpc is a generated protocol buffer package.
+
+It is generated from these files:
+
+	push.proto
+
+It has these top-level messages:
+
+	SubscribeRequest
+	SubscribeResponse
+	Notification
+*/
+package rpc
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type SubscribeRequest struct {
+	// type of the content, Article by default
+	Type string `protobuf:"bytes,1,opt,name=type" json:"type,omitempty"`
+	// monitor subscribers receive all the fields of the notifications
+	Monitor bool `protobuf:"varint,2,opt,name=monitor" json:"monitor,omitempty"`
+	// header values the notifications must have, i.e. Origin-System-Id
+	Headers map[string]string `protobuf:"bytes,3,rep,name=headers" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// resume_token of the last notification received
+	ResumeToken string `protobuf:"bytes,4,opt,name=resume_token,json=resumeToken" json:"resume_token,omitempty"`
+}
+
+func (m *SubscribeRequest) Reset()                    { *m = SubscribeRequest{} }
+func (m *SubscribeRequest) String() string            { return proto.CompactTextString(m) }
+func (*SubscribeRequest) ProtoMessage()               {}
+func (*SubscribeRequest) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *SubscribeRequest) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *SubscribeRequest) GetMonitor() bool {
+	if m != nil {
+		return m.Monitor
+	}
+	return false
+}
+
+func (m *SubscribeRequest) GetHeaders() map[string]string {
+	if m != nil {
+		return m.Headers
+	}
+	return nil
+}
+
+func (m *SubscribeRequest) GetResumeToken() string {
+	if m != nil {
+		return m.ResumeToken
+	}
+	return ""
+}
+
+type SubscribeResponse struct {
+	// resume_token to resume the stream after this notification
+	ResumeToken  string        `protobuf:"bytes,1,opt,name=resume_token,json=resumeToken" json:"resume_token,omitempty"`
+	Notification *Notification `protobuf:"bytes,2,opt,name=notification" json:"notification,omitempty"`
+}
+
+func (m *SubscribeResponse) Reset()                    { *m = SubscribeResponse{} }
+func (m *SubscribeResponse) String() string            { return proto.CompactTextString(m) }
+func (*SubscribeResponse) ProtoMessage()               {}
+func (*SubscribeResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *SubscribeResponse) GetResumeToken() string {
+	if m != nil {
+		return m.ResumeToken
+	}
+	return ""
+}
+
+func (m *SubscribeResponse) GetNotification() *Notification {
+	if m != nil {
+		return m.Notification
+	}
+	return nil
+}
+
+type Notification struct {
+	ApiUrl string `protobuf:"bytes,1,opt,name=api_url,json=apiUrl" json:"api_url,omitempty"`
+	Id     string `protobuf:"bytes,2,opt,name=id" json:"id,omitempty"`
+	Type   string `protobuf:"bytes,3,opt,name=type" json:"type,omitempty"`
+	// publish_reference, last_modified, notification_date and headers are sent to monitor subscribers only
+	PublishReference string            `protobuf:"bytes,4,opt,name=publish_reference,json=publishReference" json:"publish_reference,omitempty"`
+	LastModified     string            `protobuf:"bytes,5,opt,name=last_modified,json=lastModified" json:"last_modified,omitempty"`
+	NotificationDate string            `protobuf:"bytes,6,opt,name=notification_date,json=notificationDate" json:"notification_date,omitempty"`
+	Title            string            `protobuf:"bytes,7,opt,name=title" json:"title,omitempty"`
+	Scoop            bool              `protobuf:"varint,8,opt,name=scoop" json:"scoop,omitempty"`
+	Flags            []string          `protobuf:"bytes,9,rep,name=flags" json:"flags,omitempty"`
+	Headers          map[string]string `protobuf:"bytes,10,rep,name=headers" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// fields is the JSON object of the additional payload fields
+	Fields string `protobuf:"bytes,11,opt,name=fields" json:"fields,omitempty"`
+}
+
+func (m *Notification) Reset()                    { *m = Notification{} }
+func (m *Notification) String() string            { return proto.CompactTextString(m) }
+func (*Notification) ProtoMessage()               {}
+func (*Notification) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *Notification) GetApiUrl() string {
+	if m != nil {
+		return m.ApiUrl
+	}
+	return ""
+}
+
+func (m *Notification) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Notification) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *Notification) GetPublishReference() string {
+	if m != nil {
+		return m.PublishReference
+	}
+	return ""
+}
+
+func (m *Notification) GetLastModified() string {
+	if m != nil {
+		return m.LastModified
+	}
+	return ""
+}
+
+func (m *Notification) GetNotificationDate() string {
+	if m != nil {
+		return m.NotificationDate
+	}
+	return ""
+}
+
+func (m *Notification) GetTitle() string {
+	if m != nil {
+		return m.Title
+	}
+	return ""
+}
+
+func (m *Notification) GetScoop() bool {
+	if m != nil {
+		return m.Scoop
+	}
+	return false
+}
+
+func (m *Notification) GetFlags() []string {
+	if m != nil {
+		return m.Flags
+	}
+	return nil
+}
+
+func (m *Notification) GetHeaders() map[string]string {
+	if m != nil {
+		return m.Headers
+	}
+	return nil
+}
+
+func (m *Notification) GetFields() string {
+	if m != nil {
+		return m.Fields
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterType((*SubscribeRequest)(nil), "notifications.push.SubscribeRequest")
+	proto.RegisterType((*SubscribeResponse)(nil), "notifications.push.SubscribeResponse")
+	proto.RegisterType((*Notification)(nil), "notifications.push.Notification")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for Push service
+
+type PushClient interface {
+	// Subscribe streams the notifications matching the request. The API key is sent in the x-api-key metadata.
+	// Streams resumed with a resume token start with the notifications missed since then.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Push_SubscribeClient, error)
+}
+
+type pushClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewPushClient(cc *grpc.ClientConn) PushClient {
+	return &pushClient{cc}
+}
+
+func (c *pushClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Push_SubscribeClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Push_serviceDesc.Streams[0], c.cc, "/notifications.push.Push/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &pushSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Push_SubscribeClient interface {
+	Recv() (*SubscribeResponse, error)
+	grpc.ClientStream
+}
+
+type pushSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *pushSubscribeClient) Recv() (*SubscribeResponse, error) {
+	m := new(SubscribeResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for Push service
+
+type PushServer interface {
+	// Subscribe streams the notifications matching the request. The API key is sent in the x-api-key metadata.
+	// Streams resumed with a resume token start with the notifications missed since then.
+	Subscribe(*SubscribeRequest, Push_SubscribeServer) error
+}
+
+func RegisterPushServer(s *grpc.Server, srv PushServer) {
+	s.RegisterService(&_Push_serviceDesc, srv)
+}
+
+func _Push_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PushServer).Subscribe(m, &pushSubscribeServer{stream})
+}
+
+type Push_SubscribeServer interface {
+	Send(*SubscribeResponse) error
+	grpc.ServerStream
+}
+
+type pushSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *pushSubscribeServer) Send(m *SubscribeResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Push_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "notifications.push.Push",
+	HandlerType: (*PushServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Push_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "push.proto",
+}
+
+func init() { proto.RegisterFile("push.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 442 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x53, 0x5d, 0x8b, 0xd4, 0x30,
+	0x14, 0xa5, 0xd3, 0xf9, 0xd8, 0xb9, 0x53, 0x65, 0x36, 0x88, 0x86, 0x7d, 0xaa, 0xa3, 0xc2, 0x80,
+	0x58, 0x74, 0x7c, 0x91, 0x7d, 0x94, 0x15, 0x05, 0x51, 0xa4, 0xea, 0xcb, 0xbe, 0x94, 0xb4, 0xbd,
+	0xb5, 0x61, 0x3b, 0x4d, 0x4c, 0x52, 0x61, 0xc0, 0x3f, 0xe4, 0x7f, 0xf3, 0x47, 0x48, 0x92, 0xce,
+	0x5a, 0x1d, 0x65, 0x04, 0xdf, 0x72, 0xce, 0xfd, 0x3a, 0xb9, 0x39, 0x01, 0x90, 0x9d, 0xae, 0x13,
+	0xa9, 0x84, 0x11, 0x84, 0xb4, 0xc2, 0xf0, 0x8a, 0x17, 0xcc, 0x70, 0xd1, 0xea, 0xc4, 0x46, 0x56,
+	0xdf, 0x03, 0x58, 0xbe, 0xef, 0x72, 0x5d, 0x28, 0x9e, 0x63, 0x8a, 0x9f, 0x3b, 0xd4, 0x86, 0x10,
+	0x18, 0x9b, 0x9d, 0x44, 0x1a, 0xc4, 0xc1, 0x7a, 0x9e, 0xba, 0x33, 0xa1, 0x30, 0xdb, 0x8a, 0x96,
+	0x1b, 0xa1, 0xe8, 0x28, 0x0e, 0xd6, 0x27, 0xe9, 0x1e, 0x92, 0xd7, 0x30, 0xab, 0x91, 0x95, 0xa8,
+	0x34, 0x0d, 0xe3, 0x70, 0xbd, 0xd8, 0x3c, 0x49, 0x0e, 0x07, 0x25, 0xbf, 0x0f, 0x49, 0x5e, 0xf9,
+	0x9a, 0x17, 0xad, 0x51, 0xbb, 0x74, 0xdf, 0x81, 0xdc, 0x85, 0x48, 0xa1, 0xee, 0xb6, 0x98, 0x19,
+	0x71, 0x85, 0x2d, 0x1d, 0x3b, 0x09, 0x0b, 0xcf, 0x7d, 0xb0, 0xd4, 0xd9, 0x39, 0x44, 0xc3, 0x5a,
+	0xb2, 0x84, 0xf0, 0x0a, 0x77, 0xbd, 0x58, 0x7b, 0x24, 0xb7, 0x60, 0xf2, 0x85, 0x35, 0x1d, 0x3a,
+	0xa5, 0xf3, 0xd4, 0x83, 0xf3, 0xd1, 0xb3, 0x60, 0xf5, 0x15, 0x4e, 0x07, 0x42, 0xb4, 0x14, 0xad,
+	0xc6, 0x83, 0x99, 0xc1, 0xc1, 0x4c, 0x72, 0x01, 0xd1, 0xf0, 0x4e, 0xae, 0xf1, 0x62, 0x13, 0xff,
+	0xe9, 0xa2, 0x6f, 0x07, 0x54, 0xfa, 0x4b, 0xd5, 0xea, 0x5b, 0x08, 0xd1, 0x30, 0x4c, 0xee, 0xc0,
+	0x8c, 0x49, 0x9e, 0x75, 0xaa, 0xe9, 0x87, 0x4e, 0x99, 0xe4, 0x1f, 0x55, 0x43, 0x6e, 0xc2, 0x88,
+	0x97, 0xbd, 0xfc, 0x11, 0x2f, 0xaf, 0x5f, 0x24, 0x1c, 0xbc, 0xc8, 0x43, 0x38, 0x95, 0x5d, 0xde,
+	0x70, 0x5d, 0x67, 0x0a, 0x2b, 0x54, 0xd8, 0x16, 0xd8, 0xef, 0x6b, 0xd9, 0x07, 0xd2, 0x3d, 0x4f,
+	0xee, 0xc1, 0x8d, 0x86, 0x69, 0x93, 0x6d, 0x45, 0xc9, 0x2b, 0x8e, 0x25, 0x9d, 0xb8, 0xc4, 0xc8,
+	0x92, 0x6f, 0x7a, 0xce, 0x76, 0x1c, 0xea, 0xcd, 0x4a, 0x66, 0x90, 0x4e, 0x7d, 0xc7, 0x61, 0xe0,
+	0x82, 0x19, 0xb4, 0x4b, 0x36, 0xdc, 0x34, 0x48, 0x67, 0x7e, 0xc9, 0x0e, 0x58, 0x56, 0x17, 0x42,
+	0x48, 0x7a, 0xe2, 0x4c, 0xe2, 0x81, 0x65, 0xab, 0x86, 0x7d, 0xd2, 0x74, 0x1e, 0x87, 0x36, 0xd7,
+	0x01, 0xf2, 0xf2, 0xa7, 0x71, 0xc0, 0x19, 0xe7, 0xd1, 0xb1, 0x7d, 0xfe, 0xc5, 0x34, 0xb7, 0x61,
+	0x5a, 0x71, 0x6c, 0x4a, 0x4d, 0x17, 0x7e, 0x8b, 0x1e, 0xfd, 0x8f, 0x53, 0x36, 0x39, 0x8c, 0xdf,
+	0x75, 0xba, 0x26, 0x97, 0x30, 0xbf, 0x76, 0x0c, 0xb9, 0xff, 0x2f, 0xce, 0x3e, 0x7b, 0x70, 0x24,
+	0xcb, 0xdb, 0xee, 0x71, 0xf0, 0x7c, 0x72, 0x19, 0x2a, 0x59, 0xe4, 0x53, 0xf7, 0x3d, 0x9f, 0xfe,
+	0x18, 0x00, 0x51, 0xd6, 0x2a, 0x22, 0xac, 0x03, 0x00, 0x00,
+}
@@ -0,0 +1,282 @@
+// Package rpc serves the push stream over gRPC, as defined in push.proto
+package rpc
+
+//go:generate protoc --go_out=plugins=grpc:. push.proto
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/audit"
+	"github.com/Financial-Times/notifications-push/certs"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/Financial-Times/notifications-push/resources"
+	"github.com/Financial-Times/notifications-push/tracing"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	apiKeyMetadata       = "x-api-key"
+	forwardedForMetadata = "x-forwarded-for"
+	userAgentMetadata    = "user-agent"
+	// ResumedMetadata is the header metadata telling subscribers sending a resume token if their stream is resumed
+	ResumedMetadata = "x-resumed"
+
+	// keepaliveTimeout is how long a keepalive ping waits for its acknowledgement before the connection is closed
+	keepaliveTimeout = 20 * time.Second
+	// minClientKeepalive is the shortest period of the keepalive pings subscribers are allowed to send
+	minClientKeepalive = 10 * time.Second
+)
+
+// Server implements the Push service, registering its subscribers like the push endpoint does
+type Server struct {
+	reg                        dispatch.Registrar
+	history                    dispatch.History
+	apiGatewayKeyValidationURL string
+	httpClient                 *http.Client
+	clock                      clock.Clock
+	auditLog                   *audit.Log
+}
+
+// NewServer returns a new Push service. The API keys are not validated when there is no API Gateway, i.e. in standalone mode.
+// The sessions of the subscribers are recorded in the optional audit log.
+func NewServer(reg dispatch.Registrar, history dispatch.History, apiGatewayKeyValidationURL string, httpClient *http.Client, clk clock.Clock, auditLog *audit.Log) *Server {
+	return &Server{
+		reg:                        reg,
+		history:                    history,
+		apiGatewayKeyValidationURL: apiGatewayKeyValidationURL,
+		httpClient:                 httpClient,
+		clock:                      clk,
+		auditLog:                   auditLog,
+	}
+}
+
+// NewGRPCServer returns a gRPC server of the Push service, over TLS if there is a TLS configuration. The server sends
+// keepalive pings on idle connections every keepalive period, they stand in for the heartbeats of the push endpoint.
+func NewGRPCServer(s *Server, keepalivePeriod time.Duration, tlsConfig *tls.Config) *grpc.Server {
+	opts := []grpc.ServerOption{
+		grpc.KeepaliveParams(keepalive.ServerParameters{Time: keepalivePeriod, Timeout: keepaliveTimeout}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{MinTime: minClientKeepalive, PermitWithoutStream: true}),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	g := grpc.NewServer(opts...)
+	RegisterPushServer(g, s)
+	return g
+}
+
+// Subscribe streams the notifications matching the request. Subscribers with a verified client certificate are
+// identified by it instead of their API key. Subscribers resuming the stream with a resume token receive
+// the notifications they missed from history first. The stream ends with the Unavailable code when the subscribers are
+// asked to reconnect, i.e. to another replica.
+func (s *Server) Subscribe(req *SubscribeRequest, stream Push_SubscribeServer) error {
+	ctx := stream.Context()
+	identity := certs.Identity(tlsState(ctx))
+	if identity == "" && s.apiGatewayKeyValidationURL != "" {
+		if isValid, errMsg, errStatusCode := resources.IsValidApiKey(metadataValue(ctx, apiKeyMetadata), s.apiGatewayKeyValidationURL, s.httpClient); !isValid {
+			return status.Error(statusCode(errStatusCode), errMsg)
+		}
+	}
+
+	contentType, err := resources.ResolveContentType(req.Type)
+	if err != nil {
+		log.WithError(err).Error("Invalid content type")
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	headerFilter, err := resolveHeaderFilter(req.Headers)
+	if err != nil {
+		log.WithError(err).Error("Invalid header filter")
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var sub dispatch.Subscriber
+	if req.Monitor {
+		sub = dispatch.NewMonitorSubscriber(clientAddr(stream), contentType, headerFilter, s.clock)
+	} else {
+		sub = dispatch.NewStandardSubscriber(clientAddr(stream), contentType, headerFilter, s.clock)
+	}
+
+	if identity != "" {
+		dispatch.Identify(sub, identity)
+	}
+
+	s.reg.Register(sub)
+	defer s.reg.Close(sub)
+
+	client := audit.Client{UserAgent: metadataValue(ctx, userAgentMetadata), Protocol: "grpc", Monitor: req.Monitor}
+	if identity == "" {
+		client.APIKey = metadataValue(ctx, apiKeyMetadata)
+	}
+	session := s.auditLog.Open(sub, client)
+	defer session.Close()
+
+	// live notifications may be in history too when the subscriber is resumed
+	resumed := map[string]bool{}
+	if req.ResumeToken != "" {
+		missed, found := dispatch.Missed(s.history, sub, req.ResumeToken)
+		entry := log.WithField("subscriber", sub.Address()).WithField("resumeToken", req.ResumeToken)
+		if found {
+			entry.WithField("missed", len(missed)).Info("Resuming subscriber")
+		} else {
+			entry.Warn("Cannot resume subscriber, the last event is not in history")
+		}
+		if err := stream.SendHeader(metadata.Pairs(ResumedMetadata, strconv.FormatBool(found))); err != nil {
+			session.Failed(err)
+			return err
+		}
+		for _, e := range missed {
+			if err := send(stream, e, session); err != nil {
+				return err
+			}
+			resumed[e.ID] = true
+		}
+	}
+
+	for {
+		select {
+		case e := <-sub.NotificationChannel():
+			switch {
+			case e.Type == dispatch.HeartbeatEvent || resumed[e.ID]:
+				continue
+			case e.Type == dispatch.ReconnectEvent:
+				session.Reconnect()
+				return status.Error(codes.Unavailable, "The service is shutting down, please reconnect")
+			}
+			if err := send(stream, e, session); err != nil {
+				log.Infof("[%v]", err)
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// send sends the notifications of the event, with the ID of the event as resume token, counting them in the audit session
+func send(stream Push_SubscribeServer, e dispatch.Event, session *audit.Session) error {
+	for _, n := range e.Notifications {
+		sent, err := sendNotification(stream, e.ID, n)
+		if err != nil {
+			session.Failed(err)
+			return err
+		}
+		if sent {
+			session.Delivered(1)
+		}
+	}
+	return nil
+}
+
+// sendNotification is traced as a child of the fan-out of the notification, notifications that cannot be converted are skipped
+func sendNotification(stream Push_SubscribeServer, resumeToken string, n dispatch.Notification) (bool, error) {
+	span := tracing.Start("subscriber.write", n.Trace)
+	span.SetAttribute("transaction_id", n.PublishReference)
+	defer span.Finish()
+
+	notification, err := toProto(n)
+	if err != nil {
+		log.WithError(err).WithField("transaction_id", n.PublishReference).Warn("Failed forwarding to subscriber.")
+		span.SetError(err)
+		return false, nil
+	}
+	err = stream.Send(&SubscribeResponse{ResumeToken: resumeToken, Notification: notification})
+	span.SetError(err)
+	return err == nil, err
+}
+
+func toProto(n dispatch.Notification) (*Notification, error) {
+	var fields string
+	if len(n.Fields) > 0 {
+		data, err := json.Marshal(n.Fields)
+		if err != nil {
+			return nil, err
+		}
+		fields = string(data)
+	}
+
+	return &Notification{
+		ApiUrl:           n.APIURL,
+		Id:               n.ID,
+		Type:             n.Type,
+		PublishReference: n.PublishReference,
+		LastModified:     n.LastModified,
+		NotificationDate: n.NotificationDate,
+		Title:            n.Title,
+		Scoop:            n.Standout.Scoop,
+		Flags:            n.Flags,
+		Headers:          n.Headers,
+		Fields:           fields,
+	}, nil
+}
+
+func resolveHeaderFilter(headers map[string]string) (dispatch.HeaderFilter, error) {
+	var filter dispatch.HeaderFilter
+	for name, value := range headers {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("The header filter has a value (%s) with no header name", value)
+		}
+		if filter == nil {
+			filter = dispatch.HeaderFilter{}
+		}
+		filter[strings.TrimSpace(name)] = value
+	}
+	return filter, nil
+}
+
+func clientAddr(stream Push_SubscribeServer) string {
+	if forwardedFor := metadataValue(stream.Context(), forwardedForMetadata); forwardedFor != "" {
+		return strings.Split(forwardedFor, ",")[0]
+	}
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+func tlsState(ctx context.Context) *tls.ConnectionState {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		return &info.State
+	}
+	return nil
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md[key]) == 0 {
+		return ""
+	}
+	return md[key][0]
+}
+
+// statusCode returns the gRPC status code of the HTTP status code of a failed API key validation
+func statusCode(httpStatusCode int) codes.Code {
+	switch httpStatusCode {
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	default:
+		return codes.Unavailable
+	}
+}
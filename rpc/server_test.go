@@ -0,0 +1,261 @@
+package rpc
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/audit"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/Financial-Times/notifications-push/test/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const timeout = 5 * time.Second
+
+// registrar hands over the registered subscribers to the test
+type registrar struct {
+	registered chan dispatch.Subscriber
+	closed     chan dispatch.Subscriber
+}
+
+func newRegistrar() *registrar {
+	return &registrar{registered: make(chan dispatch.Subscriber, 1), closed: make(chan dispatch.Subscriber, 1)}
+}
+
+func (r *registrar) Register(sub dispatch.Subscriber) {
+	r.registered <- sub
+}
+
+func (r *registrar) Close(sub dispatch.Subscriber) {
+	r.closed <- sub
+}
+
+func (r *registrar) subscriber(t *testing.T) dispatch.Subscriber {
+	select {
+	case sub := <-r.registered:
+		return sub
+	case <-time.After(timeout):
+		t.Fatal("The subscriber is not registered")
+		return nil
+	}
+}
+
+func startServer(t *testing.T, s *Server) (PushClient, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	g := NewGRPCServer(s, time.Minute, nil)
+	go g.Serve(lis)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	return NewPushClient(conn), func() {
+		conn.Close()
+		g.Stop()
+	}
+}
+
+func code(err error) codes.Code {
+	s, _ := status.FromError(err)
+	return s.Code()
+}
+
+func notificationEvent(n dispatch.Notification) dispatch.Event {
+	return dispatch.Event{ID: dispatch.EventID(n), Type: dispatch.NotificationEvent, Notifications: []dispatch.Notification{n}}
+}
+
+func TestSubscribe(t *testing.T) {
+	reg := newRegistrar()
+	client, stop := startServer(t, NewServer(reg, dispatch.NewHistory(10), "http://dummy.ft.com", mocks.MockHTTPClientWithResponseCode(http.StatusOK), clock.System(), nil))
+	defer stop()
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs(apiKeyMetadata, "some-api-key", forwardedForMetadata, "some-host, some-other-host-that-isnt-used"))
+	stream, err := client.Subscribe(ctx, &SubscribeRequest{Type: "Article", Headers: map[string]string{"Origin-System-Id": "methode"}})
+	require.NoError(t, err)
+
+	sub := reg.subscriber(t)
+	assert.Equal(t, "some-host", sub.Address())
+	assert.Equal(t, "Article", sub.AcceptedContentType())
+	assert.Equal(t, dispatch.HeaderFilter{"Origin-System-Id": "methode"}, sub.HeaderFilter())
+
+	n := dispatch.Notification{APIURL: "http://api.ft.com/content/1", ID: "http://www.ft.com/thing/1", Type: "http://www.ft.com/thing/ThingChangeType/UPDATE",
+		Title: "A title", Standout: dispatch.Standout{Scoop: true}, Fields: map[string]interface{}{"brands": []string{"FT"}}}
+	sub.NotificationChannel() <- dispatch.Event{Type: dispatch.HeartbeatEvent, Data: "[]"}
+	sub.NotificationChannel() <- notificationEvent(n)
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, dispatch.EventID(n), resp.ResumeToken)
+	assert.Equal(t, &Notification{ApiUrl: n.APIURL, Id: n.ID, Type: n.Type, Title: "A title", Scoop: true, Fields: `{"brands":["FT"]}`}, resp.Notification,
+		"Heartbeats are not sent, keepalives stand in for them")
+}
+
+func TestSubscribeMonitor(t *testing.T) {
+	reg := newRegistrar()
+	client, stop := startServer(t, NewServer(reg, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clock.System(), nil))
+	defer stop()
+
+	_, err := client.Subscribe(context.Background(), &SubscribeRequest{Monitor: true})
+	require.NoError(t, err)
+
+	sub := reg.subscriber(t)
+	assert.Equal(t, "*dispatch.monitorSubscriber", fmt.Sprintf("%T", sub))
+	assert.Equal(t, "Article", sub.AcceptedContentType(), "Article is the default content type")
+}
+
+func TestSubscribeInvalidApiKey(t *testing.T) {
+	reg := newRegistrar()
+	client, stop := startServer(t, NewServer(reg, dispatch.NewHistory(10), "http://dummy.ft.com", mocks.MockHTTPClientWithResponseCode(http.StatusUnauthorized), clock.System(), nil))
+	defer stop()
+
+	stream, err := client.Subscribe(context.Background(), &SubscribeRequest{})
+	require.NoError(t, err)
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, code(err))
+	assert.Len(t, reg.registered, 0, "The subscriber is not registered")
+}
+
+func TestSubscribeInvalidArguments(t *testing.T) {
+	reg := newRegistrar()
+	client, stop := startServer(t, NewServer(reg, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clock.System(), nil))
+	defer stop()
+
+	for _, req := range []*SubscribeRequest{{Type: "Audio"}, {Headers: map[string]string{" ": "methode"}}} {
+		stream, err := client.Subscribe(context.Background(), req)
+		require.NoError(t, err)
+
+		_, err = stream.Recv()
+		assert.Equal(t, codes.InvalidArgument, code(err), "Request %v", req)
+	}
+	assert.Len(t, reg.registered, 0, "The subscribers are not registered")
+}
+
+func TestSubscribeResumes(t *testing.T) {
+	n1 := dispatch.Notification{ID: "http://www.ft.com/thing/1", Type: "http://www.ft.com/thing/ThingChangeType/DELETE", LastModified: "2016-11-02T10:54:22.234Z"}
+	n2 := dispatch.Notification{ID: "http://www.ft.com/thing/2", Type: "http://www.ft.com/thing/ThingChangeType/DELETE", LastModified: "2016-11-02T10:54:23.234Z"}
+	n3 := dispatch.Notification{ID: "http://www.ft.com/thing/3", Type: "http://www.ft.com/thing/ThingChangeType/DELETE", LastModified: "2016-11-02T10:54:24.234Z"}
+	history := dispatch.NewHistory(10)
+	history.Push(n1)
+	history.Push(n2)
+
+	reg := newRegistrar()
+	client, stop := startServer(t, NewServer(reg, history, "", mocks.DefaultMockHTTPClient(), clock.System(), nil))
+	defer stop()
+
+	stream, err := client.Subscribe(context.Background(), &SubscribeRequest{ResumeToken: dispatch.EventID(n1)})
+	require.NoError(t, err)
+	sub := reg.subscriber(t)
+
+	header, err := stream.Header()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"true"}, header[ResumedMetadata])
+
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, dispatch.EventID(n2), resp.ResumeToken, "The missed notification is sent first")
+
+	sub.NotificationChannel() <- notificationEvent(n2)
+	sub.NotificationChannel() <- notificationEvent(n3)
+	resp, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, dispatch.EventID(n3), resp.ResumeToken, "Live notifications already sent from history are skipped")
+}
+
+func TestSubscribeResumeFailed(t *testing.T) {
+	reg := newRegistrar()
+	client, stop := startServer(t, NewServer(reg, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clock.System(), nil))
+	defer stop()
+
+	stream, err := client.Subscribe(context.Background(), &SubscribeRequest{ResumeToken: "unknown"})
+	require.NoError(t, err)
+
+	header, err := stream.Header()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"false"}, header[ResumedMetadata])
+}
+
+func TestSubscribeEndsOnReconnect(t *testing.T) {
+	reg := newRegistrar()
+	client, stop := startServer(t, NewServer(reg, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clock.System(), nil))
+	defer stop()
+
+	stream, err := client.Subscribe(context.Background(), &SubscribeRequest{})
+	require.NoError(t, err)
+
+	sub := reg.subscriber(t)
+	sub.NotificationChannel() <- dispatch.Event{Type: dispatch.ReconnectEvent}
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, code(err))
+	select {
+	case closed := <-reg.closed:
+		assert.Equal(t, sub, closed, "The subscriber is unregistered")
+	case <-time.After(timeout):
+		t.Fatal("The subscriber is not unregistered")
+	}
+}
+
+func TestSubscribeCancelled(t *testing.T) {
+	reg := newRegistrar()
+	client, stop := startServer(t, NewServer(reg, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clock.System(), nil))
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Subscribe(ctx, &SubscribeRequest{})
+	require.NoError(t, err)
+	sub := reg.subscriber(t)
+
+	cancel()
+	_, err = stream.Recv()
+	assert.NotEqual(t, io.EOF, err)
+	select {
+	case closed := <-reg.closed:
+		assert.Equal(t, sub, closed, "The subscriber is unregistered")
+	case <-time.After(timeout):
+		t.Fatal("The subscriber is not unregistered")
+	}
+}
+
+func TestSubscribeAudited(t *testing.T) {
+	reg := newRegistrar()
+	records := &mocks.AuditSink{}
+	client, stop := startServer(t, NewServer(reg, dispatch.NewHistory(10), "", mocks.DefaultMockHTTPClient(), clock.System(), audit.New(records, 10, "salt", clock.System())))
+	defer stop()
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs(apiKeyMetadata, "an-api-key-ending-in-c0de"))
+	stream, err := client.Subscribe(ctx, &SubscribeRequest{Type: "Article"})
+	require.NoError(t, err)
+
+	sub := reg.subscriber(t)
+	sub.NotificationChannel() <- notificationEvent(dispatch.Notification{APIURL: "http://api.ft.com/content/1", ID: "http://www.ft.com/thing/1"})
+	_, err = stream.Recv()
+	require.NoError(t, err)
+	sub.NotificationChannel() <- dispatch.Event{Type: dispatch.ReconnectEvent}
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, code(err))
+
+	select {
+	case <-reg.closed:
+	case <-time.After(timeout):
+		t.Fatal("The subscriber is not unregistered")
+	}
+	require.Len(t, records.Records(), 2)
+	registered, closed := records.Records()[0], records.Records()[1]
+	assert.Equal(t, "c0de", registered.KeySuffix)
+	assert.Equal(t, "grpc", registered.Protocol)
+	assert.Contains(t, registered.UserAgent, "grpc-go")
+	assert.Equal(t, "Article", registered.ContentType)
+	assert.Equal(t, int64(1), closed.Notifications)
+	assert.Equal(t, audit.Reconnect, closed.Reason)
+}
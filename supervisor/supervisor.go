@@ -0,0 +1,325 @@
+package supervisor
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Shopify/sarama"
+)
+
+// Policy is what the supervisor does about an error
+type Policy int
+
+// Policies of the errors, from the mildest
+const (
+	// Ignore drops the error
+	Ignore Policy = iota
+	// Count records the error in the history
+	Count
+	// Restart records the error and restarts the consumer, with backoff
+	Restart
+	// Exit records the error and exits the service
+	Exit
+)
+
+var policyNames = []string{"ignore", "count", "restart", "exit"}
+
+// Unclassified is the class of the errors matching no rule, they are counted
+const Unclassified = "unclassified"
+
+func (p Policy) String() string {
+	if p < Ignore || p > Exit {
+		return fmt.Sprintf("policy(%d)", int(p))
+	}
+	return policyNames[p]
+}
+
+// MarshalText encodes the policy as its name
+func (p Policy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// ParsePolicy reads a policy name
+func ParsePolicy(name string) (Policy, error) {
+	for i, policyName := range policyNames {
+		if strings.EqualFold(name, policyName) {
+			return Policy(i), nil
+		}
+	}
+	return Ignore, fmt.Errorf("%q is not a policy, it must be one of %s", name, strings.Join(policyNames, ", "))
+}
+
+// Rule classifies the errors it matches, and applies its policy to them
+type Rule struct {
+	Name    string
+	Matches func(err error) bool
+	Policy  Policy
+}
+
+// OverridePolicies changes the policies of the rules with the given name:policy list, i.e. partition-not-claimed:exit
+func OverridePolicies(rules []Rule, overrides string) ([]Rule, error) {
+	overridden := append([]Rule{}, rules...)
+	for _, override := range strings.Split(overrides, ",") {
+		if strings.TrimSpace(override) == "" {
+			continue
+		}
+		namePolicy := strings.SplitN(override, ":", 2)
+		if len(namePolicy) != 2 {
+			return nil, fmt.Errorf("the policy override %q is not in the name:policy format", override)
+		}
+		policy, err := ParsePolicy(strings.TrimSpace(namePolicy[1]))
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for i := range overridden {
+			if overridden[i].Name == strings.TrimSpace(namePolicy[0]) {
+				overridden[i].Policy = policy
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("there is no %q rule", namePolicy[0])
+		}
+	}
+	return overridden, nil
+}
+
+// Is matches the errors caused by target
+func Is(target error) func(err error) bool {
+	return func(err error) bool {
+		return Cause(err) == target
+	}
+}
+
+// IsType matches the errors caused by an error of the same type as the example
+func IsType(example error) func(err error) bool {
+	errType := reflect.TypeOf(example)
+	return func(err error) bool {
+		return reflect.TypeOf(Cause(err)) == errType
+	}
+}
+
+// Cause returns the error at the root of err, unwrapping the errors of github.com/pkg/errors and the sarama consumer errors
+func Cause(err error) error {
+	for {
+		var cause error
+		switch e := err.(type) {
+		case *sarama.ConsumerError:
+			cause = e.Err
+		case sarama.ConsumerError:
+			cause = e.Err
+		case interface {
+			Cause() error
+		}:
+			cause = e.Cause()
+		}
+		if cause == nil {
+			return err
+		}
+		err = cause
+	}
+}
+
+// Backoff times the restarts, each consecutive restart waits twice as long as the previous one
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	// Attempts is the number of consecutive restarts after which the service exits instead, 0 for no limit.
+	// Restarts are no longer consecutive once the consumer has run for twice the max delay.
+	Attempts int
+}
+
+func (b Backoff) delay(attempt int) time.Duration {
+	delay := b.Initial
+	for i := 0; i < attempt && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		return b.Max
+	}
+	return delay
+}
+
+// ErrorRecord is an error the supervisor has seen
+type ErrorRecord struct {
+	Time   time.Time `json:"time"`
+	Error  string    `json:"error"`
+	Class  string    `json:"class"`
+	Policy Policy    `json:"policy"`
+}
+
+// Status is what the supervisor has seen and done, the history is newest first
+type Status struct {
+	Errors      map[string]int `json:"errors"`
+	History     []ErrorRecord  `json:"history"`
+	Restarts    int            `json:"restarts"`
+	Restarting  bool           `json:"restarting"`
+	LastRestart *time.Time     `json:"lastRestart,omitempty"`
+}
+
+// Supervisor applies the policy of the first rule matching each error of the service
+type Supervisor struct {
+	errChan     <-chan error
+	rules       []Rule
+	restart     func() error
+	exit        func(err error)
+	backoff     Backoff
+	historySize int
+	clock       clock.Clock
+	lock        *sync.RWMutex
+	history     []ErrorRecord
+	counts      map[string]int
+	restarts    int
+	consecutive int
+	restarting  bool
+	restartErr  error
+	lastRestart time.Time
+}
+
+// New returns a supervisor of the errors of the channel, restarting the consumer with restart and exiting the service with exit.
+// It keeps the latest historySize errors.
+func New(errChan <-chan error, rules []Rule, restart func() error, exit func(err error), backoff Backoff, historySize int, clk clock.Clock) *Supervisor {
+	return &Supervisor{
+		errChan:     errChan,
+		rules:       rules,
+		restart:     restart,
+		exit:        exit,
+		backoff:     backoff,
+		historySize: historySize,
+		clock:       clk,
+		lock:        &sync.RWMutex{},
+		counts:      map[string]int{},
+	}
+}
+
+// Supervise handles the errors until the channel is closed
+func (s *Supervisor) Supervise() {
+	for err := range s.errChan {
+		if err == nil {
+			continue
+		}
+		rule := s.classify(err)
+		entry := log.WithError(err).WithField("class", rule.Name).WithField("policy", rule.Policy.String())
+		switch rule.Policy {
+		case Ignore:
+			continue
+		case Count:
+			entry.Warn("Service error")
+		default:
+			entry.Error("Service error")
+		}
+		s.record(err, rule)
+
+		switch rule.Policy {
+		case Restart:
+			s.scheduleRestart()
+		case Exit:
+			s.exit(err)
+		}
+	}
+}
+
+func (s *Supervisor) classify(err error) Rule {
+	for _, rule := range s.rules {
+		if rule.Matches(err) {
+			return rule
+		}
+	}
+	return Rule{Name: Unclassified, Policy: Count}
+}
+
+func (s *Supervisor) record(err error, rule Rule) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.counts[rule.Name]++
+	s.history = append([]ErrorRecord{{Time: s.clock.Now(), Error: err.Error(), Class: rule.Name, Policy: rule.Policy}}, s.history...)
+	if len(s.history) > s.historySize {
+		s.history = s.history[:s.historySize]
+	}
+}
+
+// scheduleRestart restarts the consumer in the background, so that the errors it sends while it shuts down are still handled.
+// Errors asking for a restart while one is pending are only recorded.
+func (s *Supervisor) scheduleRestart() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.restarting {
+		return
+	}
+	if !s.lastRestart.IsZero() && s.clock.Now().Sub(s.lastRestart) > 2*s.backoff.Max {
+		s.consecutive = 0
+	}
+	s.restarting = true
+	go s.restartWithBackoff()
+}
+
+func (s *Supervisor) restartWithBackoff() {
+	for {
+		s.lock.Lock()
+		if s.backoff.Attempts > 0 && s.consecutive >= s.backoff.Attempts {
+			err := fmt.Errorf("the consumer was restarted %d times in a row, last error: %v", s.consecutive, s.restartErr)
+			s.lock.Unlock()
+			s.exit(err)
+			return
+		}
+		delay := s.backoff.delay(s.consecutive)
+		s.consecutive++
+		s.lock.Unlock()
+
+		log.WithField("delay", delay).Warn("Restarting the consumer")
+		<-s.clock.After(delay)
+		err := s.restart()
+
+		s.lock.Lock()
+		s.restarts++
+		s.lastRestart = s.clock.Now()
+		s.restartErr = err
+		if err == nil {
+			s.restarting = false
+			s.lock.Unlock()
+			log.Info("Restarted the consumer")
+			return
+		}
+		s.lock.Unlock()
+		log.WithError(err).Error("Failed restarting the consumer")
+	}
+}
+
+// Status returns the errors seen and the restarts done
+func (s *Supervisor) Status() Status {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	status := Status{
+		Errors:     map[string]int{},
+		History:    append([]ErrorRecord{}, s.history...),
+		Restarts:   s.restarts,
+		Restarting: s.restarting,
+	}
+	for class, count := range s.counts {
+		status.Errors[class] = count
+	}
+	if !s.lastRestart.IsZero() {
+		lastRestart := s.lastRestart
+		status.LastRestart = &lastRestart
+	}
+	return status
+}
+
+// Check returns an error while the consumer is being restarted
+func (s *Supervisor) Check() error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if !s.restarting {
+		return nil
+	}
+	if s.restartErr != nil {
+		return fmt.Errorf("the consumer is being restarted, the last attempt failed: %v", s.restartErr)
+	}
+	return fmt.Errorf("the consumer is being restarted")
+}
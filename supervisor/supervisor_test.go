@@ -0,0 +1,264 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Shopify/sarama"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/samuel/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/wvanbergen/kazoo-go"
+)
+
+var fatalErrs = []error{kazoo.ErrPartitionNotClaimed, zk.ErrNoServer}
+var nonFatalErrs = []error{errors.New("foo"), errors.New("bar")}
+
+var exitRules = []Rule{
+	{Name: "partition-not-claimed", Matches: Is(kazoo.ErrPartitionNotClaimed), Policy: Exit},
+	{Name: "zookeeper-unreachable", Matches: Is(zk.ErrNoServer), Policy: Exit},
+}
+
+var start = time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+
+// recorder records the calls of the restart and exit functions of a supervisor
+type recorder struct {
+	lock       sync.Mutex
+	restarts   int
+	exits      []error
+	restartErr error
+}
+
+func (r *recorder) restart() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.restarts++
+	return r.restartErr
+}
+
+func (r *recorder) exit(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.exits = append(r.exits, err)
+}
+
+func (r *recorder) calls() (int, int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.restarts, len(r.exits)
+}
+
+// supervise has the supervisor handle the errors, and returns once it has handled them all
+func supervise(s *Supervisor, errCh chan error, errs ...error) {
+	done := make(chan struct{})
+	go func() {
+		s.Supervise()
+		close(done)
+	}()
+	for _, err := range errs {
+		errCh <- err
+	}
+	close(errCh)
+	<-done
+}
+
+func TestSupervise(t *testing.T) {
+	var testCases = []struct {
+		description   string
+		inputErrs     []error
+		expectedExits int
+		expectedCount int
+	}{
+		{
+			description: "No errors",
+			inputErrs:   []error{},
+		},
+		{
+			description:   "Only non-fatal errors",
+			inputErrs:     nonFatalErrs,
+			expectedCount: len(nonFatalErrs),
+		},
+		{
+			description:   "Only fatal errors",
+			inputErrs:     fatalErrs,
+			expectedExits: len(fatalErrs),
+		},
+		{
+			description:   "Fatal and non-fatal errors",
+			inputErrs:     append(append([]error{}, nonFatalErrs...), fatalErrs...),
+			expectedExits: len(fatalErrs),
+			expectedCount: len(nonFatalErrs),
+		},
+		{
+			description: "Nil error",
+			inputErrs:   []error{nil, nil},
+		},
+	}
+	for _, tc := range testCases {
+		errCh := make(chan error)
+		r := &recorder{}
+		s := New(errCh, exitRules, r.restart, r.exit, Backoff{Initial: time.Second, Max: time.Minute}, 10, clock.NewFake(start))
+
+		supervise(s, errCh, tc.inputErrs...)
+
+		_, exits := r.calls()
+		assert.Equal(t, tc.expectedExits, exits, tc.description)
+		assert.Equal(t, tc.expectedCount, s.Status().Errors[Unclassified], tc.description)
+		assert.Len(t, s.Status().History, len(tc.inputErrs)-countNil(tc.inputErrs), tc.description)
+	}
+}
+
+func countNil(errs []error) int {
+	n := 0
+	for _, err := range errs {
+		if err == nil {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSuperviseClassifiesByCause(t *testing.T) {
+	errCh := make(chan error)
+	rules := []Rule{
+		{Name: "partition-not-claimed", Matches: Is(kazoo.ErrPartitionNotClaimed), Policy: Count},
+		{Name: "offset-out-of-range", Matches: Is(sarama.ErrOffsetOutOfRange), Policy: Count},
+		{Name: "broker-errors", Matches: IsType(sarama.KError(0)), Policy: Count},
+		{Name: "noise", Matches: Is(zk.ErrNoNode), Policy: Ignore},
+	}
+	s := New(errCh, rules, nil, nil, Backoff{}, 10, clock.NewFake(start))
+
+	supervise(s, errCh,
+		pkgerrors.Wrap(kazoo.ErrPartitionNotClaimed, "claiming partition 3"),
+		&sarama.ConsumerError{Topic: "PostPublicationEvents", Partition: 0, Err: sarama.ErrOffsetOutOfRange},
+		sarama.ConsumerError{Topic: "PostPublicationEvents", Partition: 1, Err: sarama.ErrNotLeaderForPartition},
+		zk.ErrNoNode,
+		errors.New("claiming partition 3: kafka: partition not claimed"),
+	)
+
+	status := s.Status()
+	assert.Equal(t, map[string]int{"partition-not-claimed": 1, "offset-out-of-range": 1, "broker-errors": 1, Unclassified: 1}, status.Errors,
+		"Errors are classified by their cause, not their message, and ignored ones are not recorded")
+	require.Len(t, status.History, 4)
+	assert.Equal(t, Unclassified, status.History[0].Class, "The history is newest first")
+	assert.Equal(t, "partition-not-claimed", status.History[3].Class)
+}
+
+func TestSupervisorRestartsWithBackoff(t *testing.T) {
+	errCh := make(chan error)
+	clk := clock.NewFake(start)
+	r := &recorder{}
+	rules := []Rule{{Name: "zookeeper-session-expired", Matches: Is(zk.ErrSessionExpired), Policy: Restart}}
+	s := New(errCh, rules, r.restart, r.exit, Backoff{Initial: time.Second, Max: 4 * time.Second}, 10, clk)
+	go s.Supervise()
+	defer close(errCh)
+
+	restartAfter := func(delay time.Duration, restarts int) {
+		errCh <- zk.ErrSessionExpired
+		require.True(t, clk.WaitForTimers(1, time.Second), "The restart is scheduled")
+		assert.Error(t, s.Check(), "The consumer is being restarted")
+		clk.Advance(delay - time.Millisecond)
+		calls, _ := r.calls()
+		assert.Equal(t, restarts-1, calls, "The restart waits for the backoff")
+		clk.Advance(time.Millisecond)
+		for i := 0; i < 1000 && s.Status().Restarting; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		calls, _ = r.calls()
+		assert.Equal(t, restarts, calls)
+		assert.NoError(t, s.Check())
+	}
+
+	restartAfter(time.Second, 1)
+	restartAfter(2*time.Second, 2)
+	restartAfter(4*time.Second, 3)
+	restartAfter(4*time.Second, 4)
+
+	clk.Advance(8*time.Second + time.Millisecond)
+	restartAfter(time.Second, 5)
+
+	status := s.Status()
+	assert.Equal(t, 5, status.Restarts)
+	assert.Equal(t, 5, status.Errors["zookeeper-session-expired"])
+	require.NotNil(t, status.LastRestart)
+	assert.Equal(t, clk.Now(), *status.LastRestart)
+	_, exits := r.calls()
+	assert.Zero(t, exits)
+}
+
+func TestSupervisorExitsAfterFailedRestarts(t *testing.T) {
+	errCh := make(chan error)
+	clk := clock.NewFake(start)
+	r := &recorder{restartErr: errors.New("zookeeper is unreachable")}
+	rules := []Rule{{Name: "zookeeper-session-expired", Matches: Is(zk.ErrSessionExpired), Policy: Restart}}
+	s := New(errCh, rules, r.restart, r.exit, Backoff{Initial: time.Second, Max: time.Minute, Attempts: 2}, 10, clk)
+	go s.Supervise()
+	defer close(errCh)
+
+	errCh <- zk.ErrSessionExpired
+	require.True(t, clk.WaitForTimers(1, time.Second))
+	clk.Advance(time.Second)
+	require.True(t, clk.WaitForTimers(1, time.Second), "The failed restart is retried")
+	assert.EqualError(t, s.Check(), "the consumer is being restarted, the last attempt failed: zookeeper is unreachable")
+
+	clk.Advance(2 * time.Second)
+	for i := 0; i < 1000; i++ {
+		if _, exits := r.calls(); exits > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	restarts, exits := r.calls()
+	assert.Equal(t, 2, restarts)
+	assert.Equal(t, 1, exits, "The service exits once the attempts are exhausted")
+}
+
+func TestStatusHistorySize(t *testing.T) {
+	errCh := make(chan error)
+	s := New(errCh, nil, nil, nil, Backoff{}, 2, clock.NewFake(start))
+
+	supervise(s, errCh, errors.New("first"), errors.New("second"), errors.New("third"))
+
+	status := s.Status()
+	require.Len(t, status.History, 2)
+	assert.Equal(t, "third", status.History[0].Error)
+	assert.Equal(t, "second", status.History[1].Error)
+	assert.Equal(t, 3, status.Errors[Unclassified], "Errors are counted beyond the history")
+
+	encoded, err := json.Marshal(status.History[0])
+	require.NoError(t, err)
+	assert.Equal(t, `{"time":"2017-06-01T10:00:00Z","error":"third","class":"unclassified","policy":"count"}`, string(encoded))
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, policy := range []Policy{Ignore, Count, Restart, Exit} {
+		parsed, err := ParsePolicy(policy.String())
+		assert.NoError(t, err)
+		assert.Equal(t, policy, parsed)
+	}
+	_, err := ParsePolicy("panic")
+	assert.Error(t, err)
+}
+
+func TestOverridePolicies(t *testing.T) {
+	rules, err := OverridePolicies(exitRules, "zookeeper-unreachable:restart, partition-not-claimed:count")
+	require.NoError(t, err)
+	assert.Equal(t, Count, rules[0].Policy)
+	assert.Equal(t, Restart, rules[1].Policy)
+	assert.Equal(t, Exit, exitRules[1].Policy, "The rules are copied")
+
+	rules, err = OverridePolicies(exitRules, "")
+	require.NoError(t, err)
+	assert.Len(t, rules, len(exitRules))
+
+	for _, invalid := range []string{"zookeeper-unreachable", "zookeeper-unreachable:panic", "unknown:exit"} {
+		_, err = OverridePolicies(exitRules, invalid)
+		assert.Error(t, err, fmt.Sprintf("%q is invalid", invalid))
+	}
+}
@@ -0,0 +1,227 @@
+// Package harness runs the service end to end in tests: messages published to an in-memory consumer
+// go through the real queue handler, dispatcher and routing, up to the push streams of the subscribers.
+// Time is controlled by a fake clock.
+package harness
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/kafka-client-go/kafka"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/Financial-Times/notifications-push/cluster"
+	"github.com/Financial-Times/notifications-push/config"
+	"github.com/Financial-Times/notifications-push/consumer"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/Financial-Times/notifications-push/resources"
+)
+
+const (
+	apiKeyValidationPath = "/t800/a"
+	startTimeout         = 5 * time.Second
+	clusterSyncPeriod    = 5 * time.Second
+)
+
+// Config of the service under test, zero values are replaced by the defaults
+type Config struct {
+	Resource        string
+	APIBaseURL      string
+	Whitelist       string
+	Delay           time.Duration
+	HeartbeatPeriod time.Duration
+	HistorySize     int
+	SkipRules       consumer.SkipRules
+	CapturedHeaders []string
+	// APIKeys are accepted by the stub API Gateway, any other key is rejected
+	APIKeys []string
+	// Start is the initial time of the clock
+	Start time.Time
+	// Backplane runs the service in cluster mode as the given Node, the cluster is only synced by Cluster.Sync
+	Backplane cluster.Backplane
+	Node      string
+}
+
+var healthThresholds = resources.HealthThresholds{DelayedNotifications: 1000, ConsumerLag: 5 * time.Minute, LaggingSubscribers: 10}
+
+// Defaults of the harness configuration
+var (
+	DefaultAPIKey = "test-api-key"
+	DefaultStart  = time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+)
+
+func (c Config) withDefaults() Config {
+	if c.Resource == "" {
+		c.Resource = "content"
+	}
+	if c.APIBaseURL == "" {
+		c.APIBaseURL = "http://api.ft.com"
+	}
+	if c.Whitelist == "" {
+		c.Whitelist = `^http://.*/` + c.Resource + `/[\w-]+.*$`
+	}
+	if c.HeartbeatPeriod == 0 {
+		c.HeartbeatPeriod = 30 * time.Second
+	}
+	if c.HistorySize == 0 {
+		c.HistorySize = 200
+	}
+	if c.SkipRules == nil {
+		c.SkipRules = consumer.DefaultSkipRules()
+	}
+	if c.APIKeys == nil {
+		c.APIKeys = []string{DefaultAPIKey}
+	}
+	if c.Start.IsZero() {
+		c.Start = DefaultStart
+	}
+	return c
+}
+
+// Harness is a running service with an in-memory consumer and a stub API Gateway
+type Harness struct {
+	Clock      *clock.Fake
+	Dispatcher dispatch.Dispatcher
+	History    dispatch.History
+	// Cluster is the replica of the service in cluster mode
+	Cluster *cluster.Cluster
+	// URL is the base URL of the service
+	URL string
+
+	config      Config
+	consumer    *consumer.LocalConsumer
+	server      *httptest.Server
+	gateway     *httptest.Server
+	subscribers []*Subscriber
+	lock        *sync.Mutex
+}
+
+// New starts the service with the given configuration
+func New(c Config) (*Harness, error) {
+	c = c.withDefaults()
+
+	active, err := config.Activate(config.Config{
+		Whitelist:             c.Whitelist,
+		SupportedContentTypes: resources.DefaultSupportedContentTypes,
+		NotificationsDelay:    int(c.Delay / time.Second),
+		HeartbeatPeriod:       int(c.HeartbeatPeriod / time.Second),
+		SkipRules:             c.SkipRules,
+	}, "harness")
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Harness{
+		Clock:   clock.NewFake(c.Start),
+		History: dispatch.NewHistory(c.HistorySize),
+		config:  c,
+		lock:    &sync.Mutex{},
+	}
+	h.Dispatcher = dispatch.NewDispatcher(c.Delay, c.HeartbeatPeriod, h.History, h.Clock)
+
+	mapper := consumer.NotificationMapper{Resource: c.Resource, APIBaseURL: c.APIBaseURL}
+	queueHandler := consumer.NewMessageQueueHandler(active.WhitelistRegexp, active.Config.SkipRules, c.CapturedHeaders, nil, mapper, h.Dispatcher)
+	h.consumer = consumer.NewLocalConsumer(nil, false, time.Millisecond)
+	h.gateway = httptest.NewServer(apiGateway(c.APIKeys))
+
+	if c.Backplane != nil {
+		h.Cluster = cluster.New(c.Node, c.Backplane, h.Dispatcher, h.History, c.HistorySize, clusterSyncPeriod, h.Clock)
+	}
+
+	router := resources.NewRouter(c.Resource, h.Dispatcher, h.History, resources.NewStandaloneHealthCheck(h.consumer, h.Dispatcher, healthThresholds),
+		h.gateway.URL+apiKeyValidationPath, &http.Client{}, func() *config.Active { return active }, h.Clock, resources.RouterOptions{IngestHandler: queueHandler, Cluster: h.Cluster})
+	h.server = httptest.NewServer(router)
+	h.URL = h.server.URL
+
+	go h.Dispatcher.Start()
+	go h.consumer.StartListening(queueHandler.HandleMessage)
+
+	// the dispatcher is started once its heartbeat is scheduled
+	if !h.Clock.WaitForTimers(1, startTimeout) {
+		h.Close()
+		return nil, errors.New("the dispatcher did not start")
+	}
+	for h.consumer.ConnectivityCheck() != nil {
+		time.Sleep(time.Millisecond)
+	}
+	return h, nil
+}
+
+// Close disconnects the subscribers and stops the service
+func (h *Harness) Close() {
+	h.lock.Lock()
+	subscribers := h.subscribers
+	h.lock.Unlock()
+	for _, s := range subscribers {
+		s.Close()
+	}
+
+	h.consumer.Shutdown()
+	h.Dispatcher.Stop()
+	h.server.Close()
+	h.gateway.Close()
+}
+
+// Publish passes a Kafka message to the service as if it was consumed from the queue
+func (h *Harness) Publish(message kafka.FTMessage) error {
+	return h.consumer.Publish(message)
+}
+
+// PublishContent publishes a publication event of the given content, a nil payload is a delete.
+// The content is last modified at the current time of the clock.
+func (h *Harness) PublishContent(uuid string, transactionID string, payload map[string]interface{}) error {
+	event := map[string]interface{}{
+		"ContentURI":   fmt.Sprintf("http://methode-article-transformer.svc.ft.com/%s/%s", h.config.Resource, uuid),
+		"LastModified": h.Clock.Now().Format(time.RFC3339Nano),
+	}
+	if payload != nil {
+		event["Payload"] = payload
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return h.Publish(kafka.FTMessage{
+		Headers: map[string]string{"X-Request-Id": transactionID, "Message-Timestamp": h.Clock.Now().Format(time.RFC3339Nano)},
+		Body:    string(body),
+	})
+}
+
+// Advance moves the clock forward, i.e. to release the notifications waiting for the delay or to trigger a heartbeat
+func (h *Harness) Advance(d time.Duration) {
+	h.Clock.Advance(d)
+}
+
+// PushURL returns the URL of the push stream with the given query, i.e. type=All&monitor=true
+func (h *Harness) PushURL(query string) string {
+	url := h.URL + "/" + h.config.Resource + "/notifications-push"
+	if query != "" {
+		url += "?" + query
+	}
+	return url
+}
+
+func apiGateway(apiKeys []string) http.Handler {
+	valid := map[string]bool{}
+	for _, key := range apiKeys {
+		valid[key] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != apiKeyValidationPath {
+			http.NotFound(w, r)
+			return
+		}
+		if !valid[r.Header.Get("X-Api-Key")] {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Invalid api key"}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,363 @@
+package harness
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/cluster"
+	"github.com/Financial-Times/notifications-push/consumer"
+	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	uuid    = "7998974a-1e97-11e6-b286-cddde55ca122"
+	timeout = time.Second
+)
+
+func TestNotificationIsDeliveredAfterDelay(t *testing.T) {
+	h, err := New(Config{Delay: 30 * time.Second})
+	require.NoError(t, err)
+	defer h.Close()
+
+	s, err := h.Subscribe("type=Article&monitor=true", DefaultAPIKey)
+	require.NoError(t, err)
+
+	require.NoError(t, h.PublishContent(uuid, "tid_test", map[string]interface{}{"title": "Lorem ipsum", "type": "Article"}))
+
+	h.Advance(29 * time.Second)
+	assert.NoError(t, s.ExpectNothing(50*time.Millisecond), "Should not be delivered before the delay")
+
+	h.Advance(time.Second)
+	n, err := s.NextNotification(timeout)
+	require.NoError(t, err)
+	assert.Equal(t, "http://www.ft.com/thing/"+uuid, n.ID)
+	assert.Equal(t, "http://api.ft.com/content/"+uuid, n.APIURL)
+	assert.Equal(t, "http://www.ft.com/thing/ThingChangeType/UPDATE", n.Type)
+	assert.Equal(t, "tid_test", n.PublishReference)
+	assert.Equal(t, "Lorem ipsum", n.Title)
+	assert.Equal(t, "2017-06-01T10:00:30.000Z", n.NotificationDate, "Should be dated by the clock")
+}
+
+func TestHeartbeats(t *testing.T) {
+	h, err := New(Config{HeartbeatPeriod: 30 * time.Second})
+	require.NoError(t, err)
+	defer h.Close()
+
+	s, err := h.Subscribe("", DefaultAPIKey)
+	require.NoError(t, err)
+
+	h.Advance(29 * time.Second)
+	assert.NoError(t, s.ExpectNothing(50*time.Millisecond))
+
+	h.Advance(time.Second)
+	frame, err := s.NextHeartbeat(timeout)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultStart.Add(30*time.Second), frame.ReceivedAt)
+
+	h.Advance(30 * time.Second)
+	frame, err = s.NextHeartbeat(timeout)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultStart.Add(time.Minute), frame.ReceivedAt)
+}
+
+func TestNotificationPostponesHeartbeat(t *testing.T) {
+	h, err := New(Config{HeartbeatPeriod: 30 * time.Second})
+	require.NoError(t, err)
+	defer h.Close()
+
+	s, err := h.Subscribe("type=All", DefaultAPIKey)
+	require.NoError(t, err)
+
+	h.Advance(20 * time.Second)
+	require.NoError(t, h.PublishContent(uuid, "tid_test", map[string]interface{}{"type": "Article"}))
+	_, err = s.NextNotification(timeout)
+	require.NoError(t, err)
+
+	h.Advance(20 * time.Second)
+	assert.NoError(t, s.ExpectNothing(50*time.Millisecond), "The heartbeat should be postponed by the notification")
+
+	h.Advance(10 * time.Second)
+	_, err = s.NextHeartbeat(timeout)
+	assert.NoError(t, err)
+}
+
+func TestSubscribersReceiveTheirContentTypes(t *testing.T) {
+	h, err := New(Config{})
+	require.NoError(t, err)
+	defer h.Close()
+
+	article, err := h.Subscribe("type=Article", DefaultAPIKey)
+	require.NoError(t, err)
+	contentPackage, err := h.Subscribe("type=ContentPackage", DefaultAPIKey)
+	require.NoError(t, err)
+	all, err := h.Subscribe("type=All", DefaultAPIKey)
+	require.NoError(t, err)
+
+	require.NoError(t, h.PublishContent(uuid, "tid_test", map[string]interface{}{"type": "ContentPackage"}))
+
+	n, err := contentPackage.NextNotification(timeout)
+	require.NoError(t, err)
+	assert.Equal(t, "http://www.ft.com/thing/"+uuid, n.ID)
+	assert.Empty(t, n.PublishReference, "Standard subscribers should not receive the publish reference")
+	_, err = all.NextNotification(timeout)
+	require.NoError(t, err)
+	assert.NoError(t, article.ExpectNothing(50*time.Millisecond))
+
+	require.NoError(t, h.PublishContent(uuid, "tid_delete", nil))
+	n, err = article.NextNotification(timeout)
+	require.NoError(t, err)
+	assert.Equal(t, "http://www.ft.com/thing/ThingChangeType/DELETE", n.Type, "Deletes should be sent to every subscriber")
+}
+
+func TestMonitorOnlyNotifications(t *testing.T) {
+	h, err := New(Config{SkipRules: consumer.SkipRules{{Name: "Synthetic", Pattern: "^SYNTH", Action: consumer.MonitorOnlyAction}}})
+	require.NoError(t, err)
+	defer h.Close()
+
+	standard, err := h.Subscribe("type=All", DefaultAPIKey)
+	require.NoError(t, err)
+	monitor, err := h.Subscribe("type=All&monitor=true", DefaultAPIKey)
+	require.NoError(t, err)
+
+	require.NoError(t, h.PublishContent(uuid, "SYNTH_tid", map[string]interface{}{"type": "Article"}))
+
+	n, err := monitor.NextNotification(timeout)
+	require.NoError(t, err)
+	assert.Equal(t, "SYNTH_tid", n.PublishReference)
+	assert.NoError(t, standard.ExpectNothing(50*time.Millisecond))
+}
+
+func TestInvalidMessagesAreRejected(t *testing.T) {
+	h, err := New(Config{})
+	require.NoError(t, err)
+	defer h.Close()
+
+	s, err := h.Subscribe("type=All", DefaultAPIKey)
+	require.NoError(t, err)
+
+	assert.Error(t, h.PublishContent("not-a-uuid", "tid_test", map[string]interface{}{"type": "Article"}))
+	assert.NoError(t, s.ExpectNothing(50*time.Millisecond))
+}
+
+func TestSubscriptionWithInvalidAPIKey(t *testing.T) {
+	h, err := New(Config{})
+	require.NoError(t, err)
+	defer h.Close()
+
+	_, err = h.Subscribe("", "invalid-key")
+	assert.Equal(t, StatusError{StatusCode: http.StatusUnauthorized, Message: "Invalid api key"}, err)
+}
+
+func TestHistoryAndStats(t *testing.T) {
+	h, err := New(Config{})
+	require.NoError(t, err)
+	defer h.Close()
+
+	s, err := h.Subscribe("type=All", DefaultAPIKey)
+	require.NoError(t, err)
+	require.NoError(t, h.PublishContent(uuid, "tid_test", map[string]interface{}{"type": "Article"}))
+	_, err = s.NextNotification(timeout)
+	require.NoError(t, err)
+
+	resp, err := http.Get(h.URL + "/__history")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var history []dispatch.Notification
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+	require.Len(t, history, 1)
+	assert.Equal(t, "tid_test", history[0].PublishReference)
+
+	statsResp, err := http.Get(h.URL + "/__stats")
+	require.NoError(t, err)
+	defer statsResp.Body.Close()
+	var stats struct {
+		NrOfSubscribers int `json:"nrOfSubscribers"`
+	}
+	require.NoError(t, json.NewDecoder(statsResp.Body).Decode(&stats))
+	assert.Equal(t, 1, stats.NrOfSubscribers)
+}
+
+func TestClusterSharesHistoryStatsAndEventIDs(t *testing.T) {
+	backplane := cluster.NewLocalBackplane()
+	a, err := New(Config{Backplane: backplane, Node: "pod-a"})
+	require.NoError(t, err)
+	defer a.Close()
+
+	s, err := a.Subscribe("type=All", DefaultAPIKey)
+	require.NoError(t, err)
+	require.NoError(t, a.PublishContent(uuid, "tid_1", map[string]interface{}{"type": "Article"}))
+	first, err := s.NextNotificationFrame(timeout)
+	require.NoError(t, err)
+
+	// the second replica starts after the first publish, every replica consumes every publish from then on
+	b, err := New(Config{Backplane: backplane, Node: "pod-b"})
+	require.NoError(t, err)
+	defer b.Close()
+
+	const otherUUID = "5056c256-225e-11e6-9d4d-c11776a5124d"
+	require.NoError(t, a.PublishContent(otherUUID, "tid_2", map[string]interface{}{"type": "Article"}))
+	require.NoError(t, b.PublishContent(otherUUID, "tid_2", map[string]interface{}{"type": "Article"}))
+	second, err := s.NextNotificationFrame(timeout)
+	require.NoError(t, err)
+	for deadline := time.Now().Add(timeout); len(b.History.Notifications()) == 0; time.Sleep(time.Millisecond) {
+		require.True(t, time.Now().Before(deadline), "The second replica should dispatch the second publish")
+	}
+
+	require.NoError(t, a.Cluster.Sync())
+	require.NoError(t, b.Cluster.Sync())
+
+	resumed, err := b.Resume("type=All", DefaultAPIKey, first.ID)
+	require.NoError(t, err)
+	missed, err := resumed.NextNotificationFrame(timeout)
+	require.NoError(t, err)
+	assert.Equal(t, second.ID, missed.ID, "The resumed subscriber should get the same event ID from any replica")
+	assert.Equal(t, "http://www.ft.com/thing/"+otherUUID, missed.Notifications[0].ID)
+	assert.NoError(t, resumed.ExpectNothing(50*time.Millisecond), "The missed notification should be sent once")
+
+	resp, err := http.Get(b.URL + "/__history")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var history []dispatch.Notification
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+	require.Len(t, history, 2, "The history should include the publish the second replica missed")
+	assert.Equal(t, "tid_2", history[0].PublishReference)
+	assert.Equal(t, "tid_1", history[1].PublishReference)
+
+	statsResp, err := http.Get(b.URL + "/__stats")
+	require.NoError(t, err)
+	defer statsResp.Body.Close()
+	var stats struct {
+		NrOfSubscribers int `json:"nrOfSubscribers"`
+		Nodes           []struct {
+			Node            string `json:"node"`
+			NrOfSubscribers int    `json:"nrOfSubscribers"`
+		} `json:"nodes"`
+	}
+	require.NoError(t, json.NewDecoder(statsResp.Body).Decode(&stats))
+	assert.Equal(t, 2, stats.NrOfSubscribers)
+	require.Len(t, stats.Nodes, 2)
+	assert.Equal(t, "pod-b", stats.Nodes[0].Node)
+	assert.Equal(t, 1, stats.Nodes[0].NrOfSubscribers)
+	assert.Equal(t, "pod-a", stats.Nodes[1].Node)
+	assert.Equal(t, 1, stats.Nodes[1].NrOfSubscribers)
+}
+
+func TestProtocolV2(t *testing.T) {
+	h, err := New(Config{HeartbeatPeriod: 30 * time.Second})
+	require.NoError(t, err)
+	defer h.Close()
+
+	s, err := h.Subscribe("type=Article&protocol=2", DefaultAPIKey)
+	require.NoError(t, err)
+	require.Len(t, s.Preamble, 1)
+	assert.Equal(t, "subscribed", s.Preamble[0].Event)
+
+	require.NoError(t, h.PublishContent(uuid, "tid_test", map[string]interface{}{"type": "Article"}))
+	frame, err := s.NextNotificationFrame(timeout)
+	require.NoError(t, err)
+	assert.Equal(t, dispatch.NotificationEvent, frame.Event)
+	assert.Equal(t, "http://www.ft.com/thing/"+uuid, frame.Notifications[0].ID)
+
+	h.Advance(30 * time.Second)
+	frame, err = s.NextHeartbeat(timeout)
+	require.NoError(t, err)
+	assert.Equal(t, dispatch.HeartbeatEvent, frame.Event)
+	assert.Equal(t, `{"time":"2017-06-01T10:00:30Z"}`, frame.Data, "Heartbeats are dated by the server")
+
+	h.Dispatcher.Reconnect()
+	frame, err = s.Next(timeout)
+	require.NoError(t, err)
+	assert.Equal(t, dispatch.ReconnectEvent, frame.Event)
+	_, err = s.Next(timeout)
+	assert.Error(t, err, "The stream is closed after the reconnect event")
+}
+
+func TestCommentHeartbeats(t *testing.T) {
+	h, err := New(Config{HeartbeatPeriod: 30 * time.Second})
+	require.NoError(t, err)
+	defer h.Close()
+
+	s, err := h.Subscribe("protocol=2&heartbeat=comment", DefaultAPIKey)
+	require.NoError(t, err)
+
+	h.Advance(30 * time.Second)
+	frame, err := s.NextHeartbeat(timeout)
+	require.NoError(t, err)
+	assert.Equal(t, ": heartbeat 2017-06-01T10:00:30Z", frame.Data)
+}
+
+func TestBatchedNotifications(t *testing.T) {
+	h, err := New(Config{})
+	require.NoError(t, err)
+	defer h.Close()
+
+	s, err := h.Subscribe("type=All&batchSize=3&batchLinger=1s", DefaultAPIKey)
+	require.NoError(t, err)
+
+	uuids := []string{
+		"7998974a-1e97-11e6-b286-cddde55ca121",
+		"7998974a-1e97-11e6-b286-cddde55ca122",
+		"7998974a-1e97-11e6-b286-cddde55ca123",
+		"7998974a-1e97-11e6-b286-cddde55ca124",
+	}
+	for i, id := range uuids {
+		require.NoError(t, h.PublishContent(id, fmt.Sprintf("tid_%d", i), map[string]interface{}{"type": "Article"}))
+	}
+
+	frame, err := s.Next(timeout)
+	require.NoError(t, err)
+	require.Len(t, frame.Notifications, 3, "A full batch is sent right away")
+	// the messages are dispatched concurrently, so they are not in order
+	received := map[string]bool{}
+	for _, n := range frame.Notifications {
+		received[n.ID] = true
+	}
+
+	require.True(t, h.Clock.WaitForDeadline(DefaultStart.Add(time.Second), timeout), "The last notification waits for the batch to fill up")
+	assert.NoError(t, s.ExpectNothing(50*time.Millisecond))
+	h.Advance(time.Second)
+	frame, err = s.Next(timeout)
+	require.NoError(t, err)
+	require.Len(t, frame.Notifications, 1, "The batch is sent after the linger time")
+	received[frame.Notifications[0].ID] = true
+
+	for _, id := range uuids {
+		assert.True(t, received["http://www.ft.com/thing/"+id], id)
+	}
+}
+
+func TestCompressedStream(t *testing.T) {
+	h, err := New(Config{HeartbeatPeriod: 30 * time.Second})
+	require.NoError(t, err)
+	defer h.Close()
+
+	s, err := h.Subscribe("type=All", DefaultAPIKey)
+	require.NoError(t, err)
+	require.True(t, s.Compressed)
+
+	h.Advance(30 * time.Second)
+	_, err = s.NextHeartbeat(timeout)
+	require.NoError(t, err, "Heartbeats are flushed through the compressor")
+
+	require.NoError(t, h.PublishContent(uuid, "tid_test", map[string]interface{}{"type": "Article"}))
+	_, err = s.NextNotification(timeout)
+	require.NoError(t, err)
+
+	statsResp, err := http.Get(h.URL + "/__stats")
+	require.NoError(t, err)
+	defer statsResp.Body.Close()
+	var stats struct {
+		Compression struct {
+			Streams           int    `json:"streams"`
+			UncompressedBytes uint64 `json:"uncompressedBytes"`
+		} `json:"compression"`
+	}
+	require.NoError(t, json.NewDecoder(statsResp.Body).Decode(&stats))
+	assert.Equal(t, 1, stats.Compression.Streams)
+	assert.True(t, stats.Compression.UncompressedBytes > 0)
+}
@@ -0,0 +1,206 @@
+package harness
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/client"
+	"github.com/Financial-Times/notifications-push/dispatch"
+)
+
+// Frame is an event received by a subscriber
+type Frame struct {
+	// ID is the event ID of the notifications
+	ID string
+	// Event is the type of the event, it is empty in the version 1 of the protocol
+	Event         string
+	Data          string
+	Notifications []dispatch.Notification
+	Heartbeat     bool
+	// ReceivedAt is the time of the harness clock when the frame was received
+	ReceivedAt time.Time
+}
+
+// Control returns true if the frame is a control event of the version 2 of the protocol, i.e. subscribed or dropped
+func (f Frame) Control() bool {
+	return !f.Heartbeat && f.Event != "" && f.Event != dispatch.NotificationEvent
+}
+
+// Subscriber is a client connected to the push stream of the service
+type Subscriber struct {
+	// Preamble are the control events received before the first heartbeat
+	Preamble []Frame
+	// Compressed is true if the stream was compressed with gzip, which the HTTP client asks for by default
+	Compressed bool
+
+	frames chan Frame
+	err    error
+	resp   *http.Response
+}
+
+// StatusError is returned when a subscription is rejected
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("subscription rejected with status %d: %s", e.StatusCode, e.Message)
+}
+
+// Subscribe connects to the push stream with the given query and API key. It returns once the subscriber
+// is registered, when the first heartbeat is received. The protocol version is chosen by the query, i.e. protocol=2.
+func (h *Harness) Subscribe(query string, apiKey string) (*Subscriber, error) {
+	return h.Resume(query, apiKey, "")
+}
+
+// Resume connects to the push stream like Subscribe, resuming it after the given event ID. The missed
+// notifications are received after the first heartbeat.
+func (h *Harness) Resume(query string, apiKey string, lastEventID string) (*Subscriber, error) {
+	req, err := http.NewRequest("GET", h.PushURL(query), nil)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey != "" {
+		req.Header.Set("X-Api-Key", apiKey)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := ioutil.ReadAll(resp.Body)
+		return nil, StatusError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+
+	s := &Subscriber{frames: make(chan Frame, 100), resp: resp, Compressed: resp.Uncompressed}
+	go s.read(h)
+
+	frame, err := s.Next(startTimeout)
+	for err == nil && frame.Control() {
+		s.Preamble = append(s.Preamble, frame)
+		frame, err = s.Next(startTimeout)
+	}
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	if !frame.Heartbeat {
+		s.Close()
+		return nil, fmt.Errorf("expected a heartbeat on subscription, received %q", frame.Data)
+	}
+
+	h.lock.Lock()
+	h.subscribers = append(h.subscribers, s)
+	h.lock.Unlock()
+	return s, nil
+}
+
+func (s *Subscriber) read(h *Harness) {
+	// comments are not events, heartbeats sent as comments are turned into frames
+	reader := client.NewEventReader(s.resp.Body, func(line string) {
+		if strings.HasPrefix(line, ": heartbeat") {
+			s.frames <- Frame{Data: line, Heartbeat: true, ReceivedAt: h.Clock.Now()}
+		}
+	})
+	for {
+		event, err := reader.ReadEvent()
+		if err != nil {
+			s.err = err
+			close(s.frames)
+			return
+		}
+
+		frame := Frame{ID: event.ID, Event: event.Type, Data: event.Data, ReceivedAt: h.Clock.Now()}
+		if event.Type == dispatch.HeartbeatEvent {
+			frame.Heartbeat = true
+		}
+		if frame.Heartbeat || frame.Control() {
+			s.frames <- frame
+			continue
+		}
+		if err := json.Unmarshal([]byte(event.Data), &frame.Notifications); err != nil {
+			s.err = fmt.Errorf("decoding %q: %v", event.Data, err)
+			close(s.frames)
+			return
+		}
+		frame.Heartbeat = len(frame.Notifications) == 0
+		s.frames <- frame
+	}
+}
+
+// Next returns the next frame received, waiting up to the given timeout
+func (s *Subscriber) Next(timeout time.Duration) (Frame, error) {
+	select {
+	case frame, ok := <-s.frames:
+		if !ok {
+			return Frame{}, s.err
+		}
+		return frame, nil
+	case <-time.After(timeout):
+		return Frame{}, fmt.Errorf("nothing received within %v", timeout)
+	}
+}
+
+// NextNotification returns the next notification received, skipping heartbeats, waiting up to the given timeout
+func (s *Subscriber) NextNotification(timeout time.Duration) (dispatch.Notification, error) {
+	frame, err := s.NextNotificationFrame(timeout)
+	if err != nil {
+		return dispatch.Notification{}, err
+	}
+	return frame.Notifications[0], nil
+}
+
+// NextNotificationFrame returns the next frame with a single notification, skipping heartbeats and control events,
+// waiting up to the given timeout
+func (s *Subscriber) NextNotificationFrame(timeout time.Duration) (Frame, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		frame, err := s.Next(deadline.Sub(time.Now()))
+		if err != nil {
+			return Frame{}, err
+		}
+		if !frame.Heartbeat && !frame.Control() {
+			if len(frame.Notifications) != 1 {
+				return Frame{}, fmt.Errorf("expected a single notification, received %q", frame.Data)
+			}
+			return frame, nil
+		}
+	}
+}
+
+// NextHeartbeat returns the next frame received if it is a heartbeat, waiting up to the given timeout
+func (s *Subscriber) NextHeartbeat(timeout time.Duration) (Frame, error) {
+	frame, err := s.Next(timeout)
+	if err == nil && !frame.Heartbeat {
+		err = fmt.Errorf("expected a heartbeat, received %q", frame.Data)
+	}
+	return frame, err
+}
+
+// ExpectNothing returns an error if a frame is received within the given time
+func (s *Subscriber) ExpectNothing(wait time.Duration) error {
+	select {
+	case frame, ok := <-s.frames:
+		if !ok {
+			return s.err
+		}
+		return fmt.Errorf("expected nothing, received %q", frame.Data)
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+// Close disconnects the subscriber
+func (s *Subscriber) Close() {
+	s.resp.Body.Close()
+}
@@ -2,11 +2,15 @@ package mocks
 
 import (
 	"github.com/stretchr/testify/mock"
+	"github.com/Financial-Times/notifications-push/audit"
 	"github.com/Financial-Times/notifications-push/dispatch"
+	"github.com/Financial-Times/notifications-push/tracing"
 	"net/http"
 	"io/ioutil"
 	"strings"
 	"errors"
+	"time"
+	"sync"
 )
 
 // MockDispatcher is a mock of a dispatcher that can be reused for testing
@@ -35,6 +39,34 @@ func (m *MockDispatcher) Subscribers() []dispatch.Subscriber {
 	return args.Get(0).([]dispatch.Subscriber)
 }
 
+// Reconfigure mocks Reconfigure
+func (m *MockDispatcher) Reconfigure(delay time.Duration, heartbeatPeriod time.Duration) {
+	m.Called(delay, heartbeatPeriod)
+}
+
+// Reconnect mocks Reconnect
+func (m *MockDispatcher) Reconnect() {
+	m.Called()
+}
+
+// Delayed mocks Delayed
+func (m *MockDispatcher) Delayed() int {
+	args := m.Called()
+	return args.Int(0)
+}
+
+// CheckAlive mocks CheckAlive
+func (m *MockDispatcher) CheckAlive() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// Freshness mocks Freshness
+func (m *MockDispatcher) Freshness() dispatch.Freshness {
+	args := m.Called()
+	return args.Get(0).(dispatch.Freshness)
+}
+
 // Register mocks Register
 func (m *MockDispatcher) Register(subscriber dispatch.Subscriber) {
 	m.Called(subscriber)
@@ -87,3 +119,55 @@ func (t *MockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	}
 	return response, nil
 }
+
+// SpanRecorder is a tracing exporter keeping the spans in memory
+type SpanRecorder struct {
+	lock  sync.Mutex
+	spans []*tracing.Span
+}
+
+// Export records the span
+func (r *SpanRecorder) Export(span *tracing.Span) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+// Spans returns the spans recorded with the given name
+func (r *SpanRecorder) Spans(name string) []*tracing.Span {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var spans []*tracing.Span
+	for _, s := range r.spans {
+		if s.Name == name {
+			spans = append(spans, s)
+		}
+	}
+	return spans
+}
+
+// AuditSink is an audit sink keeping the records in memory
+type AuditSink struct {
+	lock    sync.Mutex
+	records []audit.Record
+}
+
+// Write records the audit record
+func (s *AuditSink) Write(r audit.Record) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.records = append(s.records, r)
+	return nil
+}
+
+// Close does nothing
+func (s *AuditSink) Close() error {
+	return nil
+}
+
+// Records returns the audit records written
+func (s *AuditSink) Records() []audit.Record {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]audit.Record{}, s.records...)
+}
@@ -0,0 +1,128 @@
+// Package tracing times the steps of handling a notification as spans of a trace, in the style of OpenTelemetry.
+// The trace context of a Kafka message is read from its W3C traceparent header, see https://www.w3.org/TR/trace-context/.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TraceparentHeader is the header carrying the trace context of a message
+const TraceparentHeader = "traceparent"
+
+const sampledFlag = 0x01
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span of a trace
+type SpanID [8]byte
+
+// IsValid tells if the ID is not all zeros
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid tells if the ID is not all zeros
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext identifies a span across services, the zero value is no span
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid tells if the context identifies a span
+func (c SpanContext) IsValid() bool {
+	return c.TraceID.IsValid() && c.SpanID.IsValid()
+}
+
+// Traceparent returns the traceparent header value of the context
+func (c SpanContext) Traceparent() string {
+	var flags byte
+	if c.Sampled {
+		flags = sampledFlag
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", c.TraceID, c.SpanID, flags)
+}
+
+// ParseTraceparent reads a traceparent header value, i.e. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func ParseTraceparent(value string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+
+	var c SpanContext
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || len(version) != 1 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent version %q", parts[0])
+	}
+	if err := decodeID(c.TraceID[:], parts[1]); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid trace ID %q", parts[1])
+	}
+	if err := decodeID(c.SpanID[:], parts[2]); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid parent span ID %q", parts[2])
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return SpanContext{}, fmt.Errorf("invalid trace flags %q", parts[3])
+	}
+	if !c.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q, the IDs cannot be zero", value)
+	}
+	c.Sampled = flags[0]&sampledFlag != 0
+	return c, nil
+}
+
+func decodeID(id []byte, value string) error {
+	if len(value) != 2*len(id) || strings.ToLower(value) != value {
+		return fmt.Errorf("invalid ID %q", value)
+	}
+	_, err := hex.Decode(id, []byte(value))
+	return err
+}
+
+// FromHeaders returns the trace context of the traceparent header, header names are case insensitive.
+// A missing or invalid header is no span.
+func FromHeaders(headers map[string]string) SpanContext {
+	for name, value := range headers {
+		if strings.EqualFold(name, TraceparentHeader) {
+			c, err := ParseTraceparent(value)
+			if err != nil {
+				return SpanContext{}
+			}
+			return c
+		}
+	}
+	return SpanContext{}
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	c, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", c.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", c.SpanID.String())
+	assert.True(t, c.Sampled)
+	assert.True(t, c.IsValid())
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", c.Traceparent())
+}
+
+func TestParseTraceparentNotSampled(t *testing.T) {
+	c, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	require.NoError(t, err)
+	assert.False(t, c.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", c.Traceparent())
+}
+
+func TestParseTraceparentFutureVersion(t *testing.T) {
+	c, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", c.TraceID.String())
+}
+
+func TestParseTraceparentInvalid(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"not-a-traceparent",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba9zzzz-01",
+	} {
+		_, err := ParseTraceparent(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestFromHeaders(t *testing.T) {
+	c := FromHeaders(map[string]string{"X-Request-Id": "tid_test", "Traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+	assert.Equal(t, "00f067aa0ba902b7", c.SpanID.String())
+
+	assert.False(t, FromHeaders(map[string]string{"X-Request-Id": "tid_test"}).IsValid())
+	assert.False(t, FromHeaders(map[string]string{"traceparent": "invalid"}).IsValid())
+	assert.False(t, FromHeaders(nil).IsValid())
+}
@@ -0,0 +1,284 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Financial-Times/go-logger"
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/rcrowley/go-metrics"
+)
+
+// ServiceName is the name of the service in the exported spans
+const ServiceName = "notifications-push"
+
+// DefaultCollectorURL is the OTLP/HTTP traces endpoint of a collector running next to the service
+const DefaultCollectorURL = "http://localhost:4318/v1/traces"
+
+// DroppedSpans counts the spans dropped because the collector could not keep up
+var DroppedSpans = metrics.GetOrRegisterCounter("tracing.spans.dropped", metrics.DefaultRegistry)
+
+// WriterExporter writes one JSON span per line, i.e. to stdout
+type WriterExporter struct {
+	writer io.Writer
+	lock   *sync.Mutex
+}
+
+// NewWriterExporter returns an exporter writing to the given writer
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{writer: w, lock: &sync.Mutex{}}
+}
+
+type spanJSON struct {
+	TraceID      string                 `json:"traceId"`
+	SpanID       string                 `json:"spanId"`
+	ParentSpanID string                 `json:"parentSpanId,omitempty"`
+	Name         string                 `json:"name"`
+	Start        string                 `json:"start"`
+	Duration     string                 `json:"duration"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+// Export writes the span, errors are logged
+func (e *WriterExporter) Export(span *Span) {
+	line := spanJSON{
+		TraceID:    span.Context.TraceID.String(),
+		SpanID:     span.Context.SpanID.String(),
+		Name:       span.Name,
+		Start:      span.Start.UTC().Format(time.RFC3339Nano),
+		Duration:   span.Duration().String(),
+		Attributes: span.Attributes,
+		Error:      span.Error,
+	}
+	if span.ParentID.IsValid() {
+		line.ParentSpanID = span.ParentID.String()
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		log.WithError(err).WithField("span", span.Name).Warn("Failed to export span")
+		return
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if _, err := e.writer.Write(append(data, '\n')); err != nil {
+		log.WithError(err).WithField("span", span.Name).Warn("Failed to export span")
+	}
+}
+
+// CollectorExporter posts batches of spans to an OTLP/HTTP collector, as JSON.
+// Spans are queued so that they are exported off the path of the notifications, they are dropped when the queue is full.
+type CollectorExporter struct {
+	url         string
+	httpClient  *http.Client
+	batchSize   int
+	flushPeriod time.Duration
+	clock       clock.Clock
+	queue       chan *Span
+	stop        chan struct{}
+	stopped     chan struct{}
+}
+
+// NewCollectorExporter returns an exporter posting to the given collector URL, once a batch is full or every flush period
+func NewCollectorExporter(url string, httpClient *http.Client, batchSize int, flushPeriod time.Duration, clk clock.Clock) *CollectorExporter {
+	return &CollectorExporter{
+		url:         url,
+		httpClient:  httpClient,
+		batchSize:   batchSize,
+		flushPeriod: flushPeriod,
+		clock:       clk,
+		queue:       make(chan *Span, 4*batchSize),
+		stop:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+}
+
+// Export queues the span, it is dropped if the queue is full
+func (e *CollectorExporter) Export(span *Span) {
+	select {
+	case e.queue <- span:
+	default:
+		DroppedSpans.Inc(1)
+	}
+}
+
+// Run posts the queued spans until the exporter is stopped
+func (e *CollectorExporter) Run() {
+	defer close(e.stopped)
+
+	var batch []*Span
+	flush := e.clock.NewTimer(e.flushPeriod)
+	post := func() {
+		if len(batch) > 0 {
+			if err := e.post(batch); err != nil {
+				DroppedSpans.Inc(int64(len(batch)))
+				log.WithError(err).WithField("spans", len(batch)).Warn("Failed to export spans to the collector")
+			}
+			batch = nil
+		}
+	}
+
+	for {
+		select {
+		case span := <-e.queue:
+			batch = append(batch, span)
+			if len(batch) >= e.batchSize {
+				post()
+			}
+		case <-flush.C():
+			post()
+			flush.Reset(e.flushPeriod)
+		case <-e.stop:
+			flush.Stop()
+			for len(e.queue) > 0 {
+				batch = append(batch, <-e.queue)
+			}
+			post()
+			return
+		}
+	}
+}
+
+// Stop posts the spans left in the queue and stops the exporter
+func (e *CollectorExporter) Stop() {
+	close(e.stop)
+	<-e.stopped
+}
+
+func (e *CollectorExporter) post(spans []*Span) error {
+	body, err := json.Marshal(otlpRequest(spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.httpClient.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the collector responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// OTLP/HTTP JSON encoding, see https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusError      = 2
+)
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func otlpRequest(spans []*Span) otlpTraces {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: ServiceName}}
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			Name:              s.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+		}
+		if s.ParentID.IsValid() {
+			span.ParentSpanID = s.ParentID.String()
+		}
+		if s.Error != "" {
+			span.Status = &otlpStatus{Code: otlpStatusError, Message: s.Error}
+		}
+		scope.Spans = append(scope.Spans, span)
+	}
+
+	resource := otlpResource{Attributes: otlpAttributes(map[string]interface{}{"service.name": ServiceName})}
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{{Resource: resource, ScopeSpans: []otlpScopeSpans{scope}}}}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []otlpAttribute {
+	var keys []string
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result []otlpAttribute
+	for _, key := range keys {
+		result = append(result, otlpAttribute{Key: key, Value: otlpValue(attrs[key])})
+	}
+	return result
+}
+
+func otlpValue(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case uint64:
+		return map[string]interface{}{"intValue": strconv.FormatUint(v, 10)}
+	case float64:
+		return map[string]interface{}{"doubleValue": v}
+	case time.Duration:
+		return map[string]interface{}{"stringValue": v.String()}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+}
@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testStart = time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+
+func testSpan(t *testing.T) *Span {
+	parent, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+
+	clk := clock.NewFake(testStart)
+	span := NewTracer(&recorder{}, clk).Start("subscriber.write", parent)
+	span.Context.SpanID = SpanID{0, 0, 0, 0, 0, 0, 0, 1}
+	span.SetAttribute("subscriber.address", "192.168.1.1")
+	span.SetAttribute("notifications", 2)
+	span.SetError(errors.New("broken pipe"))
+	clk.Advance(1500 * time.Microsecond)
+	span.Finish()
+	return span
+}
+
+func TestWriterExporter(t *testing.T) {
+	out := &bytes.Buffer{}
+	NewWriterExporter(out).Export(testSpan(t))
+
+	assert.JSONEq(t, `{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"0000000000000001","parentSpanId":"00f067aa0ba902b7",
+		"name":"subscriber.write","start":"2017-06-01T10:00:00Z","duration":"1.5ms",
+		"attributes":{"subscriber.address":"192.168.1.1","notifications":2},"error":"broken pipe"}`, out.String())
+	assert.Equal(t, byte('\n'), out.Bytes()[out.Len()-1], "one span per line")
+}
+
+func TestCollectorExporter(t *testing.T) {
+	bodies := make(chan string, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies <- string(body)
+	}))
+	defer collector.Close()
+
+	exporter := NewCollectorExporter(collector.URL+"/v1/traces", &http.Client{}, 10, time.Minute, clock.NewFake(testStart))
+	go exporter.Run()
+	exporter.Export(testSpan(t))
+	exporter.Stop()
+
+	require.Len(t, bodies, 1)
+	assert.JSONEq(t, `{"resourceSpans":[{
+		"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"notifications-push"}}]},
+		"scopeSpans":[{"scope":{"name":"notifications-push"},"spans":[{
+			"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"0000000000000001","parentSpanId":"00f067aa0ba902b7",
+			"name":"subscriber.write","kind":1,"startTimeUnixNano":"1496311200000000000","endTimeUnixNano":"1496311200001500000",
+			"attributes":[{"key":"notifications","value":{"intValue":"2"}},{"key":"subscriber.address","value":{"stringValue":"192.168.1.1"}}],
+			"status":{"code":2,"message":"broken pipe"}}]}]}]}`, <-bodies)
+}
+
+func TestCollectorExporterPostsFullBatches(t *testing.T) {
+	posted := make(chan struct{}, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted <- struct{}{}
+	}))
+	defer collector.Close()
+
+	exporter := NewCollectorExporter(collector.URL, &http.Client{}, 2, time.Minute, clock.NewFake(testStart))
+	go exporter.Run()
+	defer exporter.Stop()
+
+	exporter.Export(testSpan(t))
+	exporter.Export(testSpan(t))
+
+	select {
+	case <-posted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the full batch was not posted")
+	}
+}
+
+func TestCollectorExporterPostsEveryFlushPeriod(t *testing.T) {
+	posted := make(chan struct{}, 10)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted <- struct{}{}
+	}))
+	defer collector.Close()
+
+	clk := clock.NewFake(testStart)
+	exporter := NewCollectorExporter(collector.URL, &http.Client{}, 10, time.Second, clk)
+	go exporter.Run()
+	defer exporter.Stop()
+
+	require.True(t, clk.WaitForTimers(1, 5*time.Second))
+	exporter.Export(testSpan(t))
+	for len(exporter.queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(time.Second)
+
+	select {
+	case <-posted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the batch was not posted after the flush period")
+	}
+}
+
+func TestCollectorExporterDropsSpans(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	dropped := DroppedSpans.Count()
+	exporter := NewCollectorExporter(collector.URL, &http.Client{}, 1, time.Minute, clock.NewFake(testStart))
+	for i := 0; i < 5; i++ {
+		exporter.Export(testSpan(t))
+	}
+	assert.Equal(t, dropped+1, DroppedSpans.Count(), "the queue holds 4 batches")
+
+	go exporter.Run()
+	exporter.Stop()
+	assert.Equal(t, dropped+5, DroppedSpans.Count(), "the collector rejected the spans")
+}
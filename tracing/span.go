@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+)
+
+// Span is a timed step of a trace. The methods of a nil span do nothing, so that steps are traced the same way
+// whether tracing is enabled or not.
+type Span struct {
+	Name       string
+	Context    SpanContext
+	ParentID   SpanID
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	// Error is the reason the step failed, if it did
+	Error  string
+	tracer *Tracer
+}
+
+// SetAttribute records an attribute of the step, i.e. the transaction ID
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	if s.Attributes == nil {
+		s.Attributes = map[string]interface{}{}
+	}
+	s.Attributes[key] = value
+}
+
+// SetError records that the step failed, a nil error does nothing
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.Error = err.Error()
+}
+
+// SpanContext returns the context of the span, to start its children
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.Context
+}
+
+// Finish ends the step and exports the span, if it is sampled
+func (s *Span) Finish() {
+	if s == nil || !s.End.IsZero() {
+		return
+	}
+	s.End = s.tracer.clock.Now()
+	if s.Context.Sampled {
+		s.tracer.exporter.Export(s)
+	}
+}
+
+// Duration of the step, once finished
+func (s *Span) Duration() time.Duration {
+	if s == nil || s.End.IsZero() {
+		return 0
+	}
+	return s.End.Sub(s.Start)
+}
+
+// Exporter sends finished spans to where they are looked at, it must not block
+type Exporter interface {
+	Export(span *Span)
+}
+
+// Tracer starts the spans of the service and exports them once finished
+type Tracer struct {
+	exporter Exporter
+	clock    clock.Clock
+}
+
+// NewTracer returns a tracer exporting the spans to the given exporter, timed by the given clock
+func NewTracer(exporter Exporter, clk clock.Clock) *Tracer {
+	return &Tracer{exporter: exporter, clock: clk}
+}
+
+// Start starts a span, in the trace of the parent if it is valid, or in a new trace otherwise.
+// Spans are sampled when their parent is, so that the decision of the upstream service is followed.
+func (t *Tracer) Start(name string, parent SpanContext) *Span {
+	if t == nil {
+		return nil
+	}
+
+	s := &Span{Name: name, Start: t.clock.Now(), tracer: t}
+	if parent.IsValid() {
+		s.Context = SpanContext{TraceID: parent.TraceID, SpanID: newSpanID(), Sampled: parent.Sampled}
+		s.ParentID = parent.SpanID
+	} else {
+		s.Context = SpanContext{TraceID: newTraceID(), SpanID: newSpanID(), Sampled: true}
+	}
+	return s
+}
+
+var defaultTracer atomic.Value
+
+func init() {
+	defaultTracer.Store((*Tracer)(nil))
+}
+
+// SetTracer sets the tracer of the service, nil disables tracing
+func SetTracer(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Start starts a span with the tracer of the service, it is nil when tracing is disabled
+func Start(name string, parent SpanContext) *Span {
+	return defaultTracer.Load().(*Tracer).Start(name, parent)
+}
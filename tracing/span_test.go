@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/notifications-push/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	spans []*Span
+}
+
+func (r *recorder) Export(span *Span) {
+	r.spans = append(r.spans, span)
+}
+
+func TestTracerStartsNewTrace(t *testing.T) {
+	clk := clock.NewFake(time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC))
+	exported := &recorder{}
+	tracer := NewTracer(exported, clk)
+
+	span := tracer.Start("kafka.message", SpanContext{})
+	span.SetAttribute("transaction_id", "tid_test")
+	clk.Advance(30 * time.Millisecond)
+	span.Finish()
+
+	require.Len(t, exported.spans, 1)
+	assert.Equal(t, "kafka.message", exported.spans[0].Name)
+	assert.True(t, span.Context.IsValid())
+	assert.True(t, span.Context.Sampled)
+	assert.False(t, span.ParentID.IsValid())
+	assert.Equal(t, 30*time.Millisecond, span.Duration())
+	assert.Equal(t, map[string]interface{}{"transaction_id": "tid_test"}, span.Attributes)
+}
+
+func TestTracerStartsChildSpan(t *testing.T) {
+	tracer := NewTracer(&recorder{}, clock.NewFake(time.Now()))
+	parent, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+
+	span := tracer.Start("notification.map", parent)
+
+	assert.Equal(t, parent.TraceID, span.Context.TraceID)
+	assert.Equal(t, parent.SpanID, span.ParentID)
+	assert.NotEqual(t, parent.SpanID, span.Context.SpanID)
+	assert.True(t, span.Context.Sampled)
+}
+
+func TestTracerFollowsUnsampledParent(t *testing.T) {
+	exported := &recorder{}
+	tracer := NewTracer(exported, clock.NewFake(time.Now()))
+	parent, err := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	require.NoError(t, err)
+
+	span := tracer.Start("kafka.message", parent)
+	child := tracer.Start("notification.map", span.SpanContext())
+	child.Finish()
+	span.Finish()
+
+	assert.Equal(t, parent.TraceID, child.Context.TraceID)
+	assert.False(t, child.Context.Sampled)
+	assert.Empty(t, exported.spans)
+}
+
+func TestSpanFinishedOnce(t *testing.T) {
+	exported := &recorder{}
+	span := NewTracer(exported, clock.NewFake(time.Now())).Start("dispatch.fanout", SpanContext{})
+	span.SetError(errors.New("subscriber gone"))
+	span.SetError(nil)
+	span.Finish()
+	span.Finish()
+
+	require.Len(t, exported.spans, 1)
+	assert.Equal(t, "subscriber gone", span.Error)
+}
+
+func TestNilSpan(t *testing.T) {
+	var span *Span
+	span.SetAttribute("transaction_id", "tid_test")
+	span.SetError(errors.New("failed"))
+	span.Finish()
+
+	assert.False(t, span.SpanContext().IsValid())
+	assert.Equal(t, time.Duration(0), span.Duration())
+}
+
+func TestDefaultTracer(t *testing.T) {
+	defer SetTracer(nil)
+	assert.Nil(t, Start("kafka.message", SpanContext{}), "tracing is disabled by default")
+
+	exported := &recorder{}
+	SetTracer(NewTracer(exported, clock.NewFake(time.Now())))
+	Start("kafka.message", SpanContext{}).Finish()
+	assert.Len(t, exported.spans, 1)
+}